@@ -5,14 +5,29 @@ import (
 	"database/sql"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"time"
+	"tribbie/internal/activity"
 	"tribbie/internal/album"
+	"tribbie/internal/attachment"
 	"tribbie/internal/auth"
+	"tribbie/internal/comment"
 	"tribbie/internal/config"
+	"tribbie/internal/device"
+	"tribbie/internal/entity"
 	"tribbie/internal/errors"
+	"tribbie/internal/friend"
+	"tribbie/internal/graphql"
 	"tribbie/internal/healthcheck"
+	"tribbie/internal/itinerary"
+	"tribbie/internal/ledger"
+	"tribbie/internal/me"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/reminder"
+	"tribbie/internal/search"
 	"tribbie/internal/transaction"
 	transactionExpenses "tribbie/internal/transaction-expenses"
 	transactionItem "tribbie/internal/transaction-item"
@@ -20,9 +35,15 @@ import (
 	"tribbie/internal/trip"
 	tripMember "tribbie/internal/trip-member"
 	"tribbie/internal/user"
+	"tribbie/internal/webhook"
 	"tribbie/pkg/accesslog"
+	"tribbie/pkg/blobstore"
 	"tribbie/pkg/dbcontext"
 	"tribbie/pkg/log"
+	"tribbie/pkg/mailer"
+	"tribbie/pkg/pagination"
+	"tribbie/pkg/push"
+	"tribbie/pkg/secretbox"
 
 	dbx "github.com/go-ozzo/ozzo-dbx"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
@@ -47,6 +68,7 @@ func main() {
 		logger.Errorf("failed to load application configuration: %s", err)
 		os.Exit(-1)
 	}
+	pagination.CursorKey = []byte(cfg.CursorKey)
 
 	// connect to the database
 	db, err := dbx.MustOpen("postgres", cfg.DSN)
@@ -62,11 +84,54 @@ func main() {
 		}
 	}()
 
+	signer, err := newSigner(cfg)
+	if err != nil {
+		logger.Errorf("failed to load JWT keys: %s", err)
+		os.Exit(-1)
+	}
+	box, err := secretbox.NewFromString(cfg.PayoutEncryptionKey)
+	if err != nil {
+		logger.Errorf("failed to load the payout encryption key: %s", err)
+		os.Exit(-1)
+	}
+	senders, err := newPushSenders(cfg)
+	if err != nil {
+		logger.Errorf("failed to load the APNs key: %s", err)
+		os.Exit(-1)
+	}
+	store, err := newBlobStore(cfg)
+	if err != nil {
+		logger.Errorf("failed to set up the blob store: %s", err)
+		os.Exit(-1)
+	}
+	trustedProxies, err := auth.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Errorf("failed to load the trusted proxies: %s", err)
+		os.Exit(-1)
+	}
+
+	// start the payment reminders
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go newReminderScheduler(logger, dbcontext.New(db), box, senders, cfg).Run(ctx)
+
+	// start the webhook deliveries
+	dispatcher := webhook.NewDispatcher(webhook.NewRepository(dbcontext.New(db), logger), box, time.Duration(cfg.WebhookPollInterval)*time.Second, logger)
+	go dispatcher.Run(ctx)
+
+	// receive the trip events published by all server instances
+	hub := realtime.NewHub()
+	go func() {
+		if err := realtime.Listen(ctx, cfg.DSN, hub, logger); err != nil {
+			logger.Errorf("failed to listen for trip events: %s", err)
+		}
+	}()
+
 	// build HTTP server
 	address := fmt.Sprintf(":%v", cfg.ServerPort)
 	hs := &http.Server{
 		Addr:    address,
-		Handler: buildHandler(logger, dbcontext.New(db), cfg),
+		Handler: buildHandler(logger, dbcontext.New(db), signer, box, senders, hub, store, trustedProxies, cfg),
 	}
 
 	// start the HTTP server with graceful shutdown
@@ -79,7 +144,7 @@ func main() {
 }
 
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.Handler {
+func buildHandler(logger log.Logger, db *dbcontext.DB, signer *auth.Signer, box *secretbox.Box, senders map[string]push.Sender, hub *realtime.Hub, store blobstore.Store, trustedProxies []*net.IPNet, cfg *config.Config) http.Handler {
 	router := routing.New()
 
 	router.Use(
@@ -93,66 +158,262 @@ func buildHandler(logger log.Logger, db *dbcontext.DB, cfg *config.Config) http.
 
 	rg := router.Group("/v1")
 
-	authHandler := auth.Handler(cfg.JWTSigningKey)
+	authService := auth.NewService(signer, cfg.AccessTokenExpiration, cfg.RefreshTokenExpiration,
+		newAppleVerifier(cfg), auth.NewRepository(db, logger), logger)
+	tokenService := auth.NewTokenService(auth.NewRepository(db, logger), logger)
+	authHandler := auth.Handler(signer, authService, tokenService, trustedProxies, logger)
+	profileService := user.NewProfileService(user.NewRepository(db, logger), box, logger)
+	deviceService := device.NewService(device.NewRepository(db, logger), senders, logger)
+	notificationService := notification.NewService(notification.NewRepository(db, logger), deviceService, logger)
+	webhookService := webhook.NewService(webhook.NewRepository(db, logger), box, logger)
+	publisher := realtime.NewPublisher(db, logger)
+	activityService := activity.NewService(activity.NewRepository(db, logger), logger)
+	tripMemberService := tripMember.NewService(tripMember.NewRepository(db, logger), notificationService, webhookService, activityService, publisher, logger)
+	transactionItemService := transactionItem.NewService(transactionItem.NewRepository(db, logger), publisher, logger)
+	transactionExpander := transaction.NewExpander(
+		transactionItemService,
+		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+		user.NewService(user.NewRepository(db, logger), logger),
+	)
 
 	album.RegisterHandlers(rg.Group(""),
-		album.NewService(album.NewRepository(db, logger), logger),
+		album.NewService(album.NewRepository(db, logger), store, []byte(cfg.AttachmentURLKey),
+			int64(cfg.PhotoMaxSize)<<20, time.Duration(cfg.AttachmentURLExpiration)*time.Minute, logger),
+		int64(cfg.PhotoMaxSize)<<20,
 		authHandler, logger,
 	)
 
 	trip.RegisterHandlers(rg.Group(""),
-		trip.NewService(trip.NewRepository(db, logger), logger),
-		tripMember.NewService(tripMember.NewRepository(db, logger), logger),
-		transaction.NewService(transaction.NewRepository(db, logger), logger),
-		transactionItem.NewService(transactionItem.NewRepository(db, logger), logger),
-		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), logger),
-		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), logger),
+		trip.NewService(trip.NewRepository(db, logger), profileService, activityService, logger),
+		tripMemberService,
+		transaction.NewService(transaction.NewRepository(db, logger), tripMemberService, notificationService, webhookService, activityService, publisher, logger),
+		transactionItemService,
+		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+		transactionExpander,
+		hub,
+		authHandler, logger,
+	)
+
+	attachment.RegisterHandlers(rg.Group(""),
+		attachment.NewService(attachment.NewRepository(db, logger), store, []byte(cfg.AttachmentURLKey),
+			int64(cfg.AttachmentMaxSize)<<20, time.Duration(cfg.AttachmentURLExpiration)*time.Minute, logger),
+		int64(cfg.AttachmentMaxSize)<<20,
+		authHandler, logger,
+	)
+
+	itinerary.RegisterHandlers(rg.Group(""),
+		itinerary.NewService(itinerary.NewRepository(db, logger), publisher, logger),
+		authHandler, logger,
+	)
+
+	graphql.RegisterHandlers(rg.Group(""),
+		graphql.NewResolver(
+			user.NewService(user.NewRepository(db, logger), logger),
+			trip.NewService(trip.NewRepository(db, logger), profileService, activityService, logger),
+			tripMemberService,
+			transaction.NewService(transaction.NewRepository(db, logger), tripMemberService, notificationService, webhookService, activityService, publisher, logger),
+			transactionItemService,
+			transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+			transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+			logger,
+		),
+		authHandler, logger,
+	)
+
+	search.RegisterHandlers(rg.Group(""),
+		search.NewService(search.NewRepository(db, logger), logger),
+		authHandler, logger,
+	)
+
+	comment.RegisterHandlers(rg.Group(""),
+		comment.NewService(comment.NewRepository(db, logger), notificationService, publisher, logger),
+		authHandler, logger,
+	)
+
+	activity.RegisterHandlers(rg.Group(""),
+		activityService,
 		authHandler, logger,
 	)
 
 	tripMember.RegisterHandlers(rg.Group(""),
-		tripMember.NewService(tripMember.NewRepository(db, logger), logger),
+		tripMemberService,
+		profileService,
 		authHandler, logger,
 	)
 
 	transaction.RegisterHandlers(rg.Group(""),
-		transaction.NewService(transaction.NewRepository(db, logger), logger),
-		transactionItem.NewService(transactionItem.NewRepository(db, logger), logger),
-		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), logger),
-		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), logger),
+		transaction.NewService(transaction.NewRepository(db, logger), tripMemberService, notificationService, webhookService, activityService, publisher, logger),
+		transactionItemService,
+		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+		tripMemberService,
+		transactionExpander,
 		authHandler, logger,
 	)
 
 	transactionItem.RegisterHandlers(rg.Group(""),
-		transactionItem.NewService(transactionItem.NewRepository(db, logger), logger),
+		transactionItemService,
 		authHandler, logger,
 	)
 
 	transactionExpenses.RegisterHandlers(rg.Group(""),
-		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), logger),
+		transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
 		authHandler, logger,
 	)
 
 	transactionPayment.RegisterHandlers(rg.Group(""),
-		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), logger),
+		transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
 		authHandler, logger,
 	)
 
 	auth.RegisterHandlers(rg.Group(""),
-		auth.NewService(cfg.JWTSigningKey, cfg.JWTExpiration, logger),
+		authService,
+		auth.NewAccountService(auth.NewRepository(db, logger), authService, tokenService,
+			user.NewService(user.NewRepository(db, logger), logger), newMailer(cfg), cfg.AppURL, logger),
+		tokenService,
 		user.NewService(user.NewRepository(db, logger), logger),
+		authHandler,
+		logger,
+	)
+
+	me.RegisterHandlers(rg.Group(""),
+		me.NewService(
+			user.NewService(user.NewRepository(db, logger), logger),
+			profileService,
+			trip.NewService(trip.NewRepository(db, logger), profileService, activityService, logger),
+			tripMemberService,
+			transaction.NewService(transaction.NewRepository(db, logger), tripMemberService, notificationService, webhookService, activityService, publisher, logger),
+			transactionItemService,
+			transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+			transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+			authService,
+			tokenService,
+			logger,
+		),
+		profileService,
+		authHandler,
+		logger,
+	)
+
+	friend.RegisterHandlers(rg.Group(""),
+		friend.NewService(friend.NewRepository(db, logger),
+			user.NewService(user.NewRepository(db, logger), logger),
+			trip.NewService(trip.NewRepository(db, logger), profileService, activityService, logger),
+			tripMemberService,
+			ledger.NewLoader(
+				tripMemberService,
+				transaction.NewService(transaction.NewRepository(db, logger), tripMemberService, notificationService, webhookService, activityService, publisher, logger),
+				transactionItemService,
+				transactionExpenses.NewService(transactionExpenses.NewRepository(db, logger), tripMemberService, transactionItemService, notificationService, publisher, logger),
+				transactionPayment.NewService(transactionPayment.NewRepository(db, logger), profileService, notificationService, webhookService, activityService, publisher, logger),
+			),
+			logger,
+		),
+		authHandler,
+		logger,
+	)
+
+	device.RegisterHandlers(rg.Group(""),
+		deviceService,
+		authHandler,
+		logger,
+	)
+
+	webhook.RegisterHandlers(rg.Group(""),
+		webhookService,
+		authHandler,
+		logger,
+	)
+
+	notification.RegisterHandlers(rg.Group(""),
+		notificationService,
+		authHandler,
 		logger,
 	)
 
 	user.RegisterHandlers(rg.Group(""),
 		user.NewService(user.NewRepository(db, logger), logger),
-		authHandler,
 		logger,
 	)
 
 	return router
 }
 
+// newSigner builds the access token signer from the legacy signing key and the configured JWT keys.
+func newSigner(cfg *config.Config) (*auth.Signer, error) {
+	var keys []auth.Key
+	if cfg.JWTSigningKey != "" {
+		keys = append(keys, auth.NewHMACKey(auth.DefaultKeyID, cfg.JWTSigningKey))
+	}
+	for _, k := range cfg.JWTKeys {
+		key, err := auth.LoadKey(k.ID, k.Algorithm, k.Secret, k.PrivateKeyFile, k.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return auth.NewSigner(cfg.JWTIssuer, cfg.JWTAudience, cfg.JWTActiveKey, keys...)
+}
+
+// newAppleVerifier builds the Sign in with Apple identity token verifier from the application configuration.
+func newAppleVerifier(cfg *config.Config) auth.AppleVerifier {
+	fetch := auth.HTTPJWKSFetcher(&http.Client{Timeout: 10 * time.Second}, cfg.AppleKeysURL)
+	if cfg.AppleKeysFile != "" {
+		fetch = auth.FileJWKSFetcher(cfg.AppleKeysFile)
+	}
+	keys := auth.NewCachedKeySource(fetch, time.Duration(cfg.AppleKeysCacheTTL)*time.Hour)
+	return auth.NewAppleVerifier(keys, cfg.AppleClientID)
+}
+
+// newMailer builds the mailer selected in the application configuration.
+func newMailer(cfg *config.Config) mailer.Mailer {
+	if cfg.Mailer == "smtp" {
+		return mailer.NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+	}
+	return mailer.NewFile(cfg.MailDir, cfg.MailFrom)
+}
+
+// newReminderScheduler builds the scheduler sending reminders for pending payments.
+func newReminderScheduler(logger log.Logger, db *dbcontext.DB, box *secretbox.Box, senders map[string]push.Sender, cfg *config.Config) *reminder.Scheduler {
+	deviceService := device.NewService(device.NewRepository(db, logger), senders, logger)
+	return reminder.NewScheduler(reminder.NewRepository(db, logger),
+		user.NewProfileService(user.NewRepository(db, logger), box, logger),
+		notification.NewService(notification.NewRepository(db, logger), deviceService, logger),
+		cfg.ReminderCadence,
+		time.Duration(cfg.ReminderScanInterval)*time.Minute,
+		cfg.ReminderQuietHoursStart,
+		cfg.ReminderQuietHoursEnd,
+		logger,
+	)
+}
+
+// newPushSenders builds the push notification senders per device platform from the application configuration.
+func newPushSenders(cfg *config.Config) (map[string]push.Sender, error) {
+	senders := map[string]push.Sender{}
+	if cfg.APNsKeyFile != "" {
+		key, err := push.LoadAPNsKey(cfg.APNsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := push.APNsDevelopment
+		if cfg.APNsProduction {
+			endpoint = push.APNsProduction
+		}
+		senders[entity.DevicePlatformIOS] = push.NewAPNs(endpoint, key, cfg.APNsKeyID, cfg.APNsTeamID, cfg.APNsTopic)
+	}
+	return senders, nil
+}
+
+// newBlobStore builds the blob store selected in the application configuration.
+func newBlobStore(cfg *config.Config) (blobstore.Store, error) {
+	if cfg.BlobStore == "s3" {
+		return blobstore.NewS3(cfg.S3Endpoint, cfg.S3Region, cfg.S3Bucket, cfg.S3AccessKey, cfg.S3SecretKey)
+	}
+	return blobstore.NewLocal(cfg.BlobDir), nil
+}
+
 // logDBQuery returns a logging function that can be used to log SQL queries.
 func logDBQuery(logger log.Logger) dbx.QueryLogFunc {
 	return func(ctx context.Context, t time.Duration, sql string, rows *sql.Rows, err error) {
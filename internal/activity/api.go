@@ -0,0 +1,43 @@
+package activity
+
+import (
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/trips/<id>/activity", authHandler, res.query)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the activity of the trip, newest first.
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	count, err := r.service.Count(ctx, identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	activities, err := r.service.Query(ctx, identity.GetID(), c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = activities
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
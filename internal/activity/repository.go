@@ -0,0 +1,82 @@
+package activity
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access the activity of trips from the data source.
+type Repository interface {
+	// Query returns the activity of the trip, newest first.
+	Query(ctx context.Context, tripId string, offset, limit int) ([]entity.Activity, error)
+	// Count returns the number of activities of the trip.
+	Count(ctx context.Context, tripId string) (int, error)
+	// Create saves a new activity in the storage.
+	Create(ctx context.Context, activity entity.Activity) error
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+	// UserName returns the name of the user within the trip: their member name, else their display name or username.
+	UserName(ctx context.Context, tripId, userId string) (string, error)
+}
+
+// repository persists the activity of trips in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new activity repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Query retrieves the activity of the trip from the database.
+func (r repository) Query(ctx context.Context, tripId string, offset, limit int) ([]entity.Activity, error) {
+	var activities []entity.Activity
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("created_at DESC", "id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&activities)
+	return activities, err
+}
+
+// Count returns the number of activities of the trip in the database.
+func (r repository) Count(ctx context.Context, tripId string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("activity").Where(dbx.HashExp{"trip_id": tripId}).Row(&count)
+	return count, err
+}
+
+// Create saves a new activity record in the database.
+func (r repository) Create(ctx context.Context, activity entity.Activity) error {
+	return r.db.With(ctx).Model(&activity).Insert()
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// UserName reads the name of the user from the trip members and the users in the database.
+func (r repository) UserName(ctx context.Context, tripId, userId string) (string, error) {
+	var name string
+	err := r.db.With(ctx).NewQuery(`
+		SELECT CASE WHEN u.deleted_at IS NOT NULL THEN {:deleted}
+			ELSE COALESCE(NULLIF(m.name, ''), NULLIF(u.display_name, ''), u.username, '') END
+		FROM user_default u
+		LEFT JOIN trip_member m ON m.user_id = u.id AND m.trip_id = {:trip_id}
+		WHERE u.id = {:user_id}
+		LIMIT 1`).
+		Bind(dbx.Params{"deleted": entity.DeletedUserName, "trip_id": tripId, "user_id": userId}).
+		Row(&name)
+	return name, err
+}
@@ -0,0 +1,166 @@
+package activity
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+)
+
+// someone names actors who cannot be resolved, e.g. changes made by background jobs.
+const someone = "Someone"
+
+// Service encapsulates usecase logic for the activity feed of trips.
+type Service interface {
+	// Query returns the activity of the trip, newest first. Only the members of the trip can read it.
+	Query(ctx context.Context, userId, tripId string, offset, limit int) ([]Activity, error)
+	// Count returns the number of activities of the trip. Only the members of the trip can read it.
+	Count(ctx context.Context, userId, tripId string) (int, error)
+	// Record adds a change of a trip to its feed. Failures are logged rather than returned so that they never fail
+	// the operation producing the change.
+	Record(ctx context.Context, req RecordRequest)
+}
+
+// Activity represents the data about an activity.
+type Activity struct {
+	entity.Activity
+}
+
+// RecordRequest represents a change of a trip made by the user performing the request.
+// The summary describes the change after the name of that user, e.g. "added Dinner at Jimbaran — Rp 850.000".
+// A "{user}" placeholder in the summary is replaced with the name of the user with the given UserId, e.g. the
+// recipient of a payment.
+type RecordRequest struct {
+	TripId    string
+	Kind      string
+	SubjectId string
+	Summary   string
+	UserId    string
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new activity service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Query returns the activity of the trip with the specified offset and limit.
+func (s service) Query(ctx context.Context, userId, tripId string, offset, limit int) ([]Activity, error) {
+	if err := s.authorize(ctx, userId, tripId); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Query(ctx, tripId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Activity{}
+	for _, item := range items {
+		result = append(result, Activity{item})
+	}
+	return result, nil
+}
+
+// Count returns the number of activities of the trip.
+func (s service) Count(ctx context.Context, userId, tripId string) (int, error) {
+	if err := s.authorize(ctx, userId, tripId); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, tripId)
+}
+
+// authorize returns an error unless the user is a member of the trip.
+func (s service) authorize(ctx context.Context, userId, tripId string) error {
+	member, err := s.repo.IsTripMember(ctx, tripId, userId)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.Forbidden("Only the members of the trip can see its activity.")
+	}
+	return nil
+}
+
+// Record adds the change to the feed of the trip, naming the user performing the request as its actor.
+func (s service) Record(ctx context.Context, req RecordRequest) {
+	if req.TripId == "" {
+		return
+	}
+	actorId := ""
+	if identity := auth.CurrentUserDefault(ctx); identity != nil {
+		actorId = identity.GetID()
+	}
+	message := s.name(ctx, req.TripId, actorId) + " " + req.Summary
+	if strings.Contains(message, "{user}") {
+		message = strings.Replace(message, "{user}", s.name(ctx, req.TripId, req.UserId), -1)
+	}
+	activity := entity.Activity{
+		ID:        entity.GenerateID(),
+		TripId:    req.TripId,
+		ActorId:   actorId,
+		Kind:      req.Kind,
+		SubjectId: req.SubjectId,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+	if err := s.repo.Create(ctx, activity); err != nil {
+		s.logger.With(ctx).Errorf("failed to record %v of trip %v: %v", req.Kind, req.TripId, err)
+	}
+}
+
+// name returns the name of the user within the trip.
+func (s service) name(ctx context.Context, tripId, userId string) string {
+	if userId == "" {
+		return someone
+	}
+	name, err := s.repo.UserName(ctx, tripId, userId)
+	if err != nil || name == "" {
+		return someone
+	}
+	return name
+}
+
+// currencySymbols lists the symbols used instead of the currency code when formatting amounts.
+var currencySymbols = map[string]string{
+	"IDR": "Rp",
+	"USD": "$",
+	"EUR": "€",
+	"SGD": "S$",
+	"JPY": "¥",
+}
+
+// FormatAmount formats an amount of the currency for the feed, e.g. "Rp 850.000". Rupiah amounts are grouped
+// with dots as customary in Indonesia, other currencies with commas.
+func FormatAmount(amount int64, currency string) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	digits := strconv.FormatInt(amount, 10)
+	separator := ","
+	if currency == "IDR" {
+		separator = "."
+	}
+	var grouped strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			grouped.WriteString(separator)
+		}
+		grouped.WriteRune(digit)
+	}
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	if symbol == "" {
+		return sign + grouped.String()
+	}
+	return symbol + " " + sign + grouped.String()
+}
@@ -0,0 +1,99 @@
+package activity
+
+import (
+	"context"
+	"testing"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatAmount(t *testing.T) {
+	assert.Equal(t, "Rp 850.000", FormatAmount(850000, "IDR"))
+	assert.Equal(t, "Rp 1.250.500", FormatAmount(1250500, "IDR"))
+	assert.Equal(t, "$ 999", FormatAmount(999, "USD"))
+	assert.Equal(t, "AUD 12,000", FormatAmount(12000, "AUD"))
+	assert.Equal(t, "Rp -5.000", FormatAmount(-5000, "IDR"))
+	assert.Equal(t, "100", FormatAmount(100, ""))
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		members: map[string]string{"budi": "Budi", "sari": "Sari", "andi": "Andi"},
+	}
+	s := NewService(repo, logger)
+
+	ctx := auth.WithUserDefault(context.Background(), "budi", "")
+	s.Record(ctx, RecordRequest{TripId: "trip1", Kind: entity.ActivityTransactionCreated, SubjectId: "t1", Summary: "added Dinner at Jimbaran — Rp 850.000"})
+	ctx = auth.WithUserDefault(context.Background(), "sari", "")
+	s.Record(ctx, RecordRequest{TripId: "trip1", Kind: entity.ActivityPaymentConfirmed, SubjectId: "p1", Summary: "confirmed payment from {user}", UserId: "andi"})
+	s.Record(context.Background(), RecordRequest{TripId: "trip1", Kind: entity.ActivityTripUpdated, Summary: "updated the trip details"})
+	s.Record(ctx, RecordRequest{Kind: entity.ActivityTripUpdated, Summary: "ignored without a trip"})
+
+	count, err := s.Count(ctx, "sari", "trip1")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	activities, err := s.Query(ctx, "sari", "trip1", 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, activities, 3) {
+		assert.Equal(t, "Someone updated the trip details", activities[0].Message)
+		assert.Equal(t, "Sari confirmed payment from Andi", activities[1].Message)
+		assert.Equal(t, "sari", activities[1].ActorId)
+		assert.Equal(t, "Budi added Dinner at Jimbaran — Rp 850.000", activities[2].Message)
+	}
+
+	// only the members of the trip can see its activity
+	_, err = s.Query(ctx, "carol", "trip1", 0, 10)
+	assert.NotNil(t, err)
+	_, err = s.Count(ctx, "carol", "trip1")
+	assert.NotNil(t, err)
+}
+
+type mockRepository struct {
+	members    map[string]string
+	activities []entity.Activity
+}
+
+func (m *mockRepository) Query(ctx context.Context, tripId string, offset, limit int) ([]entity.Activity, error) {
+	var result []entity.Activity
+	for i := len(m.activities) - 1; i >= 0; i-- {
+		if m.activities[i].TripId == tripId {
+			result = append(result, m.activities[i])
+		}
+	}
+	if offset > len(result) {
+		offset = len(result)
+	}
+	result = result[offset:]
+	if limit < len(result) {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (m *mockRepository) Count(ctx context.Context, tripId string) (int, error) {
+	count := 0
+	for _, activity := range m.activities {
+		if activity.TripId == tripId {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, activity entity.Activity) error {
+	m.activities = append(m.activities, activity)
+	return nil
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	_, ok := m.members[userId]
+	return ok, nil
+}
+
+func (m *mockRepository) UserName(ctx context.Context, tripId, userId string) (string, error) {
+	return m.members[userId], nil
+}
@@ -1,35 +1,53 @@
 package album
 
 import (
-	"github.com/go-ozzo/ozzo-routing/v2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"tribbie/internal/auth"
 	"tribbie/internal/errors"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
-	"net/http"
-)
 
-// RegisterHandlers sets up the routing of the HTTP handlers.
-func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
-	res := resource{service, logger}
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
 
-	r.Get("/albums/<id>", res.get)
-	r.Get("/albums", res.query)
+// multipartOverhead is the room left for the caption and the multipart headers and boundaries of an upload of the
+// largest size.
+const multipartOverhead = 64 << 10
 
-	r.Use(authHandler)
+// RegisterHandlers sets up the routing of the HTTP handlers. Uploads larger than maxSize bytes are rejected before
+// they are read in full. Download URLs authenticate with their signature rather than an access token.
+func RegisterHandlers(r *routing.RouteGroup, service Service, maxSize int64, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, maxSize, logger}
 
-	// the following endpoints require a valid JWT
-	r.Post("/albums", res.create)
-	r.Put("/albums/<id>", res.update)
-	r.Delete("/albums/<id>", res.delete)
+	r.Get("/trips/<id>/albums", authHandler, res.query)
+	r.Post("/trips/<id>/albums", authHandler, res.create)
+	r.Get("/albums/<id>", authHandler, res.get)
+	r.Put("/albums/<id>", authHandler, res.update)
+	r.Delete("/albums/<id>", authHandler, res.delete)
+	r.Get("/albums/<id>/photos", authHandler, res.queryPhotos)
+	r.Post("/albums/<id>/photos", authHandler, res.uploadPhoto)
+	r.Get("/photos/<id>", authHandler, res.getPhoto)
+	r.Put("/photos/<id>", authHandler, res.updatePhoto)
+	r.Delete("/photos/<id>", authHandler, res.deletePhoto)
+	r.Get("/photos/<id>/download", res.download)
 }
 
 type resource struct {
 	service Service
+	maxSize int64
 	logger  log.Logger
 }
 
 func (r resource) get(c *routing.Context) error {
-	album, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	album, err := r.service.Get(c.Request.Context(), identity.GetID(), c.Param("id"))
 	if err != nil {
 		return err
 	}
@@ -39,26 +57,36 @@ func (r resource) get(c *routing.Context) error {
 
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	count, err := r.service.CountByTrip(ctx, identity.GetID(), c.Param("id"))
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	albums, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	albums, err := r.service.QueryByTrip(ctx, identity.GetID(), c.Param("id"), pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = albums
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
 	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
 	var input CreateAlbumRequest
 	if err := c.Read(&input); err != nil {
 		r.logger.With(c.Request.Context()).Info(err)
 		return errors.BadRequest("")
 	}
-	album, err := r.service.Create(c.Request.Context(), input)
+	input.TripId = c.Param("id")
+	album, err := r.service.Create(c.Request.Context(), identity.GetID(), input)
 	if err != nil {
 		return err
 	}
@@ -67,13 +95,17 @@ func (r resource) create(c *routing.Context) error {
 }
 
 func (r resource) update(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
 	var input UpdateAlbumRequest
 	if err := c.Read(&input); err != nil {
 		r.logger.With(c.Request.Context()).Info(err)
 		return errors.BadRequest("")
 	}
 
-	album, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
+	album, err := r.service.Update(c.Request.Context(), identity.GetID(), c.Param("id"), input)
 	if err != nil {
 		return err
 	}
@@ -82,10 +114,156 @@ func (r resource) update(c *routing.Context) error {
 }
 
 func (r resource) delete(c *routing.Context) error {
-	album, err := r.service.Delete(c.Request.Context(), c.Param("id"))
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	album, err := r.service.Delete(c.Request.Context(), identity.GetID(), c.Param("id"))
 	if err != nil {
 		return err
 	}
 
 	return c.Write(album)
 }
+
+// queryPhotos returns the photos of an album in the order they were taken.
+func (r resource) queryPhotos(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	count, err := r.service.CountPhotos(ctx, identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	photos, err := r.service.QueryPhotos(ctx, identity.GetID(), c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = photos
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// uploadPhoto reads the "file" and "caption" fields of a multipart/form-data upload of the current user.
+func (r resource) uploadPhoto(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if c.Request.ContentLength > r.maxSize+multipartOverhead {
+		return errors.RequestEntityTooLarge("")
+	}
+	c.Request.Body = http.MaxBytesReader(c.Response, c.Request.Body, r.maxSize+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return errors.BadRequest("The photo must be uploaded as multipart/form-data.")
+	}
+	input := UploadPhotoRequest{AlbumId: c.Param("id")}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			r.logger.With(c.Request.Context()).Info(err)
+			return errors.BadRequest("")
+		}
+		switch part.FormName() {
+		case "file":
+			data, err := ioutil.ReadAll(io.LimitReader(part, r.maxSize+1))
+			if err != nil {
+				r.logger.With(c.Request.Context()).Info(err)
+				return errors.RequestEntityTooLarge("")
+			}
+			if int64(len(data)) > r.maxSize {
+				return errors.RequestEntityTooLarge(fmt.Sprintf("Photos must not be larger than %v MB.", r.maxSize>>20))
+			}
+			input.Data = data
+		case "caption":
+			caption, err := ioutil.ReadAll(io.LimitReader(part, multipartOverhead))
+			if err != nil {
+				r.logger.With(c.Request.Context()).Info(err)
+				return errors.BadRequest("")
+			}
+			input.Caption = string(caption)
+		}
+	}
+	if input.Data == nil {
+		return errors.BadRequest(`The upload has no "file" field.`)
+	}
+	photo, err := r.service.UploadPhoto(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(photo, http.StatusCreated)
+}
+
+// getPhoto returns a photo with fresh download URLs.
+func (r resource) getPhoto(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	photo, err := r.service.GetPhoto(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(photo)
+}
+
+// updatePhoto changes the caption of a photo uploaded by the current user.
+func (r resource) updatePhoto(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input UpdatePhotoRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	photo, err := r.service.UpdatePhoto(c.Request.Context(), identity.GetID(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(photo)
+}
+
+// deletePhoto removes a photo.
+func (r resource) deletePhoto(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	photo, err := r.service.DeletePhoto(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(photo)
+}
+
+// download streams the file of a signed download URL.
+func (r resource) download(c *routing.Context) error {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return errors.Forbidden("The download link is invalid.")
+	}
+	variant := c.Query("variant", VariantOriginal)
+	file, err := r.service.Open(c.Request.Context(), c.Param("id"), variant, expires, c.Query("signature"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := c.Response.Header()
+	header.Set("Content-Type", file.ContentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=300")
+	c.Response.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(c.Response, file); err != nil {
+		r.logger.With(c.Request.Context()).Infof("download of photo %v interrupted: %v", c.Param("id"), err)
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"tribbie/internal/auth"
 	"tribbie/internal/entity"
 	"tribbie/internal/test"
+	"tribbie/pkg/blobstore"
 	"tribbie/pkg/log"
 	"net/http"
 	"testing"
@@ -13,24 +14,35 @@ import (
 func TestAPI(t *testing.T) {
 	logger, _ := log.NewForTest()
 	router := test.MockRouter(logger)
-	repo := &mockRepository{items: []entity.Album{
-		{"123", "album123", time.Now(), time.Now()},
-	}}
-	RegisterHandlers(router.Group(""), NewService(repo, logger), auth.MockAuthHandler, logger)
+	repo := &mockRepository{
+		members: map[string]bool{"100": true},
+		items: []entity.Album{
+			{ID: "123", TripId: "trip1", UserId: "100", Name: "album123", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+			{ID: "456", TripId: "trip2", UserId: "200", Name: "album456", CreatedAt: time.Now(), UpdatedAt: time.Now()},
+		},
+		photos: []entity.Photo{{ID: "p1", AlbumId: "123", TripId: "trip1", UserId: "100", Caption: "sunset"}},
+	}
+	service := NewService(repo, blobstore.NewMemory(), []byte("secret"), 1<<20, time.Minute, logger)
+	RegisterHandlers(router.Group(""), service, 1<<20, auth.MockAuthHandler, logger)
 	header := auth.MockAuthHeader()
 
 	tests := []test.APITestCase{
-		{"get all", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":1*`},
-		{"get 123", "GET", "/albums/123", "", nil, http.StatusOK, `*album123*`},
-		{"get unknown", "GET", "/albums/1234", "", nil, http.StatusNotFound, ""},
-		{"create ok", "POST", "/albums", `{"name":"test"}`, header, http.StatusCreated, "*test*"},
-		{"create ok count", "GET", "/albums", "", nil, http.StatusOK, `*"total_count":2*`},
-		{"create auth error", "POST", "/albums", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
-		{"create input error", "POST", "/albums", `"name":"test"}`, header, http.StatusBadRequest, ""},
+		{"get all", "GET", "/trips/trip1/albums", "", header, http.StatusOK, `*"total_count":1*`},
+		{"get all auth error", "GET", "/trips/trip1/albums", "", nil, http.StatusUnauthorized, ""},
+		{"get 123", "GET", "/albums/123", "", header, http.StatusOK, `*album123*`},
+		{"get unknown", "GET", "/albums/1234", "", header, http.StatusNotFound, ""},
+		{"create ok", "POST", "/trips/trip1/albums", `{"name":"test"}`, header, http.StatusCreated, `*"trip_id":"trip1"*`},
+		{"create ok count", "GET", "/trips/trip1/albums", "", header, http.StatusOK, `*"total_count":2*`},
+		{"create auth error", "POST", "/trips/trip1/albums", `{"name":"test"}`, nil, http.StatusUnauthorized, ""},
+		{"create input error", "POST", "/trips/trip1/albums", `"name":"test"}`, header, http.StatusBadRequest, ""},
 		{"update ok", "PUT", "/albums/123", `{"name":"albumxyz"}`, header, http.StatusOK, "*albumxyz*"},
-		{"update verify", "GET", "/albums/123", "", nil, http.StatusOK, `*albumxyz*`},
+		{"update verify", "GET", "/albums/123", "", header, http.StatusOK, `*albumxyz*`},
 		{"update auth error", "PUT", "/albums/123", `{"name":"albumxyz"}`, nil, http.StatusUnauthorized, ""},
 		{"update input error", "PUT", "/albums/123", `"name":"albumxyz"}`, header, http.StatusBadRequest, ""},
+		{"get photos", "GET", "/albums/123/photos", "", header, http.StatusOK, `*"thumbnail_url":"/v1/photos/p1/download?*`},
+		{"update photo", "PUT", "/photos/p1", `{"caption":"sunrise"}`, header, http.StatusOK, `*"caption":"sunrise"*`},
+		{"upload input error", "POST", "/albums/123/photos", `{}`, header, http.StatusBadRequest, ""},
+		{"download unsigned", "GET", "/photos/p1/download?expires=1", "", nil, http.StatusForbidden, ""},
 		{"delete ok", "DELETE", "/albums/123", ``, header, http.StatusOK, "*albumxyz*"},
 		{"delete verify", "DELETE", "/albums/123", ``, header, http.StatusNotFound, ""},
 		{"delete auth error", "DELETE", "/albums/123", ``, nil, http.StatusUnauthorized, ""},
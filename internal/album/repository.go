@@ -5,22 +5,43 @@ import (
 	"tribbie/internal/entity"
 	"tribbie/pkg/dbcontext"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
-// Repository encapsulates the logic to access albums from the data source.
+// Repository encapsulates the logic to access albums and their photos from the data source.
 type Repository interface {
+	// GetTrip returns the trip with the specified ID.
+	GetTrip(ctx context.Context, id string) (entity.Trip, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+
 	// Get returns the album with the specified album ID.
 	Get(ctx context.Context, id string) (entity.Album, error)
-	// Count returns the number of albums.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of albums with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Album, error)
+	// CountByTrip returns the number of albums of the trip.
+	CountByTrip(ctx context.Context, tripId string) (int, error)
+	// QueryByTrip returns the albums of the trip with the given offset and limit, newest first.
+	QueryByTrip(ctx context.Context, tripId string, offset, limit int) ([]entity.Album, error)
 	// Create saves a new album in the storage.
 	Create(ctx context.Context, album entity.Album) error
 	// Update updates the album with given ID in the storage.
 	Update(ctx context.Context, album entity.Album) error
-	// Delete removes the album with given ID from the storage.
+	// Delete removes the album with given ID together with its photos from the storage.
 	Delete(ctx context.Context, id string) error
+
+	// GetPhoto returns the photo with the specified ID.
+	GetPhoto(ctx context.Context, id string) (entity.Photo, error)
+	// CountPhotos returns the number of photos in the album.
+	CountPhotos(ctx context.Context, albumId string) (int, error)
+	// QueryPhotos returns the photos of the album with the given offset and limit, in the order they were taken.
+	// Photos without a capture time come last, in the order they were uploaded. A negative limit returns all.
+	QueryPhotos(ctx context.Context, albumId string, offset, limit int) ([]entity.Photo, error)
+	// CreatePhoto saves a new photo in the storage.
+	CreatePhoto(ctx context.Context, photo entity.Photo) error
+	// UpdatePhoto updates the photo with given ID in the storage.
+	UpdatePhoto(ctx context.Context, photo entity.Photo) error
+	// DeletePhoto removes the photo with given ID from the storage.
+	DeletePhoto(ctx context.Context, id string) error
 }
 
 // repository persists albums in database
@@ -34,6 +55,20 @@ func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
 	return repository{db, logger}
 }
 
+// GetTrip reads the trip with the specified ID from the database.
+func (r repository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	var trip entity.Trip
+	err := r.db.With(ctx).Select().Model(id, &trip)
+	return trip, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
 // Get reads the album with the specified ID from the database.
 func (r repository) Get(ctx context.Context, id string) (entity.Album, error) {
 	var album entity.Album
@@ -41,8 +76,27 @@ func (r repository) Get(ctx context.Context, id string) (entity.Album, error) {
 	return album, err
 }
 
+// CountByTrip returns the number of the album records of the trip in the database.
+func (r repository) CountByTrip(ctx context.Context, tripId string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("album").Where(dbx.HashExp{"trip_id": tripId}).Row(&count)
+	return count, err
+}
+
+// QueryByTrip retrieves the album records of the trip with the specified offset and limit from the database.
+func (r repository) QueryByTrip(ctx context.Context, tripId string, offset, limit int) ([]entity.Album, error) {
+	var albums []entity.Album
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("created_at DESC", "id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&albums)
+	return albums, err
+}
+
 // Create saves a new album record in the database.
-// It returns the ID of the newly inserted album record.
 func (r repository) Create(ctx context.Context, album entity.Album) error {
 	return r.db.With(ctx).Model(&album).Insert()
 }
@@ -52,30 +106,58 @@ func (r repository) Update(ctx context.Context, album entity.Album) error {
 	return r.db.With(ctx).Model(&album).Update()
 }
 
-// Delete deletes an album with the specified ID from the database.
+// Delete deletes an album with the specified ID and its photos from the database.
 func (r repository) Delete(ctx context.Context, id string) error {
 	album, err := r.Get(ctx, id)
 	if err != nil {
 		return err
 	}
+	if _, err := r.db.With(ctx).Delete("photo", dbx.HashExp{"album_id": id}).Execute(); err != nil {
+		return err
+	}
 	return r.db.With(ctx).Model(&album).Delete()
 }
 
-// Count returns the number of the album records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// GetPhoto reads the photo with the specified ID from the database.
+func (r repository) GetPhoto(ctx context.Context, id string) (entity.Photo, error) {
+	var photo entity.Photo
+	err := r.db.With(ctx).Select().Model(id, &photo)
+	return photo, err
+}
+
+// CountPhotos returns the number of the photo records of the album in the database.
+func (r repository) CountPhotos(ctx context.Context, albumId string) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("album").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("photo").Where(dbx.HashExp{"album_id": albumId}).Row(&count)
 	return count, err
 }
 
-// Query retrieves the album records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
-	var albums []entity.Album
+// QueryPhotos retrieves the photo records of the album with the specified offset and limit from the database.
+// Ascending order puts the photos without a capture time last.
+func (r repository) QueryPhotos(ctx context.Context, albumId string, offset, limit int) ([]entity.Photo, error) {
+	var photos []entity.Photo
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(dbx.HashExp{"album_id": albumId}).
+		OrderBy("taken_at", "created_at", "id").
 		Offset(int64(offset)).
 		Limit(int64(limit)).
-		All(&albums)
-	return albums, err
+		All(&photos)
+	return photos, err
+}
+
+// CreatePhoto saves a new photo record in the database.
+func (r repository) CreatePhoto(ctx context.Context, photo entity.Photo) error {
+	return r.db.With(ctx).Model(&photo).Insert()
+}
+
+// UpdatePhoto saves the changes to a photo in the database.
+func (r repository) UpdatePhoto(ctx context.Context, photo entity.Photo) error {
+	return r.db.With(ctx).Model(&photo).Update()
+}
+
+// DeletePhoto deletes the photo with the specified ID from the database.
+func (r repository) DeletePhoto(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("photo", dbx.HashExp{"id": id}).Execute()
+	return err
 }
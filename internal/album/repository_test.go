@@ -14,24 +14,26 @@ import (
 func TestRepository(t *testing.T) {
 	logger, _ := log.NewForTest()
 	db := test.DB(t)
-	test.ResetTables(t, db, "album")
+	test.ResetTables(t, db, "photo", "album")
 	repo := NewRepository(db, logger)
 
 	ctx := context.Background()
 
 	// initial count
-	count, err := repo.Count(ctx)
+	count, err := repo.CountByTrip(ctx, "trip1")
 	assert.Nil(t, err)
 
 	// create
 	err = repo.Create(ctx, entity.Album{
 		ID:        "test1",
+		TripId:    "trip1",
+		UserId:    "user1",
 		Name:      "album1",
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	})
 	assert.Nil(t, err)
-	count2, _ := repo.Count(ctx)
+	count2, _ := repo.CountByTrip(ctx, "trip1")
 	assert.Equal(t, 1, count2-count)
 
 	// get
@@ -42,26 +44,45 @@ func TestRepository(t *testing.T) {
 	assert.Equal(t, sql.ErrNoRows, err)
 
 	// update
-	err = repo.Update(ctx, entity.Album{
-		ID:        "test1",
-		Name:      "album1 updated",
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	})
+	album.Name = "album1 updated"
+	err = repo.Update(ctx, album)
 	assert.Nil(t, err)
 	album, _ = repo.Get(ctx, "test1")
 	assert.Equal(t, "album1 updated", album.Name)
 
 	// query
-	albums, err := repo.Query(ctx, 0, count2)
+	albums, err := repo.QueryByTrip(ctx, "trip1", 0, count2)
 	assert.Nil(t, err)
 	assert.Equal(t, count2, len(albums))
 
+	// photos are ordered by capture time, with the photos without one last
+	takenAt := time.Date(2026, 7, 14, 10, 0, 0, 0, time.UTC)
+	for i, photo := range []entity.Photo{{ID: "photo1"}, {ID: "photo2", TakenAt: &takenAt}} {
+		photo.AlbumId, photo.TripId, photo.UserId = "test1", "trip1", "user1"
+		photo.ContentType, photo.StorageKey, photo.ThumbnailKey = "image/jpeg", "photos/"+photo.ID+"/original", "photos/"+photo.ID+"/thumbnail"
+		photo.CreatedAt = time.Now().Add(time.Duration(i) * time.Second)
+		photo.UpdatedAt = photo.CreatedAt
+		assert.Nil(t, repo.CreatePhoto(ctx, photo))
+	}
+	photos, err := repo.QueryPhotos(ctx, "test1", 0, -1)
+	assert.Nil(t, err)
+	if assert.Len(t, photos, 2) {
+		assert.Equal(t, "photo2", photos[0].ID)
+		assert.Equal(t, "photo1", photos[1].ID)
+	}
+	photoCount, _ := repo.CountPhotos(ctx, "test1")
+	assert.Equal(t, 2, photoCount)
+	assert.Nil(t, repo.DeletePhoto(ctx, "photo1"))
+	_, err = repo.GetPhoto(ctx, "photo1")
+	assert.Equal(t, sql.ErrNoRows, err)
+
 	// delete
 	err = repo.Delete(ctx, "test1")
 	assert.Nil(t, err)
 	_, err = repo.Get(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.GetPhoto(ctx, "photo2")
+	assert.Equal(t, sql.ErrNoRows, err)
 	err = repo.Delete(ctx, "test1")
 	assert.Equal(t, sql.ErrNoRows, err)
 }
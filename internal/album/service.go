@@ -2,20 +2,74 @@ package album
 
 import (
 	"context"
-	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/blobstore"
+	"tribbie/pkg/imaging"
 	"tribbie/pkg/log"
-	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// VariantOriginal is the download variant of the uploaded photo.
+	VariantOriginal = "original"
+	// VariantThumbnail is the download variant of the thumbnail of a photo.
+	VariantThumbnail = "thumbnail"
+
+	// thumbnailSize is the largest width and height of thumbnails in pixels.
+	thumbnailSize = 320
 )
 
+// photoTypes lists the accepted content types of photos, as detected from the uploaded data. Only the formats
+// that can be decoded to generate thumbnails are accepted.
+var photoTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
 // Service encapsulates usecase logic for albums.
+// Only the members of a trip can see its albums and upload photos to them.
 type Service interface {
-	Get(ctx context.Context, id string) (Album, error)
-	Query(ctx context.Context, offset, limit int) ([]Album, error)
-	Count(ctx context.Context) (int, error)
-	Create(ctx context.Context, input CreateAlbumRequest) (Album, error)
-	Update(ctx context.Context, id string, input UpdateAlbumRequest) (Album, error)
-	Delete(ctx context.Context, id string) (Album, error)
+	// Get returns the album with the specified ID.
+	Get(ctx context.Context, userId, id string) (Album, error)
+	// QueryByTrip returns the albums of the trip with the given offset and limit.
+	QueryByTrip(ctx context.Context, userId, tripId string, offset, limit int) ([]Album, error)
+	// CountByTrip returns the number of albums of the trip.
+	CountByTrip(ctx context.Context, userId, tripId string) (int, error)
+	// Create creates a new album in a trip.
+	Create(ctx context.Context, userId string, input CreateAlbumRequest) (Album, error)
+	// Update updates the name and description of the album.
+	Update(ctx context.Context, userId, id string, input UpdateAlbumRequest) (Album, error)
+	// Delete removes an album created by the user together with its photos.
+	Delete(ctx context.Context, userId, id string) (Album, error)
+
+	// GetPhoto returns the photo with the specified ID.
+	GetPhoto(ctx context.Context, userId, id string) (Photo, error)
+	// QueryPhotos returns the photos of the album with the given offset and limit, in the order they were taken.
+	QueryPhotos(ctx context.Context, userId, albumId string, offset, limit int) ([]Photo, error)
+	// CountPhotos returns the number of photos in the album.
+	CountPhotos(ctx context.Context, userId, albumId string) (int, error)
+	// UploadPhoto stores a photo uploaded by the user to an album.
+	UploadPhoto(ctx context.Context, userId string, input UploadPhotoRequest) (Photo, error)
+	// UpdatePhoto updates the caption of a photo uploaded by the user.
+	UpdatePhoto(ctx context.Context, userId, id string, input UpdatePhotoRequest) (Photo, error)
+	// DeletePhoto removes a photo uploaded by the user, or any photo of an album created by the user.
+	DeletePhoto(ctx context.Context, userId, id string) (Photo, error)
+	// Open returns the file of a download URL after verifying its signature and expiration.
+	Open(ctx context.Context, id, variant string, expires int64, signature string) (Download, error)
 }
 
 // Album represents the data about an album.
@@ -23,79 +77,169 @@ type Album struct {
 	entity.Album
 }
 
+// Photo represents the data about a photo with its signed download URLs.
+type Photo struct {
+	entity.Photo
+	Url          string    `json:"url"`
+	ThumbnailUrl string    `json:"thumbnail_url"`
+	UrlExpiresAt time.Time `json:"url_expires_at"`
+}
+
 // CreateAlbumRequest represents an album creation request.
 type CreateAlbumRequest struct {
-	Name string `json:"name"`
+	TripId      string `json:"-"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
 // Validate validates the CreateAlbumRequest fields.
 func (m CreateAlbumRequest) Validate() error {
 	return validation.ValidateStruct(&m,
+		validation.Field(&m.TripId, validation.Required),
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Description, validation.Length(0, 1000)),
 	)
 }
 
 // UpdateAlbumRequest represents an album update request.
 type UpdateAlbumRequest struct {
-	Name string `json:"name"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
 }
 
-// Validate validates the CreateAlbumRequest fields.
+// Validate validates the UpdateAlbumRequest fields.
 func (m UpdateAlbumRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Description, validation.Length(0, 1000)),
+	)
+}
+
+// UploadPhotoRequest represents an uploaded photo.
+type UploadPhotoRequest struct {
+	AlbumId string
+	Caption string
+	Data    []byte
+}
+
+// Validate validates the UploadPhotoRequest fields.
+func (m UploadPhotoRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.AlbumId, validation.Required),
+		validation.Field(&m.Caption, validation.Length(0, 1000)),
+		validation.Field(&m.Data, validation.Required),
 	)
 }
 
+// UpdatePhotoRequest represents a photo update request.
+type UpdatePhotoRequest struct {
+	Caption string `json:"caption"`
+}
+
+// Validate validates the UpdatePhotoRequest fields.
+func (m UpdatePhotoRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Caption, validation.Length(0, 1000)),
+	)
+}
+
+// Download represents the file of a photo being downloaded. The caller must close it.
+type Download struct {
+	io.ReadCloser
+	ContentType string
+}
+
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo          Repository
+	store         blobstore.Store
+	urlKey        []byte
+	maxSize       int64
+	urlExpiration time.Duration
+	logger        log.Logger
 }
 
 // NewService creates a new album service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The photos are kept in the blob store, uploads larger than maxSize bytes are rejected, and download URLs signed
+// with urlKey stay valid for urlExpiration.
+func NewService(repo Repository, store blobstore.Store, urlKey []byte, maxSize int64, urlExpiration time.Duration, logger log.Logger) Service {
+	return service{repo, store, urlKey, maxSize, urlExpiration, logger}
 }
 
 // Get returns the album with the specified the album ID.
-func (s service) Get(ctx context.Context, id string) (Album, error) {
+func (s service) Get(ctx context.Context, userId, id string) (Album, error) {
 	album, err := s.repo.Get(ctx, id)
-	if err != nil {
+	if err == sql.ErrNoRows {
+		return Album{}, errors.NotFound("")
+	} else if err != nil {
+		return Album{}, err
+	}
+	if err := s.authorize(ctx, album.TripId, userId); err != nil {
 		return Album{}, err
 	}
 	return Album{album}, nil
 }
 
+// QueryByTrip returns the albums of the trip, newest first.
+func (s service) QueryByTrip(ctx context.Context, userId, tripId string, offset, limit int) ([]Album, error) {
+	if err := s.authorize(ctx, tripId, userId); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryByTrip(ctx, tripId, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Album{}
+	for _, item := range items {
+		result = append(result, Album{item})
+	}
+	return result, nil
+}
+
+// CountByTrip returns the number of albums of the trip.
+func (s service) CountByTrip(ctx context.Context, userId, tripId string) (int, error) {
+	if err := s.authorize(ctx, tripId, userId); err != nil {
+		return 0, err
+	}
+	return s.repo.CountByTrip(ctx, tripId)
+}
+
 // Create creates a new album.
-func (s service) Create(ctx context.Context, req CreateAlbumRequest) (Album, error) {
+func (s service) Create(ctx context.Context, userId string, req CreateAlbumRequest) (Album, error) {
 	if err := req.Validate(); err != nil {
 		return Album{}, err
 	}
+	if err := s.authorize(ctx, req.TripId, userId); err != nil {
+		return Album{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 	err := s.repo.Create(ctx, entity.Album{
-		ID:        id,
-		Name:      req.Name,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          id,
+		TripId:      req.TripId,
+		UserId:      userId,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	})
 	if err != nil {
 		return Album{}, err
 	}
-	return s.Get(ctx, id)
+	return s.Get(ctx, userId, id)
 }
 
-// Update updates the album with the specified ID.
-func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest) (Album, error) {
+// Update updates the album with the specified ID. Any member of the trip can rename an album.
+func (s service) Update(ctx context.Context, userId, id string, req UpdateAlbumRequest) (Album, error) {
 	if err := req.Validate(); err != nil {
 		return Album{}, err
 	}
 
-	album, err := s.Get(ctx, id)
+	album, err := s.Get(ctx, userId, id)
 	if err != nil {
 		return album, err
 	}
 	album.Name = req.Name
+	album.Description = req.Description
 	album.UpdatedAt = time.Now()
 
 	if err := s.repo.Update(ctx, album.Album); err != nil {
@@ -104,32 +248,261 @@ func (s service) Update(ctx context.Context, id string, req UpdateAlbumRequest)
 	return album, nil
 }
 
-// Delete deletes the album with the specified ID.
-func (s service) Delete(ctx context.Context, id string) (Album, error) {
-	album, err := s.Get(ctx, id)
+// Delete deletes the album with the specified ID together with its photos. Only the user who created an album can
+// delete it.
+func (s service) Delete(ctx context.Context, userId, id string) (Album, error) {
+	album, err := s.Get(ctx, userId, id)
+	if err != nil {
+		return Album{}, err
+	}
+	if album.UserId != userId {
+		return Album{}, errors.Forbidden("Only the user who created the album can delete it.")
+	}
+	photos, err := s.repo.QueryPhotos(ctx, id, 0, -1)
 	if err != nil {
 		return Album{}, err
 	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return Album{}, err
 	}
+	for _, photo := range photos {
+		s.remove(ctx, photo)
+	}
 	return album, nil
 }
 
-// Count returns the number of albums.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// GetPhoto returns the photo with the specified ID.
+func (s service) GetPhoto(ctx context.Context, userId, id string) (Photo, error) {
+	photo, err := s.repo.GetPhoto(ctx, id)
+	if err == sql.ErrNoRows {
+		return Photo{}, errors.NotFound("")
+	} else if err != nil {
+		return Photo{}, err
+	}
+	if err := s.authorize(ctx, photo.TripId, userId); err != nil {
+		return Photo{}, err
+	}
+	return s.newPhoto(photo, time.Now().Add(s.urlExpiration)), nil
 }
 
-// Query returns the albums with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Album, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// QueryPhotos returns the photos of the album in the order they were taken.
+func (s service) QueryPhotos(ctx context.Context, userId, albumId string, offset, limit int) ([]Photo, error) {
+	if _, err := s.Get(ctx, userId, albumId); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryPhotos(ctx, albumId, offset, limit)
 	if err != nil {
 		return nil, err
 	}
-	result := []Album{}
+	expiresAt := time.Now().Add(s.urlExpiration)
+	result := []Photo{}
 	for _, item := range items {
-		result = append(result, Album{item})
+		result = append(result, s.newPhoto(item, expiresAt))
 	}
 	return result, nil
 }
+
+// CountPhotos returns the number of photos in the album.
+func (s service) CountPhotos(ctx context.Context, userId, albumId string) (int, error) {
+	if _, err := s.Get(ctx, userId, albumId); err != nil {
+		return 0, err
+	}
+	return s.repo.CountPhotos(ctx, albumId)
+}
+
+// UploadPhoto checks the size and the detected type of the photo, reads its capture time and location from its
+// EXIF data, and stores it with a thumbnail. Capture times recorded without a UTC offset are taken to be in the time
+// zone of the trip.
+func (s service) UploadPhoto(ctx context.Context, userId string, req UploadPhotoRequest) (Photo, error) {
+	if err := req.Validate(); err != nil {
+		return Photo{}, err
+	}
+	if int64(len(req.Data)) > s.maxSize {
+		return Photo{}, errors.RequestEntityTooLarge(fmt.Sprintf("Photos must not be larger than %v MB.", s.maxSize>>20))
+	}
+	contentType := detectContentType(req.Data)
+	if !photoTypes[contentType] {
+		return Photo{}, errors.UnsupportedMediaType("Only JPEG, PNG and GIF photos can be uploaded.")
+	}
+	album, err := s.Get(ctx, userId, req.AlbumId)
+	if err != nil {
+		return Photo{}, err
+	}
+	thumbnail, width, height, err := imaging.Thumbnail(req.Data, thumbnailSize)
+	if err == imaging.ErrTooLarge {
+		return Photo{}, errors.RequestEntityTooLarge("The photo has too many pixels.")
+	} else if err != nil {
+		return Photo{}, errors.UnsupportedMediaType("The photo could not be read.")
+	}
+
+	id := entity.GenerateID()
+	now := time.Now()
+	photo := entity.Photo{
+		ID:           id,
+		AlbumId:      album.ID,
+		TripId:       album.TripId,
+		UserId:       userId,
+		Caption:      req.Caption,
+		ContentType:  contentType,
+		Size:         int64(len(req.Data)),
+		Width:        width,
+		Height:       height,
+		StorageKey:   "photos/" + id + "/" + VariantOriginal,
+		ThumbnailKey: "photos/" + id + "/" + VariantThumbnail,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if contentType == "image/jpeg" {
+		loc := time.UTC
+		if trip, err := s.repo.GetTrip(ctx, album.TripId); err == nil {
+			loc = trip.Location()
+		}
+		// the metadata is optional, so photos with malformed EXIF data are kept without it
+		exif, err := imaging.ReadExif(req.Data, loc)
+		if err != nil {
+			s.logger.With(ctx).Infof("failed to read the EXIF data of photo %v: %v", id, err)
+		}
+		photo.TakenAt, photo.Latitude, photo.Longitude = exif.TakenAt, exif.Latitude, exif.Longitude
+	}
+	if err := s.store.Put(ctx, photo.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+		return Photo{}, err
+	}
+	if err := s.store.Put(ctx, photo.StorageKey, req.Data, contentType); err != nil {
+		s.remove(ctx, photo)
+		return Photo{}, err
+	}
+	if err := s.repo.CreatePhoto(ctx, photo); err != nil {
+		s.remove(ctx, photo)
+		return Photo{}, err
+	}
+	return s.newPhoto(photo, now.Add(s.urlExpiration)), nil
+}
+
+// UpdatePhoto updates the caption of the photo with the specified ID. Only the user who uploaded a photo can
+// change its caption.
+func (s service) UpdatePhoto(ctx context.Context, userId, id string, req UpdatePhotoRequest) (Photo, error) {
+	if err := req.Validate(); err != nil {
+		return Photo{}, err
+	}
+	photo, err := s.GetPhoto(ctx, userId, id)
+	if err != nil {
+		return Photo{}, err
+	}
+	if photo.UserId != userId {
+		return Photo{}, errors.Forbidden("Only the user who uploaded the photo can change its caption.")
+	}
+	photo.Caption = req.Caption
+	photo.UpdatedAt = time.Now()
+	if err := s.repo.UpdatePhoto(ctx, photo.Photo); err != nil {
+		return Photo{}, err
+	}
+	return photo, nil
+}
+
+// DeletePhoto removes the photo with the specified ID. A photo can be deleted by the user who uploaded it and by
+// the user who created its album.
+func (s service) DeletePhoto(ctx context.Context, userId, id string) (Photo, error) {
+	photo, err := s.GetPhoto(ctx, userId, id)
+	if err != nil {
+		return Photo{}, err
+	}
+	if photo.UserId != userId {
+		album, err := s.repo.Get(ctx, photo.AlbumId)
+		if err != nil {
+			return Photo{}, err
+		}
+		if album.UserId != userId {
+			return Photo{}, errors.Forbidden("Only the user who uploaded the photo or created the album can delete it.")
+		}
+	}
+	if err := s.repo.DeletePhoto(ctx, id); err != nil {
+		return Photo{}, err
+	}
+	s.remove(ctx, photo.Photo)
+	return photo, nil
+}
+
+// Open verifies the signature and expiration of a download URL and opens the requested variant of the photo.
+func (s service) Open(ctx context.Context, id, variant string, expires int64, signature string) (Download, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(id, variant, expires))) {
+		return Download{}, errors.Forbidden("The download link is invalid.")
+	}
+	if time.Now().Unix() > expires {
+		return Download{}, errors.Forbidden("The download link has expired.")
+	}
+	photo, err := s.repo.GetPhoto(ctx, id)
+	if err == sql.ErrNoRows {
+		return Download{}, errors.NotFound("")
+	} else if err != nil {
+		return Download{}, err
+	}
+	key, contentType := photo.StorageKey, photo.ContentType
+	if variant == VariantThumbnail {
+		key, contentType = photo.ThumbnailKey, "image/jpeg"
+	}
+	r, err := s.store.Get(ctx, key)
+	if err == blobstore.ErrNotFound {
+		return Download{}, errors.NotFound("")
+	} else if err != nil {
+		return Download{}, err
+	}
+	return Download{r, contentType}, nil
+}
+
+// authorize returns an error unless the user is a member of the trip.
+func (s service) authorize(ctx context.Context, tripId, userId string) error {
+	member, err := s.repo.IsTripMember(ctx, tripId, userId)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.Forbidden("Only the members of the trip can access its albums.")
+	}
+	return nil
+}
+
+// remove deletes the files of the photo, logging failures since the record is gone either way.
+func (s service) remove(ctx context.Context, photo entity.Photo) {
+	for _, key := range []string{photo.StorageKey, photo.ThumbnailKey} {
+		if err := s.store.Delete(ctx, key); err != nil {
+			s.logger.With(ctx).Errorf("failed to delete blob %v: %v", key, err)
+		}
+	}
+}
+
+// newPhoto returns the photo with download URLs valid until expiresAt.
+func (s service) newPhoto(photo entity.Photo, expiresAt time.Time) Photo {
+	expiresAt = expiresAt.Truncate(time.Second)
+	return Photo{
+		Photo:        photo,
+		Url:          s.url(photo.ID, VariantOriginal, expiresAt.Unix()),
+		ThumbnailUrl: s.url(photo.ID, VariantThumbnail, expiresAt.Unix()),
+		UrlExpiresAt: expiresAt,
+	}
+}
+
+// url returns the signed download URL of the variant of the photo, relative to the API host.
+func (s service) url(id, variant string, expires int64) string {
+	query := url.Values{}
+	query.Set("variant", variant)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(id, variant, expires))
+	return "/v1/photos/" + url.PathEscape(id) + "/download?" + query.Encode()
+}
+
+// signature returns the hex-encoded HMAC-SHA256 of the download URL parameters. Photo URLs are signed with a
+// different prefix than attachment URLs, so a signature cannot be replayed across the two.
+func (s service) signature(id, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.urlKey)
+	fmt.Fprintf(mac, "photo\n%s\n%s\n%d", id, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// detectContentType returns the content type of the data without its parameters.
+func detectContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
@@ -1,13 +1,26 @@
 package album
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/binary"
 	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
 	"tribbie/internal/entity"
+	apierrors "tribbie/internal/errors"
+	"tribbie/pkg/blobstore"
 	"tribbie/pkg/log"
+
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 var errCRUD = errors.New("error crud")
@@ -18,9 +31,10 @@ func TestCreateAlbumRequest_Validate(t *testing.T) {
 		model     CreateAlbumRequest
 		wantError bool
 	}{
-		{"success", CreateAlbumRequest{Name: "test"}, false},
-		{"required", CreateAlbumRequest{Name: ""}, true},
-		{"too long", CreateAlbumRequest{Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
+		{"success", CreateAlbumRequest{TripId: "trip1", Name: "test"}, false},
+		{"required", CreateAlbumRequest{TripId: "trip1", Name: ""}, true},
+		{"trip required", CreateAlbumRequest{Name: "test"}, true},
+		{"too long", CreateAlbumRequest{TripId: "trip1", Name: "1234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890123456789012345678901234567890"}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -48,84 +62,230 @@ func TestUpdateAlbumRequest_Validate(t *testing.T) {
 	}
 }
 
-func Test_service_CRUD(t *testing.T) {
+func newTestService(repo *mockRepository) (Service, *blobstore.Memory) {
 	logger, _ := log.NewForTest()
-	s := NewService(&mockRepository{}, logger)
+	store := blobstore.NewMemory()
+	return NewService(repo, store, []byte("secret"), 1<<20, time.Minute, logger), store
+}
+
+func Test_service_CRUD(t *testing.T) {
+	s, _ := newTestService(&mockRepository{members: map[string]bool{"budi": true}})
 
 	ctx := context.Background()
 
 	// initial count
-	count, _ := s.Count(ctx)
+	count, _ := s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 0, count)
 
 	// successful creation
-	album, err := s.Create(ctx, CreateAlbumRequest{Name: "test"})
+	album, err := s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: "test"})
 	assert.Nil(t, err)
 	assert.NotEmpty(t, album.ID)
 	id := album.ID
 	assert.Equal(t, "test", album.Name)
+	assert.Equal(t, "trip1", album.TripId)
+	assert.Equal(t, "budi", album.UserId)
 	assert.NotEmpty(t, album.CreatedAt)
 	assert.NotEmpty(t, album.UpdatedAt)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 1, count)
 
 	// validation error in creation
-	_, err = s.Create(ctx, CreateAlbumRequest{Name: ""})
+	_, err = s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 1, count)
 
 	// unexpected error in creation
-	_, err = s.Create(ctx, CreateAlbumRequest{Name: "error"})
+	_, err = s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 1, count)
 
-	_, _ = s.Create(ctx, CreateAlbumRequest{Name: "test2"})
+	_, _ = s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: "test2"})
 
 	// update
-	album, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "test updated"})
+	album, err = s.Update(ctx, "budi", id, UpdateAlbumRequest{Name: "test updated"})
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
-	_, err = s.Update(ctx, "none", UpdateAlbumRequest{Name: "test updated"})
+	_, err = s.Update(ctx, "budi", "none", UpdateAlbumRequest{Name: "test updated"})
 	assert.NotNil(t, err)
 
 	// validation error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: ""})
+	_, err = s.Update(ctx, "budi", id, UpdateAlbumRequest{Name: ""})
 	assert.NotNil(t, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 2, count)
 
 	// unexpected error in update
-	_, err = s.Update(ctx, id, UpdateAlbumRequest{Name: "error"})
+	_, err = s.Update(ctx, "budi", id, UpdateAlbumRequest{Name: "error"})
 	assert.Equal(t, errCRUD, err)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 2, count)
 
 	// get
-	_, err = s.Get(ctx, "none")
-	assert.NotNil(t, err)
-	album, err = s.Get(ctx, id)
+	_, err = s.Get(ctx, "budi", "none")
+	assert.Equal(t, apierrors.NotFound(""), err)
+	album, err = s.Get(ctx, "budi", id)
 	assert.Nil(t, err)
 	assert.Equal(t, "test updated", album.Name)
 	assert.Equal(t, id, album.ID)
 
 	// query
-	albums, _ := s.Query(ctx, 0, 0)
+	albums, _ := s.QueryByTrip(ctx, "budi", "trip1", 0, 0)
 	assert.Equal(t, 2, len(albums))
 
 	// delete
-	_, err = s.Delete(ctx, "none")
+	_, err = s.Delete(ctx, "budi", "none")
 	assert.NotNil(t, err)
-	album, err = s.Delete(ctx, id)
+	album, err = s.Delete(ctx, "budi", id)
 	assert.Nil(t, err)
 	assert.Equal(t, id, album.ID)
-	count, _ = s.Count(ctx)
+	count, _ = s.CountByTrip(ctx, "budi", "trip1")
 	assert.Equal(t, 1, count)
 }
 
+func Test_service_members(t *testing.T) {
+	repo := &mockRepository{members: map[string]bool{"budi": true, "sari": true}}
+	s, _ := newTestService(repo)
+	ctx := context.Background()
+
+	forbidden := apierrors.Forbidden("Only the members of the trip can access its albums.")
+	_, err := s.Create(ctx, "carol", CreateAlbumRequest{TripId: "trip1", Name: "Bali"})
+	assert.Equal(t, forbidden, err)
+	_, err = s.QueryByTrip(ctx, "carol", "trip1", 0, 10)
+	assert.Equal(t, forbidden, err)
+
+	album, _ := s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: "Bali"})
+	_, err = s.Get(ctx, "carol", album.ID)
+	assert.Equal(t, forbidden, err)
+	_, err = s.QueryPhotos(ctx, "carol", album.ID, 0, 10)
+	assert.Equal(t, forbidden, err)
+
+	// members can rename albums, but only the creator can delete them
+	_, err = s.Update(ctx, "sari", album.ID, UpdateAlbumRequest{Name: "Bali 2026"})
+	assert.Nil(t, err)
+	_, err = s.Delete(ctx, "sari", album.ID)
+	assert.Equal(t, apierrors.Forbidden("Only the user who created the album can delete it."), err)
+}
+
+func Test_service_photos(t *testing.T) {
+	repo := &mockRepository{
+		trips:   map[string]entity.Trip{"trip1": {ID: "trip1", TimeZone: "Asia/Makassar"}},
+		members: map[string]bool{"budi": true, "sari": true},
+	}
+	s, store := newTestService(repo)
+	ctx := context.Background()
+	album, _ := s.Create(ctx, "budi", CreateAlbumRequest{TripId: "trip1", Name: "Bali"})
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 640, 480)))
+	_, err := s.UploadPhoto(ctx, "carol", UploadPhotoRequest{AlbumId: album.ID, Data: buf.Bytes()})
+	assert.Equal(t, apierrors.Forbidden("Only the members of the trip can access its albums."), err)
+	_, err = s.UploadPhoto(ctx, "budi", UploadPhotoRequest{AlbumId: album.ID, Data: []byte("%PDF-1.7\n")})
+	assert.Equal(t, 415, err.(apierrors.ErrorResponse).Status)
+	_, err = s.UploadPhoto(ctx, "budi", UploadPhotoRequest{AlbumId: album.ID, Data: make([]byte, 2<<20)})
+	assert.Equal(t, 413, err.(apierrors.ErrorResponse).Status)
+
+	beach, err := s.UploadPhoto(ctx, "sari", UploadPhotoRequest{AlbumId: album.ID, Caption: "Beach", Data: buf.Bytes()})
+	assert.Nil(t, err)
+	assert.Equal(t, "trip1", beach.TripId)
+	assert.Equal(t, "image/png", beach.ContentType)
+	assert.Equal(t, 640, beach.Width)
+	assert.Nil(t, beach.TakenAt)
+
+	sunset, err := s.UploadPhoto(ctx, "budi", UploadPhotoRequest{AlbumId: album.ID, Caption: "Sunset", Data: exifJPEG(t, "2026:07:14 18:05:00")})
+	assert.Nil(t, err)
+	assert.Len(t, store.Keys(), 4)
+
+	// the capture time is in the time zone of the trip
+	if assert.NotNil(t, sunset.TakenAt) {
+		assert.True(t, time.Date(2026, 7, 14, 10, 5, 0, 0, time.UTC).Equal(*sunset.TakenAt))
+	}
+
+	// photos with a capture time come first
+	photos, err := s.QueryPhotos(ctx, "budi", album.ID, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, photos, 2) {
+		assert.Equal(t, sunset.ID, photos[0].ID)
+		assert.Equal(t, beach.ID, photos[1].ID)
+	}
+
+	// only the uploader can change the caption
+	_, err = s.UpdatePhoto(ctx, "budi", beach.ID, UpdatePhotoRequest{Caption: "Kuta"})
+	assert.Equal(t, 403, err.(apierrors.ErrorResponse).Status)
+	photo, err := s.UpdatePhoto(ctx, "sari", beach.ID, UpdatePhotoRequest{Caption: "Kuta"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Kuta", photo.Caption)
+
+	// downloads are authorized by the URL signature
+	link, _ := url.Parse(beach.ThumbnailUrl)
+	query := link.Query()
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	file, err := s.Open(ctx, beach.ID, query.Get("variant"), expires, query.Get("signature"))
+	if assert.Nil(t, err) {
+		data, _ := ioutil.ReadAll(file)
+		file.Close()
+		assert.Equal(t, "image/jpeg", file.ContentType)
+		assert.Equal(t, "image/jpeg", detectContentType(data))
+	}
+	_, err = s.Open(ctx, beach.ID, VariantOriginal, expires, query.Get("signature"))
+	assert.Equal(t, apierrors.Forbidden("The download link is invalid."), err)
+
+	// the album creator can delete any photo of the album
+	_, err = s.DeletePhoto(ctx, "budi", beach.ID)
+	assert.Nil(t, err)
+	assert.Len(t, store.Keys(), 2)
+
+	// deleting the album removes the remaining photos
+	_, err = s.Delete(ctx, "budi", album.ID)
+	assert.Nil(t, err)
+	assert.Len(t, store.Keys(), 0)
+	assert.Len(t, repo.photos, 0)
+}
+
+// exifJPEG returns a JPEG photo with an EXIF segment recording the given capture time without a UTC offset.
+func exifJPEG(t *testing.T, takenAt string) []byte {
+	var img bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, 32, 24)), nil))
+
+	// IFD0 at 8 points to the Exif IFD at 26, whose DateTimeOriginal value is stored at 44
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	for _, v := range []interface{}{
+		uint16(42), uint32(8),
+		uint16(1), uint16(0x8769), uint16(4), uint32(1), uint32(26), uint32(0),
+		uint16(1), uint16(0x9003), uint16(2), uint32(len(takenAt) + 1), uint32(44), uint32(0),
+	} {
+		assert.Nil(t, binary.Write(&tiff, binary.LittleEndian, v))
+	}
+	tiff.WriteString(takenAt + "\x00")
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var buf bytes.Buffer
+	buf.Write(img.Bytes()[:2])
+	buf.Write([]byte{0xFF, 0xE1, byte((len(segment) + 2) >> 8), byte(len(segment) + 2)})
+	buf.Write(segment)
+	buf.Write(img.Bytes()[2:])
+	return buf.Bytes()
+}
+
 type mockRepository struct {
-	items []entity.Album
+	trips   map[string]entity.Trip
+	members map[string]bool
+	items   []entity.Album
+	photos  []entity.Photo
+}
+
+func (m mockRepository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	if trip, ok := m.trips[id]; ok {
+		return trip, nil
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	return m.members[userId], nil
 }
 
 func (m mockRepository) Get(ctx context.Context, id string) (entity.Album, error) {
@@ -137,12 +297,19 @@ func (m mockRepository) Get(ctx context.Context, id string) (entity.Album, error
 	return entity.Album{}, sql.ErrNoRows
 }
 
-func (m mockRepository) Count(ctx context.Context) (int, error) {
-	return len(m.items), nil
+func (m mockRepository) CountByTrip(ctx context.Context, tripId string) (int, error) {
+	albums, _ := m.QueryByTrip(ctx, tripId, 0, -1)
+	return len(albums), nil
 }
 
-func (m mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.Album, error) {
-	return m.items, nil
+func (m mockRepository) QueryByTrip(ctx context.Context, tripId string, offset, limit int) ([]entity.Album, error) {
+	var albums []entity.Album
+	for _, item := range m.items {
+		if item.TripId == tripId {
+			albums = append(albums, item)
+		}
+	}
+	return albums, nil
 }
 
 func (m *mockRepository) Create(ctx context.Context, album entity.Album) error {
@@ -174,5 +341,64 @@ func (m *mockRepository) Delete(ctx context.Context, id string) error {
 			break
 		}
 	}
+	photos := m.photos[:0]
+	for _, photo := range m.photos {
+		if photo.AlbumId != id {
+			photos = append(photos, photo)
+		}
+	}
+	m.photos = photos
+	return nil
+}
+
+func (m mockRepository) GetPhoto(ctx context.Context, id string) (entity.Photo, error) {
+	for _, photo := range m.photos {
+		if photo.ID == id {
+			return photo, nil
+		}
+	}
+	return entity.Photo{}, sql.ErrNoRows
+}
+
+func (m mockRepository) CountPhotos(ctx context.Context, albumId string) (int, error) {
+	photos, _ := m.QueryPhotos(ctx, albumId, 0, -1)
+	return len(photos), nil
+}
+
+func (m mockRepository) QueryPhotos(ctx context.Context, albumId string, offset, limit int) ([]entity.Photo, error) {
+	var photos []entity.Photo
+	for _, photo := range m.photos {
+		if photo.AlbumId == albumId {
+			photos = append(photos, photo)
+		}
+	}
+	sort.SliceStable(photos, func(i, j int) bool {
+		a, b := photos[i].TakenAt, photos[j].TakenAt
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	return photos, nil
+}
+
+func (m *mockRepository) CreatePhoto(ctx context.Context, photo entity.Photo) error {
+	m.photos = append(m.photos, photo)
+	return nil
+}
+
+func (m *mockRepository) UpdatePhoto(ctx context.Context, photo entity.Photo) error {
+	for i, item := range m.photos {
+		if item.ID == photo.ID {
+			m.photos[i] = photo
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) DeletePhoto(ctx context.Context, id string) error {
+	for i, photo := range m.photos {
+		if photo.ID == id {
+			m.photos = append(m.photos[:i], m.photos[i+1:]...)
+			break
+		}
+	}
 	return nil
 }
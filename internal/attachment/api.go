@@ -0,0 +1,173 @@
+package attachment
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// multipartOverhead is the room left for the multipart headers and boundaries of an upload of the largest size.
+const multipartOverhead = 64 << 10
+
+// RegisterHandlers sets up the routing of the HTTP handlers. Uploads larger than maxSize bytes are rejected before
+// they are read in full. Download URLs authenticate with their signature rather than an access token.
+func RegisterHandlers(r *routing.RouteGroup, service Service, maxSize int64, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, maxSize, logger}
+
+	r.Get("/transactions/<id>/attachments", authHandler, res.queryByTransaction)
+	r.Post("/transactions/<id>/attachments", authHandler, res.uploadToTransaction)
+	r.Get("/transaction-payments/<id>/attachments", authHandler, res.queryByPayment)
+	r.Post("/transaction-payments/<id>/attachments", authHandler, res.uploadToPayment)
+	r.Get("/attachments/<id>", authHandler, res.get)
+	r.Delete("/attachments/<id>", authHandler, res.delete)
+	r.Get("/attachments/<id>/download", res.download)
+}
+
+type resource struct {
+	service Service
+	maxSize int64
+	logger  log.Logger
+}
+
+// queryByTransaction returns a page of the attachments of a transaction.
+func (r resource) queryByTransaction(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	attachments, err := r.service.QueryByTransaction(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, attachments)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// queryByPayment returns a page of the attachments of a payment.
+func (r resource) queryByPayment(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	attachments, err := r.service.QueryByPayment(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, attachments)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// uploadToTransaction attaches the file of a multipart/form-data upload to a transaction.
+func (r resource) uploadToTransaction(c *routing.Context) error {
+	return r.upload(c, UploadRequest{TransactionId: c.Param("id")})
+}
+
+// uploadToPayment attaches the file of a multipart/form-data upload to a payment.
+func (r resource) uploadToPayment(c *routing.Context) error {
+	return r.upload(c, UploadRequest{PaymentId: c.Param("id")})
+}
+
+// upload reads the "file" field of a multipart/form-data upload of the current user.
+func (r resource) upload(c *routing.Context, input UploadRequest) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if c.Request.ContentLength > r.maxSize+multipartOverhead {
+		return errors.RequestEntityTooLarge("")
+	}
+	c.Request.Body = http.MaxBytesReader(c.Response, c.Request.Body, r.maxSize+multipartOverhead)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return errors.BadRequest("The file must be uploaded as multipart/form-data.")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return errors.BadRequest(`The upload has no "file" field.`)
+		} else if err != nil {
+			r.logger.With(c.Request.Context()).Info(err)
+			return errors.BadRequest("")
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(part, r.maxSize+1))
+		if err != nil {
+			r.logger.With(c.Request.Context()).Info(err)
+			return errors.RequestEntityTooLarge("")
+		}
+		if int64(len(data)) > r.maxSize {
+			return errors.RequestEntityTooLarge(fmt.Sprintf("Attachments must not be larger than %v MB.", r.maxSize>>20))
+		}
+		input.FileName, input.Data = part.FileName(), data
+		break
+	}
+	attachment, err := r.service.Upload(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(attachment, http.StatusCreated)
+}
+
+// get returns an attachment with fresh download URLs.
+func (r resource) get(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	attachment, err := r.service.Get(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(attachment)
+}
+
+// delete removes an attachment uploaded by the current user.
+func (r resource) delete(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	attachment, err := r.service.Delete(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(attachment)
+}
+
+// download streams the file of a signed download URL.
+func (r resource) download(c *routing.Context) error {
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil {
+		return errors.Forbidden("The download link is invalid.")
+	}
+	variant := c.Query("variant", VariantOriginal)
+	file, err := r.service.Open(c.Request.Context(), c.Param("id"), variant, expires, c.Query("signature"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := c.Response.Header()
+	header.Set("Content-Type", file.ContentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": file.FileName}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", "private, max-age=300")
+	c.Response.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(c.Response, file); err != nil {
+		r.logger.With(c.Request.Context()).Infof("download of attachment %v interrupted: %v", c.Param("id"), err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package attachment
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access attachments from the data source.
+type Repository interface {
+	// GetTransaction returns the transaction with the specified ID.
+	GetTransaction(ctx context.Context, id string) (entity.Transaction, error)
+	// GetPayment returns the payment with the specified ID.
+	GetPayment(ctx context.Context, id string) (entity.TransactionPayment, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+
+	// Get returns the attachment with the specified ID.
+	Get(ctx context.Context, id string) (entity.Attachment, error)
+	// QueryByTransaction returns the attachments of the transaction, oldest first.
+	QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Attachment, error)
+	// QueryByPayment returns the attachments of the payment, oldest first.
+	QueryByPayment(ctx context.Context, paymentId string) ([]entity.Attachment, error)
+	// Create saves a new attachment in the storage.
+	Create(ctx context.Context, attachment entity.Attachment) error
+	// Delete removes the attachment with given ID from the storage.
+	Delete(ctx context.Context, id string) error
+}
+
+// repository persists attachments in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new attachment repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetTransaction reads the transaction with the specified ID from the database.
+func (r repository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	var transaction entity.Transaction
+	err := r.db.With(ctx).Select().Model(id, &transaction)
+	return transaction, err
+}
+
+// GetPayment reads the payment with the specified ID from the database.
+func (r repository) GetPayment(ctx context.Context, id string) (entity.TransactionPayment, error) {
+	var payment entity.TransactionPayment
+	err := r.db.With(ctx).Select().Model(id, &payment)
+	return payment, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// Get reads the attachment with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Attachment, error) {
+	var attachment entity.Attachment
+	err := r.db.With(ctx).Select().Model(id, &attachment)
+	return attachment, err
+}
+
+// QueryByTransaction retrieves the attachments of the transaction from the database.
+func (r repository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Attachment, error) {
+	var attachments []entity.Attachment
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": transactionId}).
+		OrderBy("created_at", "id").
+		All(&attachments)
+	return attachments, err
+}
+
+// QueryByPayment retrieves the attachments of the payment from the database.
+func (r repository) QueryByPayment(ctx context.Context, paymentId string) ([]entity.Attachment, error) {
+	var attachments []entity.Attachment
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"payment_id": paymentId}).
+		OrderBy("created_at", "id").
+		All(&attachments)
+	return attachments, err
+}
+
+// Create saves a new attachment record in the database.
+func (r repository) Create(ctx context.Context, attachment entity.Attachment) error {
+	return r.db.With(ctx).Model(&attachment).Insert()
+}
+
+// Delete deletes the attachment with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("attachment", dbx.HashExp{"id": id}).Execute()
+	return err
+}
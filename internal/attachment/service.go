@@ -0,0 +1,376 @@
+package attachment
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/blobstore"
+	"tribbie/pkg/imaging"
+	"tribbie/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// VariantOriginal is the download variant of the uploaded file.
+	VariantOriginal = "original"
+	// VariantThumbnail is the download variant of the thumbnail of an image.
+	VariantThumbnail = "thumbnail"
+
+	// thumbnailSize is the largest width and height of thumbnails in pixels.
+	thumbnailSize = 320
+)
+
+// allowedTypes lists the accepted content types, as detected from the uploaded data rather than declared by the
+// client, and whether a thumbnail can be generated for them.
+var allowedTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      false,
+	"image/heic":      false,
+	"application/pdf": false,
+}
+
+// Service encapsulates usecase logic for attachments.
+// Only the members of the trip of a transaction or payment can read and upload its attachments.
+type Service interface {
+	// QueryByTransaction returns the attachments of the transaction.
+	QueryByTransaction(ctx context.Context, userId, transactionId string) ([]Attachment, error)
+	// QueryByPayment returns the attachments of the payment.
+	QueryByPayment(ctx context.Context, userId, paymentId string) ([]Attachment, error)
+	// Get returns the attachment with the specified ID.
+	Get(ctx context.Context, userId, id string) (Attachment, error)
+	// Upload stores a file uploaded by the user to a transaction or a payment.
+	Upload(ctx context.Context, userId string, input UploadRequest) (Attachment, error)
+	// Delete removes an attachment uploaded by the user together with its files.
+	Delete(ctx context.Context, userId, id string) (Attachment, error)
+	// Open returns the file of a download URL after verifying its signature and expiration.
+	Open(ctx context.Context, id, variant string, expires int64, signature string) (Download, error)
+}
+
+// Attachment represents the data about an attachment with its signed download URLs.
+type Attachment struct {
+	entity.Attachment
+	Url          string    `json:"url"`
+	ThumbnailUrl string    `json:"thumbnail_url,omitempty"`
+	UrlExpiresAt time.Time `json:"url_expires_at"`
+}
+
+// UploadRequest represents an uploaded file. Files are attached to the transaction if TransactionId is set, and to
+// the payment otherwise.
+type UploadRequest struct {
+	TransactionId string
+	PaymentId     string
+	FileName      string
+	Data          []byte
+}
+
+// Validate validates the UploadRequest fields.
+func (m UploadRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.TransactionId, validation.When(m.PaymentId == "", validation.Required)),
+		validation.Field(&m.FileName, validation.Length(0, 255)),
+		validation.Field(&m.Data, validation.Required),
+	)
+}
+
+// Download represents the file of an attachment being downloaded. The caller must close it.
+type Download struct {
+	io.ReadCloser
+	ContentType string
+	FileName    string
+}
+
+type service struct {
+	repo          Repository
+	store         blobstore.Store
+	urlKey        []byte
+	maxSize       int64
+	urlExpiration time.Duration
+	logger        log.Logger
+}
+
+// NewService creates a new attachment service.
+// The files are kept in the blob store, uploads larger than maxSize bytes are rejected, and download URLs signed
+// with urlKey stay valid for urlExpiration.
+func NewService(repo Repository, store blobstore.Store, urlKey []byte, maxSize int64, urlExpiration time.Duration, logger log.Logger) Service {
+	return service{repo, store, urlKey, maxSize, urlExpiration, logger}
+}
+
+// QueryByTransaction returns the attachments of the transaction, oldest first.
+func (s service) QueryByTransaction(ctx context.Context, userId, transactionId string) ([]Attachment, error) {
+	if _, err := s.transactionTrip(ctx, userId, transactionId); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryByTransaction(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(items), nil
+}
+
+// QueryByPayment returns the attachments of the payment, oldest first.
+func (s service) QueryByPayment(ctx context.Context, userId, paymentId string) ([]Attachment, error) {
+	if _, err := s.paymentTrip(ctx, userId, paymentId); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.QueryByPayment(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+	return s.sign(items), nil
+}
+
+// Get returns the attachment with the specified ID. Attachments of trips the user is not a member of are not found.
+func (s service) Get(ctx context.Context, userId, id string) (Attachment, error) {
+	attachment, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return Attachment{}, errors.NotFound("")
+	} else if err != nil {
+		return Attachment{}, err
+	}
+	member, err := s.repo.IsTripMember(ctx, attachment.TripId, userId)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if !member {
+		return Attachment{}, errors.NotFound("")
+	}
+	return s.newAttachment(attachment, time.Now().Add(s.urlExpiration)), nil
+}
+
+// Upload checks the size and the detected type of the file, stores it with a thumbnail for images, and records
+// the attachment.
+func (s service) Upload(ctx context.Context, userId string, req UploadRequest) (Attachment, error) {
+	if err := req.Validate(); err != nil {
+		return Attachment{}, err
+	}
+	if int64(len(req.Data)) > s.maxSize {
+		return Attachment{}, errors.RequestEntityTooLarge(fmt.Sprintf("Attachments must not be larger than %v MB.", s.maxSize>>20))
+	}
+	contentType := DetectContentType(req.Data)
+	thumbnailable, ok := allowedTypes[contentType]
+	if !ok {
+		return Attachment{}, errors.UnsupportedMediaType("Only JPEG, PNG, GIF, WebP and HEIC images and PDF documents can be attached.")
+	}
+	var tripId string
+	var err error
+	if req.TransactionId != "" {
+		tripId, err = s.transactionTrip(ctx, userId, req.TransactionId)
+	} else {
+		tripId, err = s.paymentTrip(ctx, userId, req.PaymentId)
+	}
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	id := entity.GenerateID()
+	attachment := entity.Attachment{
+		ID:            id,
+		TripId:        tripId,
+		TransactionId: req.TransactionId,
+		PaymentId:     req.PaymentId,
+		UserId:        userId,
+		FileName:      fileName(req.FileName, contentType),
+		ContentType:   contentType,
+		Size:          int64(len(req.Data)),
+		StorageKey:    "attachments/" + id + "/" + VariantOriginal,
+		CreatedAt:     time.Now(),
+	}
+	if thumbnailable {
+		thumbnail, width, height, err := imaging.Thumbnail(req.Data, thumbnailSize)
+		if err == imaging.ErrTooLarge {
+			return Attachment{}, errors.RequestEntityTooLarge("The image has too many pixels.")
+		} else if err != nil {
+			return Attachment{}, errors.UnsupportedMediaType("The image could not be read.")
+		}
+		attachment.Width, attachment.Height = width, height
+		attachment.ThumbnailKey = "attachments/" + id + "/" + VariantThumbnail
+		if err := s.store.Put(ctx, attachment.ThumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			return Attachment{}, err
+		}
+	}
+	if err := s.store.Put(ctx, attachment.StorageKey, req.Data, contentType); err != nil {
+		s.remove(ctx, attachment)
+		return Attachment{}, err
+	}
+	if err := s.repo.Create(ctx, attachment); err != nil {
+		s.remove(ctx, attachment)
+		return Attachment{}, err
+	}
+	return s.newAttachment(attachment, time.Now().Add(s.urlExpiration)), nil
+}
+
+// Delete removes the attachment with the specified ID. Only the user who uploaded an attachment can delete it.
+func (s service) Delete(ctx context.Context, userId, id string) (Attachment, error) {
+	attachment, err := s.Get(ctx, userId, id)
+	if err != nil {
+		return Attachment{}, err
+	}
+	if attachment.UserId != userId {
+		return Attachment{}, errors.Forbidden("Only the user who uploaded the attachment can delete it.")
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return Attachment{}, err
+	}
+	s.remove(ctx, attachment.Attachment)
+	return attachment, nil
+}
+
+// Open verifies the signature and expiration of a download URL and opens the requested variant of the file.
+func (s service) Open(ctx context.Context, id, variant string, expires int64, signature string) (Download, error) {
+	if !hmac.Equal([]byte(signature), []byte(s.signature(id, variant, expires))) {
+		return Download{}, errors.Forbidden("The download link is invalid.")
+	}
+	if time.Now().Unix() > expires {
+		return Download{}, errors.Forbidden("The download link has expired.")
+	}
+	attachment, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows {
+		return Download{}, errors.NotFound("")
+	} else if err != nil {
+		return Download{}, err
+	}
+	key, contentType, name := attachment.StorageKey, attachment.ContentType, attachment.FileName
+	if variant == VariantThumbnail {
+		if attachment.ThumbnailKey == "" {
+			return Download{}, errors.NotFound("")
+		}
+		key, contentType = attachment.ThumbnailKey, "image/jpeg"
+		name = strings.TrimSuffix(name, path.Ext(name)) + "-thumbnail.jpg"
+	}
+	r, err := s.store.Get(ctx, key)
+	if err == blobstore.ErrNotFound {
+		return Download{}, errors.NotFound("")
+	} else if err != nil {
+		return Download{}, err
+	}
+	return Download{r, contentType, name}, nil
+}
+
+// transactionTrip returns the trip of the transaction if the user is a member of it.
+func (s service) transactionTrip(ctx context.Context, userId, transactionId string) (string, error) {
+	transaction, err := s.repo.GetTransaction(ctx, transactionId)
+	if err == sql.ErrNoRows {
+		return "", errors.NotFound("")
+	} else if err != nil {
+		return "", err
+	}
+	return transaction.TripId, s.authorize(ctx, transaction.TripId, userId)
+}
+
+// paymentTrip returns the trip of the payment if the user is a member of it.
+func (s service) paymentTrip(ctx context.Context, userId, paymentId string) (string, error) {
+	payment, err := s.repo.GetPayment(ctx, paymentId)
+	if err == sql.ErrNoRows {
+		return "", errors.NotFound("")
+	} else if err != nil {
+		return "", err
+	}
+	return payment.TripId, s.authorize(ctx, payment.TripId, userId)
+}
+
+// authorize returns an error unless the user is a member of the trip.
+func (s service) authorize(ctx context.Context, tripId, userId string) error {
+	member, err := s.repo.IsTripMember(ctx, tripId, userId)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.Forbidden("Only the members of the trip can access its attachments.")
+	}
+	return nil
+}
+
+// remove deletes the files of the attachment, logging failures since the record is gone either way.
+func (s service) remove(ctx context.Context, attachment entity.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			s.logger.With(ctx).Errorf("failed to delete blob %v: %v", key, err)
+		}
+	}
+}
+
+// sign returns the attachments with download URLs sharing the same expiration.
+func (s service) sign(items []entity.Attachment) []Attachment {
+	expiresAt := time.Now().Add(s.urlExpiration)
+	result := []Attachment{}
+	for _, item := range items {
+		result = append(result, s.newAttachment(item, expiresAt))
+	}
+	return result
+}
+
+// newAttachment returns the attachment with download URLs valid until expiresAt.
+func (s service) newAttachment(attachment entity.Attachment, expiresAt time.Time) Attachment {
+	expiresAt = expiresAt.Truncate(time.Second)
+	result := Attachment{
+		Attachment:   attachment,
+		Url:          s.url(attachment.ID, VariantOriginal, expiresAt.Unix()),
+		UrlExpiresAt: expiresAt,
+	}
+	if attachment.ThumbnailKey != "" {
+		result.ThumbnailUrl = s.url(attachment.ID, VariantThumbnail, expiresAt.Unix())
+	}
+	return result
+}
+
+// url returns the signed download URL of the variant of the attachment, relative to the API host.
+func (s service) url(id, variant string, expires int64) string {
+	query := url.Values{}
+	query.Set("variant", variant)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", s.signature(id, variant, expires))
+	return "/v1/attachments/" + url.PathEscape(id) + "/download?" + query.Encode()
+}
+
+// signature returns the hex-encoded HMAC-SHA256 of the download URL parameters.
+func (s service) signature(id, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, s.urlKey)
+	fmt.Fprintf(mac, "%s\n%s\n%d", id, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DetectContentType returns the content type of the data, recognizing HEIC photos in addition to the types
+// detected by http.DetectContentType.
+func DetectContentType(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		switch string(data[8:12]) {
+		case "heic", "heix", "heim", "heis", "mif1", "msf1":
+			return "image/heic"
+		}
+	}
+	contentType := http.DetectContentType(data)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// fileName returns the base name of the uploaded file, or a name derived from its content type.
+func fileName(name, contentType string) string {
+	name = path.Base(strings.Replace(name, "\\", "/", -1))
+	if name == "." || name == "/" || name == "" {
+		name = "attachment"
+		if i := strings.IndexByte(contentType, '/'); i >= 0 {
+			name += "." + strings.TrimPrefix(contentType[i+1:], "x-")
+		}
+	}
+	return name
+}
@@ -0,0 +1,169 @@
+package attachment
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/blobstore"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectContentType(t *testing.T) {
+	assert.Equal(t, "image/heic", DetectContentType([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00")))
+	assert.Equal(t, "application/pdf", DetectContentType([]byte("%PDF-1.7\n")))
+	assert.Equal(t, "text/plain", DetectContentType([]byte("hello")))
+}
+
+func TestFileName(t *testing.T) {
+	assert.Equal(t, "receipt.jpg", fileName(`C:\Users\budi\receipt.jpg`, "image/jpeg"))
+	assert.Equal(t, "receipt.jpg", fileName("../../receipt.jpg", "image/jpeg"))
+	assert.Equal(t, "attachment.pdf", fileName("", "application/pdf"))
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		transactions: map[string]entity.Transaction{"t1": {ID: "t1", TripId: "trip1"}},
+		payments:     map[string]entity.TransactionPayment{"p1": {ID: "p1", TripId: "trip1"}},
+		members:      map[string]bool{"budi": true, "sari": true},
+		attachments:  map[string]entity.Attachment{},
+	}
+	store := blobstore.NewMemory()
+	s := NewService(repo, store, []byte("secret"), 1<<20, time.Minute, logger)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	_ = png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 640, 480)))
+	photo := buf.Bytes()
+
+	_, err := s.Upload(ctx, "carol", UploadRequest{TransactionId: "t1", FileName: "receipt.png", Data: photo})
+	assert.Equal(t, errors.Forbidden("Only the members of the trip can access its attachments."), err)
+	_, err = s.Upload(ctx, "budi", UploadRequest{TransactionId: "t1", Data: []byte("plain text")})
+	assert.Equal(t, 415, err.(errors.ErrorResponse).Status)
+	_, err = s.Upload(ctx, "budi", UploadRequest{TransactionId: "t1", Data: make([]byte, 2<<20)})
+	assert.Equal(t, 413, err.(errors.ErrorResponse).Status)
+
+	receipt, err := s.Upload(ctx, "budi", UploadRequest{TransactionId: "t1", FileName: "receipt.png", Data: photo})
+	assert.Nil(t, err)
+	assert.Equal(t, "trip1", receipt.TripId)
+	assert.Equal(t, "image/png", receipt.ContentType)
+	assert.Equal(t, 640, receipt.Width)
+	assert.Equal(t, 480, receipt.Height)
+	assert.NotEmpty(t, receipt.ThumbnailUrl)
+	assert.Len(t, store.Keys(), 2)
+
+	proof, err := s.Upload(ctx, "sari", UploadRequest{PaymentId: "p1", FileName: "proof.pdf", Data: []byte("%PDF-1.7\n")})
+	assert.Nil(t, err)
+	assert.Empty(t, proof.ThumbnailUrl)
+	attachments, err := s.QueryByPayment(ctx, "budi", "p1")
+	assert.Nil(t, err)
+	assert.Len(t, attachments, 1)
+
+	// signed download URLs
+	download := func(rawURL string) (string, error) {
+		u, _ := url.Parse(rawURL)
+		q := u.Query()
+		expires, _ := strconv.ParseInt(q.Get("expires"), 10, 64)
+		file, err := s.Open(ctx, receipt.ID, q.Get("variant"), expires, q.Get("signature"))
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+		data, _ := ioutil.ReadAll(file)
+		return file.ContentType + " " + strconv.Itoa(len(data)), nil
+	}
+	result, err := download(receipt.Url)
+	assert.Nil(t, err)
+	assert.Equal(t, "image/png "+strconv.Itoa(len(photo)), result)
+	result, err = download(receipt.ThumbnailUrl)
+	assert.Nil(t, err)
+	assert.Contains(t, result, "image/jpeg ")
+	expires := receipt.UrlExpiresAt.Unix()
+	_, err = s.Open(ctx, receipt.ID, VariantOriginal, expires+60, s.(service).signature(receipt.ID, VariantOriginal, expires))
+	assert.NotNil(t, err)
+	past := time.Now().Add(-time.Second).Unix()
+	_, err = s.Open(ctx, receipt.ID, VariantOriginal, past, s.(service).signature(receipt.ID, VariantOriginal, past))
+	assert.Equal(t, errors.Forbidden("The download link has expired."), err)
+
+	// only the uploader can delete an attachment
+	_, err = s.Delete(ctx, "sari", receipt.ID)
+	assert.NotNil(t, err)
+	_, err = s.Delete(ctx, "budi", receipt.ID)
+	assert.Nil(t, err)
+	assert.Len(t, store.Keys(), 1)
+	_, err = s.Get(ctx, "budi", receipt.ID)
+	assert.NotNil(t, err)
+}
+
+type mockRepository struct {
+	transactions map[string]entity.Transaction
+	payments     map[string]entity.TransactionPayment
+	members      map[string]bool
+	attachments  map[string]entity.Attachment
+}
+
+func (m *mockRepository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	if transaction, ok := m.transactions[id]; ok {
+		return transaction, nil
+	}
+	return entity.Transaction{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetPayment(ctx context.Context, id string) (entity.TransactionPayment, error) {
+	if payment, ok := m.payments[id]; ok {
+		return payment, nil
+	}
+	return entity.TransactionPayment{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	return m.members[userId], nil
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Attachment, error) {
+	if attachment, ok := m.attachments[id]; ok {
+		return attachment, nil
+	}
+	return entity.Attachment{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Attachment, error) {
+	var result []entity.Attachment
+	for _, attachment := range m.attachments {
+		if attachment.TransactionId == transactionId {
+			result = append(result, attachment)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) QueryByPayment(ctx context.Context, paymentId string) ([]entity.Attachment, error) {
+	var result []entity.Attachment
+	for _, attachment := range m.attachments {
+		if attachment.PaymentId == paymentId {
+			result = append(result, attachment)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, attachment entity.Attachment) error {
+	m.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	delete(m.attachments, id)
+	return nil
+}
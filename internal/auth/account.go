@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/mailer"
+
+	User "tribbie/internal/user"
+)
+
+const (
+	// emailVerificationExpiration is how long an email verification link stays valid.
+	emailVerificationExpiration = 48 * time.Hour
+	// passwordResetExpiration is how long a password reset link stays valid.
+	passwordResetExpiration = time.Hour
+)
+
+// AccountService encapsulates the email verification and password reset flows.
+type AccountService interface {
+	// SendEmailVerification emails a verification link to the given user.
+	SendEmailVerification(ctx context.Context, user User.UserDefault) error
+	// VerifyEmail consumes an email verification token and marks the email address as verified.
+	VerifyEmail(ctx context.Context, token string) (User.UserDefault, error)
+	// ForgotPassword emails a password reset link to the user with the given email, if there is one.
+	ForgotPassword(ctx context.Context, email string) error
+	// ResetPassword consumes a password reset token, sets the new password and revokes all sessions and access tokens.
+	ResetPassword(ctx context.Context, token, password string) error
+}
+
+type accountService struct {
+	repo         Repository
+	service      Service
+	tokenService TokenService
+	userService  User.Service
+	mailer       mailer.Mailer
+	appURL       string
+	logger       log.Logger
+}
+
+// NewAccountService creates a new account service.
+// The appURL is the base URL of the client application that the emailed links point to.
+func NewAccountService(repo Repository, service Service, tokenService TokenService, userService User.Service, mailer mailer.Mailer, appURL string, logger log.Logger) AccountService {
+	return accountService{repo, service, tokenService, userService, mailer, appURL, logger}
+}
+
+// SendEmailVerification emails a verification link to the given user.
+// Any link sent before stops working.
+func (s accountService) SendEmailVerification(ctx context.Context, user User.UserDefault) error {
+	if user.Email == "" || user.EmailVerifiedAt != nil {
+		return nil
+	}
+	token, err := s.createToken(ctx, user.ID, entity.UserTokenEmailVerification, emailVerificationExpiration)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %v,\n\nPlease confirm your email address by opening the link below:\n\n%v\n\nThe link expires in %v hours.\n",
+			user.Username, s.link("/verify-email", token), int(emailVerificationExpiration.Hours())),
+	})
+}
+
+// VerifyEmail consumes an email verification token and marks the email address as verified.
+func (s accountService) VerifyEmail(ctx context.Context, token string) (User.UserDefault, error) {
+	userToken, err := s.useToken(ctx, entity.UserTokenEmailVerification, token)
+	if err != nil {
+		return User.UserDefault{}, err
+	}
+	return s.userService.VerifyEmail(ctx, userToken.UserId)
+}
+
+// ForgotPassword emails a password reset link to the user with the given email.
+// Unknown emails are silently ignored so that the endpoint cannot be used to discover accounts.
+func (s accountService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userService.GetByEmail(ctx, email)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	token, err := s.createToken(ctx, user.ID, entity.UserTokenPasswordReset, passwordResetExpiration)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %v,\n\nSomeone asked to reset the password of your account. If it was you, open the link below:\n\n%v\n\nThe link expires in %v minutes. If you did not ask for it, you can ignore this email.\n",
+			user.Username, s.link("/reset-password", token), int(passwordResetExpiration.Minutes())),
+	})
+}
+
+// ResetPassword consumes a password reset token, sets the new password and revokes all sessions and personal
+// access tokens of the user.
+func (s accountService) ResetPassword(ctx context.Context, token, password string) error {
+	if err := User.ValidatePassword(password); err != nil {
+		return err
+	}
+	userToken, err := s.useToken(ctx, entity.UserTokenPasswordReset, token)
+	if err != nil {
+		return err
+	}
+	if err := s.userService.SetPassword(ctx, userToken.UserId, password); err != nil {
+		return err
+	}
+	if err := s.tokenService.RevokeAll(ctx, userToken.UserId); err != nil {
+		return err
+	}
+	return s.service.LogoutAll(ctx, userToken.UserId)
+}
+
+// createToken invalidates the previous tokens of the user with the same purpose and stores a new one.
+func (s accountService) createToken(ctx context.Context, userId, purpose string, expiration time.Duration) (string, error) {
+	now := time.Now()
+	if err := s.repo.InvalidateUserTokens(ctx, userId, purpose, now); err != nil {
+		return "", err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateUserToken(ctx, entity.UserToken{
+		ID:        entity.GenerateID(),
+		UserId:    userId,
+		Purpose:   purpose,
+		TokenHash: hashToken(secret),
+		ExpiresAt: now.Add(expiration),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	return secret, err
+}
+
+// useToken checks the token and marks it as used.
+func (s accountService) useToken(ctx context.Context, purpose, token string) (entity.UserToken, error) {
+	invalid := errors.BadRequest("The token is invalid or has expired.")
+	userToken, err := s.repo.GetUserTokenByHash(ctx, purpose, hashToken(token))
+	if err == sql.ErrNoRows {
+		return entity.UserToken{}, invalid
+	} else if err != nil {
+		return entity.UserToken{}, err
+	}
+	now := time.Now()
+	if now.After(userToken.ExpiresAt) {
+		return entity.UserToken{}, invalid
+	}
+	fresh, err := s.repo.MarkUserTokenUsed(ctx, userToken.ID, now)
+	if err != nil {
+		return entity.UserToken{}, err
+	}
+	if !fresh {
+		return entity.UserToken{}, invalid
+	}
+	return userToken, nil
+}
+
+// link builds a link to the given path of the client application carrying the token.
+func (s accountService) link(path, token string) string {
+	return s.appURL + path + "?token=" + url.QueryEscape(token)
+}
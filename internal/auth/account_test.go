@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/mailer"
+
+	"github.com/stretchr/testify/assert"
+
+	User "tribbie/internal/user"
+)
+
+var linkToken = regexp.MustCompile(`\?token=(\S+)`)
+
+// tokenFromMessage extracts the token from the link in an emailed message.
+func tokenFromMessage(t *testing.T, msg mailer.Message) string {
+	m := linkToken.FindStringSubmatch(msg.Body)
+	if !assert.Len(t, m, 2) {
+		t.FailNow()
+	}
+	token, _ := url.QueryUnescape(m[1])
+	return token
+}
+
+func Test_accountService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	users := &mockUserRepository{items: []entity.UserDefault{{ID: "100", Email: "test@example.com", Username: "test"}}}
+	userService := User.NewService(users, logger)
+	mail := mailer.NewMemory()
+	tokenService := NewTokenService(repo, logger)
+	s := NewAccountService(repo, NewService(testSigner(), 15, 720, nil, repo, logger), tokenService, userService, mail, "https://app.example.com", logger)
+	ctx := context.Background()
+
+	// email verification
+	user, _ := userService.Get(ctx, "100")
+	assert.Nil(t, s.SendEmailVerification(ctx, user))
+	if !assert.Len(t, mail.Messages(), 1) {
+		t.FailNow()
+	}
+	assert.Contains(t, mail.Messages()[0].Body, "https://app.example.com/verify-email?token=")
+	token := tokenFromMessage(t, mail.Messages()[0])
+	user, err := s.VerifyEmail(ctx, token)
+	assert.Nil(t, err)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	_, err = s.VerifyEmail(ctx, token)
+	assert.NotNil(t, err)
+
+	// unknown emails are ignored
+	assert.Nil(t, s.ForgotPassword(ctx, "unknown@example.com"))
+	assert.Len(t, mail.Messages(), 1)
+
+	// password reset; requesting a new link invalidates the previous one
+	accessToken, err := tokenService.Create(ctx, "100", CreateAccessTokenRequest{Name: "bank", Scope: entity.AccessTokenScopeRead})
+	assert.Nil(t, err)
+	assert.Nil(t, s.ForgotPassword(ctx, "test@example.com"))
+	first := tokenFromMessage(t, mail.Messages()[1])
+	assert.Nil(t, s.ForgotPassword(ctx, "test@example.com"))
+	second := tokenFromMessage(t, mail.Messages()[2])
+	assert.NotNil(t, s.ResetPassword(ctx, first, "new password"))
+	assert.NotNil(t, s.ResetPassword(ctx, second, "short"))
+	assert.Nil(t, s.ResetPassword(ctx, second, "new password"))
+	assert.NotNil(t, s.ResetPassword(ctx, second, "new password"))
+
+	_, err = userService.Authenticate(ctx, "test@example.com", "new password")
+	assert.Nil(t, err)
+	// the personal access tokens are revoked with the sessions
+	_, err = tokenService.Authenticate(ctx, accessToken.Token, "10.0.0.1")
+	assert.NotNil(t, err)
+	_, err = userService.Authenticate(ctx, "test@example.com", "old password")
+	assert.NotNil(t, err)
+}
+
+type mockUserRepository struct {
+	items []entity.UserDefault
+}
+
+func (m *mockUserRepository) Get(ctx context.Context, id string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockUserRepository) GetByEmail(ctx context.Context, email string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.Email == email {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockUserRepository) GetByUsername(ctx context.Context, username string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.Username == username {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockUserRepository) GetByAppleId(ctx context.Context, appleId string) (entity.UserDefault, error) {
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockUserRepository) GetByDeviceId(ctx context.Context, deviceId string) (entity.UserDefault, error) {
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockUserRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m *mockUserRepository) Query(ctx context.Context, offset, limit int) ([]entity.UserDefault, error) {
+	return m.items, nil
+}
+
+func (m *mockUserRepository) QueryByIds(ctx context.Context, ids []string) ([]entity.UserDefault, error) {
+	var items []entity.UserDefault
+	for _, item := range m.items {
+		for _, id := range ids {
+			if item.ID == id {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user entity.UserDefault) error {
+	m.items = append(m.items, user)
+	return nil
+}
+
+func (m *mockUserRepository) Update(ctx context.Context, user entity.UserDefault) error {
+	for i, item := range m.items {
+		if item.ID == user.ID {
+			m.items[i] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockUserRepository) Delete(ctx context.Context, id string) error {
+	return nil
+}
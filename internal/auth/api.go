@@ -1,8 +1,11 @@
 package auth
 
 import (
+	"database/sql"
+	"net/http"
 	"tribbie/internal/errors"
 	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
 
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 
@@ -15,11 +18,35 @@ type LoginResponse struct {
 }
 
 // RegisterHandlers registers handlers for different HTTP requests.
-func RegisterHandlers(rg *routing.RouteGroup, service Service, userService User.Service, logger log.Logger) {
+func RegisterHandlers(rg *routing.RouteGroup, service Service, accountService AccountService, tokenService TokenService, userService User.Service, authHandler routing.Handler, logger log.Logger) {
 	rg.Post("/login", login(service, userService, logger))
 	rg.Post("/login/apple", loginByApple(service, userService, logger))
 	rg.Post("/login/device", loginByDevice(service, userService, logger))
-	rg.Post("/register", register(service, userService, logger))
+	rg.Post("/register", register(accountService, userService, logger))
+	rg.Post("/token/refresh", refresh(service, logger))
+	rg.Post("/email/verify", verifyEmail(accountService, logger))
+	rg.Post("/password/forgot", forgotPassword(accountService, logger))
+	rg.Post("/password/reset", resetPassword(accountService, logger))
+
+	rg.Use(authHandler)
+
+	// the following endpoints require a valid JWT
+	rg.Post("/logout", requireSession, logout(service))
+	rg.Post("/logout/all", requireSession, logoutAll(service))
+	rg.Post("/email/verify/resend", resendEmailVerification(accountService, userService))
+
+	// personal access tokens can only be managed with a JWT
+	rg.Get("/me/tokens", requireSession, queryAccessTokens(tokenService))
+	rg.Post("/me/tokens", requireSession, createAccessToken(tokenService, logger))
+	rg.Delete("/me/tokens/<id>", requireSession, revokeAccessToken(tokenService))
+}
+
+// requireSession rejects requests authenticated with a personal access token.
+func requireSession(c *routing.Context) error {
+	if CurrentAccessToken(c.Request.Context()) != nil {
+		return errors.Forbidden("Personal access tokens cannot be used for this request.")
+	}
+	return nil
 }
 
 // login returns a handler that handles user login request.
@@ -35,49 +62,66 @@ func login(service Service, userService User.Service, logger log.Logger) routing
 			return errors.BadRequest("")
 		}
 
-		user, err := userService.GetByEmail(c.Request.Context(), req.Email)
+		user, err := userService.Authenticate(c.Request.Context(), req.Email, req.Password)
 		if err != nil {
 			return err
 		}
 
-		token, err := service.Login(c.Request.Context(), user.Email, user.Password)
+		tokens, err := service.Login(c.Request.Context(), user)
 		if err != nil {
 			return err
 		}
 
 		return c.Write(struct {
-			User  User.UserDefault `json:"user"`
-			Token string           `json:"token"`
-		}{user, token})
+			User User.UserDefault `json:"user"`
+			Tokens
+		}{user, tokens})
 	}
 }
 
-// login returns a handler that handles user login request.
+// loginByApple returns a handler that handles Sign in with Apple login requests.
+// The user is identified by the subject of the verified identity token and is created on first login.
 func loginByApple(service Service, userService User.Service, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
 		var req struct {
-			AppleId string `json:"apple_id"`
+			IdentityToken string `json:"identity_token"`
+			Nonce         string `json:"nonce"`
+			Username      string `json:"username"`
 		}
 
 		if err := c.Read(&req); err != nil {
 			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
 			return errors.BadRequest("")
 		}
+		if req.IdentityToken == "" || req.Nonce == "" {
+			return errors.BadRequest("identity_token and nonce are required")
+		}
 
-		user, err := userService.GetByAppleId(c.Request.Context(), req.AppleId)
+		claims, err := service.VerifyAppleIdentityToken(c.Request.Context(), req.IdentityToken, req.Nonce)
 		if err != nil {
 			return err
 		}
 
-		token, err := service.Login(c.Request.Context(), user.Email, user.Password)
+		user, err := userService.GetByAppleId(c.Request.Context(), claims.Subject)
+		if err == sql.ErrNoRows {
+			user, err = userService.CreateWithAppleId(c.Request.Context(), User.CreateUserRequest{
+				Email:    claims.Email,
+				Username: req.Username,
+			}, claims.Subject)
+		}
+		if err != nil {
+			return err
+		}
+
+		tokens, err := service.Login(c.Request.Context(), user)
 		if err != nil {
 			return err
 		}
 
 		return c.Write(struct {
-			User  User.UserDefault `json:"user"`
-			Token string           `json:"token"`
-		}{user, token})
+			User User.UserDefault `json:"user"`
+			Tokens
+		}{user, tokens})
 	}
 }
 
@@ -98,20 +142,21 @@ func loginByDevice(service Service, userService User.Service, logger log.Logger)
 			return err
 		}
 
-		token, err := service.Login(c.Request.Context(), user.Email, user.Password)
+		tokens, err := service.Login(c.Request.Context(), user)
 		if err != nil {
 			return err
 		}
 
 		return c.Write(struct {
-			User  User.UserDefault `json:"user"`
-			Token string           `json:"token"`
-		}{user, token})
+			User User.UserDefault `json:"user"`
+			Tokens
+		}{user, tokens})
 	}
 }
 
-// register returns a handler that handles user login request.
-func register(service Service, userService User.Service, logger log.Logger) routing.Handler {
+// register returns a handler that handles user registration requests.
+// A verification link is emailed to the new user.
+func register(accountService AccountService, userService User.Service, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
 		var req User.CreateUserRequest
 
@@ -120,11 +165,197 @@ func register(service Service, userService User.Service, logger log.Logger) rout
 			return errors.BadRequest("")
 		}
 
-		trip, err := userService.Create(c.Request.Context(), req)
+		user, err := userService.Create(c.Request.Context(), req)
+		if err != nil {
+			return err
+		}
+
+		if err := accountService.SendEmailVerification(c.Request.Context(), user); err != nil {
+			logger.With(c.Request.Context()).Errorf("failed to send email verification: %v", err)
+		}
+
+		return c.Write(user)
+	}
+}
+
+// refresh returns a handler that exchanges a refresh token for a new pair of tokens.
+func refresh(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		tokens, err := service.Refresh(c.Request.Context(), req.RefreshToken)
+		if err != nil {
+			return err
+		}
+
+		return c.Write(tokens)
+	}
+}
+
+// logout returns a handler that revokes the session of the current access token.
+func logout(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		if err := service.Logout(c.Request.Context(), CurrentSession(c.Request.Context())); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// logoutAll returns a handler that revokes every session of the current user.
+func logoutAll(service Service) routing.Handler {
+	return func(c *routing.Context) error {
+		identity := CurrentUserDefault(c.Request.Context())
+		if identity == nil {
+			return errors.Unauthorized("")
+		}
+		if err := service.LogoutAll(c.Request.Context(), identity.GetID()); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// verifyEmail returns a handler that consumes an email verification token.
+func verifyEmail(accountService AccountService, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Token string `json:"token"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		user, err := accountService.VerifyEmail(c.Request.Context(), req.Token)
 		if err != nil {
 			return err
 		}
 
-		return c.Write(trip)
+		return c.Write(user)
+	}
+}
+
+// resendEmailVerification returns a handler that emails a new verification link to the current user.
+func resendEmailVerification(accountService AccountService, userService User.Service) routing.Handler {
+	return func(c *routing.Context) error {
+		identity := CurrentUserDefault(c.Request.Context())
+		if identity == nil {
+			return errors.Unauthorized("")
+		}
+		user, err := userService.Get(c.Request.Context(), identity.GetID())
+		if err != nil {
+			return err
+		}
+		if err := accountService.SendEmailVerification(c.Request.Context(), user); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+// forgotPassword returns a handler that emails a password reset link.
+// It responds the same way whether or not the email belongs to a user.
+func forgotPassword(accountService AccountService, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := accountService.ForgotPassword(c.Request.Context(), req.Email); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusAccepted)
+		return nil
+	}
+}
+
+// resetPassword returns a handler that sets a new password using a password reset token.
+func resetPassword(accountService AccountService, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		if err := accountService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+			return err
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+// queryAccessTokens returns a handler that lists the personal access tokens of the current user.
+func queryAccessTokens(tokenService TokenService) routing.Handler {
+	return func(c *routing.Context) error {
+		identity := CurrentUserDefault(c.Request.Context())
+		if identity == nil {
+			return errors.Unauthorized("")
+		}
+		tokens, err := tokenService.Query(c.Request.Context(), identity.GetID())
+		if err != nil {
+			return err
+		}
+		pages := pagination.NewFromSlice(c.Request, tokens)
+		pages.SetLinkHeader(c.Response.Header(), c.Request)
+		return c.Write(pages)
+	}
+}
+
+// createAccessToken returns a handler that creates a personal access token for the current user.
+// The response is the only time the token is shown.
+func createAccessToken(tokenService TokenService, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		identity := CurrentUserDefault(c.Request.Context())
+		if identity == nil {
+			return errors.Unauthorized("")
+		}
+		var req CreateAccessTokenRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+		token, err := tokenService.Create(c.Request.Context(), identity.GetID(), req)
+		if err != nil {
+			return err
+		}
+		return c.WriteWithStatus(token, http.StatusCreated)
+	}
+}
+
+// revokeAccessToken returns a handler that revokes a personal access token of the current user.
+func revokeAccessToken(tokenService TokenService) routing.Handler {
+	return func(c *routing.Context) error {
+		identity := CurrentUserDefault(c.Request.Context())
+		if identity == nil {
+			return errors.Unauthorized("")
+		}
+		token, err := tokenService.Revoke(c.Request.Context(), identity.GetID(), c.Param("id"))
+		if err != nil {
+			return err
+		}
+		return c.Write(token)
 	}
 }
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// AppleIssuer is the issuer of the identity tokens produced by Sign in with Apple.
+	AppleIssuer = "https://appleid.apple.com"
+	// AppleKeysURL is the URL of the JWKS used by Apple to sign identity tokens.
+	AppleKeysURL = "https://appleid.apple.com/auth/keys"
+	// appleKeysMinRefresh limits how often an unknown key ID can force a JWKS refresh.
+	appleKeysMinRefresh = time.Minute
+)
+
+// AppleClaims represents the claims carried by a Sign in with Apple identity token.
+type AppleClaims struct {
+	jwt.StandardClaims
+	Email string `json:"email"`
+	Nonce string `json:"nonce"`
+}
+
+// AppleVerifier verifies Sign in with Apple identity tokens.
+type AppleVerifier interface {
+	// Verify validates the identity token and returns its claims.
+	// The nonce is the raw nonce the client generated before starting the sign in flow.
+	Verify(ctx context.Context, identityToken, nonce string) (AppleClaims, error)
+}
+
+// KeySource provides the RSA public keys, indexed by key ID, used to verify identity tokens.
+type KeySource interface {
+	// Keys returns the known keys. If refresh is true, the source should bypass any cached key set.
+	Keys(ctx context.Context, refresh bool) (map[string]*rsa.PublicKey, error)
+}
+
+// JWKSFetcher loads a raw JSON Web Key Set.
+type JWKSFetcher func(ctx context.Context) ([]byte, error)
+
+type appleVerifier struct {
+	keys     KeySource
+	clientID string
+}
+
+// NewAppleVerifier creates a verifier that accepts identity tokens issued by Apple for the given client ID.
+func NewAppleVerifier(keys KeySource, clientID string) AppleVerifier {
+	return appleVerifier{keys, clientID}
+}
+
+// Verify checks the signature, issuer, audience, expiration and nonce of the identity token.
+func (v appleVerifier) Verify(ctx context.Context, identityToken, nonce string) (AppleClaims, error) {
+	var claims AppleClaims
+	parser := &jwt.Parser{ValidMethods: []string{jwt.SigningMethodRS256.Alg()}}
+	_, err := parser.ParseWithClaims(identityToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	})
+	if err != nil {
+		return AppleClaims{}, err
+	}
+	if !claims.VerifyIssuer(AppleIssuer, true) {
+		return AppleClaims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if !claims.VerifyAudience(v.clientID, true) {
+		return AppleClaims{}, fmt.Errorf("unexpected audience %q", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return AppleClaims{}, fmt.Errorf("missing subject")
+	}
+	if claims.Nonce != HashNonce(nonce) {
+		return AppleClaims{}, fmt.Errorf("nonce mismatch")
+	}
+	return claims, nil
+}
+
+// key returns the public key with the given key ID, refreshing the key set once if it is not known yet.
+func (v appleVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	keys, err := v.keys.Keys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if keys, err = v.keys.Keys(ctx, true); err != nil {
+		return nil, err
+	}
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+// HashNonce returns the SHA-256 hex digest of the raw nonce, which is what Apple embeds in the identity token.
+func HashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+type cachedKeySource struct {
+	fetch     JWKSFetcher
+	ttl       time.Duration
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+// NewCachedKeySource creates a KeySource that loads keys through the given fetcher and caches them for ttl.
+func NewCachedKeySource(fetch JWKSFetcher, ttl time.Duration) KeySource {
+	return &cachedKeySource{fetch: fetch, ttl: ttl}
+}
+
+// Keys returns the cached key set, fetching it again if it has expired or a refresh is requested.
+func (s *cachedKeySource) Keys(ctx context.Context, refresh bool) (map[string]*rsa.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	age := time.Since(s.fetchedAt)
+	if s.keys != nil && age < s.ttl && (!refresh || age < appleKeysMinRefresh) {
+		return s.keys, nil
+	}
+	data, err := s.fetch(ctx)
+	if err != nil {
+		if s.keys != nil {
+			return s.keys, nil
+		}
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	s.keys, s.fetchedAt = keys, time.Now()
+	return keys, nil
+}
+
+// HTTPJWKSFetcher returns a JWKSFetcher that downloads the key set from the given URL.
+func HTTPJWKSFetcher(client *http.Client, url string) JWKSFetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %v fetching %v", res.StatusCode, url)
+		}
+		return ioutil.ReadAll(res.Body)
+	}
+}
+
+// FileJWKSFetcher returns a JWKSFetcher that reads the key set from a local file.
+func FileJWKSFetcher(path string) JWKSFetcher {
+	return func(ctx context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+}
+
+// ParseJWKS parses the RSA keys out of a JSON Web Key Set.
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %v", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %v", k.Kid, err)
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
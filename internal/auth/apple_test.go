@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJWKS(t *testing.T, kid string, key *rsa.PrivateKey) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	assert.Nil(t, err)
+	return data
+}
+
+func newAppleToken(t *testing.T, kid string, key *rsa.PrivateKey, claims AppleClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	assert.Nil(t, err)
+	return s
+}
+
+func TestAppleVerifier_Verify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	jwks := newTestJWKS(t, "key1", key)
+	keys := NewCachedKeySource(func(ctx context.Context) ([]byte, error) { return jwks, nil }, time.Hour)
+	v := NewAppleVerifier(keys, "com.tribbie.app")
+
+	valid := func() AppleClaims {
+		return AppleClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    AppleIssuer,
+				Audience:  "com.tribbie.app",
+				Subject:   "001234.abcd",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				IssuedAt:  time.Now().Unix(),
+			},
+			Email: "test@example.com",
+			Nonce: HashNonce("raw-nonce"),
+		}
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr bool
+	}{
+		{"valid", func() string { return newAppleToken(t, "key1", key, valid()) }, "raw-nonce", false},
+		{"wrong nonce", func() string { return newAppleToken(t, "key1", key, valid()) }, "other-nonce", true},
+		{"wrong signature", func() string { return newAppleToken(t, "key1", other, valid()) }, "raw-nonce", true},
+		{"unknown kid", func() string { return newAppleToken(t, "key2", key, valid()) }, "raw-nonce", true},
+		{"wrong issuer", func() string {
+			c := valid()
+			c.Issuer = "https://example.com"
+			return newAppleToken(t, "key1", key, c)
+		}, "raw-nonce", true},
+		{"wrong audience", func() string {
+			c := valid()
+			c.Audience = "com.example.other"
+			return newAppleToken(t, "key1", key, c)
+		}, "raw-nonce", true},
+		{"expired", func() string {
+			c := valid()
+			c.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+			return newAppleToken(t, "key1", key, c)
+		}, "raw-nonce", true},
+		{"malformed", func() string { return "not-a-token" }, "raw-nonce", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), tt.token(), tt.nonce)
+			assert.Equal(t, tt.wantErr, err != nil)
+			if !tt.wantErr {
+				assert.Equal(t, "001234.abcd", claims.Subject)
+				assert.Equal(t, "test@example.com", claims.Email)
+			}
+		})
+	}
+}
+
+func TestCachedKeySource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	jwks := newTestJWKS(t, "key1", key)
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		_, _ = w.Write(jwks)
+	}))
+	defer server.Close()
+
+	s := NewCachedKeySource(HTTPJWKSFetcher(server.Client(), server.URL), time.Hour)
+	ctx := context.Background()
+
+	keys, err := s.Keys(ctx, false)
+	assert.Nil(t, err)
+	if assert.Contains(t, keys, "key1") {
+		assert.Equal(t, key.PublicKey.N, keys["key1"].N)
+		assert.Equal(t, key.PublicKey.E, keys["key1"].E)
+	}
+
+	// served from cache, including forced refreshes within the minimum refresh interval
+	_, _ = s.Keys(ctx, false)
+	_, _ = s.Keys(ctx, true)
+	assert.Equal(t, 1, hits)
+}
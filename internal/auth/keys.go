@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultKeyID is the ID of the key built from the legacy jwt_signing_key setting.
+// Tokens without a "kid" header are verified with this key.
+const DefaultKeyID = "default"
+
+// Claims represents the claims carried by an access token.
+// The subject is the user ID.
+type Claims struct {
+	jwt.StandardClaims
+	SessionId string `json:"sid"`
+}
+
+// Key represents a key used to sign and/or verify access tokens.
+// A retired key only needs its verification key so that tokens signed before the rotation remain valid.
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// NewHMACKey creates an HS256 key from a shared secret.
+func NewHMACKey(id, secret string) Key {
+	return Key{id, jwt.SigningMethodHS256, []byte(secret), []byte(secret)}
+}
+
+// LoadKey creates a key of the given algorithm. HS256 keys use the secret, while
+// RS256 and EdDSA keys are read from PEM files. The private key file may be omitted for retired keys.
+func LoadKey(id, algorithm, secret, privateKeyFile, publicKeyFile string) (Key, error) {
+	switch algorithm {
+	case "", jwt.SigningMethodHS256.Alg():
+		if secret == "" {
+			return Key{}, fmt.Errorf("key %q: secret is required", id)
+		}
+		return NewHMACKey(id, secret), nil
+	case jwt.SigningMethodRS256.Alg():
+		key := Key{ID: id, Method: jwt.SigningMethodRS256}
+		if privateKeyFile != "" {
+			data, err := ioutil.ReadFile(privateKeyFile)
+			if err != nil {
+				return Key{}, err
+			}
+			private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: %v", id, err)
+			}
+			key.SignKey, key.VerifyKey = private, &private.PublicKey
+		}
+		if publicKeyFile != "" {
+			data, err := ioutil.ReadFile(publicKeyFile)
+			if err != nil {
+				return Key{}, err
+			}
+			if key.VerifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+				return Key{}, fmt.Errorf("key %q: %v", id, err)
+			}
+		}
+		if key.VerifyKey == nil {
+			return Key{}, fmt.Errorf("key %q: a private or public key file is required", id)
+		}
+		return key, nil
+	case SigningMethodEdDSA.Alg():
+		key := Key{ID: id, Method: SigningMethodEdDSA}
+		if privateKeyFile != "" {
+			parsed, err := parsePEMFile(privateKeyFile, x509.ParsePKCS8PrivateKey)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: %v", id, err)
+			}
+			private, ok := parsed.(ed25519.PrivateKey)
+			if !ok {
+				return Key{}, fmt.Errorf("key %q: not an Ed25519 private key", id)
+			}
+			key.SignKey, key.VerifyKey = private, private.Public()
+		}
+		if publicKeyFile != "" {
+			parsed, err := parsePEMFile(publicKeyFile, x509.ParsePKIXPublicKey)
+			if err != nil {
+				return Key{}, fmt.Errorf("key %q: %v", id, err)
+			}
+			public, ok := parsed.(ed25519.PublicKey)
+			if !ok {
+				return Key{}, fmt.Errorf("key %q: not an Ed25519 public key", id)
+			}
+			key.VerifyKey = public
+		}
+		if key.VerifyKey == nil {
+			return Key{}, fmt.Errorf("key %q: a private or public key file is required", id)
+		}
+		return key, nil
+	}
+	return Key{}, fmt.Errorf("key %q: unsupported algorithm %q", id, algorithm)
+}
+
+// parsePEMFile decodes the first PEM block of a file with the given parser.
+func parsePEMFile(file string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %v", file)
+	}
+	return parse(block.Bytes)
+}
+
+// Signer signs and verifies access tokens. New tokens are signed with the active key,
+// while tokens are verified with whichever known key their "kid" header refers to.
+type Signer struct {
+	issuer   string
+	audience string
+	active   Key
+	keys     map[string]Key
+}
+
+// NewSigner creates a new Signer. The active key must be one of the given keys and must be able to sign.
+func NewSigner(issuer, audience, activeKeyID string, keys ...Key) (*Signer, error) {
+	s := &Signer{issuer: issuer, audience: audience, keys: map[string]Key{}}
+	for _, key := range keys {
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID %q", key.ID)
+		}
+		s.keys[key.ID] = key
+	}
+	active, ok := s.keys[activeKeyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown active key ID %q", activeKeyID)
+	}
+	if active.SignKey == nil {
+		return nil, fmt.Errorf("active key %q cannot sign tokens", activeKeyID)
+	}
+	s.active = active
+	return s, nil
+}
+
+// Sign fills in the issuer and audience of the claims and signs them with the active key.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	claims.Issuer = s.issuer
+	claims.Audience = s.audience
+	token := jwt.NewWithClaims(s.active.Method, claims)
+	token.Header["kid"] = s.active.ID
+	return token.SignedString(s.active.SignKey)
+}
+
+// Verify parses the token, checks its signature, expiration, issuer and audience, and returns its claims.
+func (s *Signer) Verify(token string) (Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			kid = DefaultKeyID
+		}
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key ID %q", kid)
+		}
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for key %q", t.Method.Alg(), kid)
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return Claims{}, err
+	}
+	if s.issuer != "" && !claims.VerifyIssuer(s.issuer, true) {
+		return Claims{}, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if s.audience != "" && !claims.VerifyAudience(s.audience, true) {
+		return Claims{}, fmt.Errorf("unexpected audience %q", claims.Audience)
+	}
+	if claims.Subject == "" {
+		return Claims{}, fmt.Errorf("missing subject")
+	}
+	return claims, nil
+}
+
+// SigningMethodEdDSA implements the EdDSA (Ed25519) signing method, which jwt-go does not provide.
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+type signingMethodEdDSA struct{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// Alg returns the name of the signing method.
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+// Verify checks the signature of the signing string with an ed25519.PublicKey.
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(public, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign signs the signing string with an ed25519.PrivateKey.
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(private, []byte(signingString))), nil
+}
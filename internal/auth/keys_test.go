@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// testSigner returns a signer with a single HS256 key.
+func testSigner() *Signer {
+	signer, _ := NewSigner("tribbie", "tribbie", DefaultKeyID, NewHMACKey(DefaultKeyID, "test"))
+	return signer
+}
+
+func testClaims() Claims {
+	return Claims{
+		StandardClaims: jwt.StandardClaims{Subject: "100", ExpiresAt: time.Now().Add(time.Minute).Unix()},
+		SessionId:      "s1",
+	}
+}
+
+func TestSigner_Rotation(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	old := testSigner()
+	token, err := old.Sign(testClaims())
+	assert.Nil(t, err)
+
+	// the new active key is EdDSA while the old HS256 key is kept for verification
+	rotated, err := NewSigner("tribbie", "tribbie", "2026-10",
+		NewHMACKey(DefaultKeyID, "test"),
+		Key{ID: "2026-10", Method: SigningMethodEdDSA, SignKey: private, VerifyKey: public},
+	)
+	assert.Nil(t, err)
+	claims, err := rotated.Verify(token)
+	assert.Nil(t, err)
+	assert.Equal(t, "100", claims.Subject)
+	assert.Equal(t, "s1", claims.SessionId)
+
+	token, err = rotated.Sign(testClaims())
+	assert.Nil(t, err)
+	_, err = rotated.Verify(token)
+	assert.Nil(t, err)
+	_, err = old.Verify(token)
+	assert.NotNil(t, err)
+}
+
+func TestSigner_Verify(t *testing.T) {
+	s := testSigner()
+	other, _ := NewSigner("tribbie", "other", DefaultKeyID, NewHMACKey(DefaultKeyID, "test"))
+	wrongKey, _ := NewSigner("tribbie", "tribbie", DefaultKeyID, NewHMACKey(DefaultKeyID, "other"))
+	expired := testClaims()
+	expired.ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	noSubject := testClaims()
+	noSubject.Subject = ""
+
+	sign := func(s *Signer, claims Claims) string {
+		token, _ := s.Sign(claims)
+		return token
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", sign(s, testClaims()), false},
+		{"wrong audience", sign(other, testClaims()), true},
+		{"wrong key", sign(wrongKey, testClaims()), true},
+		{"expired", sign(s, expired), true},
+		{"no subject", sign(s, noSubject), true},
+		{"malformed", "abc", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Verify(tt.token)
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	_, err := NewSigner("", "", "unknown", NewHMACKey(DefaultKeyID, "test"))
+	assert.NotNil(t, err)
+	_, err = NewSigner("", "", DefaultKeyID, NewHMACKey(DefaultKeyID, "a"), NewHMACKey(DefaultKeyID, "b"))
+	assert.NotNil(t, err)
+	_, err = LoadKey("k", "RS256", "", "", "")
+	assert.NotNil(t, err)
+	_, err = LoadKey("k", "none", "", "", "")
+	assert.NotNil(t, err)
+}
@@ -2,35 +2,163 @@ package auth
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"tribbie/internal/entity"
 	"tribbie/internal/errors"
+	"tribbie/pkg/log"
 
-	"github.com/dgrijalva/jwt-go"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
-	"github.com/go-ozzo/ozzo-routing/v2/auth"
 )
 
-// Handler returns a JWT-based authentication middleware.
-func Handler(verificationKey string) routing.Handler {
-	return auth.JWT(verificationKey, auth.JWTOptions{TokenHandler: handleToken})
+// Handler returns an authentication middleware accepting both JWTs and personal access tokens.
+// A JWT is verified with the key its "kid" header refers to, and JWTs whose session has been
+// revoked are rejected. A personal access token is rejected if its scope does not allow the request.
+// The X-Forwarded-For header is only honored for requests coming from one of the trusted proxies.
+func Handler(signer *Signer, service Service, tokenService TokenService, trustedProxies []*net.IPNet, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		header := c.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			return unauthorized(c, "")
+		}
+		if strings.HasPrefix(header[7:], AccessTokenPrefix) {
+			return handleAccessToken(c, tokenService, header[7:], trustedProxies)
+		}
+		claims, err := signer.Verify(header[7:])
+		if err != nil {
+			return unauthorized(c, err.Error())
+		}
+
+		active, err := service.IsSessionActive(c.Request.Context(), claims.SessionId)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("failed to check session: %v", err)
+			return errors.InternalServerError("")
+		}
+		if !active {
+			return unauthorized(c, "The session has been revoked.")
+		}
+
+		ctx := WithUserDefault(c.Request.Context(), claims.Subject, "")
+		ctx = WithSession(ctx, claims.SessionId)
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
 }
 
-// handleToken stores the user identity in the request context so that it can be accessed elsewhere.
-func handleToken(c *routing.Context, token *jwt.Token) error {
-	ctx := WithUserDefault(
-		c.Request.Context(),
-		token.Claims.(jwt.MapClaims)["id"].(string),
-		token.Claims.(jwt.MapClaims)["name"].(string),
-	)
+// handleAccessToken authenticates the request with a personal access token.
+func handleAccessToken(c *routing.Context, tokenService TokenService, token string, trustedProxies []*net.IPNet) error {
+	accessToken, err := tokenService.Authenticate(c.Request.Context(), token, clientIP(c.Request, trustedProxies))
+	if err != nil {
+		if _, ok := err.(errors.ErrorResponse); ok {
+			c.Response.Header().Set("WWW-Authenticate", `Bearer realm="API"`)
+		}
+		return err
+	}
+	if !scopeAllows(accessToken, c.Request) {
+		return errors.Forbidden("The access token scope does not allow this request.")
+	}
+	ctx := WithUserDefault(c.Request.Context(), accessToken.UserId, "")
+	ctx = WithAccessToken(ctx, accessToken)
 	c.Request = c.Request.WithContext(ctx)
 	return nil
 }
 
+// scopeAllows returns whether the scope of the access token allows the request.
+// Read-only tokens allow safe methods only, and trip tokens allow requests under /trips/<id> of their trip only.
+func scopeAllows(token entity.AccessToken, req *http.Request) bool {
+	switch token.Scope {
+	case entity.AccessTokenScopeWrite:
+		return true
+	case entity.AccessTokenScopeRead:
+		return req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+	case entity.AccessTokenScopeTrip:
+		segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+		for i := 0; i+1 < len(segments); i++ {
+			if segments[i] == "trips" {
+				return segments[i+1] == token.TripId
+			}
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies parses the IP addresses and CIDR ranges of the trusted reverse proxies.
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", proxy, err)
+		}
+		result = append(result, network)
+	}
+	return result, nil
+}
+
+// clientIP returns the IP address of the client. The X-Forwarded-For header is only honored when the request comes
+// from a trusted proxy, in which case the client is the last address in the header that is not a trusted proxy.
+func clientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	ip := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !isTrusted(ip, trustedProxies) {
+		return ip
+	}
+	forwarded := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		ip = hop
+		if !isTrusted(hop, trustedProxies) {
+			break
+		}
+	}
+	return ip
+}
+
+// isTrusted tells whether the IP address belongs to a trusted proxy.
+func isTrusted(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// unauthorized asks the client to authenticate with a bearer token.
+func unauthorized(c *routing.Context, msg string) error {
+	c.Response.Header().Set("WWW-Authenticate", `Bearer realm="API"`)
+	return errors.Unauthorized(msg)
+}
+
 type contextKey int
 
 const (
 	userKey contextKey = iota
+	sessionKey
+	accessTokenKey
 )
 
 // WithUser returns a context that contains the user identity from the given JWT.
@@ -47,6 +175,32 @@ func CurrentUserDefault(ctx context.Context) Identity {
 	return nil
 }
 
+// WithSession returns a context that contains the ID of the session the request was authenticated with.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// CurrentSession returns the session ID from the given context.
+// An empty string is returned if no session is found in the context.
+func CurrentSession(ctx context.Context) string {
+	id, _ := ctx.Value(sessionKey).(string)
+	return id
+}
+
+// WithAccessToken returns a context that contains the personal access token the request was authenticated with.
+func WithAccessToken(ctx context.Context, token entity.AccessToken) context.Context {
+	return context.WithValue(ctx, accessTokenKey, token)
+}
+
+// CurrentAccessToken returns the personal access token from the given context.
+// Nil is returned if the request was not authenticated with a personal access token.
+func CurrentAccessToken(ctx context.Context) *entity.AccessToken {
+	if token, ok := ctx.Value(accessTokenKey).(entity.AccessToken); ok {
+		return &token
+	}
+	return nil
+}
+
 // MockAuthHandler creates a mock authentication middleware for testing purpose.
 // If the request contains an Authorization header whose value is "TEST", then
 // it considers the user is authenticated as "Tester" whose ID is "100".
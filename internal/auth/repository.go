@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access sessions, refresh tokens, user tokens and access tokens from the data source.
+type Repository interface {
+	// GetSession returns the session with the specified ID.
+	GetSession(ctx context.Context, id string) (entity.Session, error)
+	// CreateSession saves a new session in the storage.
+	CreateSession(ctx context.Context, session entity.Session) error
+	// RevokeSession marks the session with the specified ID as revoked.
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	// RevokeUserSessions marks every active session of the specified user as revoked.
+	RevokeUserSessions(ctx context.Context, userId string, at time.Time) error
+	// GetRefreshTokenByHash returns the refresh token with the specified hash.
+	GetRefreshTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error)
+	// CreateRefreshToken saves a new refresh token in the storage.
+	CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error
+	// MarkRefreshTokenUsed marks the refresh token as used.
+	// It returns false if the token had already been used.
+	MarkRefreshTokenUsed(ctx context.Context, id string, at time.Time) (bool, error)
+	// GetUserTokenByHash returns the user token with the specified purpose and hash.
+	GetUserTokenByHash(ctx context.Context, purpose, hash string) (entity.UserToken, error)
+	// CreateUserToken saves a new user token in the storage.
+	CreateUserToken(ctx context.Context, token entity.UserToken) error
+	// MarkUserTokenUsed marks the user token as used.
+	// It returns false if the token had already been used.
+	MarkUserTokenUsed(ctx context.Context, id string, at time.Time) (bool, error)
+	// InvalidateUserTokens marks every unused token of the user with the given purpose as used.
+	InvalidateUserTokens(ctx context.Context, userId, purpose string, at time.Time) error
+	// GetAccessToken returns the access token with the specified ID.
+	GetAccessToken(ctx context.Context, id string) (entity.AccessToken, error)
+	// GetAccessTokenByHash returns the access token with the specified hash.
+	GetAccessTokenByHash(ctx context.Context, hash string) (entity.AccessToken, error)
+	// QueryAccessTokens returns the access tokens of the specified user, newest first.
+	QueryAccessTokens(ctx context.Context, userId string) ([]entity.AccessToken, error)
+	// CreateAccessToken saves a new access token in the storage.
+	CreateAccessToken(ctx context.Context, token entity.AccessToken) error
+	// RevokeAccessToken marks the access token with the specified ID as revoked.
+	RevokeAccessToken(ctx context.Context, id string, at time.Time) error
+	// RevokeUserAccessTokens marks every active access token of the specified user as revoked.
+	RevokeUserAccessTokens(ctx context.Context, userId string, at time.Time) error
+	// TouchAccessToken records when and from which IP address the access token was last used.
+	TouchAccessToken(ctx context.Context, id string, at time.Time, ip string) error
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+}
+
+// repository persists sessions, refresh tokens, user tokens and access tokens in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new auth repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetSession reads the session with the specified ID from the database.
+func (r repository) GetSession(ctx context.Context, id string) (entity.Session, error) {
+	var session entity.Session
+	err := r.db.With(ctx).Select().Model(id, &session)
+	return session, err
+}
+
+// CreateSession saves a new session record in the database.
+func (r repository) CreateSession(ctx context.Context, session entity.Session) error {
+	return r.db.With(ctx).Model(&session).Insert()
+}
+
+// RevokeSession marks the session with the specified ID as revoked.
+func (r repository) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("session",
+		dbx.Params{"revoked_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// RevokeUserSessions marks every active session of the specified user as revoked.
+func (r repository) RevokeUserSessions(ctx context.Context, userId string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("session",
+		dbx.Params{"revoked_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"user_id": userId}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// GetRefreshTokenByHash reads the refresh token with the specified hash from the database.
+func (r repository) GetRefreshTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"token_hash": hash}).One(&token)
+	return token, err
+}
+
+// CreateRefreshToken saves a new refresh token record in the database.
+func (r repository) CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	return r.db.With(ctx).Model(&token).Insert()
+}
+
+// MarkRefreshTokenUsed marks the refresh token as used unless another request already did so.
+func (r repository) MarkRefreshTokenUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.With(ctx).Update("refresh_token",
+		dbx.Params{"used_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("used_at IS NULL")),
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// GetUserTokenByHash reads the user token with the specified purpose and hash from the database.
+func (r repository) GetUserTokenByHash(ctx context.Context, purpose, hash string) (entity.UserToken, error) {
+	var token entity.UserToken
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"purpose": purpose, "token_hash": hash}).One(&token)
+	return token, err
+}
+
+// CreateUserToken saves a new user token record in the database.
+func (r repository) CreateUserToken(ctx context.Context, token entity.UserToken) error {
+	return r.db.With(ctx).Model(&token).Insert()
+}
+
+// MarkUserTokenUsed marks the user token as used unless another request already did so.
+func (r repository) MarkUserTokenUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	res, err := r.db.With(ctx).Update("user_token",
+		dbx.Params{"used_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("used_at IS NULL")),
+	).Execute()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// InvalidateUserTokens marks every unused token of the user with the given purpose as used.
+func (r repository) InvalidateUserTokens(ctx context.Context, userId, purpose string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("user_token",
+		dbx.Params{"used_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"user_id": userId, "purpose": purpose}, dbx.NewExp("used_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// GetAccessToken reads the access token with the specified ID from the database.
+func (r repository) GetAccessToken(ctx context.Context, id string) (entity.AccessToken, error) {
+	var token entity.AccessToken
+	err := r.db.With(ctx).Select().Model(id, &token)
+	return token, err
+}
+
+// GetAccessTokenByHash reads the access token with the specified hash from the database.
+func (r repository) GetAccessTokenByHash(ctx context.Context, hash string) (entity.AccessToken, error) {
+	var token entity.AccessToken
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"token_hash": hash}).One(&token)
+	return token, err
+}
+
+// QueryAccessTokens retrieves the access tokens of the specified user from the database.
+func (r repository) QueryAccessTokens(ctx context.Context, userId string) ([]entity.AccessToken, error) {
+	var tokens []entity.AccessToken
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userId}).
+		OrderBy("created_at DESC").
+		All(&tokens)
+	return tokens, err
+}
+
+// CreateAccessToken saves a new access token record in the database.
+func (r repository) CreateAccessToken(ctx context.Context, token entity.AccessToken) error {
+	return r.db.With(ctx).Model(&token).Insert()
+}
+
+// RevokeAccessToken marks the access token with the specified ID as revoked.
+func (r repository) RevokeAccessToken(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("access_token",
+		dbx.Params{"revoked_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"id": id}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// RevokeUserAccessTokens marks every active access token of the specified user as revoked.
+func (r repository) RevokeUserAccessTokens(ctx context.Context, userId string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("access_token",
+		dbx.Params{"revoked_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"user_id": userId}, dbx.NewExp("revoked_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// TouchAccessToken records when and from which IP address the access token was last used.
+func (r repository) TouchAccessToken(ctx context.Context, id string, at time.Time, ip string) error {
+	_, err := r.db.With(ctx).Update("access_token",
+		dbx.Params{"last_used_at": at, "last_used_ip": ip},
+		dbx.HashExp{"id": id},
+	).Execute()
+	return err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
@@ -2,8 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"time"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
 	"tribbie/pkg/log"
 
 	"github.com/dgrijalva/jwt-go"
@@ -11,19 +17,36 @@ import (
 
 // Service encapsulates the authentication logic.
 type Service interface {
-	Login(ctx context.Context, email, password string) (string, error)
+	// Login starts a new session for the given identity and returns its tokens.
+	Login(ctx context.Context, identity Identity) (Tokens, error)
+	// Refresh rotates the given refresh token and returns a new pair of tokens for the same session.
+	Refresh(ctx context.Context, refreshToken string) (Tokens, error)
+	// Logout revokes the session with the specified ID.
+	Logout(ctx context.Context, sessionId string) error
+	// LogoutAll revokes every session of the specified user.
+	LogoutAll(ctx context.Context, userId string) error
+	// IsSessionActive tells whether the session with the specified ID may still be used.
+	IsSessionActive(ctx context.Context, sessionId string) (bool, error)
+	// VerifyAppleIdentityToken validates a Sign in with Apple identity token and returns its claims.
+	VerifyAppleIdentityToken(ctx context.Context, identityToken, nonce string) (AppleClaims, error)
 }
 
 type RegisterRequest struct {
 	Email       string `json:"email"`
-	Username    string `json:"email"`
+	Username    string `json:"username"`
 	Password    string `json:"password"`
-	AppleId     string `json:"apple_id"`
 	DeviceId    string `json:"device_id"`
 	Description string `json:"description"`
 	UserPaidId  string `json:"user_paid_id"`
 }
 
+// Tokens represents the credentials issued when a session is started or refreshed.
+type Tokens struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
 // Identity represents an authenticated user identity.
 type Identity interface {
 	// GetID returns the user ID.
@@ -33,29 +56,148 @@ type Identity interface {
 }
 
 type service struct {
-	signingKey      string
-	tokenExpiration int
-	logger          log.Logger
+	signer                 *Signer
+	accessTokenExpiration  int
+	refreshTokenExpiration int
+	appleVerifier          AppleVerifier
+	repo                   Repository
+	logger                 log.Logger
 }
 
 // NewService creates a new authentication service.
-func NewService(signingKey string, tokenExpiration int, logger log.Logger) Service {
-	return service{signingKey, tokenExpiration, logger}
+// The access token expiration is given in minutes and the refresh token expiration in hours.
+func NewService(signer *Signer, accessTokenExpiration, refreshTokenExpiration int, appleVerifier AppleVerifier, repo Repository, logger log.Logger) Service {
+	return service{signer, accessTokenExpiration, refreshTokenExpiration, appleVerifier, repo, logger}
+}
+
+// Login starts a new session for the given identity and returns its tokens.
+func (s service) Login(ctx context.Context, identity Identity) (Tokens, error) {
+	now := time.Now()
+	session := entity.Session{
+		ID:        entity.GenerateID(),
+		UserId:    identity.GetID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return Tokens{}, err
+	}
+	return s.issueTokens(ctx, session, now)
+}
+
+// Refresh rotates the given refresh token and returns a new pair of tokens for the same session.
+// Presenting a refresh token that has already been rotated revokes the whole session,
+// since it means the token has been leaked to another party.
+func (s service) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	token, err := s.repo.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err == sql.ErrNoRows {
+		return Tokens{}, errors.Unauthorized("")
+	} else if err != nil {
+		return Tokens{}, err
+	}
+	session, err := s.repo.GetSession(ctx, token.SessionId)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	now := time.Now()
+	if !session.IsActive() || now.After(token.ExpiresAt) {
+		return Tokens{}, errors.Unauthorized("")
+	}
+	fresh, err := s.repo.MarkRefreshTokenUsed(ctx, token.ID, now)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if !fresh {
+		s.logger.With(ctx, "session_id", session.ID).Info("refresh token reuse detected, revoking session")
+		if err := s.repo.RevokeSession(ctx, session.ID, now); err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, errors.Unauthorized("")
+	}
+	return s.issueTokens(ctx, session, now)
+}
+
+// Logout revokes the session with the specified ID.
+func (s service) Logout(ctx context.Context, sessionId string) error {
+	return s.repo.RevokeSession(ctx, sessionId, time.Now())
+}
+
+// LogoutAll revokes every session of the specified user.
+func (s service) LogoutAll(ctx context.Context, userId string) error {
+	return s.repo.RevokeUserSessions(ctx, userId, time.Now())
+}
+
+// IsSessionActive tells whether the session with the specified ID exists and has not been revoked.
+func (s service) IsSessionActive(ctx context.Context, sessionId string) (bool, error) {
+	session, err := s.repo.GetSession(ctx, sessionId)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return session.IsActive(), nil
+}
+
+// VerifyAppleIdentityToken validates a Sign in with Apple identity token and returns its claims.
+// An Unauthorized error is returned if the token cannot be trusted.
+func (s service) VerifyAppleIdentityToken(ctx context.Context, identityToken, nonce string) (AppleClaims, error) {
+	claims, err := s.appleVerifier.Verify(ctx, identityToken, nonce)
+	if err != nil {
+		s.logger.With(ctx).Infof("Apple identity token rejected: %v", err)
+		return AppleClaims{}, errors.Unauthorized("")
+	}
+	return claims, nil
 }
 
-func (s service) Login(ctx context.Context, email, password string) (string, error) {
-	identity := s.authenticate(ctx, email, password)
-	return s.generateJWT(identity)
+// issueTokens creates a new refresh token in the session together with a short-lived access token.
+func (s service) issueTokens(ctx context.Context, session entity.Session, now time.Time) (Tokens, error) {
+	secret, err := generateSecret()
+	if err != nil {
+		return Tokens{}, err
+	}
+	err = s.repo.CreateRefreshToken(ctx, entity.RefreshToken{
+		ID:        entity.GenerateID(),
+		SessionId: session.ID,
+		UserId:    session.UserId,
+		TokenHash: hashToken(secret),
+		ExpiresAt: now.Add(time.Duration(s.refreshTokenExpiration) * time.Hour),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	expiration := time.Duration(s.accessTokenExpiration) * time.Minute
+	accessToken, err := s.signer.Sign(Claims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   session.UserId,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(expiration).Unix(),
+		},
+		SessionId: session.ID,
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: secret,
+		ExpiresIn:    int(expiration.Seconds()),
+	}, nil
 }
 
-func (s service) authenticate(ctx context.Context, email, password string) Identity {
-	return entity.UserDefault{ID: email, Email: email}
+// generateSecret returns a random URL-safe string suitable for use as an opaque token.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func (s service) generateJWT(identity Identity) (string, error) {
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":    identity.GetID(),
-		"email": identity.GetEmail(),
-		"exp":   time.Now().Add(time.Duration(s.tokenExpiration) * time.Hour).Unix(),
-	}).SignedString([]byte(s.signingKey))
+// hashToken returns the SHA-256 hex digest under which an opaque token is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
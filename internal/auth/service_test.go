@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_Refresh(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(testSigner(), 15, 720, nil, repo, logger)
+	ctx := context.Background()
+
+	tokens, err := s.Login(ctx, entity.UserDefault{ID: "100"})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, 900, tokens.ExpiresIn)
+	sessionId := repo.sessions[0].ID
+
+	// rotation
+	rotated, err := s.Refresh(ctx, tokens.RefreshToken)
+	assert.Nil(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+	active, _ := s.IsSessionActive(ctx, sessionId)
+	assert.True(t, active)
+
+	// unknown token
+	_, err = s.Refresh(ctx, "unknown")
+	assert.NotNil(t, err)
+
+	// reuse of a rotated token revokes the whole family
+	_, err = s.Refresh(ctx, tokens.RefreshToken)
+	assert.NotNil(t, err)
+	active, _ = s.IsSessionActive(ctx, sessionId)
+	assert.False(t, active)
+	_, err = s.Refresh(ctx, rotated.RefreshToken)
+	assert.NotNil(t, err)
+
+	// logout all devices
+	_, _ = s.Login(ctx, entity.UserDefault{ID: "100"})
+	_, _ = s.Login(ctx, entity.UserDefault{ID: "100"})
+	assert.Nil(t, s.LogoutAll(ctx, "100"))
+	for _, session := range repo.sessions {
+		assert.False(t, session.IsActive())
+	}
+}
+
+type mockRepository struct {
+	sessions   []entity.Session
+	tokens     []entity.RefreshToken
+	userTokens []entity.UserToken
+	access     []entity.AccessToken
+	members    []entity.TripMember
+}
+
+func (m *mockRepository) GetSession(ctx context.Context, id string) (entity.Session, error) {
+	for _, session := range m.sessions {
+		if session.ID == id {
+			return session, nil
+		}
+	}
+	return entity.Session{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateSession(ctx context.Context, session entity.Session) error {
+	m.sessions = append(m.sessions, session)
+	return nil
+}
+
+func (m *mockRepository) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	for i, session := range m.sessions {
+		if session.ID == id && session.RevokedAt == nil {
+			m.sessions[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeUserSessions(ctx context.Context, userId string, at time.Time) error {
+	for i, session := range m.sessions {
+		if session.UserId == userId && session.RevokedAt == nil {
+			m.sessions[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) GetRefreshTokenByHash(ctx context.Context, hash string) (entity.RefreshToken, error) {
+	for _, token := range m.tokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return entity.RefreshToken{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateRefreshToken(ctx context.Context, token entity.RefreshToken) error {
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockRepository) MarkRefreshTokenUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	for i, token := range m.tokens {
+		if token.ID == id && token.UsedAt == nil {
+			m.tokens[i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) GetUserTokenByHash(ctx context.Context, purpose, hash string) (entity.UserToken, error) {
+	for _, token := range m.userTokens {
+		if token.Purpose == purpose && token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return entity.UserToken{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateUserToken(ctx context.Context, token entity.UserToken) error {
+	m.userTokens = append(m.userTokens, token)
+	return nil
+}
+
+func (m *mockRepository) MarkUserTokenUsed(ctx context.Context, id string, at time.Time) (bool, error) {
+	for i, token := range m.userTokens {
+		if token.ID == id && token.UsedAt == nil {
+			m.userTokens[i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) InvalidateUserTokens(ctx context.Context, userId, purpose string, at time.Time) error {
+	for i, token := range m.userTokens {
+		if token.UserId == userId && token.Purpose == purpose && token.UsedAt == nil {
+			m.userTokens[i].UsedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) GetAccessToken(ctx context.Context, id string) (entity.AccessToken, error) {
+	for _, token := range m.access {
+		if token.ID == id {
+			return token, nil
+		}
+	}
+	return entity.AccessToken{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetAccessTokenByHash(ctx context.Context, hash string) (entity.AccessToken, error) {
+	for _, token := range m.access {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return entity.AccessToken{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryAccessTokens(ctx context.Context, userId string) ([]entity.AccessToken, error) {
+	var tokens []entity.AccessToken
+	for _, token := range m.access {
+		if token.UserId == userId {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *mockRepository) CreateAccessToken(ctx context.Context, token entity.AccessToken) error {
+	m.access = append(m.access, token)
+	return nil
+}
+
+func (m *mockRepository) RevokeAccessToken(ctx context.Context, id string, at time.Time) error {
+	for i, token := range m.access {
+		if token.ID == id && token.RevokedAt == nil {
+			m.access[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) RevokeUserAccessTokens(ctx context.Context, userId string, at time.Time) error {
+	for i, token := range m.access {
+		if token.UserId == userId && token.RevokedAt == nil {
+			m.access[i].RevokedAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) TouchAccessToken(ctx context.Context, id string, at time.Time, ip string) error {
+	for i, token := range m.access {
+		if token.ID == id {
+			m.access[i].LastUsedAt, m.access[i].LastUsedIp = &at, ip
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	for _, member := range m.members {
+		if member.TripId == tripId && member.UserId == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
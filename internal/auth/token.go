@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// AccessTokenPrefix is the prefix of every personal access token.
+	// It tells access tokens apart from JWTs and makes leaked tokens easy to search for.
+	AccessTokenPrefix = "trb_"
+	// accessTokenTouchInterval is how often the last-used time of an access token is written back.
+	accessTokenTouchInterval = time.Minute
+)
+
+// TokenService encapsulates the management of personal access tokens.
+type TokenService interface {
+	// Query returns the access tokens of the given user.
+	Query(ctx context.Context, userId string) ([]entity.AccessToken, error)
+	// Create creates a new access token for the given user. The token itself is only returned here.
+	Create(ctx context.Context, userId string, input CreateAccessTokenRequest) (CreatedAccessToken, error)
+	// Revoke revokes an access token of the given user.
+	Revoke(ctx context.Context, userId, id string) (entity.AccessToken, error)
+	// RevokeAll revokes every access token of the given user.
+	RevokeAll(ctx context.Context, userId string) error
+	// Authenticate returns the access token matching the given token and records its use from the given IP address.
+	Authenticate(ctx context.Context, token, ip string) (entity.AccessToken, error)
+}
+
+// CreateAccessTokenRequest represents an access token creation request.
+type CreateAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scope     string     `json:"scope"`
+	TripId    string     `json:"trip_id"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Validate validates the CreateAccessTokenRequest fields.
+func (m CreateAccessTokenRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Name, validation.Required, validation.Length(1, 100)),
+		validation.Field(&m.Scope, validation.Required, validation.In(entity.AccessTokenScopeRead, entity.AccessTokenScopeWrite, entity.AccessTokenScopeTrip)),
+		validation.Field(&m.TripId, validation.When(m.Scope == entity.AccessTokenScopeTrip, validation.Required)),
+		validation.Field(&m.ExpiresAt, validation.By(func(value interface{}) error {
+			if at := value.(*time.Time); at != nil && !at.After(time.Now()) {
+				return validation.NewError("validation_expires_at_past", "must be in the future")
+			}
+			return nil
+		})),
+	)
+}
+
+// CreatedAccessToken is returned once when an access token is created, together with the token itself.
+type CreatedAccessToken struct {
+	entity.AccessToken
+	Token string `json:"token"`
+}
+
+type tokenService struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewTokenService creates a new personal access token service.
+func NewTokenService(repo Repository, logger log.Logger) TokenService {
+	return tokenService{repo, logger}
+}
+
+// Query returns the access tokens of the given user, including revoked ones.
+func (s tokenService) Query(ctx context.Context, userId string) ([]entity.AccessToken, error) {
+	tokens, err := s.repo.QueryAccessTokens(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		tokens = []entity.AccessToken{}
+	}
+	return tokens, nil
+}
+
+// Create creates a new access token for the given user. A trip token can only be created by a member of the trip.
+func (s tokenService) Create(ctx context.Context, userId string, req CreateAccessTokenRequest) (CreatedAccessToken, error) {
+	if err := req.Validate(); err != nil {
+		return CreatedAccessToken{}, err
+	}
+	if req.Scope == entity.AccessTokenScopeTrip {
+		member, err := s.repo.IsTripMember(ctx, req.TripId, userId)
+		if err != nil {
+			return CreatedAccessToken{}, err
+		}
+		if !member {
+			return CreatedAccessToken{}, errors.Forbidden("Only the members of the trip can create a token for it.")
+		}
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return CreatedAccessToken{}, err
+	}
+	token := AccessTokenPrefix + secret
+	if req.Scope != entity.AccessTokenScopeTrip {
+		req.TripId = ""
+	}
+	now := time.Now()
+	accessToken := entity.AccessToken{
+		ID:        entity.GenerateID(),
+		UserId:    userId,
+		Name:      req.Name,
+		Scope:     req.Scope,
+		TripId:    req.TripId,
+		TokenHash: hashToken(token),
+		ExpiresAt: req.ExpiresAt,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateAccessToken(ctx, accessToken); err != nil {
+		return CreatedAccessToken{}, err
+	}
+	return CreatedAccessToken{accessToken, token}, nil
+}
+
+// Revoke revokes an access token of the given user. Tokens of other users are reported as not found.
+func (s tokenService) Revoke(ctx context.Context, userId, id string) (entity.AccessToken, error) {
+	token, err := s.repo.GetAccessToken(ctx, id)
+	if err == sql.ErrNoRows || err == nil && token.UserId != userId {
+		return entity.AccessToken{}, errors.NotFound("")
+	} else if err != nil {
+		return entity.AccessToken{}, err
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		if err := s.repo.RevokeAccessToken(ctx, id, now); err != nil {
+			return entity.AccessToken{}, err
+		}
+		token.RevokedAt = &now
+	}
+	return token, nil
+}
+
+// RevokeAll revokes every access token of the given user.
+func (s tokenService) RevokeAll(ctx context.Context, userId string) error {
+	return s.repo.RevokeUserAccessTokens(ctx, userId, time.Now())
+}
+
+// Authenticate returns the access token matching the given token.
+// The last-used time and IP address are written back at most once per minute unless the IP address changes.
+func (s tokenService) Authenticate(ctx context.Context, token, ip string) (entity.AccessToken, error) {
+	invalid := errors.Unauthorized("The access token is invalid, expired or revoked.")
+	if !strings.HasPrefix(token, AccessTokenPrefix) {
+		return entity.AccessToken{}, invalid
+	}
+	accessToken, err := s.repo.GetAccessTokenByHash(ctx, hashToken(token))
+	if err == sql.ErrNoRows {
+		return entity.AccessToken{}, invalid
+	} else if err != nil {
+		return entity.AccessToken{}, err
+	}
+	now := time.Now()
+	if !accessToken.IsActive(now) {
+		return entity.AccessToken{}, invalid
+	}
+	if accessToken.LastUsedAt == nil || now.Sub(*accessToken.LastUsedAt) >= accessTokenTouchInterval || accessToken.LastUsedIp != ip {
+		if err := s.repo.TouchAccessToken(ctx, accessToken.ID, now, ip); err != nil {
+			s.logger.With(ctx).Errorf("failed to record access token use: %v", err)
+		} else {
+			accessToken.LastUsedAt, accessToken.LastUsedIp = &now, ip
+		}
+	}
+	return accessToken, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_tokenService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewTokenService(repo, logger)
+	ctx := context.Background()
+
+	// validation
+	_, err := s.Create(ctx, "100", CreateAccessTokenRequest{Name: "bank", Scope: "admin"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, "100", CreateAccessTokenRequest{Name: "bank", Scope: entity.AccessTokenScopeTrip})
+	assert.NotNil(t, err)
+
+	created, err := s.Create(ctx, "100", CreateAccessTokenRequest{Name: "bank", Scope: entity.AccessTokenScopeWrite})
+	assert.Nil(t, err)
+	assert.Contains(t, created.Token, AccessTokenPrefix)
+	assert.NotContains(t, repo.access[0].TokenHash, created.Token)
+
+	// authentication records the last use
+	token, err := s.Authenticate(ctx, created.Token, "10.0.0.1")
+	assert.Nil(t, err)
+	assert.Equal(t, "100", token.UserId)
+	assert.NotNil(t, repo.access[0].LastUsedAt)
+	assert.Equal(t, "10.0.0.1", repo.access[0].LastUsedIp)
+	_, err = s.Authenticate(ctx, AccessTokenPrefix+"unknown", "10.0.0.1")
+	assert.NotNil(t, err)
+
+	// tokens of other users cannot be revoked
+	_, err = s.Revoke(ctx, "101", created.ID)
+	assert.NotNil(t, err)
+	revoked, err := s.Revoke(ctx, "100", created.ID)
+	assert.Nil(t, err)
+	assert.NotNil(t, revoked.RevokedAt)
+	_, err = s.Authenticate(ctx, created.Token, "10.0.0.1")
+	assert.NotNil(t, err)
+
+	tokens, err := s.Query(ctx, "100")
+	assert.Nil(t, err)
+	assert.Len(t, tokens, 1)
+
+	// trip tokens are issued to the members of the trip only
+	repo.members = []entity.TripMember{{TripId: "t1", UserId: "100"}}
+	_, err = s.Create(ctx, "100", CreateAccessTokenRequest{Name: "trip", Scope: entity.AccessTokenScopeTrip, TripId: "t2"})
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	created, err = s.Create(ctx, "100", CreateAccessTokenRequest{Name: "trip", Scope: entity.AccessTokenScopeTrip, TripId: "t1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", created.TripId)
+}
+
+func Test_scopeAllows(t *testing.T) {
+	read := entity.AccessToken{Scope: entity.AccessTokenScopeRead}
+	write := entity.AccessToken{Scope: entity.AccessTokenScopeWrite}
+	trip := entity.AccessToken{Scope: entity.AccessTokenScopeTrip, TripId: "t1"}
+	tests := []struct {
+		name   string
+		token  entity.AccessToken
+		method string
+		path   string
+		want   bool
+	}{
+		{"read get", read, "GET", "/v1/trips", true},
+		{"read post", read, "POST", "/v1/transactions", false},
+		{"write post", write, "POST", "/v1/transactions", true},
+		{"trip own", trip, "POST", "/v1/trips/t1/transactions", true},
+		{"trip other", trip, "GET", "/v1/trips/t2", false},
+		{"trip outside", trip, "GET", "/v1/users", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, scopeAllows(tt.token, httptest.NewRequest(tt.method, tt.path, nil)))
+		})
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.1", "172.16.0.0/12"})
+	assert.Nil(t, err)
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.NotNil(t, err)
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"direct", "203.0.113.1:1234", "", "203.0.113.1"},
+		{"spoofed", "203.0.113.1:1234", "198.51.100.1", "203.0.113.1"},
+		{"proxied", "10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"chained", "10.0.0.1:1234", "192.0.2.9, 198.51.100.1, 172.16.0.5", "198.51.100.1"},
+		{"proxy without header", "10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/trips", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			assert.Equal(t, tt.want, clientIP(req, proxies))
+		})
+	}
+}
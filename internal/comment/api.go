@@ -0,0 +1,140 @@
+package comment
+
+import (
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/transactions/<id>/comments", authHandler, res.query)
+	r.Post("/transactions/<id>/comments", authHandler, res.create)
+	r.Put("/transactions/<id>/comments/<comment_id>", authHandler, res.update)
+	r.Delete("/transactions/<id>/comments/<comment_id>", authHandler, res.delete)
+	r.Get("/transactions/<id>/reactions", authHandler, res.queryReactions)
+	r.Post("/transactions/<id>/reactions", authHandler, res.react)
+	r.Delete("/transactions/<id>/reactions/<emoji>", authHandler, res.unreact)
+	r.Get("/transactions/<id>/comments/<comment_id>/reactions", authHandler, res.queryReactions)
+	r.Post("/transactions/<id>/comments/<comment_id>/reactions", authHandler, res.react)
+	r.Delete("/transactions/<id>/comments/<comment_id>/reactions/<emoji>", authHandler, res.unreact)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the comment threads of a transaction.
+func (r resource) query(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	comments, err := r.service.Query(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, comments)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// create adds a comment of the current user to a transaction.
+func (r resource) create(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input CreateCommentRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	comment, err := r.service.Create(c.Request.Context(), identity.GetID(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(comment, http.StatusCreated)
+}
+
+// update changes a comment of the current user.
+func (r resource) update(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input UpdateCommentRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	comment, err := r.service.Update(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("comment_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(comment)
+}
+
+// delete removes a comment of the current user.
+func (r resource) delete(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	comment, err := r.service.Delete(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("comment_id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(comment)
+}
+
+// queryReactions returns the reactions to a transaction or one of its comments.
+func (r resource) queryReactions(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	reactions, err := r.service.QueryReactions(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("comment_id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(reactions)
+}
+
+// react adds a reaction of the current user to a transaction or one of its comments.
+func (r resource) react(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input ReactRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	reactions, err := r.service.React(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("comment_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(reactions)
+}
+
+// unreact removes a reaction of the current user from a transaction or one of its comments.
+func (r resource) unreact(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	reactions, err := r.service.Unreact(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("comment_id"), c.Param("emoji"))
+	if err != nil {
+		return err
+	}
+	return c.Write(reactions)
+}
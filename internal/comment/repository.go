@@ -0,0 +1,149 @@
+package comment
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access comments and reactions from the data source.
+type Repository interface {
+	// GetTransaction returns the transaction with the specified ID.
+	GetTransaction(ctx context.Context, id string) (entity.Transaction, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+	// QueryMembers returns the members of the trip who have an account.
+	QueryMembers(ctx context.Context, tripId string) ([]Member, error)
+
+	// Get returns the comment with the specified ID.
+	Get(ctx context.Context, id string) (entity.Comment, error)
+	// QueryByTransaction returns the comments on the transaction, oldest first.
+	QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Comment, error)
+	// Create saves a new comment in the storage.
+	Create(ctx context.Context, comment entity.Comment) error
+	// Update updates the comment in the storage.
+	Update(ctx context.Context, comment entity.Comment) error
+
+	// QueryReactions returns the reactions to the transaction and its comments, oldest first.
+	QueryReactions(ctx context.Context, transactionId string) ([]entity.Reaction, error)
+	// CreateReaction saves a new reaction in the storage unless the user already reacted with the same emoji.
+	CreateReaction(ctx context.Context, reaction entity.Reaction) error
+	// DeleteReaction removes the reaction of the user with the emoji from the storage.
+	DeleteReaction(ctx context.Context, transactionId, commentId, userId, emoji string) error
+}
+
+// Member represents a trip member who can be mentioned in comments.
+type Member struct {
+	UserId   string `json:"user_id"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// repository persists comments and reactions in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new comment repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetTransaction reads the transaction with the specified ID from the database.
+func (r repository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	var transaction entity.Transaction
+	err := r.db.With(ctx).Select().Model(id, &transaction)
+	return transaction, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// QueryMembers reads the members of the trip and their usernames from the database.
+func (r repository) QueryMembers(ctx context.Context, tripId string) ([]Member, error) {
+	var members []Member
+	err := r.db.With(ctx).NewQuery(`
+		SELECT m.user_id, m.name, COALESCE(u.username, '') AS username
+		FROM trip_member m
+		JOIN user_default u ON u.id = m.user_id
+		WHERE m.trip_id = {:trip_id} AND u.deleted_at IS NULL`).
+		Bind(dbx.Params{"trip_id": tripId}).
+		All(&members)
+	return members, err
+}
+
+// Get reads the comment with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Comment, error) {
+	var comment entity.Comment
+	err := r.db.With(ctx).Select().Model(id, &comment)
+	return comment, err
+}
+
+// QueryByTransaction retrieves the comments on the transaction from the database.
+func (r repository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Comment, error) {
+	var comments []entity.Comment
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": transactionId}).
+		OrderBy("created_at", "id").
+		All(&comments)
+	return comments, err
+}
+
+// Create saves a new comment record in the database.
+func (r repository) Create(ctx context.Context, comment entity.Comment) error {
+	return r.db.With(ctx).Model(&comment).Insert()
+}
+
+// Update saves the changes to a comment in the database.
+func (r repository) Update(ctx context.Context, comment entity.Comment) error {
+	return r.db.With(ctx).Model(&comment).Update()
+}
+
+// QueryReactions retrieves the reactions to the transaction and its comments from the database.
+func (r repository) QueryReactions(ctx context.Context, transactionId string) ([]entity.Reaction, error) {
+	var reactions []entity.Reaction
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": transactionId}).
+		OrderBy("created_at", "id").
+		All(&reactions)
+	return reactions, err
+}
+
+// CreateReaction saves a new reaction record in the database, ignoring duplicates.
+func (r repository) CreateReaction(ctx context.Context, reaction entity.Reaction) error {
+	_, err := r.db.With(ctx).NewQuery(`
+		INSERT INTO reaction (id, transaction_id, comment_id, user_id, emoji, created_at)
+		VALUES ({:id}, {:transaction_id}, {:comment_id}, {:user_id}, {:emoji}, {:created_at})
+		ON CONFLICT (transaction_id, comment_id, user_id, emoji) DO NOTHING`).
+		Bind(dbx.Params{
+			"id":             reaction.ID,
+			"transaction_id": reaction.TransactionId,
+			"comment_id":     reaction.CommentId,
+			"user_id":        reaction.UserId,
+			"emoji":          reaction.Emoji,
+			"created_at":     reaction.CreatedAt,
+		}).
+		Execute()
+	return err
+}
+
+// DeleteReaction deletes the reaction record from the database.
+func (r repository) DeleteReaction(ctx context.Context, transactionId, commentId, userId, emoji string) error {
+	_, err := r.db.With(ctx).Delete("reaction", dbx.HashExp{
+		"transaction_id": transactionId,
+		"comment_id":     commentId,
+		"user_id":        userId,
+		"emoji":          emoji,
+	}).Execute()
+	return err
+}
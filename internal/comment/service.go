@@ -0,0 +1,467 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// mentionPattern matches @-mentions such as "@sari" or "@andi.p".
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_])@([\p{L}\p{N}_.\-]+)`)
+
+// Service encapsulates usecase logic for the comments and reactions on transactions.
+// Only the members of the trip of a transaction can read and write its comments and reactions.
+type Service interface {
+	// Query returns the comments on the transaction as threads, oldest first, together with their reactions.
+	Query(ctx context.Context, userId, transactionId string) ([]Comment, error)
+	// Create adds a comment of the user to the transaction, notifying the trip members it mentions.
+	Create(ctx context.Context, userId, transactionId string, input CreateCommentRequest) (Comment, error)
+	// Update changes the body of a comment of the user, notifying the trip members it newly mentions.
+	Update(ctx context.Context, userId, transactionId, id string, input UpdateCommentRequest) (Comment, error)
+	// Delete removes the body of a comment of the user while keeping its replies.
+	Delete(ctx context.Context, userId, transactionId, id string) (Comment, error)
+	// QueryReactions returns the reactions to the transaction, or to one of its comments if commentId is set.
+	QueryReactions(ctx context.Context, userId, transactionId, commentId string) ([]Reaction, error)
+	// React adds a reaction of the user to the transaction or one of its comments and returns the updated reactions.
+	React(ctx context.Context, userId, transactionId, commentId string, input ReactRequest) ([]Reaction, error)
+	// Unreact removes a reaction of the user from the transaction or one of its comments and returns the updated
+	// reactions.
+	Unreact(ctx context.Context, userId, transactionId, commentId, emoji string) ([]Reaction, error)
+}
+
+// Comment represents a comment together with its reactions and replies.
+type Comment struct {
+	entity.Comment
+	Reactions []Reaction `json:"reactions"`
+	Replies   []Comment  `json:"replies"`
+}
+
+// Reaction represents the users who reacted with an emoji.
+type Reaction struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIds []string `json:"user_ids"`
+}
+
+// CreateCommentRequest represents a comment creation request. Replies refer to the comment they answer.
+type CreateCommentRequest struct {
+	ParentId string `json:"parent_id"`
+	Body     string `json:"body"`
+}
+
+// Validate validates the CreateCommentRequest fields.
+func (m CreateCommentRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.ParentId, validation.Length(0, 128)),
+		validation.Field(&m.Body, validation.Required, validation.Length(0, 4000)),
+	)
+}
+
+// UpdateCommentRequest represents a comment update request.
+type UpdateCommentRequest struct {
+	Body string `json:"body"`
+}
+
+// Validate validates the UpdateCommentRequest fields.
+func (m UpdateCommentRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Body, validation.Required, validation.Length(0, 4000)),
+	)
+}
+
+// ReactRequest represents a reaction request.
+type ReactRequest struct {
+	Emoji string `json:"emoji"`
+}
+
+// Validate validates the ReactRequest fields.
+func (m ReactRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Emoji, validation.Required, validation.Length(0, 32), validation.By(validateEmoji)),
+	)
+}
+
+// validateEmoji rejects reactions made of plain text rather than emoji. Only the ASCII characters of keycap
+// emoji such as "#️⃣" are allowed.
+func validateEmoji(value interface{}) error {
+	emoji := false
+	for _, r := range value.(string) {
+		if r >= 0x80 {
+			emoji = true
+		} else if r != '#' && r != '*' && (r < '0' || r > '9') {
+			emoji = false
+			break
+		}
+	}
+	if !emoji {
+		return validation.NewError("validation_is_emoji", "must be an emoji")
+	}
+	return nil
+}
+
+type service struct {
+	repo                Repository
+	notificationService notification.Service
+	publisher           realtime.Publisher
+	logger              log.Logger
+}
+
+// NewService creates a new comment service.
+// The notification service informs the trip members mentioned in comments, and the publisher streams the changes
+// to the members of the trip.
+func NewService(repo Repository, notificationService notification.Service, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, notificationService, publisher, logger}
+}
+
+// Query returns the comments on the transaction arranged in threads.
+func (s service) Query(ctx context.Context, userId, transactionId string) ([]Comment, error) {
+	if _, err := s.transaction(ctx, userId, transactionId); err != nil {
+		return nil, err
+	}
+	comments, err := s.repo.QueryByTransaction(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	reactions, err := s.repo.QueryReactions(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	return threads(comments, reactions), nil
+}
+
+// Create adds a comment to the transaction. Replies must answer a comment on the same transaction.
+func (s service) Create(ctx context.Context, userId, transactionId string, req CreateCommentRequest) (Comment, error) {
+	if err := req.Validate(); err != nil {
+		return Comment{}, err
+	}
+	transaction, err := s.transaction(ctx, userId, transactionId)
+	if err != nil {
+		return Comment{}, err
+	}
+	if req.ParentId != "" {
+		parent, err := s.repo.Get(ctx, req.ParentId)
+		if err == sql.ErrNoRows || err == nil && parent.TransactionId != transactionId {
+			return Comment{}, errors.BadRequest("The parent comment does not belong to the transaction.")
+		} else if err != nil {
+			return Comment{}, err
+		}
+	}
+	now := time.Now()
+	comment := entity.Comment{
+		ID:            entity.GenerateID(),
+		TransactionId: transactionId,
+		TripId:        transaction.TripId,
+		UserId:        userId,
+		ParentId:      req.ParentId,
+		Body:          req.Body,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.repo.Create(ctx, comment); err != nil {
+		return Comment{}, err
+	}
+	s.mentioned(ctx, transaction, comment, "")
+	s.publisher.Publish(ctx, realtime.NewEvent(comment.TripId, "comment", realtime.Created, comment))
+	return newComment(comment), nil
+}
+
+// Update changes the body of the comment. Only the author can change a comment.
+func (s service) Update(ctx context.Context, userId, transactionId, id string, req UpdateCommentRequest) (Comment, error) {
+	if err := req.Validate(); err != nil {
+		return Comment{}, err
+	}
+	transaction, err := s.transaction(ctx, userId, transactionId)
+	if err != nil {
+		return Comment{}, err
+	}
+	comment, err := s.own(ctx, userId, transactionId, id)
+	if err != nil {
+		return Comment{}, err
+	}
+	previousBody := comment.Body
+	comment.Body = req.Body
+	comment.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, comment); err != nil {
+		return Comment{}, err
+	}
+	s.mentioned(ctx, transaction, comment, previousBody)
+	s.publisher.Publish(ctx, realtime.NewEvent(comment.TripId, "comment", realtime.Updated, comment))
+	return newComment(comment), nil
+}
+
+// Delete removes the body of the comment so that its replies stay in place. Only the author can delete a comment.
+func (s service) Delete(ctx context.Context, userId, transactionId, id string) (Comment, error) {
+	if _, err := s.transaction(ctx, userId, transactionId); err != nil {
+		return Comment{}, err
+	}
+	comment, err := s.own(ctx, userId, transactionId, id)
+	if err != nil {
+		return Comment{}, err
+	}
+	now := time.Now()
+	comment.Body = ""
+	comment.DeletedAt = &now
+	comment.UpdatedAt = now
+	if err := s.repo.Update(ctx, comment); err != nil {
+		return Comment{}, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(comment.TripId, "comment", realtime.Deleted, comment))
+	return newComment(comment), nil
+}
+
+// QueryReactions returns the reactions to the transaction or the comment, grouped by emoji.
+func (s service) QueryReactions(ctx context.Context, userId, transactionId, commentId string) ([]Reaction, error) {
+	if _, err := s.transaction(ctx, userId, transactionId); err != nil {
+		return nil, err
+	}
+	if err := s.checkComment(ctx, transactionId, commentId); err != nil {
+		return nil, err
+	}
+	return s.reactions(ctx, transactionId, commentId)
+}
+
+// React adds the reaction unless the user already reacted with the same emoji.
+func (s service) React(ctx context.Context, userId, transactionId, commentId string, req ReactRequest) ([]Reaction, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	transaction, err := s.transaction(ctx, userId, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkComment(ctx, transactionId, commentId); err != nil {
+		return nil, err
+	}
+	reaction := entity.Reaction{
+		ID:            entity.GenerateID(),
+		TransactionId: transactionId,
+		CommentId:     commentId,
+		UserId:        userId,
+		Emoji:         req.Emoji,
+		CreatedAt:     time.Now(),
+	}
+	if err := s.repo.CreateReaction(ctx, reaction); err != nil {
+		return nil, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transaction.TripId, "reaction", realtime.Created, reaction))
+	return s.reactions(ctx, transactionId, commentId)
+}
+
+// Unreact removes the reaction of the user with the emoji, if any.
+func (s service) Unreact(ctx context.Context, userId, transactionId, commentId, emoji string) ([]Reaction, error) {
+	transaction, err := s.transaction(ctx, userId, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkComment(ctx, transactionId, commentId); err != nil {
+		return nil, err
+	}
+	if err := s.repo.DeleteReaction(ctx, transactionId, commentId, userId, emoji); err != nil {
+		return nil, err
+	}
+	reaction := entity.Reaction{TransactionId: transactionId, CommentId: commentId, UserId: userId, Emoji: emoji}
+	s.publisher.Publish(ctx, realtime.NewEvent(transaction.TripId, "reaction", realtime.Deleted, reaction))
+	return s.reactions(ctx, transactionId, commentId)
+}
+
+// transaction returns the transaction if the user is a member of its trip.
+func (s service) transaction(ctx context.Context, userId, transactionId string) (entity.Transaction, error) {
+	transaction, err := s.repo.GetTransaction(ctx, transactionId)
+	if err == sql.ErrNoRows {
+		return entity.Transaction{}, errors.NotFound("")
+	} else if err != nil {
+		return entity.Transaction{}, err
+	}
+	member, err := s.repo.IsTripMember(ctx, transaction.TripId, userId)
+	if err != nil {
+		return entity.Transaction{}, err
+	}
+	if !member {
+		return entity.Transaction{}, errors.Forbidden("Only the members of the trip can comment on its transactions.")
+	}
+	return transaction, nil
+}
+
+// own returns the comment on the transaction if the user wrote it and it was not deleted.
+func (s service) own(ctx context.Context, userId, transactionId, id string) (entity.Comment, error) {
+	comment, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows || err == nil && (comment.TransactionId != transactionId || comment.IsDeleted()) {
+		return entity.Comment{}, errors.NotFound("")
+	} else if err != nil {
+		return entity.Comment{}, err
+	}
+	if comment.UserId != userId {
+		return entity.Comment{}, errors.Forbidden("Only the author can change the comment.")
+	}
+	return comment, nil
+}
+
+// checkComment returns an error unless the comment, if any, is on the transaction.
+func (s service) checkComment(ctx context.Context, transactionId, commentId string) error {
+	if commentId == "" {
+		return nil
+	}
+	comment, err := s.repo.Get(ctx, commentId)
+	if err == sql.ErrNoRows || err == nil && comment.TransactionId != transactionId {
+		return errors.NotFound("")
+	}
+	return err
+}
+
+// reactions returns the reactions to the transaction or the comment, grouped by emoji.
+func (s service) reactions(ctx context.Context, transactionId, commentId string) ([]Reaction, error) {
+	items, err := s.repo.QueryReactions(ctx, transactionId)
+	if err != nil {
+		return nil, err
+	}
+	if reactions, ok := group(items)[commentId]; ok {
+		return reactions, nil
+	}
+	return []Reaction{}, nil
+}
+
+// mentioned notifies the trip members mentioned in the comment, except those already mentioned in its previous
+// body.
+func (s service) mentioned(ctx context.Context, transaction entity.Transaction, comment entity.Comment, previousBody string) {
+	mentions := parseMentions(comment.Body)
+	if len(mentions) == 0 {
+		return
+	}
+	members, err := s.repo.QueryMembers(ctx, transaction.TripId)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+	previous := resolveMentions(parseMentions(previousBody), members)
+	for _, member := range resolveMentions(mentions, members) {
+		if containsMember(previous, member.UserId) {
+			continue
+		}
+		s.notificationService.Notify(ctx, notification.NotifyRequest{
+			UserId:    member.UserId,
+			Kind:      entity.NotificationCommentMentioned,
+			TripId:    transaction.TripId,
+			SubjectId: transaction.ID,
+			Title:     "Mentioned in a comment",
+			Body:      fmt.Sprintf("You were mentioned in a comment on %v: %v", transaction.Title, excerpt(comment.Body)),
+		})
+	}
+}
+
+// parseMentions returns the lower-cased names mentioned in the text, e.g. "sari" for "@Sari".
+func parseMentions(text string) []string {
+	var mentions []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		mentions = append(mentions, strings.ToLower(strings.TrimRight(match[1], ".-")))
+	}
+	return mentions
+}
+
+// resolveMentions returns the members mentioned by their username or by their member name without spaces.
+func resolveMentions(mentions []string, members []Member) []Member {
+	var result []Member
+	for _, member := range members {
+		name := strings.ToLower(strings.Join(strings.Fields(member.Name), ""))
+		for _, mention := range mentions {
+			if mention == strings.ToLower(member.Username) || mention == name {
+				if !containsMember(result, member.UserId) {
+					result = append(result, member)
+				}
+				break
+			}
+		}
+	}
+	return result
+}
+
+// containsMember returns whether the members include the user.
+func containsMember(members []Member, userId string) bool {
+	for _, member := range members {
+		if member.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// excerpt shortens the text for a notification body.
+func excerpt(text string) string {
+	runes := []rune(text)
+	if len(runes) <= 100 {
+		return text
+	}
+	return string(runes[:100]) + "…"
+}
+
+// newComment wraps a comment without reactions or replies.
+func newComment(comment entity.Comment) Comment {
+	return Comment{Comment: comment, Reactions: []Reaction{}, Replies: []Comment{}}
+}
+
+// threads arranges the comments in threads, nesting replies under the comment they answer.
+// Replies whose parent is missing are shown at the top level.
+func threads(comments []entity.Comment, reactions []entity.Reaction) []Comment {
+	grouped := group(reactions)
+	children := map[string][]entity.Comment{}
+	ids := map[string]bool{}
+	for _, comment := range comments {
+		ids[comment.ID] = true
+	}
+	var roots []entity.Comment
+	for _, comment := range comments {
+		if comment.ParentId != "" && ids[comment.ParentId] {
+			children[comment.ParentId] = append(children[comment.ParentId], comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	var build func(comment entity.Comment) Comment
+	build = func(comment entity.Comment) Comment {
+		result := newComment(comment)
+		if reactions, ok := grouped[comment.ID]; ok {
+			result.Reactions = reactions
+		}
+		for _, child := range children[comment.ID] {
+			result.Replies = append(result.Replies, build(child))
+		}
+		return result
+	}
+	result := []Comment{}
+	for _, root := range roots {
+		result = append(result, build(root))
+	}
+	return result
+}
+
+// group groups the reactions by their comment, with the reactions to the transaction itself under "", and by emoji
+// in the order the emoji were first used.
+func group(reactions []entity.Reaction) map[string][]Reaction {
+	result := map[string][]Reaction{"": {}}
+	for _, reaction := range reactions {
+		list := result[reaction.CommentId]
+		found := false
+		for i := range list {
+			if list[i].Emoji == reaction.Emoji {
+				list[i].Count++
+				list[i].UserIds = append(list[i].UserIds, reaction.UserId)
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, Reaction{Emoji: reaction.Emoji, Count: 1, UserIds: []string{reaction.UserId}})
+		}
+		result[reaction.CommentId] = list
+	}
+	return result
+}
@@ -0,0 +1,205 @@
+package comment
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMentions(t *testing.T) {
+	assert.Equal(t, []string{"sari", "andi.p"}, parseMentions("@Sari I didn't have dessert, ask @andi.p."))
+	assert.Nil(t, parseMentions("mail budi@example.com"))
+
+	members := []Member{
+		{UserId: "u1", Name: "Sari Dewi", Username: "sari"},
+		{UserId: "u2", Name: "Andi", Username: "andi.p"},
+		{UserId: "u3", Name: "Budi", Username: "budi"},
+	}
+	resolved := resolveMentions([]string{"saridewi", "sari", "andi.p", "carol"}, members)
+	if assert.Len(t, resolved, 2) {
+		assert.Equal(t, "u1", resolved[0].UserId)
+		assert.Equal(t, "u2", resolved[1].UserId)
+	}
+}
+
+func TestReactRequest_Validate(t *testing.T) {
+	assert.Nil(t, ReactRequest{Emoji: "👍"}.Validate())
+	assert.Nil(t, ReactRequest{Emoji: "👍🏽"}.Validate())
+	assert.Nil(t, ReactRequest{Emoji: "#️⃣"}.Validate())
+	assert.NotNil(t, ReactRequest{Emoji: ""}.Validate())
+	assert.NotNil(t, ReactRequest{Emoji: "lol"}.Validate())
+	assert.NotNil(t, ReactRequest{Emoji: "123"}.Validate())
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		transactions: map[string]entity.Transaction{"t1": {ID: "t1", TripId: "trip1", Title: "Dinner"}},
+		members: []Member{
+			{UserId: "budi", Name: "Budi", Username: "budi"},
+			{UserId: "sari", Name: "Sari", Username: "sari"},
+			{UserId: "andi", Name: "Andi", Username: "andi"},
+		},
+		comments: map[string]entity.Comment{},
+	}
+	notifications := &mockNotificationService{}
+	s := NewService(repo, notifications, mockPublisher{}, logger)
+	ctx := auth.WithUserDefault(context.Background(), "sari", "")
+
+	// only the members of the trip can comment
+	_, err := s.Create(ctx, "carol", "t1", CreateCommentRequest{Body: "hi"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, "sari", "t2", CreateCommentRequest{Body: "hi"})
+	assert.NotNil(t, err)
+
+	root, err := s.Create(ctx, "sari", "t1", CreateCommentRequest{Body: "@budi I didn't have dessert"})
+	assert.Nil(t, err)
+	assert.Equal(t, "trip1", root.TripId)
+	if assert.Len(t, notifications.requests, 1) {
+		assert.Equal(t, "budi", notifications.requests[0].UserId)
+		assert.Equal(t, entity.NotificationCommentMentioned, notifications.requests[0].Kind)
+		assert.Equal(t, "t1", notifications.requests[0].SubjectId)
+	}
+	reply, err := s.Create(ctx, "budi", "t1", CreateCommentRequest{ParentId: root.ID, Body: "You did!"})
+	assert.Nil(t, err)
+	_, err = s.Create(ctx, "budi", "t1", CreateCommentRequest{ParentId: "missing", Body: "?"})
+	assert.NotNil(t, err)
+
+	// editing notifies only the newly mentioned members
+	_, err = s.Update(ctx, "sari", "t1", root.ID, UpdateCommentRequest{Body: "@budi @andi I didn't have dessert"})
+	assert.Nil(t, err)
+	if assert.Len(t, notifications.requests, 2) {
+		assert.Equal(t, "andi", notifications.requests[1].UserId)
+	}
+	_, err = s.Update(ctx, "budi", "t1", root.ID, UpdateCommentRequest{Body: "hacked"})
+	assert.NotNil(t, err)
+
+	_, err = s.React(ctx, "andi", "t1", root.ID, ReactRequest{Emoji: "😂"})
+	assert.Nil(t, err)
+	reactions, err := s.React(ctx, "budi", "t1", root.ID, ReactRequest{Emoji: "😂"})
+	assert.Nil(t, err)
+	assert.Equal(t, []Reaction{{Emoji: "😂", Count: 2, UserIds: []string{"andi", "budi"}}}, reactions)
+	reactions, err = s.React(ctx, "budi", "t1", "", ReactRequest{Emoji: "🍰"})
+	assert.Nil(t, err)
+	assert.Len(t, reactions, 1)
+	reactions, err = s.Unreact(ctx, "budi", "t1", "", "🍰")
+	assert.Nil(t, err)
+	assert.Equal(t, []Reaction{}, reactions)
+
+	deleted, err := s.Delete(ctx, "sari", "t1", root.ID)
+	assert.Nil(t, err)
+	assert.True(t, deleted.IsDeleted())
+	assert.Equal(t, "", deleted.Body)
+
+	threads, err := s.Query(ctx, "andi", "t1")
+	assert.Nil(t, err)
+	if assert.Len(t, threads, 1) {
+		assert.True(t, threads[0].IsDeleted())
+		assert.Equal(t, 2, threads[0].Reactions[0].Count)
+		if assert.Len(t, threads[0].Replies, 1) {
+			assert.Equal(t, reply.ID, threads[0].Replies[0].ID)
+		}
+	}
+}
+
+type mockRepository struct {
+	transactions map[string]entity.Transaction
+	members      []Member
+	comments     map[string]entity.Comment
+	order        []string
+	reactions    []entity.Reaction
+}
+
+func (m *mockRepository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	if transaction, ok := m.transactions[id]; ok {
+		return transaction, nil
+	}
+	return entity.Transaction{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	return containsMember(m.members, userId), nil
+}
+
+func (m *mockRepository) QueryMembers(ctx context.Context, tripId string) ([]Member, error) {
+	return m.members, nil
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Comment, error) {
+	if comment, ok := m.comments[id]; ok {
+		return comment, nil
+	}
+	return entity.Comment{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.Comment, error) {
+	var result []entity.Comment
+	for _, id := range m.order {
+		if m.comments[id].TransactionId == transactionId {
+			result = append(result, m.comments[id])
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, comment entity.Comment) error {
+	m.comments[comment.ID] = comment
+	m.order = append(m.order, comment.ID)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, comment entity.Comment) error {
+	m.comments[comment.ID] = comment
+	return nil
+}
+
+func (m *mockRepository) QueryReactions(ctx context.Context, transactionId string) ([]entity.Reaction, error) {
+	var result []entity.Reaction
+	for _, reaction := range m.reactions {
+		if reaction.TransactionId == transactionId {
+			result = append(result, reaction)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) CreateReaction(ctx context.Context, reaction entity.Reaction) error {
+	for _, r := range m.reactions {
+		if r.TransactionId == reaction.TransactionId && r.CommentId == reaction.CommentId && r.UserId == reaction.UserId && r.Emoji == reaction.Emoji {
+			return nil
+		}
+	}
+	m.reactions = append(m.reactions, reaction)
+	return nil
+}
+
+func (m *mockRepository) DeleteReaction(ctx context.Context, transactionId, commentId, userId, emoji string) error {
+	var result []entity.Reaction
+	for _, r := range m.reactions {
+		if !(r.TransactionId == transactionId && r.CommentId == commentId && r.UserId == userId && r.Emoji == emoji) {
+			result = append(result, r)
+		}
+	}
+	m.reactions = result
+	return nil
+}
+
+type mockNotificationService struct {
+	notification.Service
+	requests []notification.NotifyRequest
+}
+
+func (m *mockNotificationService) Notify(ctx context.Context, req notification.NotifyRequest) {
+	m.requests = append(m.requests, req)
+}
+
+type mockPublisher struct{}
+
+func (mockPublisher) Publish(ctx context.Context, event realtime.Event) {}
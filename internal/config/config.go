@@ -3,33 +3,162 @@ package config
 import (
 	"github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/qiangxue/go-env"
-	"tribbie/pkg/log"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
+	"tribbie/pkg/log"
 )
 
 const (
-	defaultServerPort         = 8080
-	defaultJWTExpirationHours = 72
+	defaultServerPort                   = 8080
+	defaultAccessTokenExpirationMinutes = 15
+	defaultRefreshTokenExpirationHours  = 720
+	defaultMailer                       = "file"
+	defaultMailDir                      = "./mail"
+	defaultSMTPPort                     = 587
+	defaultAppleKeysURL                 = "https://appleid.apple.com/auth/keys"
+	defaultAppleKeysCacheTTL            = 24
+	defaultJWTActiveKey                 = "default"
+	defaultJWTIssuer                    = "tribbie"
+	defaultJWTAudience                  = "tribbie"
+	defaultReminderScanInterval         = 15
+	defaultReminderQuietHoursStart      = 22
+	defaultReminderQuietHoursEnd        = 8
+	defaultWebhookPollInterval          = 5
+	defaultBlobStore                    = "local"
+	defaultBlobDir                      = "./blobs"
+	defaultS3Region                     = "us-east-1"
+	defaultAttachmentMaxSize            = 10
+	defaultAttachmentURLExpiration      = 15
+	defaultPhotoMaxSize                 = 20
 )
 
+// defaultReminderCadence is the number of days between payment reminders.
+var defaultReminderCadence = []int{1, 3, 7}
+
 // Config represents an application configuration.
 type Config struct {
 	// the server port. Defaults to 8080
 	ServerPort int `yaml:"server_port" env:"SERVER_PORT"`
+	// the IP addresses or CIDR ranges of the reverse proxies whose X-Forwarded-For header is trusted.
+	// The header is ignored if empty.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
 	// the data source name (DSN) for connecting to the database. required.
 	DSN string `yaml:"dsn" env:"DSN,secret"`
-	// JWT signing key. required.
+	// JWT signing key, registered as the HS256 key with ID "default". required unless JWTKeys is set.
 	JWTSigningKey string `yaml:"jwt_signing_key" env:"JWT_SIGNING_KEY,secret"`
-	// JWT expiration in hours. Defaults to 72 hours (3 days)
-	JWTExpiration int `yaml:"jwt_expiration" env:"JWT_EXPIRATION"`
+	// additional JWT keys. Keeping a retired key here lets tokens signed with it remain valid after a rotation.
+	JWTKeys []JWTKey `yaml:"jwt_keys" env:"-"`
+	// the ID of the key used to sign new tokens. Defaults to "default".
+	JWTActiveKey string `yaml:"jwt_active_key" env:"JWT_ACTIVE_KEY"`
+	// the issuer and audience of access tokens. Both default to "tribbie".
+	JWTIssuer   string `yaml:"jwt_issuer" env:"JWT_ISSUER"`
+	JWTAudience string `yaml:"jwt_audience" env:"JWT_AUDIENCE"`
+	// the base64-encoded 32-byte key used to encrypt payout details. required.
+	PayoutEncryptionKey string `yaml:"payout_encryption_key" env:"PAYOUT_ENCRYPTION_KEY,secret"`
+	// access token (JWT) expiration in minutes. Defaults to 15 minutes
+	AccessTokenExpiration int `yaml:"access_token_expiration" env:"ACCESS_TOKEN_EXPIRATION"`
+	// refresh token expiration in hours. Defaults to 720 hours (30 days)
+	RefreshTokenExpiration int `yaml:"refresh_token_expiration" env:"REFRESH_TOKEN_EXPIRATION"`
+	// the Sign in with Apple client ID (bundle or services ID) expected as the identity token audience.
+	AppleClientID string `yaml:"apple_client_id" env:"APPLE_CLIENT_ID"`
+	// the URL of Apple's JWKS. Defaults to https://appleid.apple.com/auth/keys
+	AppleKeysURL string `yaml:"apple_keys_url" env:"APPLE_KEYS_URL"`
+	// a local JWKS file used instead of AppleKeysURL, e.g. for local development.
+	AppleKeysFile string `yaml:"apple_keys_file" env:"APPLE_KEYS_FILE"`
+	// how long the Apple JWKS is cached in hours. Defaults to 24 hours.
+	AppleKeysCacheTTL int `yaml:"apple_keys_cache_ttl" env:"APPLE_KEYS_CACHE_TTL"`
+	// the base URL of the client application used in emailed links.
+	AppURL string `yaml:"app_url" env:"APP_URL"`
+	// the mailer implementation: "smtp" or "file". Defaults to "file".
+	Mailer string `yaml:"mailer" env:"MAILER"`
+	// the directory the file mailer writes messages to. Defaults to ./mail
+	MailDir string `yaml:"mail_dir" env:"MAIL_DIR"`
+	// the sender address of outgoing emails.
+	MailFrom string `yaml:"mail_from" env:"MAIL_FROM"`
+	// the SMTP server settings used by the smtp mailer.
+	SMTPHost     string `yaml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `yaml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" env:"SMTP_PASSWORD,secret"`
+	// the number of days between reminders of a pending payment. The first reminder is sent the given days after
+	// the payment was requested and the last interval repeats. Defaults to [1, 3, 7].
+	ReminderCadence []int `yaml:"reminder_cadence" env:"REMINDER_CADENCE"`
+	// how often the payment reminders are checked in minutes. Defaults to 15 minutes.
+	ReminderScanInterval int `yaml:"reminder_scan_interval" env:"REMINDER_SCAN_INTERVAL"`
+	// the hours of the day, in the time zone of the payer, during which no reminders are sent. Defaults to 22-8.
+	ReminderQuietHoursStart int `yaml:"reminder_quiet_hours_start" env:"REMINDER_QUIET_HOURS_START"`
+	ReminderQuietHoursEnd   int `yaml:"reminder_quiet_hours_end" env:"REMINDER_QUIET_HOURS_END"`
+	// how often the queued webhook deliveries are sent in seconds. Defaults to 5 seconds.
+	WebhookPollInterval int `yaml:"webhook_poll_interval" env:"WEBHOOK_POLL_INTERVAL"`
+	// the blob store keeping uploaded files: "local" or "s3". Defaults to "local".
+	BlobStore string `yaml:"blob_store" env:"BLOB_STORE"`
+	// the directory the local blob store writes files to. Defaults to ./blobs
+	BlobDir string `yaml:"blob_dir" env:"BLOB_DIR"`
+	// the S3-compatible service used by the s3 blob store, e.g. https://s3.ap-southeast-1.amazonaws.com or a MinIO
+	// server. The region defaults to us-east-1.
+	S3Endpoint  string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region    string `yaml:"s3_region" env:"S3_REGION"`
+	S3Bucket    string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey string `yaml:"s3_access_key" env:"S3_ACCESS_KEY"`
+	S3SecretKey string `yaml:"s3_secret_key" env:"S3_SECRET_KEY,secret"`
+	// the largest accepted attachment in megabytes. Defaults to 10 MB.
+	AttachmentMaxSize int `yaml:"attachment_max_size" env:"ATTACHMENT_MAX_SIZE"`
+	// the largest accepted album photo in megabytes. Defaults to 20 MB.
+	PhotoMaxSize int `yaml:"photo_max_size" env:"PHOTO_MAX_SIZE"`
+	// how long attachment and photo download URLs stay valid in minutes. Defaults to 15 minutes.
+	AttachmentURLExpiration int `yaml:"attachment_url_expiration" env:"ATTACHMENT_URL_EXPIRATION"`
+	// the key signing attachment and photo download URLs. required.
+	AttachmentURLKey string `yaml:"attachment_url_key" env:"ATTACHMENT_URL_KEY,secret"`
+	// the key signing pagination cursors. required.
+	CursorKey string `yaml:"cursor_key" env:"CURSOR_KEY,secret"`
+	// the .p8 APNs authentication key file. Push notifications to iOS devices are disabled if empty.
+	APNsKeyFile string `yaml:"apns_key_file" env:"APNS_KEY_FILE"`
+	// the ID of the APNs authentication key and the ID of the team it was issued to.
+	APNsKeyID  string `yaml:"apns_key_id" env:"APNS_KEY_ID"`
+	APNsTeamID string `yaml:"apns_team_id" env:"APNS_TEAM_ID"`
+	// the bundle ID of the iOS app.
+	APNsTopic string `yaml:"apns_topic" env:"APNS_TOPIC"`
+	// whether to use the production APNs environment instead of the sandbox.
+	APNsProduction bool `yaml:"apns_production" env:"APNS_PRODUCTION"`
+}
+
+// JWTKey represents a key used to sign or verify access tokens.
+type JWTKey struct {
+	// the key ID written to the "kid" header of the tokens it signs.
+	ID string `yaml:"id"`
+	// the signing algorithm: HS256, RS256 or EdDSA. Defaults to HS256.
+	Algorithm string `yaml:"algorithm"`
+	// the shared secret of an HS256 key.
+	Secret string `yaml:"secret"`
+	// the PEM files of an RS256 or EdDSA key. The private key may be omitted for a retired key.
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
 }
 
 // Validate validates the application configuration.
 func (c Config) Validate() error {
 	return validation.ValidateStruct(&c,
 		validation.Field(&c.DSN, validation.Required),
-		validation.Field(&c.JWTSigningKey, validation.Required),
+		validation.Field(&c.JWTSigningKey, validation.When(len(c.JWTKeys) == 0, validation.Required)),
+		validation.Field(&c.PayoutEncryptionKey, validation.Required),
+		validation.Field(&c.Mailer, validation.In("smtp", "file")),
+		validation.Field(&c.SMTPHost, validation.When(c.Mailer == "smtp", validation.Required)),
+		validation.Field(&c.ReminderCadence, validation.Required, validation.Each(validation.Min(1))),
+		validation.Field(&c.ReminderScanInterval, validation.Min(1)),
+		validation.Field(&c.ReminderQuietHoursStart, validation.Min(0), validation.Max(23)),
+		validation.Field(&c.ReminderQuietHoursEnd, validation.Min(0), validation.Max(23)),
+		validation.Field(&c.WebhookPollInterval, validation.Min(1)),
+		validation.Field(&c.BlobStore, validation.In("local", "s3")),
+		validation.Field(&c.S3Endpoint, validation.When(c.BlobStore == "s3", validation.Required)),
+		validation.Field(&c.S3Bucket, validation.When(c.BlobStore == "s3", validation.Required)),
+		validation.Field(&c.AttachmentMaxSize, validation.Min(1)),
+		validation.Field(&c.AttachmentURLExpiration, validation.Min(1)),
+		validation.Field(&c.PhotoMaxSize, validation.Min(1)),
+		validation.Field(&c.AttachmentURLKey, validation.Required),
+		validation.Field(&c.CursorKey, validation.Required),
+		validation.Field(&c.APNsKeyID, validation.When(c.APNsKeyFile != "", validation.Required)),
+		validation.Field(&c.APNsTeamID, validation.When(c.APNsKeyFile != "", validation.Required)),
+		validation.Field(&c.APNsTopic, validation.When(c.APNsKeyFile != "", validation.Required)),
 	)
 }
 
@@ -37,8 +166,28 @@ func (c Config) Validate() error {
 func Load(file string, logger log.Logger) (*Config, error) {
 	// default config
 	c := Config{
-		ServerPort:    defaultServerPort,
-		JWTExpiration: defaultJWTExpirationHours,
+		ServerPort:              defaultServerPort,
+		AccessTokenExpiration:   defaultAccessTokenExpirationMinutes,
+		RefreshTokenExpiration:  defaultRefreshTokenExpirationHours,
+		Mailer:                  defaultMailer,
+		MailDir:                 defaultMailDir,
+		SMTPPort:                defaultSMTPPort,
+		AppleKeysURL:            defaultAppleKeysURL,
+		AppleKeysCacheTTL:       defaultAppleKeysCacheTTL,
+		JWTActiveKey:            defaultJWTActiveKey,
+		JWTIssuer:               defaultJWTIssuer,
+		JWTAudience:             defaultJWTAudience,
+		ReminderCadence:         defaultReminderCadence,
+		ReminderScanInterval:    defaultReminderScanInterval,
+		ReminderQuietHoursStart: defaultReminderQuietHoursStart,
+		ReminderQuietHoursEnd:   defaultReminderQuietHoursEnd,
+		WebhookPollInterval:     defaultWebhookPollInterval,
+		BlobStore:               defaultBlobStore,
+		BlobDir:                 defaultBlobDir,
+		S3Region:                defaultS3Region,
+		AttachmentMaxSize:       defaultAttachmentMaxSize,
+		AttachmentURLExpiration: defaultAttachmentURLExpiration,
+		PhotoMaxSize:            defaultPhotoMaxSize,
 	}
 
 	// load from YAML config file
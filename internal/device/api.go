@@ -0,0 +1,71 @@
+package device
+
+import (
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/devices", authHandler, res.query)
+	r.Post("/devices", authHandler, res.register)
+	r.Delete("/devices/<id>", authHandler, res.delete)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the devices of the current user.
+func (r resource) query(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	devices, err := r.service.Query(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, devices)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// register adds a device to the current user.
+func (r resource) register(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input RegisterDeviceRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	device, err := r.service.Register(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(device, http.StatusCreated)
+}
+
+// delete removes a device of the current user.
+func (r resource) delete(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	device, err := r.service.Delete(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(device)
+}
@@ -0,0 +1,77 @@
+package device
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access devices from the data source.
+type Repository interface {
+	// Get returns the device with the specified ID.
+	Get(ctx context.Context, id string) (entity.Device, error)
+	// GetByPushToken returns the device with the specified push token.
+	GetByPushToken(ctx context.Context, token string) (entity.Device, error)
+	// QueryByUser returns the devices of the specified user.
+	QueryByUser(ctx context.Context, userId string) ([]entity.Device, error)
+	// Create saves a new device in the storage.
+	Create(ctx context.Context, device entity.Device) error
+	// Update updates the device with given ID in the storage.
+	Update(ctx context.Context, device entity.Device) error
+	// Delete removes the device with given ID from the storage.
+	Delete(ctx context.Context, id string) error
+}
+
+// repository persists devices in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new device repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the device with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Device, error) {
+	var device entity.Device
+	err := r.db.With(ctx).Select().Model(id, &device)
+	return device, err
+}
+
+// GetByPushToken reads the device with the specified push token from the database.
+func (r repository) GetByPushToken(ctx context.Context, token string) (entity.Device, error) {
+	var device entity.Device
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"push_token": token}).One(&device)
+	return device, err
+}
+
+// QueryByUser retrieves the devices of the user from the database.
+func (r repository) QueryByUser(ctx context.Context, userId string) ([]entity.Device, error) {
+	var devices []entity.Device
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"user_id": userId}).OrderBy("created_at").All(&devices)
+	return devices, err
+}
+
+// Create saves a new device record in the database.
+func (r repository) Create(ctx context.Context, device entity.Device) error {
+	return r.db.With(ctx).Model(&device).Insert()
+}
+
+// Update saves the changes to a device in the database.
+func (r repository) Update(ctx context.Context, device entity.Device) error {
+	return r.db.With(ctx).Model(&device).Update()
+}
+
+// Delete deletes the device with the specified ID from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	device, err := r.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	return r.db.With(ctx).Model(&device).Delete()
+}
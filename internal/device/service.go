@@ -0,0 +1,164 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/push"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// maxFailures is the number of consecutive failed deliveries after which a device is removed.
+const maxFailures = 5
+
+// Service encapsulates usecase logic for devices.
+type Service interface {
+	// Query returns the devices of the user.
+	Query(ctx context.Context, userId string) ([]Device, error)
+	// Register adds a device to the user, or updates it if its push token is already registered.
+	Register(ctx context.Context, userId string, input RegisterDeviceRequest) (Device, error)
+	// Delete removes a device of the user.
+	Delete(ctx context.Context, userId, id string) (Device, error)
+	// Push sends the message to all devices of the user. Devices whose token is rejected, or which keep failing,
+	// are removed.
+	Push(ctx context.Context, userId string, msg push.Message) error
+}
+
+// Device represents the data about a device.
+type Device struct {
+	entity.Device
+}
+
+// RegisterDeviceRequest represents a device registration request.
+type RegisterDeviceRequest struct {
+	Platform  string `json:"platform"`
+	PushToken string `json:"push_token"`
+	Name      string `json:"name"`
+}
+
+// Validate validates the RegisterDeviceRequest fields.
+func (m RegisterDeviceRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Platform, validation.Required, validation.In(entity.DevicePlatformIOS, entity.DevicePlatformAndroid)),
+		validation.Field(&m.PushToken, validation.Required, validation.Length(1, 512)),
+		validation.Field(&m.Name, validation.Length(0, 128)),
+	)
+}
+
+type service struct {
+	repo    Repository
+	senders map[string]push.Sender
+	logger  log.Logger
+}
+
+// NewService creates a new device service. The senders deliver push notifications per device platform;
+// devices of a platform without a sender are skipped.
+func NewService(repo Repository, senders map[string]push.Sender, logger log.Logger) Service {
+	return service{repo, senders, logger}
+}
+
+// Query returns the devices of the user.
+func (s service) Query(ctx context.Context, userId string) ([]Device, error) {
+	items, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := []Device{}
+	for _, item := range items {
+		result = append(result, Device{item})
+	}
+	return result, nil
+}
+
+// Register adds a device to the user. A push token identifies a device, so registering a token known from
+// another account moves the device to the user.
+func (s service) Register(ctx context.Context, userId string, req RegisterDeviceRequest) (Device, error) {
+	if err := req.Validate(); err != nil {
+		return Device{}, err
+	}
+	now := time.Now()
+	device, err := s.repo.GetByPushToken(ctx, req.PushToken)
+	if err == sql.ErrNoRows {
+		device = entity.Device{
+			ID:        entity.GenerateID(),
+			UserId:    userId,
+			Platform:  req.Platform,
+			PushToken: req.PushToken,
+			Name:      req.Name,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := s.repo.Create(ctx, device); err != nil {
+			return Device{}, err
+		}
+		return Device{device}, nil
+	} else if err != nil {
+		return Device{}, err
+	}
+
+	device.UserId = userId
+	device.Platform = req.Platform
+	device.Name = req.Name
+	device.FailureCount = 0
+	device.UpdatedAt = now
+	if err := s.repo.Update(ctx, device); err != nil {
+		return Device{}, err
+	}
+	return Device{device}, nil
+}
+
+// Delete removes the device with the specified ID from the devices of the user.
+func (s service) Delete(ctx context.Context, userId, id string) (Device, error) {
+	device, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows || err == nil && device.UserId != userId {
+		return Device{}, errors.NotFound("")
+	} else if err != nil {
+		return Device{}, err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return Device{}, err
+	}
+	return Device{device}, nil
+}
+
+// Push sends the message to every device of the user. Failures of single devices are logged rather than
+// returned so that one broken device does not prevent the delivery to the others.
+func (s service) Push(ctx context.Context, userId string, msg push.Message) error {
+	devices, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		sender := s.senders[device.Platform]
+		if sender == nil {
+			continue
+		}
+		msg.Token = device.PushToken
+		err := sender.Send(ctx, msg)
+		if err == push.ErrInvalidToken || err != nil && device.FailureCount+1 >= maxFailures {
+			s.logger.With(ctx).Infof("removing device %v after a failed push: %v", device.ID, err)
+			if err := s.repo.Delete(ctx, device.ID); err != nil {
+				s.logger.With(ctx).Error(err)
+			}
+			continue
+		}
+
+		now := time.Now()
+		if err != nil {
+			s.logger.With(ctx).Errorf("failed to push to device %v: %v", device.ID, err)
+			device.FailureCount++
+		} else {
+			device.FailureCount = 0
+			device.LastPushedAt = &now
+		}
+		device.UpdatedAt = now
+		if err := s.repo.Update(ctx, device); err != nil {
+			s.logger.With(ctx).Error(err)
+		}
+	}
+	return nil
+}
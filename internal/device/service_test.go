@@ -0,0 +1,132 @@
+package device
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/push"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_Register(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, nil, logger)
+	ctx := context.Background()
+
+	_, err := s.Register(ctx, "alice", RegisterDeviceRequest{Platform: "windows", PushToken: "token"})
+	assert.NotNil(t, err)
+
+	device, err := s.Register(ctx, "alice", RegisterDeviceRequest{Platform: entity.DevicePlatformIOS, PushToken: "token", Name: "iPhone"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", device.UserId)
+
+	// registering the same token again moves the device instead of duplicating it
+	moved, err := s.Register(ctx, "bob", RegisterDeviceRequest{Platform: entity.DevicePlatformIOS, PushToken: "token", Name: "iPhone"})
+	assert.Nil(t, err)
+	assert.Equal(t, device.ID, moved.ID)
+	assert.Len(t, repo.items, 1)
+	assert.Equal(t, "bob", repo.items[0].UserId)
+
+	_, err = s.Delete(ctx, "alice", device.ID)
+	assert.NotNil(t, err)
+	_, err = s.Delete(ctx, "bob", device.ID)
+	assert.Nil(t, err)
+	assert.Empty(t, repo.items)
+}
+
+func Test_service_Push(t *testing.T) {
+	logger, _ := log.NewForTest()
+	sender := push.NewMemory()
+	repo := &mockRepository{items: []entity.Device{
+		{ID: "1", UserId: "alice", Platform: entity.DevicePlatformIOS, PushToken: "good"},
+		{ID: "2", UserId: "alice", Platform: entity.DevicePlatformIOS, PushToken: "gone"},
+		{ID: "3", UserId: "alice", Platform: entity.DevicePlatformIOS, PushToken: "flaky"},
+		{ID: "4", UserId: "alice", Platform: entity.DevicePlatformAndroid, PushToken: "android"},
+		{ID: "5", UserId: "bob", Platform: entity.DevicePlatformIOS, PushToken: "bob"},
+	}}
+	s := NewService(repo, map[string]push.Sender{entity.DevicePlatformIOS: sender}, logger)
+	ctx := context.Background()
+	sender.Fail("gone", push.ErrInvalidToken)
+	sender.Fail("flaky", errors.New("timeout"))
+
+	assert.Nil(t, s.Push(ctx, "alice", push.Message{Title: "Payment requested"}))
+	if assert.Len(t, sender.Messages(), 1) {
+		assert.Equal(t, "good", sender.Messages()[0].Token)
+	}
+	// the unregistered token is removed at once, the failing one is kept for now
+	_, err := repo.Get(ctx, "2")
+	assert.Equal(t, sql.ErrNoRows, err)
+	flaky, _ := repo.Get(ctx, "3")
+	assert.Equal(t, 1, flaky.FailureCount)
+	good, _ := repo.Get(ctx, "1")
+	assert.NotNil(t, good.LastPushedAt)
+
+	for i := 1; i < maxFailures; i++ {
+		assert.Nil(t, s.Push(ctx, "alice", push.Message{Title: "Payment requested"}))
+	}
+	_, err = repo.Get(ctx, "3")
+	assert.Equal(t, sql.ErrNoRows, err)
+	_, err = repo.Get(ctx, "4")
+	assert.Nil(t, err)
+}
+
+type mockRepository struct {
+	items []entity.Device
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Device, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Device{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByPushToken(ctx context.Context, token string) (entity.Device, error) {
+	for _, item := range m.items {
+		if item.PushToken == token {
+			return item, nil
+		}
+	}
+	return entity.Device{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryByUser(ctx context.Context, userId string) ([]entity.Device, error) {
+	var items []entity.Device
+	for _, item := range m.items {
+		if item.UserId == userId {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, device entity.Device) error {
+	m.items = append(m.items, device)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, device entity.Device) error {
+	for i, item := range m.items {
+		if item.ID == device.ID {
+			m.items[i] = device
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// AccessTokenScopeRead allows read-only requests.
+	AccessTokenScopeRead = "read"
+	// AccessTokenScopeWrite allows every request a signed-in user can make, except managing access tokens.
+	AccessTokenScopeWrite = "write"
+	// AccessTokenScopeTrip allows read and write requests limited to a single trip.
+	AccessTokenScopeTrip = "trip"
+)
+
+// AccessToken represents a personal access token a user created for an integration. Only the hash of the token is stored.
+type AccessToken struct {
+	ID         string     `json:"id"`
+	UserId     string     `json:"user_id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	TripId     string     `json:"trip_id,omitempty"`
+	TokenHash  string     `json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIp string     `json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// IsActive returns whether the access token can still be used at the given time.
+func (t AccessToken) IsActive(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || now.Before(*t.ExpiresAt))
+}
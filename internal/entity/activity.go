@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// ActivityTripCreated is recorded when a trip is created.
+	ActivityTripCreated = "trip.created"
+	// ActivityTripUpdated is recorded when the details of a trip change.
+	ActivityTripUpdated = "trip.updated"
+	// ActivityTripStatusChanged is recorded when a trip moves to another lifecycle status.
+	ActivityTripStatusChanged = "trip.status_changed"
+	// ActivityMemberAdded is recorded when a member is added to a trip or joins it.
+	ActivityMemberAdded = "member.added"
+	// ActivityMemberRemoved is recorded when a member is removed from a trip.
+	ActivityMemberRemoved = "member.removed"
+	// ActivityTransactionCreated is recorded when a transaction is added to a trip.
+	ActivityTransactionCreated = "transaction.created"
+	// ActivityTransactionUpdated is recorded when a transaction of a trip changes.
+	ActivityTransactionUpdated = "transaction.updated"
+	// ActivityTransactionDeleted is recorded when a transaction is removed from a trip.
+	ActivityTransactionDeleted = "transaction.deleted"
+	// ActivityPaymentPaid is recorded when the payer reports a payment as paid.
+	ActivityPaymentPaid = "payment.paid"
+	// ActivityPaymentConfirmed is recorded when the recipient confirms a payment.
+	ActivityPaymentConfirmed = "payment.confirmed"
+)
+
+// Activity represents a change of a trip in a human-readable form, e.g. "Budi added Dinner at Jimbaran — Rp 850.000".
+// The subject is the record the change is about, e.g. the transaction or the payment.
+type Activity struct {
+	ID        string    `json:"id"`
+	TripId    string    `json:"trip_id"`
+	ActorId   string    `json:"actor_id"`
+	Kind      string    `json:"kind"`
+	SubjectId string    `json:"subject_id"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
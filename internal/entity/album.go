@@ -4,10 +4,34 @@ import (
 	"time"
 )
 
-// Album represents an album record.
+// Album represents a photo album of a trip.
 type Album struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          string    `json:"id"`
+	TripId      string    `json:"trip_id"`
+	UserId      string    `json:"user_id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Photo represents a photo uploaded to an album. The capture time and location are read from the EXIF data of the
+// photo and are nil when it does not record them.
+type Photo struct {
+	ID           string     `json:"id"`
+	AlbumId      string     `json:"album_id"`
+	TripId       string     `json:"trip_id"`
+	UserId       string     `json:"user_id"`
+	Caption      string     `json:"caption"`
+	ContentType  string     `json:"content_type"`
+	Size         int64      `json:"size"`
+	Width        int        `json:"width"`
+	Height       int        `json:"height"`
+	TakenAt      *time.Time `json:"taken_at"`
+	Latitude     *float64   `json:"latitude"`
+	Longitude    *float64   `json:"longitude"`
+	StorageKey   string     `json:"-"`
+	ThumbnailKey string     `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
@@ -0,0 +1,23 @@
+package entity
+
+import (
+	"time"
+)
+
+// Attachment represents a file uploaded to a transaction or a payment, e.g. a receipt photo or a transfer proof.
+// Width and height are set for images only, and images in a supported format also have a thumbnail.
+type Attachment struct {
+	ID            string    `json:"id"`
+	TripId        string    `json:"trip_id"`
+	TransactionId string    `json:"transaction_id"`
+	PaymentId     string    `json:"payment_id"`
+	UserId        string    `json:"user_id"`
+	FileName      string    `json:"file_name"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	Width         int       `json:"width"`
+	Height        int       `json:"height"`
+	StorageKey    string    `json:"-"`
+	ThumbnailKey  string    `json:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"time"
+)
+
+// Comment represents a message about a transaction. Replies refer to the comment they answer as their parent.
+// Deleted comments keep their place in the thread without their body.
+type Comment struct {
+	ID            string     `json:"id"`
+	TransactionId string     `json:"transaction_id"`
+	TripId        string     `json:"trip_id"`
+	UserId        string     `json:"user_id"`
+	ParentId      string     `json:"parent_id"`
+	Body          string     `json:"body"`
+	DeletedAt     *time.Time `json:"deleted_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsDeleted returns whether the comment was deleted.
+func (c Comment) IsDeleted() bool {
+	return c.DeletedAt != nil
+}
+
+// Reaction represents an emoji a user reacted with to a transaction, or to one of its comments if CommentId is set.
+type Reaction struct {
+	ID            string    `json:"id"`
+	TransactionId string    `json:"transaction_id"`
+	CommentId     string    `json:"comment_id"`
+	UserId        string    `json:"user_id"`
+	Emoji         string    `json:"emoji"`
+	CreatedAt     time.Time `json:"created_at"`
+}
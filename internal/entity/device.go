@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// DevicePlatformIOS marks a device receiving push notifications through APNs.
+	DevicePlatformIOS = "ios"
+	// DevicePlatformAndroid marks a device receiving push notifications through FCM.
+	DevicePlatformAndroid = "android"
+)
+
+// Device represents a device of a user that can receive push notifications.
+type Device struct {
+	ID           string     `json:"id"`
+	UserId       string     `json:"user_id"`
+	Platform     string     `json:"platform"`
+	PushToken    string     `json:"push_token"`
+	Name         string     `json:"name"`
+	FailureCount int        `json:"-"`
+	LastPushedAt *time.Time `json:"last_pushed_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,15 @@
+package entity
+
+import (
+	"time"
+)
+
+// Friendship represents a friend a user added explicitly by username.
+// Friends are also derived from shared trips without being stored.
+type Friendship struct {
+	ID        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	FriendId  string    `json:"friend_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
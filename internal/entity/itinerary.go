@@ -0,0 +1,37 @@
+package entity
+
+import (
+	"time"
+)
+
+// ItineraryDay represents a day of the itinerary of a trip. The date is formatted as YYYY-MM-DD.
+type ItineraryDay struct {
+	ID        string    `json:"id"`
+	TripId    string    `json:"trip_id"`
+	Date      string    `json:"date"`
+	Title     string    `json:"title"`
+	Notes     string    `json:"notes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ItineraryEntry represents a planned activity of an itinerary day. Entries are ordered by position within their
+// day. The start and end times are formatted as HH:MM in the time zone of the trip and are empty for entries
+// lasting the whole day. The estimated cost is in the currency of the trip, and the entry can be linked to the
+// transaction that paid for it.
+type ItineraryEntry struct {
+	ID               string    `json:"id"`
+	TripId           string    `json:"trip_id"`
+	DayId            string    `json:"day_id"`
+	Position         int       `json:"position"`
+	Activity         string    `json:"activity"`
+	Place            string    `json:"place"`
+	StartTime        string    `json:"start_time"`
+	EndTime          string    `json:"end_time"`
+	Notes            string    `json:"notes"`
+	BookingReference string    `json:"booking_reference"`
+	EstimatedCost    int64     `json:"estimated_cost"`
+	TransactionId    string    `json:"transaction_id"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
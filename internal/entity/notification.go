@@ -0,0 +1,45 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// NotificationTripMemberAdded is sent to a user added to a trip.
+	NotificationTripMemberAdded = "trip_member.added"
+	// NotificationExpenseIncluded is sent to a user included in an expense.
+	NotificationExpenseIncluded = "expense.included"
+	// NotificationPaymentRequested is sent to the payer of a requested payment.
+	NotificationPaymentRequested = "payment.requested"
+	// NotificationPaymentReminder is sent to the payer of a payment that is still pending.
+	NotificationPaymentReminder = "payment.reminder"
+	// NotificationPaymentSent is sent to the recipient of a payment the payer reported as paid.
+	NotificationPaymentSent = "payment.sent"
+	// NotificationPaymentConfirmed is sent to the payer of a payment the recipient confirmed.
+	NotificationPaymentConfirmed = "payment.confirmed"
+	// NotificationCommentMentioned is sent to a user mentioned in a comment on a transaction.
+	NotificationCommentMentioned = "comment.mentioned"
+	// NotificationBudgetExceeded is sent to the members of a trip whose spending exceeded its budget.
+	NotificationBudgetExceeded = "trip.budget_exceeded"
+)
+
+// Notification represents an event relevant to a user.
+// The subject is the record the event is about, e.g. the transaction or the payment.
+type Notification struct {
+	ID        string     `json:"id"`
+	UserId    string     `json:"user_id"`
+	ActorId   string     `json:"actor_id"`
+	Kind      string     `json:"kind"`
+	TripId    string     `json:"trip_id"`
+	SubjectId string     `json:"subject_id"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// IsRead returns whether the user has read the notification.
+func (n Notification) IsRead() bool {
+	return n.ReadAt != nil
+}
@@ -0,0 +1,17 @@
+package entity
+
+import (
+	"time"
+)
+
+// RefreshToken represents a single-use refresh token. Only the hash of the token is stored.
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	SessionId string     `json:"session_id"`
+	UserId    string     `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
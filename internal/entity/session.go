@@ -0,0 +1,19 @@
+package entity
+
+import (
+	"time"
+)
+
+// Session represents a login session. All refresh tokens rotated from the same login belong to one session.
+type Session struct {
+	ID        string     `json:"id"`
+	UserId    string     `json:"user_id"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// IsActive tells whether the session has not been revoked.
+func (s Session) IsActive() bool {
+	return s.RevokedAt == nil
+}
@@ -4,15 +4,33 @@ import (
 	"time"
 )
 
+const (
+	// PaymentStatusPending marks a payment that was requested but not paid yet.
+	PaymentStatusPending = "pending"
+	// PaymentStatusPaid marks a payment the payer reported as paid but the recipient has not confirmed yet.
+	PaymentStatusPaid = "paid"
+	// PaymentStatusConfirmed marks a payment the recipient confirmed. Only confirmed payments settle debts.
+	PaymentStatusConfirmed = "confirmed"
+)
+
 type TransactionPayment struct {
-	ID            string    `json:"id"`
-	TripId        string    `json:"trip_id"`
-	TripMemberId  string    `json:"trip_member_id"`
-	TransactionId string    `json:"transaction_id"`
-	UserFromId    string    `json:"user_from_id"`
-	UserToId      string    `json:"user_to_id"`
-	Nominal       int64     `json:"nominal"`
-	Status        string    `json:"status"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID             string     `json:"id"`
+	TripId         string     `json:"trip_id"`
+	TripMemberId   string     `json:"trip_member_id"`
+	TransactionId  string     `json:"transaction_id"`
+	UserFromId     string     `json:"user_from_id"`
+	UserToId       string     `json:"user_to_id"`
+	Nominal        int64      `json:"nominal"`
+	Currency       string     `json:"currency"`
+	Status         string     `json:"status"`
+	ReminderCount  int        `json:"reminder_count"`
+	LastRemindedAt *time.Time `json:"last_reminded_at"`
+	NextReminderAt *time.Time `json:"next_reminder_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// IsConfirmed returns whether the recipient confirmed the payment.
+func (p TransactionPayment) IsConfirmed() bool {
+	return p.Status == PaymentStatusConfirmed
 }
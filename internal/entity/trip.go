@@ -4,11 +4,53 @@ import (
 	"time"
 )
 
+const (
+	// TripStatusPlanning marks a trip that has not started yet. New trips start in this status.
+	TripStatusPlanning = "planning"
+	// TripStatusOngoing marks a trip that is taking place.
+	TripStatusOngoing = "ongoing"
+	// TripStatusSettling marks a trip that has ended and whose members are settling their debts.
+	TripStatusSettling = "settling"
+	// TripStatusClosed marks a settled trip. Its transactions can no longer change.
+	TripStatusClosed = "closed"
+	// TripStatusArchived marks a closed trip hidden from the default trip listings.
+	TripStatusArchived = "archived"
+)
+
+// TripStatuses lists the lifecycle statuses of trips in their usual order.
+var TripStatuses = []string{TripStatusPlanning, TripStatusOngoing, TripStatusSettling, TripStatusClosed, TripStatusArchived}
+
+// Trip represents a trip. The start and end dates are formatted as YYYY-MM-DD and are empty when not planned yet.
 type Trip struct {
 	ID        	string    `json:"id"`
 	Title      	string    `json:"title"`
 	Description string    `json:"description"`
 	Place	 	string    `json:"place"`
+	Currency	string    `json:"currency"`
+	TimeZone	string    `json:"time_zone"`
+	Budget		int64     `json:"budget"`
+	StartDate	string    `json:"start_date"`
+	EndDate		string    `json:"end_date"`
+	CoverImage	string    `json:"cover_image"`
+	Status		string    `json:"status"`
+	CreatedBy	string    `json:"created_by"`
 	CreatedAt 	time.Time `json:"created_at"`
 	UpdatedAt 	time.Time `json:"updated_at"`
 }
+
+// IsClosed returns whether the trip was closed, which freezes its transactions.
+func (t Trip) IsClosed() bool {
+	return t.Status == TripStatusClosed || t.Status == TripStatusArchived
+}
+
+// Location returns the time zone of the trip, or UTC if it has none or it is unknown.
+func (t Trip) Location() *time.Location {
+	if t.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(t.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -4,12 +4,26 @@ import (
 	"time"
 )
 
+const (
+	// TripMemberRoleMember marks a regular member of a trip.
+	TripMemberRoleMember = "member"
+	// TripMemberRoleAdmin marks a member who can close, archive and delete the trip. The creator of a trip is its
+	// first admin.
+	TripMemberRoleAdmin = "admin"
+)
+
 type TripMember struct {
 	ID        string    `json:"id"`
 	TripId    string    `json:"trip_id"`
 	UserId    string    `json:"user_id"`
 	Name      string    `json:"name"`
 	Status    string    `json:"status"`
+	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// IsAdmin returns whether the member can close, archive and delete the trip.
+func (m TripMember) IsAdmin() bool {
+	return m.Role == TripMemberRoleAdmin
+}
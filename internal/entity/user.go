@@ -1,21 +1,33 @@
 package entity
 
 import (
+	"strings"
 	"time"
 )
 
 // User represents a user.
 type UserDefault struct {
-	ID        string    `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	AppleId   string    `json:"apple_id"`
-	DeviceId  string    `json:"device_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                string     `json:"id"`
+	Username          string     `json:"username"`
+	Email             string     `json:"email"`
+	EmailVerifiedAt   *time.Time `json:"email_verified_at"`
+	Password          string     `json:"-"`
+	AppleId           string     `json:"apple_id"`
+	DeviceId          string     `json:"device_id"`
+	DisplayName       string     `json:"display_name"`
+	AvatarUrl         string     `json:"avatar_url"`
+	PreferredCurrency string     `json:"preferred_currency"`
+	Locale            string     `json:"locale"`
+	TimeZone          string     `json:"time_zone"`
+	PayoutDetails     string     `json:"-"`
+	DeletedAt         *time.Time `json:"deleted_at"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
+// DeletedUserName replaces the name of a user who deleted their account.
+const DeletedUserName = "Deleted user"
+
 // GetID returns the user ID.
 func (u UserDefault) GetID() string {
 	return u.ID
@@ -25,3 +37,24 @@ func (u UserDefault) GetID() string {
 func (u UserDefault) GetEmail() string {
 	return u.Email
 }
+
+// Payout represents the bank or e-wallet account a user wants to be paid to.
+type Payout struct {
+	// Method is either "bank" or "ewallet".
+	Method string `json:"method"`
+	// Provider is the name of the bank or e-wallet, e.g. "BCA" or "GoPay".
+	Provider      string `json:"provider"`
+	AccountName   string `json:"account_name"`
+	AccountNumber string `json:"account_number"`
+}
+
+// Masked returns a copy of the payout details in which all but the last four digits of the account number are hidden.
+func (p Payout) Masked() Payout {
+	visible := 4
+	if len(p.AccountNumber) <= visible {
+		visible = len(p.AccountNumber) / 2
+	}
+	hidden := len(p.AccountNumber) - visible
+	p.AccountNumber = strings.Repeat("*", hidden) + p.AccountNumber[hidden:]
+	return p
+}
@@ -0,0 +1,24 @@
+package entity
+
+import (
+	"time"
+)
+
+const (
+	// UserTokenEmailVerification is the purpose of tokens sent to verify an email address.
+	UserTokenEmailVerification = "email_verification"
+	// UserTokenPasswordReset is the purpose of tokens sent to reset a password.
+	UserTokenPasswordReset = "password_reset"
+)
+
+// UserToken represents a single-use token sent to a user by email. Only the hash of the token is stored.
+type UserToken struct {
+	ID        string     `json:"id"`
+	UserId    string     `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// WebhookEventTransactionCreated is delivered when a transaction is added to a trip.
+	WebhookEventTransactionCreated = "transaction.created"
+	// WebhookEventPaymentConfirmed is delivered when the recipient of a payment confirms it.
+	WebhookEventPaymentConfirmed = "payment.confirmed"
+	// WebhookEventMemberJoined is delivered when a user joins a trip.
+	WebhookEventMemberJoined = "member.joined"
+)
+
+const (
+	// WebhookDeliveryPending marks a delivery that has not succeeded yet and will be attempted again.
+	WebhookDeliveryPending = "pending"
+	// WebhookDeliverySucceeded marks a delivery the endpoint acknowledged with a 2xx response.
+	WebhookDeliverySucceeded = "succeeded"
+	// WebhookDeliveryFailed marks a delivery that failed all its attempts.
+	WebhookDeliveryFailed = "failed"
+)
+
+// Webhook represents an endpoint receiving the events of a trip, or of all trips of its owner if TripId is empty.
+// Events holds the comma-separated names of the events delivered to the endpoint.
+type Webhook struct {
+	ID        string    `json:"id"`
+	UserId    string    `json:"user_id"`
+	TripId    string    `json:"trip_id"`
+	Url       string    `json:"url"`
+	Events    string    `json:"events"`
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Subscribes returns whether the webhook receives the given event.
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range strings.Split(w.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery represents an event sent, or to be sent, to a webhook.
+type WebhookDelivery struct {
+	ID            string     `json:"id"`
+	WebhookId     string     `json:"webhook_id"`
+	EventId       string     `json:"event_id"`
+	Event         string     `json:"event"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	ResponseCode  int        `json:"response_code"`
+	Error         string     `json:"error"`
+	NextAttemptAt *time.Time `json:"next_attempt_at"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
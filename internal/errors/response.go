@@ -78,6 +78,39 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// Conflict creates a new error response representing a request conflicting with the state of the resource (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicts with the current state of the resource."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: msg,
+	}
+}
+
+// RequestEntityTooLarge creates a new error response representing an upload exceeding the size limit (HTTP 413)
+func RequestEntityTooLarge(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The uploaded content is too large."
+	}
+	return ErrorResponse{
+		Status:  http.StatusRequestEntityTooLarge,
+		Message: msg,
+	}
+}
+
+// UnsupportedMediaType creates a new error response representing an upload of an unsupported type (HTTP 415)
+func UnsupportedMediaType(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The type of the uploaded content is not supported."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnsupportedMediaType,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
@@ -0,0 +1,85 @@
+package friend
+
+import (
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/friends", authHandler, res.query)
+	r.Post("/friends", authHandler, res.add)
+	r.Get("/friends/<user_id>", authHandler, res.get)
+	r.Delete("/friends/<user_id>", authHandler, res.remove)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the friends of the current user with their running balances.
+func (r resource) query(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	friends, err := r.service.Query(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, friends)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// get returns a friend of the current user with the balances per trip and the shared transactions.
+func (r resource) get(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	friend, err := r.service.Get(c.Request.Context(), identity.GetID(), c.Param("user_id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(friend)
+}
+
+// add adds a friend to the current user by username.
+func (r resource) add(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input AddFriendRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	friend, err := r.service.Add(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(friend, http.StatusCreated)
+}
+
+// remove removes an explicitly added friend of the current user.
+func (r resource) remove(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if err := r.service.Remove(c.Request.Context(), identity.GetID(), c.Param("user_id")); err != nil {
+		return err
+	}
+	c.Response.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,56 @@
+package friend
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access friendships from the data source.
+type Repository interface {
+	// QueryByUser returns the friendships the specified user is part of, in either direction.
+	QueryByUser(ctx context.Context, userId string) ([]entity.Friendship, error)
+	// Create saves a new friendship in the storage.
+	Create(ctx context.Context, friendship entity.Friendship) error
+	// Delete removes the friendship between the two users, in either direction, from the storage.
+	Delete(ctx context.Context, userId, friendId string) error
+}
+
+// repository persists friendships in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new friendship repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// QueryByUser reads the friendships the specified user is part of from the database.
+func (r repository) QueryByUser(ctx context.Context, userId string) ([]entity.Friendship, error) {
+	var friendships []entity.Friendship
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.Or(dbx.HashExp{"user_id": userId}, dbx.HashExp{"friend_id": userId})).
+		OrderBy("created_at").
+		All(&friendships)
+	return friendships, err
+}
+
+// Create saves a new friendship record in the database.
+func (r repository) Create(ctx context.Context, friendship entity.Friendship) error {
+	return r.db.With(ctx).Model(&friendship).Insert()
+}
+
+// Delete deletes the friendship between the two users from the database.
+func (r repository) Delete(ctx context.Context, userId, friendId string) error {
+	_, err := r.db.With(ctx).Delete("friendship", dbx.Or(
+		dbx.HashExp{"user_id": userId, "friend_id": friendId},
+		dbx.HashExp{"user_id": friendId, "friend_id": userId},
+	)).Execute()
+	return err
+}
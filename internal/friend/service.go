@@ -0,0 +1,333 @@
+package friend
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/ledger"
+	"tribbie/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	Trip "tribbie/internal/trip"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+// Service encapsulates usecase logic for friends.
+// Friends are the users sharing a trip with the user, plus the users the user added explicitly.
+type Service interface {
+	// Query returns the friends of the user with their running balances across all shared trips.
+	Query(ctx context.Context, userId string) ([]Friend, error)
+	// Get returns a friend of the user with the balance per shared trip and the shared transactions.
+	Get(ctx context.Context, userId, friendId string) (FriendDetail, error)
+	// Add adds a friend explicitly by username.
+	Add(ctx context.Context, userId string, input AddFriendRequest) (Friend, error)
+	// Remove removes an explicitly added friend. Friends from shared trips stay friends.
+	Remove(ctx context.Context, userId, friendId string) error
+}
+
+// Friend represents another user as seen by the user.
+type Friend struct {
+	UserId      string    `json:"user_id"`
+	Username    string    `json:"username"`
+	DisplayName string    `json:"display_name"`
+	AvatarUrl   string    `json:"avatar_url"`
+	Explicit    bool      `json:"explicit"`
+	SharedTrips int       `json:"shared_trips"`
+	Balances    []Balance `json:"balances"`
+}
+
+// Balance represents the net amount between the user and a friend in one currency.
+// A positive amount is owed to the user, a negative amount is owed by the user.
+type Balance struct {
+	Currency string `json:"currency"`
+	Net      int64  `json:"net"`
+}
+
+// FriendDetail represents a friend with the balance per shared trip and the transactions both took part in.
+type FriendDetail struct {
+	Friend
+	Trips        []TripBalance        `json:"trips"`
+	Transactions []entity.Transaction `json:"transactions"`
+}
+
+// TripBalance represents the balance between the user and a friend within a trip.
+type TripBalance struct {
+	TripId   string `json:"trip_id"`
+	Title    string `json:"title"`
+	Currency string `json:"currency"`
+	Net      int64  `json:"net"`
+}
+
+// AddFriendRequest represents a request to add a friend by username.
+type AddFriendRequest struct {
+	Username string `json:"username"`
+}
+
+// Validate validates the AddFriendRequest fields.
+func (m AddFriendRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Username, validation.Required, validation.Length(1, 128)),
+	)
+}
+
+type service struct {
+	repo              Repository
+	userService       User.Service
+	tripService       Trip.Service
+	tripMemberService TripMember.Service
+	loader            ledger.Loader
+	logger            log.Logger
+}
+
+// NewService creates a new friend service.
+func NewService(repo Repository, userService User.Service, tripService Trip.Service, tripMemberService TripMember.Service, loader ledger.Loader, logger log.Logger) Service {
+	return service{repo, userService, tripService, tripMemberService, loader, logger}
+}
+
+// sharedTrip holds a trip shared by the user with other users, together with its records.
+type sharedTrip struct {
+	trip    Trip.Trip
+	records ledger.Trip
+	ledger  *ledger.Ledger
+}
+
+// Query returns the friends of the user ordered by username.
+func (s service) Query(ctx context.Context, userId string) ([]Friend, error) {
+	trips, err := s.sharedTrips(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	explicit, err := s.explicitFriends(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := map[string]bool{}
+	for id := range explicit {
+		ids[id] = true
+	}
+	for _, trip := range trips {
+		for _, member := range trip.records.Members {
+			if member.UserId != "" && member.UserId != userId {
+				ids[member.UserId] = true
+			}
+		}
+	}
+
+	friends := []Friend{}
+	for id := range ids {
+		friend, err := s.friend(ctx, userId, id, explicit[id], trips)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		friends = append(friends, friend)
+	}
+	sort.Slice(friends, func(i, j int) bool {
+		return friends[i].Username < friends[j].Username || friends[i].Username == friends[j].Username && friends[i].UserId < friends[j].UserId
+	})
+	return friends, nil
+}
+
+// Get returns a friend of the user. A user who is neither added explicitly nor sharing a trip is not found.
+func (s service) Get(ctx context.Context, userId, friendId string) (FriendDetail, error) {
+	trips, err := s.sharedTrips(ctx, userId)
+	if err != nil {
+		return FriendDetail{}, err
+	}
+	explicit, err := s.explicitFriends(ctx, userId)
+	if err != nil {
+		return FriendDetail{}, err
+	}
+	friend, err := s.friend(ctx, userId, friendId, explicit[friendId], trips)
+	if err == sql.ErrNoRows || err == nil && !friend.Explicit && friend.SharedTrips == 0 {
+		return FriendDetail{}, errors.NotFound("")
+	} else if err != nil {
+		return FriendDetail{}, err
+	}
+
+	detail := FriendDetail{Friend: friend, Trips: []TripBalance{}, Transactions: []entity.Transaction{}}
+	for _, trip := range trips {
+		if !isMember(trip.records, friendId) {
+			continue
+		}
+		detail.Trips = append(detail.Trips, TripBalance{trip.trip.ID, trip.trip.Title, trip.trip.Currency, trip.ledger.Net(userId, friendId)})
+		detail.Transactions = append(detail.Transactions, sharedTransactions(trip.records, userId, friendId)...)
+	}
+	sort.SliceStable(detail.Transactions, func(i, j int) bool {
+		return detail.Transactions[i].CreatedAt.After(detail.Transactions[j].CreatedAt)
+	})
+	return detail, nil
+}
+
+// Add adds the user with the given username as a friend of the user.
+func (s service) Add(ctx context.Context, userId string, req AddFriendRequest) (Friend, error) {
+	if err := req.Validate(); err != nil {
+		return Friend{}, err
+	}
+	user, err := s.userService.GetByUsername(ctx, req.Username)
+	if err == sql.ErrNoRows {
+		return Friend{}, errors.NotFound("")
+	} else if err != nil {
+		return Friend{}, err
+	}
+	if user.ID == userId {
+		return Friend{}, errors.BadRequest("You cannot add yourself as a friend.")
+	}
+	explicit, err := s.explicitFriends(ctx, userId)
+	if err != nil {
+		return Friend{}, err
+	}
+	if explicit[user.ID] {
+		return Friend{}, errors.BadRequest("This user is already your friend.")
+	}
+
+	now := time.Now()
+	err = s.repo.Create(ctx, entity.Friendship{
+		ID:        entity.GenerateID(),
+		UserId:    userId,
+		FriendId:  user.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		return Friend{}, err
+	}
+	trips, err := s.sharedTrips(ctx, userId)
+	if err != nil {
+		return Friend{}, err
+	}
+	return s.friend(ctx, userId, user.ID, true, trips)
+}
+
+// Remove removes the explicit friendship between the user and the friend.
+func (s service) Remove(ctx context.Context, userId, friendId string) error {
+	explicit, err := s.explicitFriends(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if !explicit[friendId] {
+		return errors.NotFound("")
+	}
+	return s.repo.Delete(ctx, userId, friendId)
+}
+
+// friend builds the friend with its balances across the trips shared with the user.
+func (s service) friend(ctx context.Context, userId, friendId string, explicit bool, trips []sharedTrip) (Friend, error) {
+	user, err := s.userService.Get(ctx, friendId)
+	if err != nil {
+		return Friend{}, err
+	}
+	friend := Friend{
+		UserId:      user.ID,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		AvatarUrl:   user.AvatarUrl,
+		Explicit:    explicit,
+		Balances:    []Balance{},
+	}
+	balances := map[string]int64{}
+	for _, trip := range trips {
+		if !isMember(trip.records, friendId) {
+			continue
+		}
+		friend.SharedTrips++
+		balances[trip.trip.Currency] += trip.ledger.Net(userId, friendId)
+	}
+	for currency, net := range balances {
+		friend.Balances = append(friend.Balances, Balance{currency, net})
+	}
+	sort.Slice(friend.Balances, func(i, j int) bool { return friend.Balances[i].Currency < friend.Balances[j].Currency })
+	return friend, nil
+}
+
+// sharedTrips loads the trips the user is a member of together with their ledgers.
+func (s service) sharedTrips(ctx context.Context, userId string) ([]sharedTrip, error) {
+	memberships, err := s.tripMemberService.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	var trips []sharedTrip
+	seen := map[string]bool{}
+	for _, membership := range memberships {
+		if seen[membership.TripId] {
+			continue
+		}
+		seen[membership.TripId] = true
+		trip, err := s.tripService.Get(ctx, membership.TripId)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		records, err := s.loader.Load(ctx, trip.ID)
+		if err != nil {
+			return nil, err
+		}
+		trips = append(trips, sharedTrip{trip, records, ledger.Build(records)})
+	}
+	return trips, nil
+}
+
+// explicitFriends returns the IDs of the users explicitly befriended with the user, in either direction.
+func (s service) explicitFriends(ctx context.Context, userId string) (map[string]bool, error) {
+	friendships, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, friendship := range friendships {
+		if friendship.UserId == userId {
+			ids[friendship.FriendId] = true
+		} else {
+			ids[friendship.UserId] = true
+		}
+	}
+	return ids, nil
+}
+
+// isMember returns whether the user is a member of the trip.
+func isMember(trip ledger.Trip, userId string) bool {
+	for _, member := range trip.Members {
+		if member.UserId == userId {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedTransactions returns the transactions of the trip both users took part in, either by paying or by
+// having an expense on it.
+func sharedTransactions(trip ledger.Trip, userId, friendId string) []entity.Transaction {
+	members := map[string]string{}
+	for _, member := range trip.Members {
+		members[member.ID] = member.UserId
+	}
+	involved := map[string]map[string]bool{}
+	mark := func(transactionId, user string) {
+		if involved[transactionId] == nil {
+			involved[transactionId] = map[string]bool{}
+		}
+		involved[transactionId][user] = true
+	}
+	for _, transaction := range trip.Transactions {
+		mark(transaction.ID, transaction.UserPaidId)
+	}
+	for _, expense := range trip.Expenses {
+		mark(expense.TransactionId, members[expense.TripMemberId])
+	}
+
+	var transactions []entity.Transaction
+	for _, transaction := range trip.Transactions {
+		if involved[transaction.ID][userId] && involved[transaction.ID][friendId] {
+			transactions = append(transactions, transaction)
+		}
+	}
+	return transactions
+}
@@ -0,0 +1,39 @@
+package friend
+
+import (
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/internal/ledger"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedTransactions(t *testing.T) {
+	trip := ledger.Trip{
+		Members: []entity.TripMember{
+			{ID: "m1", UserId: "alice"},
+			{ID: "m2", UserId: "bob"},
+			{ID: "m3", UserId: "carol"},
+		},
+		Transactions: []entity.Transaction{
+			{ID: "t1", UserPaidId: "alice"},
+			{ID: "t2", UserPaidId: "carol"},
+			{ID: "t3", UserPaidId: "carol"},
+		},
+		Expenses: []entity.TransactionExpenses{
+			{TripMemberId: "m2", TransactionId: "t1"},
+			{TripMemberId: "m1", TransactionId: "t2"},
+			{TripMemberId: "m2", TransactionId: "t2"},
+			{TripMemberId: "m2", TransactionId: "t3"},
+		},
+	}
+
+	var ids []string
+	for _, transaction := range sharedTransactions(trip, "alice", "bob") {
+		ids = append(ids, transaction.ID)
+	}
+	assert.Equal(t, []string{"t1", "t2"}, ids)
+	assert.Empty(t, sharedTransactions(trip, "alice", "dave"))
+	assert.True(t, isMember(trip, "carol"))
+	assert.False(t, isMember(trip, "dave"))
+}
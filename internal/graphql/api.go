@@ -0,0 +1,66 @@
+package graphql
+
+import (
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	graphqlgo "github.com/graph-gophers/graphql-go"
+)
+
+// maxDepth is the maximum nesting of the selections of a query.
+const maxDepth = 10
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, resolver *Resolver, authHandler routing.Handler, logger log.Logger) {
+	res := resource{newSchema(resolver), resolver, logger}
+
+	r.Post("/graphql", authHandler, res.query)
+}
+
+// newSchema parses the schema with the given root resolver. It panics if the resolver does not match the schema.
+func newSchema(resolver *Resolver) *graphqlgo.Schema {
+	return graphqlgo.MustParseSchema(schema, resolver, graphqlgo.MaxDepth(maxDepth))
+}
+
+type resource struct {
+	schema   *graphqlgo.Schema
+	resolver *Resolver
+	logger   log.Logger
+}
+
+// request represents a GraphQL request.
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// query executes a GraphQL query. The errors of the resolvers are reported with their HTTP status, and the
+// unexpected ones are logged and replaced with a generic message.
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	if auth.CurrentUserDefault(ctx) == nil {
+		return errors.Unauthorized("")
+	}
+	var req request
+	if err := c.Read(&req); err != nil {
+		r.logger.With(ctx).Info(err)
+		return errors.BadRequest("")
+	}
+	response := r.schema.Exec(withLoaders(ctx, r.resolver.newLoaders()), req.Query, req.OperationName, req.Variables)
+	for _, err := range response.Errors {
+		if err.ResolverError == nil {
+			continue
+		}
+		res, ok := err.ResolverError.(errors.ErrorResponse)
+		if !ok {
+			r.logger.With(ctx).Errorf("graphql: %v", err.ResolverError)
+			res = errors.InternalServerError("")
+			err.Message = res.Message
+		}
+		err.Extensions = map[string]interface{}{"status": res.Status}
+	}
+	return c.Write(response)
+}
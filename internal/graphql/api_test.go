@@ -0,0 +1,362 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+	"testing"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/test"
+	"tribbie/internal/trip"
+	"tribbie/pkg/listing"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+func TestAPI(t *testing.T) {
+	logger, _ := log.NewForTest()
+	router := test.MockRouter(logger)
+	calls := &counter{}
+	RegisterHandlers(router.Group(""), newTestResolver(calls, logger), auth.MockAuthHandler, logger)
+	header := auth.MockAuthHeader()
+
+	tests := []test.APITestCase{
+		{Name: "me", Method: "POST", URL: "/graphql", Body: `{"query":"{ me { id username email } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"me":{"id":"100","username":"tester","email":"tester@example.com"}}}`},
+		{Name: "auth error", Method: "POST", URL: "/graphql", Body: `{"query":"{ me { id } }"}`, WantStatus: http.StatusUnauthorized},
+		{Name: "input error", Method: "POST", URL: "/graphql", Body: `"query"}`, Header: header, WantStatus: http.StatusBadRequest},
+		{Name: "other user email hidden", Method: "POST", URL: "/graphql", Body: `{"query":"{ user(id: \"200\") { username email } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"user":{"username":"budi","email":null}}}`},
+		{Name: "trips", Method: "POST", URL: "/graphql", Body: `{"query":"{ trips { id } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"trips":[{"id":"trip1"}]}}`},
+		{Name: "trip not member", Method: "POST", URL: "/graphql", Body: `{"query":"{ trip(id: \"trip2\") { id } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `*"status":403*`},
+		{Name: "trip unknown", Method: "POST", URL: "/graphql", Body: `{"query":"{ trip(id: \"trip3\") { id } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"trip":null}}`},
+		{Name: "transaction", Method: "POST", URL: "/graphql", Body: `{"query":"query($id: ID!) { transaction(id: $id) { title grandTotal trip { title } payer { username } items { title } } }","variables":{"id":"t1"}}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"transaction":{"title":"Dinner","grandTotal":20000,"trip":{"title":"Bali"},"payer":{"username":"tester"},"items":[{"title":"Steak"}]}}}`},
+		{Name: "balances", Method: "POST", URL: "/graphql", Body: `{"query":"{ trip(id: \"trip1\") { balances { member { name } net counterparts { member { name } net } } } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `{"data":{"trip":{"balances":[
+				{"member":{"name":"Tester"},"net":10000,"counterparts":[{"member":{"name":"Budi"},"net":10000}]},
+				{"member":{"name":"Budi"},"net":-10000,"counterparts":[{"member":{"name":"Tester"},"net":-10000}]}
+			]}}}`},
+		{Name: "unknown field", Method: "POST", URL: "/graphql", Body: `{"query":"{ me { password } }"}`, Header: header, WantStatus: http.StatusOK,
+			WantResponse: `*Cannot query field*`},
+	}
+	for _, tc := range tests {
+		test.Endpoint(t, router, tc)
+	}
+}
+
+func TestResolver_Batching(t *testing.T) {
+	logger, _ := log.NewForTest()
+	calls := &counter{}
+	resolver := newTestResolver(calls, logger)
+	schema := newSchema(resolver)
+	ctx := auth.WithUserDefault(context.Background(), "100", "tester")
+	ctx = withLoaders(ctx, resolver.newLoaders())
+
+	response := schema.Exec(ctx, `{
+		trip(id: "trip1") {
+			members { name user { username } }
+			transactions {
+				payer { username }
+				items { title expenses { member { name } } }
+				expenses { quantity item { title } }
+				payments { from { username } to { username } }
+			}
+			payments { member { name } }
+			balances { net }
+		}
+	}`, "", nil)
+	assert.Empty(t, response.Errors)
+	// one call per relation, whatever the number of transactions
+	assert.Equal(t, map[string]int{
+		"trip.Get":                     1,
+		"member.Query":                 1,
+		"transaction.Query":            1,
+		"item.QueryByTransactions":     1,
+		"expenses.QueryByTransactions": 1,
+		"payment.QueryByTransactions":  1,
+		"payment.Query":                1,
+		"user.QueryByIds":              1,
+	}, calls.counts())
+}
+
+func TestLoader(t *testing.T) {
+	var batches [][]string
+	l := newLoader(func(ctx context.Context, keys []string) (map[string]interface{}, error) {
+		batches = append(batches, keys)
+		values := map[string]interface{}{}
+		for _, key := range keys {
+			if key != "unknown" {
+				values[key] = "value " + key
+			}
+		}
+		return values, nil
+	})
+	ctx := context.Background()
+	l.Prime("a", "b", "a")
+	l.Prime("b", "c")
+
+	value, err := l.Load(ctx, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "value b", value)
+	value, _ = l.Load(ctx, "a")
+	assert.Equal(t, "value a", value)
+	value, _ = l.Load(ctx, "unknown")
+	assert.Nil(t, value)
+	value, _ = l.Load(ctx, "c")
+	assert.Equal(t, "value c", value)
+	assert.Equal(t, [][]string{{"a", "b"}, {"unknown"}, {"c"}}, batches)
+}
+
+// newTestResolver creates a resolver reading the test data. Tester (100) and Budi (200) are members of trip1.
+// Only Budi is a member of trip2.
+func newTestResolver(calls *counter, logger log.Logger) *Resolver {
+	return NewResolver(
+		&mockUserService{calls: calls, items: []entity.UserDefault{
+			{ID: "100", Username: "tester", Email: "tester@example.com"},
+			{ID: "200", Username: "budi", Email: "budi@example.com"},
+		}},
+		&mockTripService{calls: calls, items: []entity.Trip{
+			{ID: "trip1", Title: "Bali", Currency: "IDR"},
+			{ID: "trip2", Title: "Lombok", Currency: "IDR"},
+		}},
+		&mockMemberService{calls: calls, items: []entity.TripMember{
+			{ID: "m1", TripId: "trip1", UserId: "100", Name: "Tester"},
+			{ID: "m2", TripId: "trip1", UserId: "200", Name: "Budi"},
+			{ID: "m3", TripId: "trip2", UserId: "200", Name: "Budi"},
+		}},
+		&mockTransactionService{calls: calls, items: []entity.Transaction{
+			{ID: "t1", TripId: "trip1", UserPaidId: "100", Title: "Dinner", GrandTotal: 20000, SubTotal: 20000},
+			{ID: "t2", TripId: "trip1", UserPaidId: "200", Title: "Taxi", GrandTotal: 5000, SubTotal: 5000},
+		}},
+		&mockItemService{calls: calls, items: []entity.TransactionItem{
+			{ID: "i1", TripId: "trip1", TransactionId: "t1", Title: "Steak", Price: 10000, Quantity: 2},
+			{ID: "i2", TripId: "trip1", TransactionId: "t2", Title: "Ride", Price: 5000, Quantity: 1},
+		}},
+		&mockExpensesService{calls: calls, items: []entity.TransactionExpenses{
+			{ID: "e1", TripId: "trip1", TransactionId: "t1", ItemId: "i1", TripMemberId: "m2", Quantity: 2},
+			{ID: "e2", TripId: "trip1", TransactionId: "t2", ItemId: "i2", TripMemberId: "m1", Quantity: 1},
+		}},
+		&mockPaymentService{calls: calls, items: []entity.TransactionPayment{
+			{ID: "p1", TripId: "trip1", TransactionId: "t1", TripMemberId: "m2", UserFromId: "200", UserToId: "100",
+				Nominal: 5000, Status: entity.PaymentStatusConfirmed},
+		}},
+		logger,
+	)
+}
+
+// counter counts the calls to the services. The resolvers call them concurrently.
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (c *counter) add(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.calls == nil {
+		c.calls = map[string]int{}
+	}
+	c.calls[name]++
+}
+
+func (c *counter) counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// selected returns the values the first condition of the options selects.
+func selected(options listing.Options) map[interface{}]bool {
+	values := map[interface{}]bool{}
+	for _, value := range options.Conditions[0].Values {
+		values[value] = true
+	}
+	return values
+}
+
+type mockUserService struct {
+	User.Service
+	calls *counter
+	items []entity.UserDefault
+}
+
+func (m *mockUserService) QueryByIds(ctx context.Context, ids []string) ([]User.UserDefault, error) {
+	m.calls.add("user.QueryByIds")
+	var result []User.UserDefault
+	for _, item := range m.items {
+		for _, id := range ids {
+			if item.ID == id {
+				result = append(result, User.UserDefault{UserDefault: item})
+			}
+		}
+	}
+	return result, nil
+}
+
+type mockTripService struct {
+	trip.Service
+	calls *counter
+	items []entity.Trip
+}
+
+func (m *mockTripService) Get(ctx context.Context, id string) (trip.Trip, error) {
+	m.calls.add("trip.Get")
+	for _, item := range m.items {
+		if item.ID == id {
+			return trip.Trip{Trip: item}, nil
+		}
+	}
+	return trip.Trip{}, sql.ErrNoRows
+}
+
+func (m *mockTripService) Query(ctx context.Context, filter trip.QueryFilter, offset, limit int) ([]trip.Trip, error) {
+	m.calls.add("trip.Query")
+	ids := selected(filter.Options)
+	var result []trip.Trip
+	for _, item := range m.items {
+		if ids[item.ID] {
+			result = append(result, trip.Trip{Trip: item})
+		}
+	}
+	return result, nil
+}
+
+type mockMemberService struct {
+	TripMember.Service
+	calls *counter
+	items []entity.TripMember
+}
+
+func (m *mockMemberService) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TripMember.TripMember, error) {
+	m.calls.add("member.Query")
+	trips := selected(options)
+	var result []TripMember.TripMember
+	for _, item := range m.items {
+		if trips[item.TripId] {
+			result = append(result, TripMember.TripMember{TripMember: item})
+		}
+	}
+	return result, nil
+}
+
+func (m *mockMemberService) QueryByUser(ctx context.Context, userId string) ([]TripMember.TripMember, error) {
+	m.calls.add("member.QueryByUser")
+	var result []TripMember.TripMember
+	for _, item := range m.items {
+		if item.UserId == userId {
+			result = append(result, TripMember.TripMember{TripMember: item})
+		}
+	}
+	return result, nil
+}
+
+type mockTransactionService struct {
+	Transaction.Service
+	calls *counter
+	items []entity.Transaction
+}
+
+func (m *mockTransactionService) Get(ctx context.Context, id string) (Transaction.Transaction, error) {
+	m.calls.add("transaction.Get")
+	for _, item := range m.items {
+		if item.ID == id {
+			return Transaction.Transaction{Transaction: item}, nil
+		}
+	}
+	return Transaction.Transaction{}, sql.ErrNoRows
+}
+
+func (m *mockTransactionService) Query(ctx context.Context, options listing.Options, offset, limit int) ([]Transaction.Transaction, error) {
+	m.calls.add("transaction.Query")
+	trips := selected(options)
+	var result []Transaction.Transaction
+	for _, item := range m.items {
+		if trips[item.TripId] {
+			result = append(result, Transaction.Transaction{Transaction: item})
+		}
+	}
+	return result, nil
+}
+
+type mockItemService struct {
+	TransactionItem.Service
+	calls *counter
+	items []entity.TransactionItem
+}
+
+func (m *mockItemService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionItem.TransactionItem, error) {
+	m.calls.add("item.QueryByTransactions")
+	var result []TransactionItem.TransactionItem
+	for _, item := range m.items {
+		for _, id := range transactionIds {
+			if item.TransactionId == id {
+				result = append(result, TransactionItem.TransactionItem{TransactionItem: item})
+			}
+		}
+	}
+	return result, nil
+}
+
+type mockExpensesService struct {
+	TransactionExpenses.Service
+	calls *counter
+	items []entity.TransactionExpenses
+}
+
+func (m *mockExpensesService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionExpenses.TransactionExpenses, error) {
+	m.calls.add("expenses.QueryByTransactions")
+	var result []TransactionExpenses.TransactionExpenses
+	for _, item := range m.items {
+		for _, id := range transactionIds {
+			if item.TransactionId == id {
+				result = append(result, TransactionExpenses.TransactionExpenses{TransactionExpenses: item})
+			}
+		}
+	}
+	return result, nil
+}
+
+type mockPaymentService struct {
+	TransactionPayment.Service
+	calls *counter
+	items []entity.TransactionPayment
+}
+
+func (m *mockPaymentService) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionPayment.TransactionPayment, error) {
+	m.calls.add("payment.Query")
+	trips := selected(options)
+	var result []TransactionPayment.TransactionPayment
+	for _, item := range m.items {
+		if trips[item.TripId] {
+			result = append(result, TransactionPayment.TransactionPayment{TransactionPayment: item})
+		}
+	}
+	return result, nil
+}
+
+func (m *mockPaymentService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionPayment.TransactionPayment, error) {
+	m.calls.add("payment.QueryByTransactions")
+	var result []TransactionPayment.TransactionPayment
+	for _, item := range m.items {
+		for _, id := range transactionIds {
+			if item.TransactionId == id {
+				result = append(result, TransactionPayment.TransactionPayment{TransactionPayment: item})
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// fetchFunc loads the values of the given keys. Keys without a value are left out of the map.
+type fetchFunc func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// loader loads values by key in batches and caches them for the duration of a request.
+//
+// A resolver returning a list primes the loaders with the keys its elements will ask for. The first element loading
+// one of these keys then fetches all of them with a single call, so that a list costs one query per relation rather
+// than one per element. A key that was not primed is fetched on its own.
+type loader struct {
+	fetch   fetchFunc
+	mu      sync.Mutex
+	batches map[string]*batch
+}
+
+// batch is a set of keys fetched together.
+type batch struct {
+	keys   []string
+	once   sync.Once
+	values map[string]interface{}
+	err    error
+}
+
+// newLoader creates a loader fetching the values with the given function.
+func newLoader(fetch fetchFunc) *loader {
+	return &loader{fetch: fetch, batches: map[string]*batch{}}
+}
+
+// Prime schedules the keys that are neither loaded nor scheduled yet to be fetched together.
+func (l *loader) Prime(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := &batch{}
+	for _, key := range keys {
+		if _, ok := l.batches[key]; !ok {
+			l.batches[key] = b
+			b.keys = append(b.keys, key)
+		}
+	}
+}
+
+// Load returns the value of the key, or nil if it has none. It fetches the batch the key belongs to if needed.
+func (l *loader) Load(ctx context.Context, key string) (interface{}, error) {
+	l.mu.Lock()
+	b, ok := l.batches[key]
+	if !ok {
+		b = &batch{keys: []string{key}}
+		l.batches[key] = b
+	}
+	l.mu.Unlock()
+	b.once.Do(func() {
+		b.values, b.err = l.fetch(ctx, b.keys)
+	})
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.values[key], nil
+}
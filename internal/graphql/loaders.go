@@ -0,0 +1,273 @@
+package graphql
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/internal/trip"
+	"tribbie/pkg/listing"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+type contextKey int
+
+const loadersKey contextKey = iota
+
+// loaders holds the loaders of a request. Each loader caches what it fetched until the end of the request.
+type loaders struct {
+	// trip.Trip by trip ID
+	trips *loader
+	// []TripMember.TripMember by trip ID
+	members *loader
+	// []Transaction.Transaction by trip ID
+	transactions *loader
+	// []TransactionPayment.TransactionPayment by trip ID
+	tripPayments *loader
+	// []TransactionItem.TransactionItem by transaction ID
+	items *loader
+	// []TransactionExpenses.TransactionExpenses by transaction ID
+	expenses *loader
+	// []TransactionPayment.TransactionPayment by transaction ID
+	payments *loader
+	// User.UserDefault by user ID
+	users *loader
+}
+
+// withLoaders returns a context that contains the loaders of the request.
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey, l)
+}
+
+// loadersFrom returns the loaders of the request.
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey).(*loaders)
+}
+
+// newLoaders creates the loaders of a request.
+func (r *Resolver) newLoaders() *loaders {
+	return &loaders{
+		trips:        newLoader(r.fetchTrips),
+		members:      newLoader(r.fetchMembers),
+		transactions: newLoader(r.fetchTransactions),
+		tripPayments: newLoader(r.fetchTripPayments),
+		items:        newLoader(r.fetchItems),
+		expenses:     newLoader(r.fetchExpenses),
+		payments:     newLoader(r.fetchPayments),
+		users:        newLoader(r.fetchUsers),
+	}
+}
+
+// in returns the listing options selecting the records whose column has one of the given values, in no particular
+// order and without limit.
+func in(column string, keys []string) listing.Options {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = key
+	}
+	return listing.Options{Conditions: []listing.Condition{{Column: column, Operator: ":", Values: values}}}
+}
+
+func (r *Resolver) fetchTrips(ctx context.Context, ids []string) (map[string]interface{}, error) {
+	// archived trips are only listed if requested by status
+	trips, err := r.tripService.Query(ctx, trip.QueryFilter{Statuses: entity.TripStatuses, Options: in("id", ids)}, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for _, t := range trips {
+		values[t.ID] = t
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchMembers(ctx context.Context, tripIds []string) (map[string]interface{}, error) {
+	members, err := r.tripMemberService.Query(ctx, in("trip_id", tripIds), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]TripMember.TripMember{}
+	for _, member := range members {
+		groups[member.TripId] = append(groups[member.TripId], member)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchTransactions(ctx context.Context, tripIds []string) (map[string]interface{}, error) {
+	transactions, err := r.transactionService.Query(ctx, in("trip_id", tripIds), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]Transaction.Transaction{}
+	for _, transaction := range transactions {
+		groups[transaction.TripId] = append(groups[transaction.TripId], transaction)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchTripPayments(ctx context.Context, tripIds []string) (map[string]interface{}, error) {
+	payments, err := r.transactionPaymentService.Query(ctx, in("trip_id", tripIds), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]TransactionPayment.TransactionPayment{}
+	for _, payment := range payments {
+		groups[payment.TripId] = append(groups[payment.TripId], payment)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchItems(ctx context.Context, transactionIds []string) (map[string]interface{}, error) {
+	items, err := r.transactionItemService.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]TransactionItem.TransactionItem{}
+	for _, item := range items {
+		groups[item.TransactionId] = append(groups[item.TransactionId], item)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchExpenses(ctx context.Context, transactionIds []string) (map[string]interface{}, error) {
+	expenses, err := r.transactionExpensesService.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]TransactionExpenses.TransactionExpenses{}
+	for _, expense := range expenses {
+		groups[expense.TransactionId] = append(groups[expense.TransactionId], expense)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchPayments(ctx context.Context, transactionIds []string) (map[string]interface{}, error) {
+	payments, err := r.transactionPaymentService.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]TransactionPayment.TransactionPayment{}
+	for _, payment := range payments {
+		groups[payment.TransactionId] = append(groups[payment.TransactionId], payment)
+	}
+	values := map[string]interface{}{}
+	for id, group := range groups {
+		values[id] = group
+	}
+	return values, nil
+}
+
+func (r *Resolver) fetchUsers(ctx context.Context, ids []string) (map[string]interface{}, error) {
+	users, err := r.userService.QueryByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for _, user := range users {
+		values[user.ID] = user
+	}
+	return values, nil
+}
+
+// trip returns the trip with the given ID, or nil if there is none.
+func (l *loaders) trip(ctx context.Context, id string) (*trip.Trip, error) {
+	value, err := l.trips.Load(ctx, id)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	t := value.(trip.Trip)
+	return &t, nil
+}
+
+// tripMembers returns the members of the trip.
+func (l *loaders) tripMembers(ctx context.Context, tripId string) ([]TripMember.TripMember, error) {
+	value, err := l.members.Load(ctx, tripId)
+	members, _ := value.([]TripMember.TripMember)
+	return members, err
+}
+
+// user returns the user with the given ID, or nil if there is none.
+func (l *loaders) user(ctx context.Context, id string) (*User.UserDefault, error) {
+	if id == "" {
+		return nil, nil
+	}
+	value, err := l.users.Load(ctx, id)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	user := value.(User.UserDefault)
+	return &user, nil
+}
+
+// isMember returns whether the user is a member of the trip.
+func (l *loaders) isMember(ctx context.Context, tripId, userId string) (bool, error) {
+	members, err := l.tripMembers(ctx, tripId)
+	if err != nil {
+		return false, err
+	}
+	for _, member := range members {
+		if member.UserId == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// tripTransactions returns the transactions of the trip.
+func (l *loaders) tripTransactions(ctx context.Context, tripId string) ([]Transaction.Transaction, error) {
+	value, err := l.transactions.Load(ctx, tripId)
+	transactions, _ := value.([]Transaction.Transaction)
+	return transactions, err
+}
+
+// tripPaymentList returns the payments of the trip.
+func (l *loaders) tripPaymentList(ctx context.Context, tripId string) ([]TransactionPayment.TransactionPayment, error) {
+	value, err := l.tripPayments.Load(ctx, tripId)
+	payments, _ := value.([]TransactionPayment.TransactionPayment)
+	return payments, err
+}
+
+// transactionItems returns the items of the transaction.
+func (l *loaders) transactionItems(ctx context.Context, transactionId string) ([]TransactionItem.TransactionItem, error) {
+	value, err := l.items.Load(ctx, transactionId)
+	items, _ := value.([]TransactionItem.TransactionItem)
+	return items, err
+}
+
+// transactionExpenses returns the expenses of the transaction.
+func (l *loaders) transactionExpenses(ctx context.Context, transactionId string) ([]TransactionExpenses.TransactionExpenses, error) {
+	value, err := l.expenses.Load(ctx, transactionId)
+	expenses, _ := value.([]TransactionExpenses.TransactionExpenses)
+	return expenses, err
+}
+
+// transactionPayments returns the payments of the transaction.
+func (l *loaders) transactionPayments(ctx context.Context, transactionId string) ([]TransactionPayment.TransactionPayment, error) {
+	value, err := l.payments.Load(ctx, transactionId)
+	payments, _ := value.([]TransactionPayment.TransactionPayment)
+	return payments, err
+}
@@ -0,0 +1,193 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/internal/trip"
+	"tribbie/pkg/log"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+// Resolver is the root resolver of the GraphQL schema. It reads the data with the services of the REST API.
+// Only the members of a trip can read it and the records it holds.
+type Resolver struct {
+	userService                User.Service
+	tripService                trip.Service
+	tripMemberService          TripMember.Service
+	transactionService         Transaction.Service
+	transactionItemService     TransactionItem.Service
+	transactionExpensesService TransactionExpenses.Service
+	transactionPaymentService  TransactionPayment.Service
+	logger                     log.Logger
+}
+
+// NewResolver creates a new root resolver.
+func NewResolver(
+	userService User.Service,
+	tripService trip.Service,
+	tripMemberService TripMember.Service,
+	transactionService Transaction.Service,
+	transactionItemService TransactionItem.Service,
+	transactionExpensesService TransactionExpenses.Service,
+	transactionPaymentService TransactionPayment.Service,
+	logger log.Logger) *Resolver {
+	return &Resolver{userService, tripService, tripMemberService, transactionService, transactionItemService, transactionExpensesService, transactionPaymentService, logger}
+}
+
+// Me returns the current user.
+func (r *Resolver) Me(ctx context.Context) (*userResolver, error) {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	user, err := loadUser(ctx, identity.GetID())
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errors.NotFound("")
+	}
+	return user, nil
+}
+
+// User returns the user with the given ID, or nil if there is none.
+func (r *Resolver) User(ctx context.Context, args struct{ ID graphqlgo.ID }) (*userResolver, error) {
+	return loadUser(ctx, string(args.ID))
+}
+
+// Trips returns the trips the current user is a member of.
+func (r *Resolver) Trips(ctx context.Context) ([]*tripResolver, error) {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	memberships, err := r.tripMemberService.QueryByUser(ctx, identity.GetID())
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	seen := map[string]bool{}
+	for _, membership := range memberships {
+		if !seen[membership.TripId] {
+			seen[membership.TripId] = true
+			ids = append(ids, membership.TripId)
+		}
+	}
+	loaders := loadersFrom(ctx)
+	loaders.trips.Prime(ids...)
+	primeTrips(loaders, ids)
+	result := []*tripResolver{}
+	for _, id := range ids {
+		t, err := loaders.trip(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			result = append(result, &tripResolver{*t})
+		}
+	}
+	return result, nil
+}
+
+// Trip returns the trip with the given ID, or nil if there is none.
+func (r *Resolver) Trip(ctx context.Context, args struct{ ID graphqlgo.ID }) (*tripResolver, error) {
+	t, err := r.tripService.Get(ctx, string(args.ID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := checkMember(ctx, t.ID); err != nil {
+		return nil, err
+	}
+	return &tripResolver{t}, nil
+}
+
+// Transaction returns the transaction with the given ID, or nil if there is none.
+func (r *Resolver) Transaction(ctx context.Context, args struct{ ID graphqlgo.ID }) (*transactionResolver, error) {
+	transaction, err := r.transactionService.Get(ctx, string(args.ID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := checkMember(ctx, transaction.TripId); err != nil {
+		return nil, err
+	}
+	primeTransactions(loadersFrom(ctx), []Transaction.Transaction{transaction})
+	return &transactionResolver{transaction}, nil
+}
+
+// checkMember checks that the current user is a member of the trip.
+func checkMember(ctx context.Context, tripId string) error {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	member, err := loadersFrom(ctx).isMember(ctx, tripId, identity.GetID())
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.Forbidden("Only the members of the trip can read it.")
+	}
+	return nil
+}
+
+// primeTrips schedules the relations of the trips to be fetched together.
+func primeTrips(l *loaders, ids []string) {
+	l.members.Prime(ids...)
+	l.transactions.Prime(ids...)
+	l.tripPayments.Prime(ids...)
+}
+
+// primeTransactions schedules the relations of the transactions to be fetched together.
+func primeTransactions(l *loaders, transactions []Transaction.Transaction) {
+	ids := make([]string, len(transactions))
+	var payers []string
+	for i, transaction := range transactions {
+		ids[i] = transaction.ID
+		if transaction.UserPaidId != "" {
+			payers = append(payers, transaction.UserPaidId)
+		}
+	}
+	l.items.Prime(ids...)
+	l.expenses.Prime(ids...)
+	l.payments.Prime(ids...)
+	l.users.Prime(payers...)
+}
+
+// primeMembers schedules the users of the members to be fetched together.
+func primeMembers(l *loaders, members []TripMember.TripMember) {
+	var users []string
+	for _, member := range members {
+		if member.UserId != "" {
+			users = append(users, member.UserId)
+		}
+	}
+	l.users.Prime(users...)
+}
+
+// primePayments schedules the users of the payments to be fetched together.
+func primePayments(l *loaders, payments []TransactionPayment.TransactionPayment) {
+	var users []string
+	for _, payment := range payments {
+		if payment.UserFromId != "" {
+			users = append(users, payment.UserFromId)
+		}
+		if payment.UserToId != "" {
+			users = append(users, payment.UserToId)
+		}
+	}
+	l.users.Prime(users...)
+}
@@ -0,0 +1,128 @@
+package graphql
+
+// schema is the GraphQL schema of the API. Amounts are Long because the Int type of GraphQL has only 32 bits.
+const schema = `
+schema {
+	query: Query
+}
+
+"A 64-bit integer."
+scalar Long
+
+"A time formatted as RFC 3339."
+scalar Time
+
+type Query {
+	"The current user."
+	me: User!
+	"A user by ID."
+	user(id: ID!): User
+	"The trips the current user is a member of."
+	trips: [Trip!]!
+	"A trip the current user is a member of."
+	trip(id: ID!): Trip
+	"A transaction of a trip the current user is a member of."
+	transaction(id: ID!): Transaction
+}
+
+type User {
+	id: ID!
+	username: String!
+	displayName: String!
+	avatarUrl: String!
+	"Only shown to the user themselves."
+	email: String
+}
+
+type Trip {
+	id: ID!
+	title: String!
+	description: String!
+	place: String!
+	currency: String!
+	timeZone: String!
+	budget: Long!
+	startDate: String
+	endDate: String
+	coverImage: String!
+	status: String!
+	createdAt: Time!
+	updatedAt: Time!
+	members: [TripMember!]!
+	transactions: [Transaction!]!
+	payments: [Payment!]!
+	"How much each member is owed by, or owes to, the others."
+	balances: [Balance!]!
+}
+
+type TripMember {
+	id: ID!
+	name: String!
+	status: String!
+	"The account of the member, if any."
+	user: User
+	createdAt: Time!
+}
+
+type Transaction {
+	id: ID!
+	title: String!
+	description: String!
+	method: String!
+	status: String!
+	grandTotal: Long!
+	subTotal: Long!
+	serviceCharge: Long!
+	createdAt: Time!
+	updatedAt: Time!
+	trip: Trip!
+	payer: User
+	items: [Item!]!
+	expenses: [Expense!]!
+	payments: [Payment!]!
+}
+
+type Item {
+	id: ID!
+	title: String!
+	description: String!
+	price: Long!
+	quantity: Int!
+	createdAt: Time!
+	expenses: [Expense!]!
+}
+
+type Expense {
+	id: ID!
+	quantity: Long!
+	member: TripMember
+	item: Item
+	createdAt: Time!
+}
+
+type Payment {
+	id: ID!
+	nominal: Long!
+	currency: String!
+	status: String!
+	from: User
+	to: User
+	member: TripMember
+	createdAt: Time!
+	updatedAt: Time!
+}
+
+"The balance of a member. A positive amount is owed to the member, a negative amount is owed by the member."
+type Balance {
+	member: TripMember!
+	net: Long!
+	counterparts: [Counterpart!]!
+}
+
+"The net amount between a member and another person of the trip."
+type Counterpart {
+	"The member the balance is with, if the person is a member of the trip."
+	member: TripMember
+	net: Long!
+}
+`
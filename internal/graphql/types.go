@@ -0,0 +1,416 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/internal/ledger"
+	"tribbie/internal/trip"
+
+	graphqlgo "github.com/graph-gophers/graphql-go"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+// Long is the Long scalar of the schema, a 64-bit integer.
+type Long int64
+
+// ImplementsGraphQLType maps the type to the Long scalar.
+func (Long) ImplementsGraphQLType(name string) bool {
+	return name == "Long"
+}
+
+// UnmarshalGraphQL parses a Long argument.
+func (l *Long) UnmarshalGraphQL(input interface{}) error {
+	switch v := input.(type) {
+	case int32:
+		*l = Long(v)
+	case float64:
+		*l = Long(v)
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		*l = Long(n)
+	default:
+		return fmt.Errorf("wrong type for Long: %T", input)
+	}
+	return nil
+}
+
+// nullable returns nil for an empty string.
+func nullable(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+type userResolver struct {
+	user User.UserDefault
+}
+
+func (r *userResolver) ID() graphqlgo.ID    { return graphqlgo.ID(r.user.ID) }
+func (r *userResolver) Username() string    { return r.user.Username }
+func (r *userResolver) DisplayName() string { return r.user.DisplayName }
+func (r *userResolver) AvatarUrl() string   { return r.user.AvatarUrl }
+
+// Email returns the email address of the user if they are the current user.
+func (r *userResolver) Email(ctx context.Context) *string {
+	if identity := auth.CurrentUserDefault(ctx); identity != nil && identity.GetID() == r.user.ID {
+		return &r.user.Email
+	}
+	return nil
+}
+
+type tripResolver struct {
+	trip trip.Trip
+}
+
+func (r *tripResolver) ID() graphqlgo.ID          { return graphqlgo.ID(r.trip.ID) }
+func (r *tripResolver) Title() string             { return r.trip.Title }
+func (r *tripResolver) Description() string       { return r.trip.Description }
+func (r *tripResolver) Place() string             { return r.trip.Place }
+func (r *tripResolver) Currency() string          { return r.trip.Currency }
+func (r *tripResolver) TimeZone() string          { return r.trip.TimeZone }
+func (r *tripResolver) Budget() Long              { return Long(r.trip.Budget) }
+func (r *tripResolver) StartDate() *string        { return nullable(r.trip.StartDate) }
+func (r *tripResolver) EndDate() *string          { return nullable(r.trip.EndDate) }
+func (r *tripResolver) CoverImage() string        { return r.trip.CoverImage }
+func (r *tripResolver) Status() string            { return r.trip.Status }
+func (r *tripResolver) CreatedAt() graphqlgo.Time { return graphqlgo.Time{Time: r.trip.CreatedAt} }
+func (r *tripResolver) UpdatedAt() graphqlgo.Time { return graphqlgo.Time{Time: r.trip.UpdatedAt} }
+
+// Members returns the members of the trip.
+func (r *tripResolver) Members(ctx context.Context) ([]*memberResolver, error) {
+	loaders := loadersFrom(ctx)
+	members, err := loaders.tripMembers(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	primeMembers(loaders, members)
+	result := make([]*memberResolver, len(members))
+	for i, member := range members {
+		result[i] = &memberResolver{member}
+	}
+	return result, nil
+}
+
+// Transactions returns the transactions of the trip.
+func (r *tripResolver) Transactions(ctx context.Context) ([]*transactionResolver, error) {
+	loaders := loadersFrom(ctx)
+	transactions, err := loaders.tripTransactions(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	primeTransactions(loaders, transactions)
+	result := make([]*transactionResolver, len(transactions))
+	for i, transaction := range transactions {
+		result[i] = &transactionResolver{transaction}
+	}
+	return result, nil
+}
+
+// Payments returns the payments of the trip.
+func (r *tripResolver) Payments(ctx context.Context) ([]*paymentResolver, error) {
+	loaders := loadersFrom(ctx)
+	payments, err := loaders.tripPaymentList(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	return newPaymentResolvers(loaders, payments), nil
+}
+
+// Balances returns the balance of every member of the trip computed from its ledger.
+func (r *tripResolver) Balances(ctx context.Context) ([]*balanceResolver, error) {
+	loaders := loadersFrom(ctx)
+	var records ledger.Trip
+	members, err := loaders.tripMembers(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		records.Members = append(records.Members, member.TripMember)
+	}
+	transactions, err := loaders.tripTransactions(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	primeTransactions(loaders, transactions)
+	for _, transaction := range transactions {
+		records.Transactions = append(records.Transactions, transaction.Transaction)
+		items, err := loaders.transactionItems(ctx, transaction.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			records.Items = append(records.Items, item.TransactionItem)
+		}
+		expenses, err := loaders.transactionExpenses(ctx, transaction.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, expense := range expenses {
+			records.Expenses = append(records.Expenses, expense.TransactionExpenses)
+		}
+	}
+	payments, err := loaders.tripPaymentList(ctx, r.trip.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		records.Payments = append(records.Payments, payment.TransactionPayment)
+	}
+
+	l := ledger.Build(records)
+	people := map[string]TripMember.TripMember{}
+	for _, member := range members {
+		people[ledger.Person(member.TripMember)] = member
+	}
+	result := make([]*balanceResolver, len(members))
+	for i, member := range members {
+		balance := &balanceResolver{member: member, counterparts: []*counterpartResolver{}}
+		person := ledger.Person(member.TripMember)
+		for _, counterpart := range l.Counterparts(person) {
+			net := l.Net(person, counterpart)
+			balance.net += net
+			c := &counterpartResolver{net: net}
+			if m, ok := people[counterpart]; ok {
+				c.member = &memberResolver{m}
+			}
+			balance.counterparts = append(balance.counterparts, c)
+		}
+		result[i] = balance
+	}
+	return result, nil
+}
+
+type memberResolver struct {
+	member TripMember.TripMember
+}
+
+func (r *memberResolver) ID() graphqlgo.ID          { return graphqlgo.ID(r.member.ID) }
+func (r *memberResolver) Name() string              { return r.member.Name }
+func (r *memberResolver) Status() string            { return r.member.Status }
+func (r *memberResolver) CreatedAt() graphqlgo.Time { return graphqlgo.Time{Time: r.member.CreatedAt} }
+
+// User returns the account of the member, if any.
+func (r *memberResolver) User(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.member.UserId)
+}
+
+type transactionResolver struct {
+	transaction Transaction.Transaction
+}
+
+func (r *transactionResolver) ID() graphqlgo.ID    { return graphqlgo.ID(r.transaction.ID) }
+func (r *transactionResolver) Title() string       { return r.transaction.Title }
+func (r *transactionResolver) Description() string { return r.transaction.Description }
+func (r *transactionResolver) Method() string      { return r.transaction.Method }
+func (r *transactionResolver) Status() string      { return r.transaction.Status }
+func (r *transactionResolver) GrandTotal() Long    { return Long(r.transaction.GrandTotal) }
+func (r *transactionResolver) SubTotal() Long      { return Long(r.transaction.SubTotal) }
+func (r *transactionResolver) ServiceCharge() Long { return Long(r.transaction.ServiceCharge) }
+func (r *transactionResolver) CreatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: r.transaction.CreatedAt}
+}
+func (r *transactionResolver) UpdatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: r.transaction.UpdatedAt}
+}
+
+// Trip returns the trip of the transaction.
+func (r *transactionResolver) Trip(ctx context.Context) (*tripResolver, error) {
+	t, err := loadersFrom(ctx).trip(ctx, r.transaction.TripId)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.NotFound("")
+	}
+	return &tripResolver{*t}, nil
+}
+
+// Payer returns the user who paid the transaction, if known.
+func (r *transactionResolver) Payer(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.transaction.UserPaidId)
+}
+
+// Items returns the items of the transaction.
+func (r *transactionResolver) Items(ctx context.Context) ([]*itemResolver, error) {
+	items, err := loadersFrom(ctx).transactionItems(ctx, r.transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*itemResolver, len(items))
+	for i, item := range items {
+		result[i] = &itemResolver{item}
+	}
+	return result, nil
+}
+
+// Expenses returns the expenses of the transaction.
+func (r *transactionResolver) Expenses(ctx context.Context) ([]*expenseResolver, error) {
+	expenses, err := loadersFrom(ctx).transactionExpenses(ctx, r.transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*expenseResolver, len(expenses))
+	for i, expense := range expenses {
+		result[i] = &expenseResolver{expense}
+	}
+	return result, nil
+}
+
+// Payments returns the payments of the transaction.
+func (r *transactionResolver) Payments(ctx context.Context) ([]*paymentResolver, error) {
+	loaders := loadersFrom(ctx)
+	payments, err := loaders.transactionPayments(ctx, r.transaction.ID)
+	if err != nil {
+		return nil, err
+	}
+	return newPaymentResolvers(loaders, payments), nil
+}
+
+type itemResolver struct {
+	item TransactionItem.TransactionItem
+}
+
+func (r *itemResolver) ID() graphqlgo.ID          { return graphqlgo.ID(r.item.ID) }
+func (r *itemResolver) Title() string             { return r.item.Title }
+func (r *itemResolver) Description() string       { return r.item.Description }
+func (r *itemResolver) Price() Long               { return Long(r.item.Price) }
+func (r *itemResolver) Quantity() int32           { return int32(r.item.Quantity) }
+func (r *itemResolver) CreatedAt() graphqlgo.Time { return graphqlgo.Time{Time: r.item.CreatedAt} }
+
+// Expenses returns the expenses of the item.
+func (r *itemResolver) Expenses(ctx context.Context) ([]*expenseResolver, error) {
+	expenses, err := loadersFrom(ctx).transactionExpenses(ctx, r.item.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+	result := []*expenseResolver{}
+	for _, expense := range expenses {
+		if expense.ItemId == r.item.ID {
+			result = append(result, &expenseResolver{expense})
+		}
+	}
+	return result, nil
+}
+
+type expenseResolver struct {
+	expense TransactionExpenses.TransactionExpenses
+}
+
+func (r *expenseResolver) ID() graphqlgo.ID { return graphqlgo.ID(r.expense.ID) }
+func (r *expenseResolver) Quantity() Long   { return Long(r.expense.Quantity) }
+func (r *expenseResolver) CreatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: r.expense.CreatedAt}
+}
+
+// Member returns the member who consumed the item.
+func (r *expenseResolver) Member(ctx context.Context) (*memberResolver, error) {
+	return loadMember(ctx, r.expense.TripId, r.expense.TripMemberId)
+}
+
+// Item returns the item of the expense.
+func (r *expenseResolver) Item(ctx context.Context) (*itemResolver, error) {
+	items, err := loadersFrom(ctx).transactionItems(ctx, r.expense.TransactionId)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.ID == r.expense.ItemId {
+			return &itemResolver{item}, nil
+		}
+	}
+	return nil, nil
+}
+
+type paymentResolver struct {
+	payment TransactionPayment.TransactionPayment
+}
+
+// newPaymentResolvers returns the resolvers of the payments and schedules their users to be fetched together.
+func newPaymentResolvers(loaders *loaders, payments []TransactionPayment.TransactionPayment) []*paymentResolver {
+	primePayments(loaders, payments)
+	result := make([]*paymentResolver, len(payments))
+	for i, payment := range payments {
+		result[i] = &paymentResolver{payment}
+	}
+	return result
+}
+
+func (r *paymentResolver) ID() graphqlgo.ID { return graphqlgo.ID(r.payment.ID) }
+func (r *paymentResolver) Nominal() Long    { return Long(r.payment.Nominal) }
+func (r *paymentResolver) Currency() string { return r.payment.Currency }
+func (r *paymentResolver) Status() string   { return r.payment.Status }
+func (r *paymentResolver) CreatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: r.payment.CreatedAt}
+}
+func (r *paymentResolver) UpdatedAt() graphqlgo.Time {
+	return graphqlgo.Time{Time: r.payment.UpdatedAt}
+}
+
+// From returns the user who pays.
+func (r *paymentResolver) From(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.payment.UserFromId)
+}
+
+// To returns the user who is paid.
+func (r *paymentResolver) To(ctx context.Context) (*userResolver, error) {
+	return loadUser(ctx, r.payment.UserToId)
+}
+
+// Member returns the trip member the payment is for.
+func (r *paymentResolver) Member(ctx context.Context) (*memberResolver, error) {
+	return loadMember(ctx, r.payment.TripId, r.payment.TripMemberId)
+}
+
+type balanceResolver struct {
+	member       TripMember.TripMember
+	net          int64
+	counterparts []*counterpartResolver
+}
+
+func (r *balanceResolver) Member() *memberResolver              { return &memberResolver{r.member} }
+func (r *balanceResolver) Net() Long                            { return Long(r.net) }
+func (r *balanceResolver) Counterparts() []*counterpartResolver { return r.counterparts }
+
+type counterpartResolver struct {
+	member *memberResolver
+	net    int64
+}
+
+func (r *counterpartResolver) Member() *memberResolver { return r.member }
+func (r *counterpartResolver) Net() Long               { return Long(r.net) }
+
+// loadUser returns the resolver of the user with the given ID, or nil if there is none.
+func loadUser(ctx context.Context, id string) (*userResolver, error) {
+	user, err := loadersFrom(ctx).user(ctx, id)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	return &userResolver{*user}, nil
+}
+
+// loadMember returns the resolver of the member of the trip with the given ID, or nil if there is none.
+func loadMember(ctx context.Context, tripId, id string) (*memberResolver, error) {
+	members, err := loadersFrom(ctx).tripMembers(ctx, tripId)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if member.ID == id {
+			return &memberResolver{member}, nil
+		}
+	}
+	return nil, nil
+}
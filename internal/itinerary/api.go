@@ -0,0 +1,180 @@
+package itinerary
+
+import (
+	"mime"
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/ical"
+	"tribbie/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/trips/<id>/itinerary", authHandler, res.get)
+	r.Get("/trips/<id>/itinerary.ics", authHandler, res.export)
+	r.Post("/trips/<id>/itinerary/days", authHandler, res.createDay)
+	r.Put("/trips/<id>/itinerary/days/<day_id>", authHandler, res.updateDay)
+	r.Delete("/trips/<id>/itinerary/days/<day_id>", authHandler, res.deleteDay)
+	r.Put("/trips/<id>/itinerary/days/<day_id>/order", authHandler, res.reorder)
+	r.Post("/trips/<id>/itinerary/days/<day_id>/entries", authHandler, res.createEntry)
+	r.Put("/trips/<id>/itinerary/entries/<entry_id>", authHandler, res.updateEntry)
+	r.Delete("/trips/<id>/itinerary/entries/<entry_id>", authHandler, res.deleteEntry)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// get returns the itinerary of a trip.
+func (r resource) get(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	itinerary, err := r.service.Get(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(itinerary)
+}
+
+// export returns the itinerary of a trip as an iCalendar file.
+func (r resource) export(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	calendar, err := r.service.Export(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	header := c.Response.Header()
+	header.Set("Content-Type", ical.ContentType)
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "itinerary.ics"}))
+	c.Response.WriteHeader(http.StatusOK)
+	_, err = c.Response.Write(calendar.Marshal())
+	return err
+}
+
+// createDay adds a day to the itinerary of a trip.
+func (r resource) createDay(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input CreateDayRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	input.TripId = c.Param("id")
+	day, err := r.service.CreateDay(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(day, http.StatusCreated)
+}
+
+// updateDay updates an itinerary day.
+func (r resource) updateDay(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input UpdateDayRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	day, err := r.service.UpdateDay(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("day_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(day)
+}
+
+// deleteDay removes an itinerary day with its entries.
+func (r resource) deleteDay(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	day, err := r.service.DeleteDay(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("day_id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(day)
+}
+
+// reorder changes the order of the entries of an itinerary day.
+func (r resource) reorder(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input ReorderRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	day, err := r.service.Reorder(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("day_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(day)
+}
+
+// createEntry adds an entry to an itinerary day.
+func (r resource) createEntry(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input EntryRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	entry, err := r.service.CreateEntry(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("day_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(entry, http.StatusCreated)
+}
+
+// updateEntry updates an itinerary entry.
+func (r resource) updateEntry(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input UpdateEntryRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	entry, err := r.service.UpdateEntry(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("entry_id"), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(entry)
+}
+
+// deleteEntry removes an itinerary entry.
+func (r resource) deleteEntry(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	entry, err := r.service.DeleteEntry(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("entry_id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(entry)
+}
@@ -0,0 +1,171 @@
+package itinerary
+
+import (
+	"context"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access itineraries from the data source.
+type Repository interface {
+	// GetTrip returns the trip with the specified ID.
+	GetTrip(ctx context.Context, id string) (entity.Trip, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+	// GetTransaction returns the transaction with the specified ID.
+	GetTransaction(ctx context.Context, id string) (entity.Transaction, error)
+
+	// QueryDays returns the itinerary days of the trip in chronological order.
+	QueryDays(ctx context.Context, tripId string) ([]entity.ItineraryDay, error)
+	// GetDay returns the itinerary day with the specified ID.
+	GetDay(ctx context.Context, id string) (entity.ItineraryDay, error)
+	// CreateDay saves a new itinerary day in the storage.
+	CreateDay(ctx context.Context, day entity.ItineraryDay) error
+	// UpdateDay updates the itinerary day in the storage.
+	UpdateDay(ctx context.Context, day entity.ItineraryDay) error
+	// DeleteDay removes the itinerary day with given ID together with its entries from the storage.
+	DeleteDay(ctx context.Context, id string) error
+
+	// QueryEntries returns the itinerary entries of the trip ordered by their position within their day.
+	QueryEntries(ctx context.Context, tripId string) ([]entity.ItineraryEntry, error)
+	// GetEntry returns the itinerary entry with the specified ID.
+	GetEntry(ctx context.Context, id string) (entity.ItineraryEntry, error)
+	// NextPosition returns the position of an entry added to the end of the day.
+	NextPosition(ctx context.Context, dayId string) (int, error)
+	// CreateEntry saves a new itinerary entry in the storage.
+	CreateEntry(ctx context.Context, entry entity.ItineraryEntry) error
+	// UpdateEntry updates the itinerary entry in the storage.
+	UpdateEntry(ctx context.Context, entry entity.ItineraryEntry) error
+	// DeleteEntry removes the itinerary entry with given ID from the storage.
+	DeleteEntry(ctx context.Context, id string) error
+	// Reorder sets the positions of the entries of the day to their order in entryIds.
+	Reorder(ctx context.Context, dayId string, entryIds []string) error
+}
+
+// repository persists itineraries in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new itinerary repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetTrip reads the trip with the specified ID from the database.
+func (r repository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	var trip entity.Trip
+	err := r.db.With(ctx).Select().Model(id, &trip)
+	return trip, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// GetTransaction reads the transaction with the specified ID from the database.
+func (r repository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	var transaction entity.Transaction
+	err := r.db.With(ctx).Select().Model(id, &transaction)
+	return transaction, err
+}
+
+// QueryDays retrieves the itinerary days of the trip from the database.
+func (r repository) QueryDays(ctx context.Context, tripId string) ([]entity.ItineraryDay, error) {
+	var days []entity.ItineraryDay
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("date", "id").
+		All(&days)
+	return days, err
+}
+
+// GetDay reads the itinerary day with the specified ID from the database.
+func (r repository) GetDay(ctx context.Context, id string) (entity.ItineraryDay, error) {
+	var day entity.ItineraryDay
+	err := r.db.With(ctx).Select().Model(id, &day)
+	return day, err
+}
+
+// CreateDay saves a new itinerary day record in the database.
+func (r repository) CreateDay(ctx context.Context, day entity.ItineraryDay) error {
+	return r.db.With(ctx).Model(&day).Insert()
+}
+
+// UpdateDay saves the changes to an itinerary day in the database.
+func (r repository) UpdateDay(ctx context.Context, day entity.ItineraryDay) error {
+	return r.db.With(ctx).Model(&day).Update()
+}
+
+// DeleteDay deletes the itinerary day with the specified ID and its entries from the database.
+func (r repository) DeleteDay(ctx context.Context, id string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		if _, err := r.db.With(ctx).Delete("itinerary_entry", dbx.HashExp{"day_id": id}).Execute(); err != nil {
+			return err
+		}
+		_, err := r.db.With(ctx).Delete("itinerary_day", dbx.HashExp{"id": id}).Execute()
+		return err
+	})
+}
+
+// QueryEntries retrieves the itinerary entries of the trip from the database.
+func (r repository) QueryEntries(ctx context.Context, tripId string) ([]entity.ItineraryEntry, error) {
+	var entries []entity.ItineraryEntry
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("day_id", "position", "created_at").
+		All(&entries)
+	return entries, err
+}
+
+// GetEntry reads the itinerary entry with the specified ID from the database.
+func (r repository) GetEntry(ctx context.Context, id string) (entity.ItineraryEntry, error) {
+	var entry entity.ItineraryEntry
+	err := r.db.With(ctx).Select().Model(id, &entry)
+	return entry, err
+}
+
+// NextPosition returns the position following the last entry of the day in the database.
+func (r repository) NextPosition(ctx context.Context, dayId string) (int, error) {
+	var position int
+	err := r.db.With(ctx).Select("COALESCE(MAX(position) + 1, 0)").From("itinerary_entry").Where(dbx.HashExp{"day_id": dayId}).Row(&position)
+	return position, err
+}
+
+// CreateEntry saves a new itinerary entry record in the database.
+func (r repository) CreateEntry(ctx context.Context, entry entity.ItineraryEntry) error {
+	return r.db.With(ctx).Model(&entry).Insert()
+}
+
+// UpdateEntry saves the changes to an itinerary entry in the database.
+func (r repository) UpdateEntry(ctx context.Context, entry entity.ItineraryEntry) error {
+	return r.db.With(ctx).Model(&entry).Update()
+}
+
+// DeleteEntry deletes the itinerary entry with the specified ID from the database.
+func (r repository) DeleteEntry(ctx context.Context, id string) error {
+	_, err := r.db.With(ctx).Delete("itinerary_entry", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// Reorder updates the positions of the entries of the day in the database within a transaction.
+func (r repository) Reorder(ctx context.Context, dayId string, entryIds []string) error {
+	return r.db.Transactional(ctx, func(ctx context.Context) error {
+		for position, id := range entryIds {
+			_, err := r.db.With(ctx).Update("itinerary_entry", dbx.Params{"position": position}, dbx.HashExp{"id": id, "day_id": dayId}).Execute()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,533 @@
+package itinerary
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"tribbie/internal/activity"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/realtime"
+	"tribbie/pkg/ical"
+	"tribbie/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// dateLayout is the format of the dates of itinerary days.
+	dateLayout = "2006-01-02"
+	// timeLayout is the format of the start and end times of itinerary entries.
+	timeLayout = "15:04"
+	// defaultDuration is the length of the calendar events of entries without an end time.
+	defaultDuration = time.Hour
+)
+
+// Service encapsulates usecase logic for trip itineraries.
+// Only the members of a trip can see and plan its itinerary.
+type Service interface {
+	// Get returns the itinerary of the trip.
+	Get(ctx context.Context, userId, tripId string) (Itinerary, error)
+	// CreateDay adds a day to the itinerary of a trip.
+	CreateDay(ctx context.Context, userId string, input CreateDayRequest) (Day, error)
+	// UpdateDay updates the date, title and notes of an itinerary day.
+	UpdateDay(ctx context.Context, userId, tripId, id string, input UpdateDayRequest) (Day, error)
+	// DeleteDay removes an itinerary day together with its entries.
+	DeleteDay(ctx context.Context, userId, tripId, id string) (Day, error)
+	// Reorder changes the order of the entries of an itinerary day.
+	Reorder(ctx context.Context, userId, tripId, dayId string, input ReorderRequest) (Day, error)
+	// CreateEntry adds an entry to the end of an itinerary day.
+	CreateEntry(ctx context.Context, userId, tripId, dayId string, input EntryRequest) (Entry, error)
+	// UpdateEntry updates an itinerary entry, moving it to the end of another day if its day changes.
+	UpdateEntry(ctx context.Context, userId, tripId, id string, input UpdateEntryRequest) (Entry, error)
+	// DeleteEntry removes an itinerary entry.
+	DeleteEntry(ctx context.Context, userId, tripId, id string) (Entry, error)
+	// Export returns the itinerary of the trip as a calendar.
+	Export(ctx context.Context, userId, tripId string) (ical.Calendar, error)
+}
+
+// Itinerary represents the itinerary of a trip with the total estimated cost of its entries.
+type Itinerary struct {
+	TripId        string `json:"trip_id"`
+	TimeZone      string `json:"time_zone"`
+	Currency      string `json:"currency"`
+	EstimatedCost int64  `json:"estimated_cost"`
+	Days          []Day  `json:"days"`
+}
+
+// Day represents an itinerary day with its entries in order and their total estimated cost.
+type Day struct {
+	entity.ItineraryDay
+	EstimatedCost int64   `json:"estimated_cost"`
+	Entries       []Entry `json:"entries"`
+}
+
+// Entry represents the data about an itinerary entry.
+type Entry struct {
+	entity.ItineraryEntry
+}
+
+// CreateDayRequest represents an itinerary day creation request.
+type CreateDayRequest struct {
+	TripId string `json:"-"`
+	Date   string `json:"date"`
+	Title  string `json:"title"`
+	Notes  string `json:"notes"`
+}
+
+// Validate validates the CreateDayRequest fields.
+func (m CreateDayRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.TripId, validation.Required),
+		validation.Field(&m.Date, validation.Required, validation.Date(dateLayout)),
+		validation.Field(&m.Title, validation.Length(0, 128)),
+		validation.Field(&m.Notes, validation.Length(0, 1000)),
+	)
+}
+
+// UpdateDayRequest represents an itinerary day update request.
+type UpdateDayRequest struct {
+	Date  string `json:"date"`
+	Title string `json:"title"`
+	Notes string `json:"notes"`
+}
+
+// Validate validates the UpdateDayRequest fields.
+func (m UpdateDayRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Date, validation.Required, validation.Date(dateLayout)),
+		validation.Field(&m.Title, validation.Length(0, 128)),
+		validation.Field(&m.Notes, validation.Length(0, 1000)),
+	)
+}
+
+// ReorderRequest represents a request to order the entries of a day. It must list all the entries of the day.
+type ReorderRequest struct {
+	EntryIds []string `json:"entry_ids"`
+}
+
+// EntryRequest represents an itinerary entry creation request.
+// Entries without a start time last the whole day. The end time may be before the start time for entries ending
+// after midnight.
+type EntryRequest struct {
+	Activity         string `json:"activity"`
+	Place            string `json:"place"`
+	StartTime        string `json:"start_time"`
+	EndTime          string `json:"end_time"`
+	Notes            string `json:"notes"`
+	BookingReference string `json:"booking_reference"`
+	EstimatedCost    int64  `json:"estimated_cost"`
+	TransactionId    string `json:"transaction_id"`
+}
+
+// Validate validates the EntryRequest fields.
+func (m EntryRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Activity, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Place, validation.Length(0, 255)),
+		validation.Field(&m.StartTime, validation.Date(timeLayout), validation.When(m.EndTime != "", validation.Required)),
+		validation.Field(&m.EndTime, validation.Date(timeLayout)),
+		validation.Field(&m.Notes, validation.Length(0, 1000)),
+		validation.Field(&m.BookingReference, validation.Length(0, 128)),
+		validation.Field(&m.EstimatedCost, validation.Min(int64(0))),
+	)
+}
+
+// UpdateEntryRequest represents an itinerary entry update request. The entry stays on its day if DayId is empty.
+type UpdateEntryRequest struct {
+	EntryRequest
+	DayId string `json:"day_id"`
+}
+
+type service struct {
+	repo      Repository
+	publisher realtime.Publisher
+	logger    log.Logger
+}
+
+// NewService creates a new itinerary service.
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, publisher, logger}
+}
+
+// Get returns the days of the itinerary of the trip in chronological order, with their entries in order.
+func (s service) Get(ctx context.Context, userId, tripId string) (Itinerary, error) {
+	trip, err := s.trip(ctx, userId, tripId)
+	if err != nil {
+		return Itinerary{}, err
+	}
+	days, err := s.repo.QueryDays(ctx, tripId)
+	if err != nil {
+		return Itinerary{}, err
+	}
+	entries, err := s.repo.QueryEntries(ctx, tripId)
+	if err != nil {
+		return Itinerary{}, err
+	}
+	itinerary := Itinerary{TripId: trip.ID, TimeZone: trip.TimeZone, Currency: trip.Currency, Days: []Day{}}
+	for _, day := range days {
+		result := newDay(day, entries)
+		itinerary.EstimatedCost += result.EstimatedCost
+		itinerary.Days = append(itinerary.Days, result)
+	}
+	return itinerary, nil
+}
+
+// CreateDay adds a day to the itinerary. A trip has at most one itinerary day per date.
+func (s service) CreateDay(ctx context.Context, userId string, req CreateDayRequest) (Day, error) {
+	if err := req.Validate(); err != nil {
+		return Day{}, err
+	}
+	if _, err := s.trip(ctx, userId, req.TripId); err != nil {
+		return Day{}, err
+	}
+	if err := s.checkDate(ctx, req.TripId, "", req.Date); err != nil {
+		return Day{}, err
+	}
+	now := time.Now()
+	day := entity.ItineraryDay{
+		ID:        entity.GenerateID(),
+		TripId:    req.TripId,
+		Date:      req.Date,
+		Title:     req.Title,
+		Notes:     req.Notes,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.CreateDay(ctx, day); err != nil {
+		return Day{}, err
+	}
+	result := Day{ItineraryDay: day, Entries: []Entry{}}
+	s.publisher.Publish(ctx, realtime.NewEvent(day.TripId, "itinerary_day", realtime.Created, result))
+	return result, nil
+}
+
+// UpdateDay updates the itinerary day with the specified ID.
+func (s service) UpdateDay(ctx context.Context, userId, tripId, id string, req UpdateDayRequest) (Day, error) {
+	if err := req.Validate(); err != nil {
+		return Day{}, err
+	}
+	day, err := s.day(ctx, userId, tripId, id)
+	if err != nil {
+		return Day{}, err
+	}
+	if err := s.checkDate(ctx, tripId, id, req.Date); err != nil {
+		return Day{}, err
+	}
+	day.Date = req.Date
+	day.Title = req.Title
+	day.Notes = req.Notes
+	day.UpdatedAt = time.Now()
+	if err := s.repo.UpdateDay(ctx, day); err != nil {
+		return Day{}, err
+	}
+	return s.publishDay(ctx, day, realtime.Updated)
+}
+
+// DeleteDay deletes the itinerary day with the specified ID together with its entries.
+func (s service) DeleteDay(ctx context.Context, userId, tripId, id string) (Day, error) {
+	day, err := s.day(ctx, userId, tripId, id)
+	if err != nil {
+		return Day{}, err
+	}
+	entries, err := s.repo.QueryEntries(ctx, tripId)
+	if err != nil {
+		return Day{}, err
+	}
+	if err := s.repo.DeleteDay(ctx, id); err != nil {
+		return Day{}, err
+	}
+	result := newDay(day, entries)
+	s.publisher.Publish(ctx, realtime.NewEvent(tripId, "itinerary_day", realtime.Deleted, result))
+	return result, nil
+}
+
+// Reorder orders the entries of the day as listed in the request.
+func (s service) Reorder(ctx context.Context, userId, tripId, dayId string, req ReorderRequest) (Day, error) {
+	day, err := s.day(ctx, userId, tripId, dayId)
+	if err != nil {
+		return Day{}, err
+	}
+	entries, err := s.repo.QueryEntries(ctx, tripId)
+	if err != nil {
+		return Day{}, err
+	}
+	remaining := map[string]bool{}
+	for _, entry := range entries {
+		if entry.DayId == dayId {
+			remaining[entry.ID] = true
+		}
+	}
+	if len(req.EntryIds) != len(remaining) {
+		return Day{}, errors.BadRequest("The order must list every entry of the day once.")
+	}
+	for _, id := range req.EntryIds {
+		if !remaining[id] {
+			return Day{}, errors.BadRequest("The order must list every entry of the day once.")
+		}
+		delete(remaining, id)
+	}
+	if err := s.repo.Reorder(ctx, dayId, req.EntryIds); err != nil {
+		return Day{}, err
+	}
+	return s.publishDay(ctx, day, realtime.Updated)
+}
+
+// CreateEntry adds an entry to the end of the itinerary day.
+func (s service) CreateEntry(ctx context.Context, userId, tripId, dayId string, req EntryRequest) (Entry, error) {
+	if err := req.Validate(); err != nil {
+		return Entry{}, err
+	}
+	if _, err := s.day(ctx, userId, tripId, dayId); err != nil {
+		return Entry{}, err
+	}
+	if err := s.checkTransaction(ctx, tripId, req.TransactionId); err != nil {
+		return Entry{}, err
+	}
+	position, err := s.repo.NextPosition(ctx, dayId)
+	if err != nil {
+		return Entry{}, err
+	}
+	now := time.Now()
+	entry := entity.ItineraryEntry{
+		ID:        entity.GenerateID(),
+		TripId:    tripId,
+		DayId:     dayId,
+		Position:  position,
+		CreatedAt: now,
+	}
+	setEntry(&entry, req, now)
+	if err := s.repo.CreateEntry(ctx, entry); err != nil {
+		return Entry{}, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(tripId, "itinerary_entry", realtime.Created, entry))
+	return Entry{entry}, nil
+}
+
+// UpdateEntry updates the itinerary entry with the specified ID.
+func (s service) UpdateEntry(ctx context.Context, userId, tripId, id string, req UpdateEntryRequest) (Entry, error) {
+	if err := req.Validate(); err != nil {
+		return Entry{}, err
+	}
+	entry, err := s.entry(ctx, userId, tripId, id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := s.checkTransaction(ctx, tripId, req.TransactionId); err != nil {
+		return Entry{}, err
+	}
+	if req.DayId != "" && req.DayId != entry.DayId {
+		if _, err := s.day(ctx, userId, tripId, req.DayId); err != nil {
+			return Entry{}, err
+		}
+		if entry.Position, err = s.repo.NextPosition(ctx, req.DayId); err != nil {
+			return Entry{}, err
+		}
+		entry.DayId = req.DayId
+	}
+	setEntry(&entry, req.EntryRequest, time.Now())
+	if err := s.repo.UpdateEntry(ctx, entry); err != nil {
+		return Entry{}, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(tripId, "itinerary_entry", realtime.Updated, entry))
+	return Entry{entry}, nil
+}
+
+// DeleteEntry deletes the itinerary entry with the specified ID.
+func (s service) DeleteEntry(ctx context.Context, userId, tripId, id string) (Entry, error) {
+	entry, err := s.entry(ctx, userId, tripId, id)
+	if err != nil {
+		return Entry{}, err
+	}
+	if err := s.repo.DeleteEntry(ctx, id); err != nil {
+		return Entry{}, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(tripId, "itinerary_entry", realtime.Deleted, entry))
+	return Entry{entry}, nil
+}
+
+// Export returns the itinerary as a calendar. Entries with a start time become events in the time zone of the
+// trip, while the other entries and the titled days become all-day events.
+func (s service) Export(ctx context.Context, userId, tripId string) (ical.Calendar, error) {
+	itinerary, err := s.Get(ctx, userId, tripId)
+	if err != nil {
+		return ical.Calendar{}, err
+	}
+	trip, err := s.repo.GetTrip(ctx, tripId)
+	if err != nil {
+		return ical.Calendar{}, err
+	}
+	loc := trip.Location()
+	calendar := ical.Calendar{ProdID: "-//Tribbie//Itinerary//EN", Name: trip.Title, Events: []ical.Event{}}
+	for _, day := range itinerary.Days {
+		date, err := time.ParseInLocation(dateLayout, day.Date, loc)
+		if err != nil {
+			s.logger.With(ctx).Errorf("invalid date of itinerary day %v: %v", day.ID, err)
+			continue
+		}
+		if day.Title != "" {
+			calendar.Events = append(calendar.Events, ical.Event{
+				UID:         day.ID + "@tribbie",
+				Start:       date,
+				End:         date.AddDate(0, 0, 1),
+				AllDay:      true,
+				Summary:     day.Title,
+				Description: day.Notes,
+				Stamp:       day.UpdatedAt,
+			})
+		}
+		for _, entry := range day.Entries {
+			event := ical.Event{
+				UID:         entry.ID + "@tribbie",
+				Start:       date,
+				End:         date.AddDate(0, 0, 1),
+				AllDay:      true,
+				Summary:     entry.Activity,
+				Location:    entry.Place,
+				Description: describe(entry.ItineraryEntry, trip.Currency),
+				Stamp:       entry.UpdatedAt,
+			}
+			if entry.StartTime != "" {
+				event.AllDay = false
+				event.Start = atTime(date, entry.StartTime)
+				event.End = event.Start.Add(defaultDuration)
+				if entry.EndTime != "" {
+					event.End = atTime(date, entry.EndTime)
+					if !event.End.After(event.Start) {
+						event.End = atTime(date.AddDate(0, 0, 1), entry.EndTime)
+					}
+				}
+			}
+			calendar.Events = append(calendar.Events, event)
+		}
+	}
+	return calendar, nil
+}
+
+// trip returns the trip if the user is a member of it.
+func (s service) trip(ctx context.Context, userId, tripId string) (entity.Trip, error) {
+	trip, err := s.repo.GetTrip(ctx, tripId)
+	if err == sql.ErrNoRows {
+		return entity.Trip{}, errors.NotFound("")
+	} else if err != nil {
+		return entity.Trip{}, err
+	}
+	member, err := s.repo.IsTripMember(ctx, tripId, userId)
+	if err != nil {
+		return entity.Trip{}, err
+	}
+	if !member {
+		return entity.Trip{}, errors.Forbidden("Only the members of the trip can access its itinerary.")
+	}
+	return trip, nil
+}
+
+// day returns the itinerary day of the trip if the user is a member of it.
+func (s service) day(ctx context.Context, userId, tripId, id string) (entity.ItineraryDay, error) {
+	if _, err := s.trip(ctx, userId, tripId); err != nil {
+		return entity.ItineraryDay{}, err
+	}
+	day, err := s.repo.GetDay(ctx, id)
+	if err == sql.ErrNoRows || err == nil && day.TripId != tripId {
+		return entity.ItineraryDay{}, errors.NotFound("")
+	}
+	return day, err
+}
+
+// entry returns the itinerary entry of the trip if the user is a member of it.
+func (s service) entry(ctx context.Context, userId, tripId, id string) (entity.ItineraryEntry, error) {
+	if _, err := s.trip(ctx, userId, tripId); err != nil {
+		return entity.ItineraryEntry{}, err
+	}
+	entry, err := s.repo.GetEntry(ctx, id)
+	if err == sql.ErrNoRows || err == nil && entry.TripId != tripId {
+		return entity.ItineraryEntry{}, errors.NotFound("")
+	}
+	return entry, err
+}
+
+// checkDate returns an error if another day of the itinerary has the date.
+func (s service) checkDate(ctx context.Context, tripId, dayId, date string) error {
+	days, err := s.repo.QueryDays(ctx, tripId)
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if day.Date == date && day.ID != dayId {
+			return errors.Conflict(fmt.Sprintf("The itinerary already has a day on %v.", date))
+		}
+	}
+	return nil
+}
+
+// checkTransaction returns an error unless the transaction linked to an entry belongs to the trip.
+func (s service) checkTransaction(ctx context.Context, tripId, transactionId string) error {
+	if transactionId == "" {
+		return nil
+	}
+	transaction, err := s.repo.GetTransaction(ctx, transactionId)
+	if err == sql.ErrNoRows || err == nil && transaction.TripId != tripId {
+		return errors.BadRequest("The linked transaction must belong to the trip.")
+	}
+	return err
+}
+
+// publishDay streams the change of the day with its entries to the members of the trip.
+func (s service) publishDay(ctx context.Context, day entity.ItineraryDay, action string) (Day, error) {
+	entries, err := s.repo.QueryEntries(ctx, day.TripId)
+	if err != nil {
+		return Day{}, err
+	}
+	result := newDay(day, entries)
+	s.publisher.Publish(ctx, realtime.NewEvent(day.TripId, "itinerary_day", action, result))
+	return result, nil
+}
+
+// newDay returns the day with its entries among the given entries, which must be in order.
+func newDay(day entity.ItineraryDay, entries []entity.ItineraryEntry) Day {
+	result := Day{ItineraryDay: day, Entries: []Entry{}}
+	for _, entry := range entries {
+		if entry.DayId == day.ID {
+			result.Entries = append(result.Entries, Entry{entry})
+			result.EstimatedCost += entry.EstimatedCost
+		}
+	}
+	return result
+}
+
+// setEntry copies the fields of the request to the entry.
+func setEntry(entry *entity.ItineraryEntry, req EntryRequest, now time.Time) {
+	entry.Activity = req.Activity
+	entry.Place = req.Place
+	entry.StartTime = req.StartTime
+	entry.EndTime = req.EndTime
+	entry.Notes = req.Notes
+	entry.BookingReference = req.BookingReference
+	entry.EstimatedCost = req.EstimatedCost
+	entry.TransactionId = req.TransactionId
+	entry.UpdatedAt = now
+}
+
+// atTime returns the time of the day given as HH:MM on the date.
+func atTime(date time.Time, clock string) time.Time {
+	t, _ := time.Parse(timeLayout, clock)
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, date.Location())
+}
+
+// describe returns the description of the calendar event of the entry.
+func describe(entry entity.ItineraryEntry, currency string) string {
+	var lines []string
+	if entry.Notes != "" {
+		lines = append(lines, entry.Notes)
+	}
+	if entry.BookingReference != "" {
+		lines = append(lines, "Booking reference: "+entry.BookingReference)
+	}
+	if entry.EstimatedCost > 0 {
+		lines = append(lines, "Estimated cost: "+activity.FormatAmount(entry.EstimatedCost, currency))
+	}
+	return strings.Join(lines, "\n")
+}
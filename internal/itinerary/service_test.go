@@ -0,0 +1,241 @@
+package itinerary
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/realtime"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     EntryRequest
+		wantError bool
+	}{
+		{"success", EntryRequest{Activity: "Dinner", StartTime: "19:00", EndTime: "21:30"}, false},
+		{"all day", EntryRequest{Activity: "Nusa Penida"}, false},
+		{"required", EntryRequest{Activity: ""}, true},
+		{"invalid time", EntryRequest{Activity: "Dinner", StartTime: "7pm"}, true},
+		{"end without start", EntryRequest{Activity: "Dinner", EndTime: "21:30"}, true},
+		{"negative cost", EntryRequest{Activity: "Dinner", EstimatedCost: -1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		trips:        map[string]entity.Trip{"trip1": {ID: "trip1", Title: "Bali", Currency: "IDR", TimeZone: "Asia/Makassar"}},
+		members:      map[string]bool{"budi": true},
+		transactions: map[string]entity.Transaction{"t1": {ID: "t1", TripId: "trip1"}, "t2": {ID: "t2", TripId: "trip2"}},
+		days:         map[string]entity.ItineraryDay{},
+		entries:      map[string]entity.ItineraryEntry{},
+	}
+	s := NewService(repo, mockPublisher{}, logger)
+	ctx := context.Background()
+
+	_, err := s.Get(ctx, "carol", "trip1")
+	assert.Equal(t, errors.Forbidden("Only the members of the trip can access its itinerary."), err)
+	_, err = s.Get(ctx, "budi", "trip0")
+	assert.Equal(t, errors.NotFound(""), err)
+
+	second, err := s.CreateDay(ctx, "budi", CreateDayRequest{TripId: "trip1", Date: "2026-07-15", Title: "Nusa Penida"})
+	assert.Nil(t, err)
+	first, err := s.CreateDay(ctx, "budi", CreateDayRequest{TripId: "trip1", Date: "2026-07-14"})
+	assert.Nil(t, err)
+	_, err = s.CreateDay(ctx, "budi", CreateDayRequest{TripId: "trip1", Date: "2026-07-14"})
+	assert.Equal(t, errors.Conflict("The itinerary already has a day on 2026-07-14."), err)
+
+	_, err = s.CreateEntry(ctx, "budi", "trip1", first.ID, EntryRequest{Activity: "Dinner", TransactionId: "t2"})
+	assert.Equal(t, errors.BadRequest("The linked transaction must belong to the trip."), err)
+	dinner, err := s.CreateEntry(ctx, "budi", "trip1", first.ID, EntryRequest{
+		Activity: "Dinner", Place: "Jimbaran", StartTime: "19:00", EndTime: "21:30", BookingReference: "JMB-42", EstimatedCost: 850000, TransactionId: "t1",
+	})
+	assert.Nil(t, err)
+	club, err := s.CreateEntry(ctx, "budi", "trip1", first.ID, EntryRequest{Activity: "Beach club", StartTime: "22:00", EndTime: "01:00", EstimatedCost: 150000})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, club.Position)
+
+	// reordering must list every entry of the day
+	_, err = s.Reorder(ctx, "budi", "trip1", first.ID, ReorderRequest{EntryIds: []string{club.ID}})
+	assert.NotNil(t, err)
+	day, err := s.Reorder(ctx, "budi", "trip1", first.ID, ReorderRequest{EntryIds: []string{club.ID, dinner.ID}})
+	assert.Nil(t, err)
+	if assert.Len(t, day.Entries, 2) {
+		assert.Equal(t, club.ID, day.Entries[0].ID)
+	}
+
+	itinerary, err := s.Get(ctx, "budi", "trip1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000000), itinerary.EstimatedCost)
+	if assert.Len(t, itinerary.Days, 2) {
+		assert.Equal(t, first.ID, itinerary.Days[0].ID)
+		assert.Equal(t, second.ID, itinerary.Days[1].ID)
+	}
+
+	// moving an entry appends it to the other day
+	moved, err := s.UpdateEntry(ctx, "budi", "trip1", club.ID, UpdateEntryRequest{EntryRequest: EntryRequest{Activity: "Snorkeling"}, DayId: second.ID})
+	assert.Nil(t, err)
+	assert.Equal(t, second.ID, moved.DayId)
+	assert.Equal(t, 0, moved.Position)
+
+	calendar, err := s.Export(ctx, "budi", "trip1")
+	assert.Nil(t, err)
+	data := string(calendar.Marshal())
+	assert.Contains(t, data, "X-WR-CALNAME:Bali\r\n")
+	assert.Contains(t, data, "SUMMARY:Dinner\r\nLOCATION:Jimbaran\r\n")
+	assert.Contains(t, data, "DTSTART:20260714T110000Z\r\nDTEND:20260714T133000Z\r\n")
+	assert.Contains(t, data, "DESCRIPTION:Booking reference: JMB-42\\nEstimated cost: Rp 850.000\r\n")
+	assert.Contains(t, data, "DTSTART;VALUE=DATE:20260715\r\nDTEND;VALUE=DATE:20260716\r\nSUMMARY:Nusa Penida\r\n")
+	assert.Equal(t, 3, strings.Count(data, "BEGIN:VEVENT"))
+
+	_, err = s.DeleteDay(ctx, "budi", "trip1", second.ID)
+	assert.Nil(t, err)
+	assert.Len(t, repo.entries, 1)
+}
+
+func TestService_Export_overnight(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		trips:   map[string]entity.Trip{"trip1": {ID: "trip1", Title: "Bali"}},
+		members: map[string]bool{"budi": true},
+		days:    map[string]entity.ItineraryDay{"d1": {ID: "d1", TripId: "trip1", Date: "2026-07-14"}},
+		entries: map[string]entity.ItineraryEntry{"e1": {ID: "e1", TripId: "trip1", DayId: "d1", Activity: "Night market", StartTime: "22:00", EndTime: "01:00"}},
+	}
+	calendar, err := NewService(repo, mockPublisher{}, logger).Export(context.Background(), "budi", "trip1")
+	assert.Nil(t, err)
+	assert.Contains(t, string(calendar.Marshal()), "DTSTART:20260714T220000Z\r\nDTEND:20260715T010000Z\r\n")
+}
+
+type mockPublisher struct{}
+
+func (mockPublisher) Publish(ctx context.Context, event realtime.Event) {}
+
+type mockRepository struct {
+	trips        map[string]entity.Trip
+	members      map[string]bool
+	transactions map[string]entity.Transaction
+	days         map[string]entity.ItineraryDay
+	entries      map[string]entity.ItineraryEntry
+}
+
+func (m *mockRepository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	if trip, ok := m.trips[id]; ok {
+		return trip, nil
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	return m.members[userId], nil
+}
+
+func (m *mockRepository) GetTransaction(ctx context.Context, id string) (entity.Transaction, error) {
+	if transaction, ok := m.transactions[id]; ok {
+		return transaction, nil
+	}
+	return entity.Transaction{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryDays(ctx context.Context, tripId string) ([]entity.ItineraryDay, error) {
+	var days []entity.ItineraryDay
+	for _, day := range m.days {
+		if day.TripId == tripId {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days, nil
+}
+
+func (m *mockRepository) GetDay(ctx context.Context, id string) (entity.ItineraryDay, error) {
+	if day, ok := m.days[id]; ok {
+		return day, nil
+	}
+	return entity.ItineraryDay{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateDay(ctx context.Context, day entity.ItineraryDay) error {
+	m.days[day.ID] = day
+	return nil
+}
+
+func (m *mockRepository) UpdateDay(ctx context.Context, day entity.ItineraryDay) error {
+	m.days[day.ID] = day
+	return nil
+}
+
+func (m *mockRepository) DeleteDay(ctx context.Context, id string) error {
+	for _, entry := range m.entries {
+		if entry.DayId == id {
+			delete(m.entries, entry.ID)
+		}
+	}
+	delete(m.days, id)
+	return nil
+}
+
+func (m *mockRepository) QueryEntries(ctx context.Context, tripId string) ([]entity.ItineraryEntry, error) {
+	var entries []entity.ItineraryEntry
+	for _, entry := range m.entries {
+		if entry.TripId == tripId {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Position < entries[j].Position })
+	return entries, nil
+}
+
+func (m *mockRepository) GetEntry(ctx context.Context, id string) (entity.ItineraryEntry, error) {
+	if entry, ok := m.entries[id]; ok {
+		return entry, nil
+	}
+	return entity.ItineraryEntry{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) NextPosition(ctx context.Context, dayId string) (int, error) {
+	position := 0
+	for _, entry := range m.entries {
+		if entry.DayId == dayId && entry.Position >= position {
+			position = entry.Position + 1
+		}
+	}
+	return position, nil
+}
+
+func (m *mockRepository) CreateEntry(ctx context.Context, entry entity.ItineraryEntry) error {
+	m.entries[entry.ID] = entry
+	return nil
+}
+
+func (m *mockRepository) UpdateEntry(ctx context.Context, entry entity.ItineraryEntry) error {
+	m.entries[entry.ID] = entry
+	return nil
+}
+
+func (m *mockRepository) DeleteEntry(ctx context.Context, id string) error {
+	delete(m.entries, id)
+	return nil
+}
+
+func (m *mockRepository) Reorder(ctx context.Context, dayId string, entryIds []string) error {
+	for position, id := range entryIds {
+		entry := m.entries[id]
+		entry.Position = position
+		m.entries[id] = entry
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Package ledger computes who owes whom within a trip from its transactions, expenses and payments.
+package ledger
+
+import (
+	"sort"
+	"tribbie/internal/entity"
+)
+
+// Trip holds the records of a trip the ledger is computed from.
+type Trip struct {
+	Members      []entity.TripMember
+	Transactions []entity.Transaction
+	Items        []entity.TransactionItem
+	Expenses     []entity.TransactionExpenses
+	Payments     []entity.TransactionPayment
+}
+
+// Ledger records how much each person owes every other person.
+// People are identified by their user ID, or by their trip member ID if the member has no account.
+type Ledger struct {
+	debts map[string]map[string]int64
+	names map[string]string
+}
+
+// New creates an empty ledger.
+func New() *Ledger {
+	return &Ledger{map[string]map[string]int64{}, map[string]string{}}
+}
+
+// Build computes the ledger of a trip.
+//
+// Every expense makes the member who consumed the item owe its price times the quantity to the user who paid the
+// transaction. When the grand total of a transaction differs from its subtotal, e.g. because of a service charge,
+// the shares are scaled proportionally. Confirmed payments reduce the debt of the payer towards the recipient.
+func Build(trip Trip) *Ledger {
+	l := New()
+	members := map[string]entity.TripMember{}
+	for _, member := range trip.Members {
+		members[member.ID] = member
+		l.names[Person(member)] = member.Name
+	}
+	items := map[string]entity.TransactionItem{}
+	for _, item := range trip.Items {
+		items[item.ID] = item
+	}
+	transactions := map[string]entity.Transaction{}
+	for _, transaction := range trip.Transactions {
+		transactions[transaction.ID] = transaction
+	}
+
+	for _, expense := range trip.Expenses {
+		transaction, ok := transactions[expense.TransactionId]
+		if !ok || transaction.UserPaidId == "" {
+			continue
+		}
+		item, ok := items[expense.ItemId]
+		if !ok {
+			continue
+		}
+		member, ok := members[expense.TripMemberId]
+		if !ok {
+			continue
+		}
+		share := item.Price * expense.Quantity
+		if transaction.SubTotal > 0 && transaction.GrandTotal != transaction.SubTotal {
+			share = share * int64(transaction.GrandTotal) / int64(transaction.SubTotal)
+		}
+		l.Add(Person(member), transaction.UserPaidId, share)
+	}
+	for _, payment := range trip.Payments {
+		if payment.IsConfirmed() && payment.UserFromId != "" && payment.UserToId != "" {
+			l.Add(payment.UserFromId, payment.UserToId, -payment.Nominal)
+		}
+	}
+	return l
+}
+
+// Person returns the key identifying a trip member in a ledger.
+func Person(member entity.TripMember) string {
+	if member.UserId != "" {
+		return member.UserId
+	}
+	return "member:" + member.ID
+}
+
+// Add records that from owes to the given amount. A negative amount reduces the debt.
+func (l *Ledger) Add(from, to string, amount int64) {
+	if from == to || amount == 0 {
+		return
+	}
+	if l.debts[from] == nil {
+		l.debts[from] = map[string]int64{}
+	}
+	l.debts[from][to] += amount
+}
+
+// Net returns how much the counterpart owes the person. A negative amount means the person owes the counterpart.
+func (l *Ledger) Net(person, counterpart string) int64 {
+	return l.debts[counterpart][person] - l.debts[person][counterpart]
+}
+
+// Counterparts returns, in a stable order, the people the person has a non-zero balance with.
+func (l *Ledger) Counterparts(person string) []string {
+	seen := map[string]bool{}
+	for to := range l.debts[person] {
+		seen[to] = true
+	}
+	for from, debts := range l.debts {
+		if _, ok := debts[person]; ok {
+			seen[from] = true
+		}
+	}
+	var result []string
+	for counterpart := range seen {
+		if l.Net(person, counterpart) != 0 {
+			result = append(result, counterpart)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Name returns the trip member name of the person, if known.
+func (l *Ledger) Name(person string) string {
+	return l.names[person]
+}
@@ -0,0 +1,51 @@
+package ledger
+
+import (
+	"testing"
+	"tribbie/internal/entity"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	trip := Trip{
+		Members: []entity.TripMember{
+			{ID: "m1", UserId: "alice", Name: "Alice"},
+			{ID: "m2", UserId: "bob", Name: "Bob"},
+			{ID: "m3", Name: "Guest"},
+		},
+		Transactions: []entity.Transaction{
+			// a 10% service charge on top of the items
+			{ID: "t1", UserPaidId: "alice", SubTotal: 100000, GrandTotal: 110000},
+			{ID: "t2", UserPaidId: "bob", SubTotal: 20000, GrandTotal: 20000},
+		},
+		Items: []entity.TransactionItem{
+			{ID: "i1", TransactionId: "t1", Price: 50000},
+			{ID: "i2", TransactionId: "t1", Price: 25000},
+			{ID: "i3", TransactionId: "t2", Price: 10000},
+		},
+		Expenses: []entity.TransactionExpenses{
+			{TripMemberId: "m1", TransactionId: "t1", ItemId: "i1", Quantity: 1},
+			{TripMemberId: "m2", TransactionId: "t1", ItemId: "i2", Quantity: 1},
+			{TripMemberId: "m3", TransactionId: "t1", ItemId: "i2", Quantity: 1},
+			{TripMemberId: "m1", TransactionId: "t2", ItemId: "i3", Quantity: 2},
+		},
+		Payments: []entity.TransactionPayment{
+			{UserFromId: "bob", UserToId: "alice", Nominal: 10000, Status: entity.PaymentStatusConfirmed},
+			{UserFromId: "bob", UserToId: "alice", Nominal: 5000, Status: entity.PaymentStatusPending},
+		},
+	}
+	l := Build(trip)
+
+	// bob owes alice 27500 for i2, alice owes bob 20000 for i3, and bob paid 10000
+	assert.Equal(t, int64(-2500), l.Net("alice", "bob"))
+	assert.Equal(t, int64(2500), l.Net("bob", "alice"))
+	assert.Equal(t, int64(27500), l.Net("alice", "member:m3"))
+	assert.Equal(t, []string{"bob", "member:m3"}, l.Counterparts("alice"))
+	assert.Equal(t, "Guest", l.Name("member:m3"))
+
+	// settled balances disappear from the counterparts
+	l.Add("alice", "bob", -2500)
+	assert.Equal(t, []string{"member:m3"}, l.Counterparts("alice"))
+	assert.Empty(t, l.Counterparts("bob"))
+}
@@ -0,0 +1,71 @@
+package ledger
+
+import (
+	"context"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
+)
+
+// Loader loads the records of a trip needed to build its ledger.
+type Loader struct {
+	tripMemberService          TripMember.Service
+	transactionService         Transaction.Service
+	transactionItemService     TransactionItem.Service
+	transactionExpensesService TransactionExpenses.Service
+	transactionPaymentService  TransactionPayment.Service
+}
+
+// NewLoader creates a new Loader.
+func NewLoader(
+	tripMemberService TripMember.Service,
+	transactionService Transaction.Service,
+	transactionItemService TransactionItem.Service,
+	transactionExpensesService TransactionExpenses.Service,
+	transactionPaymentService TransactionPayment.Service) Loader {
+	return Loader{tripMemberService, transactionService, transactionItemService, transactionExpensesService, transactionPaymentService}
+}
+
+// Load returns the members, transactions, items, expenses and payments of the trip.
+func (l Loader) Load(ctx context.Context, tripId string) (Trip, error) {
+	var trip Trip
+	members, err := l.tripMemberService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return Trip{}, err
+	}
+	for _, member := range members {
+		trip.Members = append(trip.Members, member.TripMember)
+	}
+	transactions, err := l.transactionService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return Trip{}, err
+	}
+	for _, transaction := range transactions {
+		trip.Transactions = append(trip.Transactions, transaction.Transaction)
+	}
+	items, err := l.transactionItemService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return Trip{}, err
+	}
+	for _, item := range items {
+		trip.Items = append(trip.Items, item.TransactionItem)
+	}
+	expenses, err := l.transactionExpensesService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return Trip{}, err
+	}
+	for _, expense := range expenses {
+		trip.Expenses = append(trip.Expenses, expense.TransactionExpenses)
+	}
+	payments, err := l.transactionPaymentService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return Trip{}, err
+	}
+	for _, payment := range payments {
+		trip.Payments = append(trip.Payments, payment.TransactionPayment)
+	}
+	return trip, nil
+}
@@ -0,0 +1,144 @@
+package me
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+
+	User "tribbie/internal/user"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, profileService User.ProfileService, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, profileService, logger}
+
+	r.Use(authHandler)
+
+	r.Get("/me", res.get)
+	r.Patch("/me", res.update)
+	r.Put("/me/account", res.updateAccount)
+	r.Get("/me/summary", res.summary)
+	r.Get("/me/export", res.export)
+	r.Delete("/me", res.delete)
+}
+
+type resource struct {
+	service        Service
+	profileService User.ProfileService
+	logger         log.Logger
+}
+
+// get returns the profile of the current user.
+func (r resource) get(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	profile, err := r.profileService.Get(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+	return c.Write(profile)
+}
+
+// update applies a partial update to the profile of the current user.
+func (r resource) update(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input User.UpdateProfileRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	if input.Payout != nil && auth.CurrentAccessToken(c.Request.Context()) != nil {
+		return errors.Forbidden("Personal access tokens cannot change the payout details.")
+	}
+	profile, err := r.profileService.Update(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(profile)
+}
+
+// updateAccount changes the login details of the current user. Personal access tokens cannot change them.
+func (r resource) updateAccount(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if auth.CurrentAccessToken(c.Request.Context()) != nil {
+		return errors.Forbidden("Personal access tokens cannot be used for this request.")
+	}
+	var input User.UpdateUserRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	user, err := r.service.UpdateAccount(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.Write(user)
+}
+
+// summary returns the balances of the current user across all of their trips.
+func (r resource) summary(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	summary, err := r.service.Summary(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+	return c.Write(summary)
+}
+
+// export sends the data tied to the current user as a zip archive, or as a single JSON document with ?format=json.
+func (r resource) export(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	export, err := r.service.Export(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("tribbie-export-%v", export.ExportedAt.Format("20060102"))
+	header := c.Response.Header()
+	switch c.Query("format", "zip") {
+	case "json":
+		header.Set("Content-Type", "application/json")
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%v.json"`, name))
+		return json.NewEncoder(c.Response).Encode(export)
+	case "zip":
+		header.Set("Content-Type", "application/zip")
+		header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%v.zip"`, name))
+		return export.WriteZip(c.Response)
+	}
+	return errors.BadRequest("format must be either zip or json")
+}
+
+// delete anonymizes the current user. Personal access tokens cannot delete an account.
+func (r resource) delete(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if auth.CurrentAccessToken(c.Request.Context()) != nil {
+		return errors.Forbidden("Personal access tokens cannot be used for this request.")
+	}
+	if _, err := r.service.Delete(c.Request.Context(), identity.GetID()); err != nil {
+		return err
+	}
+	c.Response.WriteHeader(http.StatusNoContent)
+	return nil
+}
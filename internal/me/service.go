@@ -0,0 +1,181 @@
+package me
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"time"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+
+	Transaction "tribbie/internal/transaction"
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	Trip "tribbie/internal/trip"
+	TripMember "tribbie/internal/trip-member"
+	User "tribbie/internal/user"
+)
+
+// Service encapsulates usecase logic for the account of the current user.
+type Service interface {
+	// Export collects everything tied to the given user.
+	Export(ctx context.Context, userId string) (Export, error)
+	// Summary aggregates the balances of the given user across all of their trips.
+	Summary(ctx context.Context, userId string) (Summary, error)
+	// UpdateAccount changes the email address, username, password or device of the given user.
+	UpdateAccount(ctx context.Context, userId string, input User.UpdateUserRequest) (User.UserDefault, error)
+	// Delete anonymizes the given user while keeping the trip ledgers of the other members intact.
+	Delete(ctx context.Context, userId string) (User.UserDefault, error)
+}
+
+// Export represents the data tied to a user.
+type Export struct {
+	ExportedAt   time.Time                                 `json:"exported_at"`
+	User         User.Profile                              `json:"user"`
+	TripMembers  []TripMember.TripMember                   `json:"trip_members"`
+	Trips        []Trip.Trip                               `json:"trips"`
+	Transactions []Transaction.Transaction                 `json:"transactions"`
+	Expenses     []TransactionExpenses.TransactionExpenses `json:"expenses"`
+	Payments     []TransactionPayment.TransactionPayment   `json:"payments"`
+	AccessTokens []entity.AccessToken                      `json:"access_tokens"`
+}
+
+// WriteZip writes the export as a zip archive holding one JSON file per kind of data.
+func (e Export) WriteZip(w io.Writer) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", e.User},
+		{"trip_members.json", e.TripMembers},
+		{"trips.json", e.Trips},
+		{"transactions.json", e.Transactions},
+		{"expenses.json", e.Expenses},
+		{"payments.json", e.Payments},
+		{"access_tokens.json", e.AccessTokens},
+	}
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: e.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+type service struct {
+	userService                User.Service
+	profileService             User.ProfileService
+	tripService                Trip.Service
+	tripMemberService          TripMember.Service
+	transactionService         Transaction.Service
+	transactionItemService     TransactionItem.Service
+	transactionExpensesService TransactionExpenses.Service
+	transactionPaymentService  TransactionPayment.Service
+	authService                auth.Service
+	tokenService               auth.TokenService
+	logger                     log.Logger
+}
+
+// NewService creates a new service for the account of the current user.
+func NewService(
+	userService User.Service,
+	profileService User.ProfileService,
+	tripService Trip.Service,
+	tripMemberService TripMember.Service,
+	transactionService Transaction.Service,
+	transactionItemService TransactionItem.Service,
+	transactionExpensesService TransactionExpenses.Service,
+	transactionPaymentService TransactionPayment.Service,
+	authService auth.Service,
+	tokenService auth.TokenService,
+	logger log.Logger) Service {
+	return service{userService, profileService, tripService, tripMemberService, transactionService, transactionItemService, transactionExpensesService, transactionPaymentService, authService, tokenService, logger}
+}
+
+// Export collects the profile with the payout details, trip memberships, trips, paid transactions, expenses, payments and access tokens of the user.
+func (s service) Export(ctx context.Context, userId string) (Export, error) {
+	export := Export{ExportedAt: time.Now()}
+	var err error
+	if export.User, err = s.profileService.Get(ctx, userId); err != nil {
+		return Export{}, err
+	}
+	if export.TripMembers, err = s.tripMemberService.QueryByUser(ctx, userId); err != nil {
+		return Export{}, err
+	}
+	export.Trips = []Trip.Trip{}
+	var memberIds []string
+	for _, member := range export.TripMembers {
+		memberIds = append(memberIds, member.ID)
+		trip, err := s.tripService.Get(ctx, member.TripId)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return Export{}, err
+		}
+		export.Trips = append(export.Trips, trip)
+	}
+	if export.Transactions, err = s.transactionService.QueryByUserPaid(ctx, userId); err != nil {
+		return Export{}, err
+	}
+	if export.Expenses, err = s.transactionExpensesService.QueryByTripMembers(ctx, memberIds); err != nil {
+		return Export{}, err
+	}
+	if export.Payments, err = s.transactionPaymentService.QueryByUser(ctx, userId); err != nil {
+		return Export{}, err
+	}
+	if export.AccessTokens, err = s.tokenService.Query(ctx, userId); err != nil {
+		return Export{}, err
+	}
+	return export, nil
+}
+
+// UpdateAccount updates the login details of the user.
+func (s service) UpdateAccount(ctx context.Context, userId string, input User.UpdateUserRequest) (User.UserDefault, error) {
+	return s.userService.Update(ctx, userId, input)
+}
+
+// Delete anonymizes the user and renames their trip memberships to "Deleted user".
+// Transactions, expenses and payments keep referring to the user so that the balances of the other members do not change.
+// Every session and access token of the user is revoked.
+func (s service) Delete(ctx context.Context, userId string) (User.UserDefault, error) {
+	members, err := s.tripMemberService.QueryByUser(ctx, userId)
+	if err != nil {
+		return User.UserDefault{}, err
+	}
+	for _, member := range members {
+		if member.Name == entity.DeletedUserName {
+			continue
+		}
+		_, err := s.tripMemberService.Update(ctx, member.ID, TripMember.UpdateTripMemberRequest{
+			TripId: member.TripId,
+			UserId: member.UserId,
+			Name:   entity.DeletedUserName,
+			Status: member.Status,
+		})
+		if err != nil {
+			return User.UserDefault{}, err
+		}
+	}
+	user, err := s.userService.Delete(ctx, userId)
+	if err != nil {
+		return User.UserDefault{}, err
+	}
+	if err := s.authService.LogoutAll(ctx, userId); err != nil {
+		return User.UserDefault{}, err
+	}
+	if err := s.tokenService.RevokeAll(ctx, userId); err != nil {
+		return User.UserDefault{}, err
+	}
+	return user, nil
+}
@@ -0,0 +1,43 @@
+package me
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+
+	"github.com/stretchr/testify/assert"
+
+	User "tribbie/internal/user"
+)
+
+func TestExport_WriteZip(t *testing.T) {
+	export := Export{
+		ExportedAt: time.Now(),
+		User:       User.Profile{UserDefault: User.UserDefault{UserDefault: entity.UserDefault{ID: "100", Username: "test"}}},
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, export.WriteZip(&buf))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.Nil(t, err) {
+		return
+	}
+	names := map[string]*zip.File{}
+	for _, f := range archive.File {
+		names[f.Name] = f
+	}
+	for _, name := range []string{"user.json", "trip_members.json", "trips.json", "transactions.json", "expenses.json", "payments.json", "access_tokens.json"} {
+		assert.Contains(t, names, name)
+	}
+	f, err := names["user.json"].Open()
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer f.Close()
+	var user entity.UserDefault
+	assert.Nil(t, json.NewDecoder(f).Decode(&user))
+	assert.Equal(t, "100", user.ID)
+}
@@ -0,0 +1,140 @@
+package me
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"tribbie/internal/ledger"
+
+	TransactionPayment "tribbie/internal/transaction-payment"
+)
+
+// Summary represents the balances of a user across all of their trips.
+// Positive amounts are owed to the user, negative amounts are owed by the user.
+type Summary struct {
+	Totals          []Total                                 `json:"totals"`
+	Trips           []TripBalance                           `json:"trips"`
+	Counterparts    []CounterpartBalance                    `json:"counterparts"`
+	PendingPayments []TransactionPayment.TransactionPayment `json:"pending_payments"`
+}
+
+// Total represents the amounts owed to and by a user in one currency.
+type Total struct {
+	Currency string `json:"currency"`
+	Owed     int64  `json:"owed"`
+	Owing    int64  `json:"owing"`
+	Net      int64  `json:"net"`
+}
+
+// TripBalance represents the balance of a user within a trip.
+type TripBalance struct {
+	TripId       string               `json:"trip_id"`
+	Title        string               `json:"title"`
+	Currency     string               `json:"currency"`
+	Net          int64                `json:"net"`
+	Counterparts []CounterpartBalance `json:"counterparts"`
+}
+
+// CounterpartBalance represents the balance between a user and another person.
+// The ID is a user ID, or "member:<trip member ID>" for trip members without an account.
+type CounterpartBalance struct {
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Currency string `json:"currency"`
+	Net      int64  `json:"net"`
+}
+
+// Summary aggregates the balances of the user per trip and per counterpart, together with the payments
+// from or to the user that are not confirmed yet.
+func (s service) Summary(ctx context.Context, userId string) (Summary, error) {
+	summary := Summary{
+		Totals:          []Total{},
+		Trips:           []TripBalance{},
+		Counterparts:    []CounterpartBalance{},
+		PendingPayments: []TransactionPayment.TransactionPayment{},
+	}
+	memberships, err := s.tripMemberService.QueryByUser(ctx, userId)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	type counterpartKey struct{ id, currency string }
+	counterparts := map[counterpartKey]*CounterpartBalance{}
+	totals := map[string]*Total{}
+	seen := map[string]bool{}
+	for _, membership := range memberships {
+		if seen[membership.TripId] {
+			continue
+		}
+		seen[membership.TripId] = true
+		trip, err := s.tripService.Get(ctx, membership.TripId)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return Summary{}, err
+		}
+		l, err := s.buildLedger(ctx, trip.ID)
+		if err != nil {
+			return Summary{}, err
+		}
+
+		balance := TripBalance{TripId: trip.ID, Title: trip.Title, Currency: trip.Currency, Counterparts: []CounterpartBalance{}}
+		for _, counterpart := range l.Counterparts(userId) {
+			net := l.Net(userId, counterpart)
+			balance.Net += net
+			balance.Counterparts = append(balance.Counterparts, CounterpartBalance{counterpart, l.Name(counterpart), trip.Currency, net})
+
+			key := counterpartKey{counterpart, trip.Currency}
+			if counterparts[key] == nil {
+				counterparts[key] = &CounterpartBalance{Id: counterpart, Name: l.Name(counterpart), Currency: trip.Currency}
+			}
+			counterparts[key].Net += net
+
+			if totals[trip.Currency] == nil {
+				totals[trip.Currency] = &Total{Currency: trip.Currency}
+			}
+			if net > 0 {
+				totals[trip.Currency].Owed += net
+			} else {
+				totals[trip.Currency].Owing -= net
+			}
+			totals[trip.Currency].Net += net
+		}
+		summary.Trips = append(summary.Trips, balance)
+	}
+
+	for _, counterpart := range counterparts {
+		if counterpart.Net != 0 {
+			summary.Counterparts = append(summary.Counterparts, *counterpart)
+		}
+	}
+	sort.Slice(summary.Counterparts, func(i, j int) bool {
+		a, b := summary.Counterparts[i], summary.Counterparts[j]
+		return a.Currency < b.Currency || a.Currency == b.Currency && a.Id < b.Id
+	})
+	for _, total := range totals {
+		summary.Totals = append(summary.Totals, *total)
+	}
+	sort.Slice(summary.Totals, func(i, j int) bool { return summary.Totals[i].Currency < summary.Totals[j].Currency })
+
+	payments, err := s.transactionPaymentService.QueryByUser(ctx, userId)
+	if err != nil {
+		return Summary{}, err
+	}
+	for _, payment := range payments {
+		if !payment.IsConfirmed() {
+			summary.PendingPayments = append(summary.PendingPayments, payment)
+		}
+	}
+	return summary, nil
+}
+
+// buildLedger loads the records of a trip and computes its ledger.
+func (s service) buildLedger(ctx context.Context, tripId string) (*ledger.Ledger, error) {
+	loader := ledger.NewLoader(s.tripMemberService, s.transactionService, s.transactionItemService, s.transactionExpensesService, s.transactionPaymentService)
+	trip, err := loader.Load(ctx, tripId)
+	if err != nil {
+		return nil, err
+	}
+	return ledger.Build(trip), nil
+}
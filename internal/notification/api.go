@@ -0,0 +1,73 @@
+package notification
+
+import (
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/notifications", authHandler, res.query)
+	r.Post("/notifications/read", authHandler, res.markAllRead)
+	r.Post("/notifications/<id>/read", authHandler, res.markRead)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the notifications of the current user. ?unread=true lists only the unread ones.
+func (r resource) query(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	unreadOnly := c.Query("unread") == "true"
+	count, err := r.service.Count(ctx, identity.GetID(), unreadOnly)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	notifications, err := r.service.Query(ctx, identity.GetID(), unreadOnly, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = notifications
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// markRead marks a notification of the current user as read.
+func (r resource) markRead(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	notification, err := r.service.MarkRead(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(notification)
+}
+
+// markAllRead marks all notifications of the current user as read.
+func (r resource) markAllRead(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	if err := r.service.MarkAllRead(c.Request.Context(), identity.GetID()); err != nil {
+		return err
+	}
+	c.Response.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,96 @@
+package notification
+
+import (
+	"context"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access notifications from the data source.
+type Repository interface {
+	// Get returns the notification with the specified ID.
+	Get(ctx context.Context, id string) (entity.Notification, error)
+	// Query returns the notifications of the user, newest first.
+	Query(ctx context.Context, userId string, unreadOnly bool, offset, limit int) ([]entity.Notification, error)
+	// Count returns the number of notifications of the user.
+	Count(ctx context.Context, userId string, unreadOnly bool) (int, error)
+	// Create saves a new notification in the storage.
+	Create(ctx context.Context, notification entity.Notification) error
+	// MarkRead marks the notification of the user as read.
+	MarkRead(ctx context.Context, userId, id string, at time.Time) error
+	// MarkAllRead marks all unread notifications of the user as read.
+	MarkAllRead(ctx context.Context, userId string, at time.Time) error
+}
+
+// repository persists notifications in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new notification repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Get reads the notification with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Notification, error) {
+	var notification entity.Notification
+	err := r.db.With(ctx).Select().Model(id, &notification)
+	return notification, err
+}
+
+// Query retrieves the notifications of the user from the database.
+func (r repository) Query(ctx context.Context, userId string, unreadOnly bool, offset, limit int) ([]entity.Notification, error) {
+	var notifications []entity.Notification
+	err := r.db.With(ctx).
+		Select().
+		Where(condition(userId, unreadOnly)).
+		OrderBy("created_at DESC", "id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&notifications)
+	return notifications, err
+}
+
+// Count returns the number of notifications of the user in the database.
+func (r repository) Count(ctx context.Context, userId string, unreadOnly bool) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("notification").Where(condition(userId, unreadOnly)).Row(&count)
+	return count, err
+}
+
+// Create saves a new notification record in the database.
+func (r repository) Create(ctx context.Context, notification entity.Notification) error {
+	return r.db.With(ctx).Model(&notification).Insert()
+}
+
+// MarkRead sets the read time of the notification unless it was read before.
+func (r repository) MarkRead(ctx context.Context, userId, id string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("notification",
+		dbx.Params{"read_at": at, "updated_at": at},
+		dbx.And(dbx.HashExp{"id": id, "user_id": userId}, dbx.NewExp("read_at IS NULL")),
+	).Execute()
+	return err
+}
+
+// MarkAllRead sets the read time of all unread notifications of the user.
+func (r repository) MarkAllRead(ctx context.Context, userId string, at time.Time) error {
+	_, err := r.db.With(ctx).Update("notification",
+		dbx.Params{"read_at": at, "updated_at": at},
+		condition(userId, true),
+	).Execute()
+	return err
+}
+
+// condition selects the notifications of the user, optionally only the unread ones.
+func condition(userId string, unreadOnly bool) dbx.Expression {
+	if unreadOnly {
+		return dbx.And(dbx.HashExp{"user_id": userId}, dbx.NewExp("read_at IS NULL"))
+	}
+	return dbx.HashExp{"user_id": userId}
+}
@@ -0,0 +1,157 @@
+package notification
+
+import (
+	"context"
+	"time"
+	"tribbie/internal/auth"
+	"tribbie/internal/device"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/push"
+)
+
+// pushedKinds lists the kinds of notifications that are also pushed to the devices of the user.
+var pushedKinds = map[string]bool{
+	entity.NotificationPaymentRequested: true,
+	entity.NotificationPaymentReminder:  true,
+	entity.NotificationExpenseIncluded:  true,
+	entity.NotificationCommentMentioned: true,
+}
+
+// Service encapsulates usecase logic for notifications.
+type Service interface {
+	// Get returns the notification of the user with the specified ID.
+	Get(ctx context.Context, userId, id string) (Notification, error)
+	// Query returns the notifications of the user, newest first.
+	Query(ctx context.Context, userId string, unreadOnly bool, offset, limit int) ([]Notification, error)
+	// Count returns the number of notifications of the user.
+	Count(ctx context.Context, userId string, unreadOnly bool) (int, error)
+	// Notify records an event for a user. Failures are logged rather than returned so that they never fail the
+	// operation producing the event.
+	Notify(ctx context.Context, input NotifyRequest)
+	// MarkRead marks the notification of the user as read.
+	MarkRead(ctx context.Context, userId, id string) (Notification, error)
+	// MarkAllRead marks all notifications of the user as read.
+	MarkAllRead(ctx context.Context, userId string) error
+}
+
+// Notification represents the data about a notification.
+type Notification struct {
+	entity.Notification
+}
+
+// NotifyRequest represents an event to notify a user about.
+type NotifyRequest struct {
+	UserId    string
+	Kind      string
+	TripId    string
+	SubjectId string
+	Title     string
+	Body      string
+}
+
+type service struct {
+	repo          Repository
+	deviceService device.Service
+	logger        log.Logger
+}
+
+// NewService creates a new notification service.
+// The device service pushes payment requests and new expenses to the devices of the user.
+func NewService(repo Repository, deviceService device.Service, logger log.Logger) Service {
+	return service{repo, deviceService, logger}
+}
+
+// Get returns the notification of the user with the specified ID.
+func (s service) Get(ctx context.Context, userId, id string) (Notification, error) {
+	notification, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Notification{}, err
+	}
+	if notification.UserId != userId {
+		return Notification{}, errors.NotFound("")
+	}
+	return Notification{notification}, nil
+}
+
+// Query returns the notifications of the user with the specified offset and limit.
+func (s service) Query(ctx context.Context, userId string, unreadOnly bool, offset, limit int) ([]Notification, error) {
+	items, err := s.repo.Query(ctx, userId, unreadOnly, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := []Notification{}
+	for _, item := range items {
+		result = append(result, Notification{item})
+	}
+	return result, nil
+}
+
+// Count returns the number of notifications of the user.
+func (s service) Count(ctx context.Context, userId string, unreadOnly bool) (int, error) {
+	return s.repo.Count(ctx, userId, unreadOnly)
+}
+
+// Notify records an event for a user. The user performing the request is the actor of the event and is not
+// notified about their own actions.
+func (s service) Notify(ctx context.Context, req NotifyRequest) {
+	if req.UserId == "" {
+		return
+	}
+	actorId := ""
+	if identity := auth.CurrentUserDefault(ctx); identity != nil {
+		actorId = identity.GetID()
+	}
+	if req.UserId == actorId {
+		return
+	}
+	now := time.Now()
+	notification := entity.Notification{
+		ID:        entity.GenerateID(),
+		UserId:    req.UserId,
+		ActorId:   actorId,
+		Kind:      req.Kind,
+		TripId:    req.TripId,
+		SubjectId: req.SubjectId,
+		Title:     req.Title,
+		Body:      req.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.Create(ctx, notification); err != nil {
+		s.logger.With(ctx).Errorf("failed to notify user %v about %v: %v", req.UserId, req.Kind, err)
+		return
+	}
+	if pushedKinds[req.Kind] {
+		err := s.deviceService.Push(ctx, req.UserId, push.Message{
+			Title: req.Title,
+			Body:  req.Body,
+			Data: map[string]string{
+				"notification_id": notification.ID,
+				"kind":            notification.Kind,
+				"trip_id":         notification.TripId,
+				"subject_id":      notification.SubjectId,
+			},
+		})
+		if err != nil {
+			s.logger.With(ctx).Errorf("failed to push notification %v: %v", notification.ID, err)
+		}
+	}
+}
+
+// MarkRead marks the notification of the user as read. Reading a notification twice keeps the first read time.
+func (s service) MarkRead(ctx context.Context, userId, id string) (Notification, error) {
+	if _, err := s.Get(ctx, userId, id); err != nil {
+		return Notification{}, err
+	}
+	if err := s.repo.MarkRead(ctx, userId, id, time.Now()); err != nil {
+		return Notification{}, err
+	}
+	return s.Get(ctx, userId, id)
+}
+
+// MarkAllRead marks all unread notifications of the user as read.
+func (s service) MarkAllRead(ctx context.Context, userId string) error {
+	return s.repo.MarkAllRead(ctx, userId, time.Now())
+}
@@ -0,0 +1,128 @@
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"tribbie/internal/auth"
+	"tribbie/internal/device"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/push"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_Notify(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	devices := &mockDeviceService{}
+	s := NewService(repo, devices, logger)
+	ctx := auth.WithUserDefault(context.Background(), "alice", "alice")
+
+	s.Notify(ctx, NotifyRequest{UserId: "bob", Kind: entity.NotificationPaymentRequested, Title: "Payment requested"})
+	// only some kinds are pushed to the devices
+	s.Notify(ctx, NotifyRequest{UserId: "bob", Kind: entity.NotificationBudgetExceeded, Title: "Budget exceeded"})
+	// the actor is not notified about their own actions
+	s.Notify(ctx, NotifyRequest{UserId: "alice", Kind: entity.NotificationPaymentRequested, Title: "Payment requested"})
+	// trip members without an account cannot be notified
+	s.Notify(ctx, NotifyRequest{Kind: entity.NotificationPaymentRequested, Title: "Payment requested"})
+
+	if assert.Len(t, repo.items, 2) {
+		assert.Equal(t, "bob", repo.items[0].UserId)
+		assert.Equal(t, "alice", repo.items[0].ActorId)
+	}
+	if assert.Len(t, devices.pushed, 1) {
+		assert.Equal(t, "Payment requested", devices.pushed[0].Title)
+		assert.Equal(t, repo.items[0].ID, devices.pushed[0].Data["notification_id"])
+	}
+}
+
+func Test_service_MarkRead(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.Notification{
+		{ID: "1", UserId: "bob"},
+		{ID: "2", UserId: "bob"},
+		{ID: "3", UserId: "carol"},
+	}}
+	s := NewService(repo, &mockDeviceService{}, logger)
+	ctx := context.Background()
+
+	notification, err := s.MarkRead(ctx, "bob", "1")
+	assert.Nil(t, err)
+	assert.True(t, notification.IsRead())
+	count, _ := s.Count(ctx, "bob", true)
+	assert.Equal(t, 1, count)
+
+	// notifications of other users are not found
+	_, err = s.MarkRead(ctx, "bob", "3")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, s.MarkAllRead(ctx, "bob"))
+	count, _ = s.Count(ctx, "bob", true)
+	assert.Equal(t, 0, count)
+	count, _ = s.Count(ctx, "carol", true)
+	assert.Equal(t, 1, count)
+}
+
+type mockRepository struct {
+	items []entity.Notification
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Notification, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.Notification{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Query(ctx context.Context, userId string, unreadOnly bool, offset, limit int) ([]entity.Notification, error) {
+	var items []entity.Notification
+	for _, item := range m.items {
+		if item.UserId == userId && (!unreadOnly || !item.IsRead()) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Count(ctx context.Context, userId string, unreadOnly bool) (int, error) {
+	items, _ := m.Query(ctx, userId, unreadOnly, 0, 0)
+	return len(items), nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, notification entity.Notification) error {
+	m.items = append(m.items, notification)
+	return nil
+}
+
+func (m *mockRepository) MarkRead(ctx context.Context, userId, id string, at time.Time) error {
+	for i, item := range m.items {
+		if item.ID == id && item.UserId == userId && !item.IsRead() {
+			m.items[i].ReadAt = &at
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) MarkAllRead(ctx context.Context, userId string, at time.Time) error {
+	for i, item := range m.items {
+		if item.UserId == userId && !item.IsRead() {
+			m.items[i].ReadAt = &at
+		}
+	}
+	return nil
+}
+
+type mockDeviceService struct {
+	device.Service
+	pushed []push.Message
+}
+
+func (m *mockDeviceService) Push(ctx context.Context, userId string, msg push.Message) error {
+	m.pushed = append(m.pushed, msg)
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package realtime streams the changes of a trip to its members, fanned out across server instances
+// through Postgres LISTEN/NOTIFY.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	"github.com/lib/pq"
+)
+
+// Channel is the Postgres notification channel carrying the trip events.
+const Channel = "trip_events"
+
+// maxDataSize is the largest record embedded in an event. Postgres limits notification payloads to 8000 bytes,
+// so larger records are left out and clients refetch them instead.
+const maxDataSize = 6000
+
+const (
+	// Created is the action of an event about a new record.
+	Created = "created"
+	// Updated is the action of an event about a changed record.
+	Updated = "updated"
+	// Deleted is the action of an event about a removed record.
+	Deleted = "deleted"
+)
+
+// Event represents a change of a record of a trip, e.g. "transaction.created".
+type Event struct {
+	ID     string          `json:"id"`
+	TripId string          `json:"trip_id"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// NewEvent creates the event about the action on a record of the given resource, e.g. "transaction".
+func NewEvent(tripId, resource, action string, record interface{}) Event {
+	event := Event{ID: entity.GenerateID(), TripId: tripId, Type: resource + "." + action}
+	if data, err := json.Marshal(record); err == nil && len(data) <= maxDataSize {
+		event.Data = data
+	}
+	return event
+}
+
+// Publisher publishes trip events.
+type Publisher interface {
+	// Publish sends the event to the subscribers of its trip on all server instances. Failures are logged rather
+	// than returned so that they never fail the operation producing the event.
+	Publish(ctx context.Context, event Event)
+}
+
+type publisher struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewPublisher creates a Publisher sending the events as Postgres notifications. Events published within a
+// transaction are delivered when it commits.
+func NewPublisher(db *dbcontext.DB, logger log.Logger) Publisher {
+	return publisher{db, logger}
+}
+
+// Publish sends the event on the notification channel.
+func (p publisher) Publish(ctx context.Context, event Event) {
+	if event.TripId == "" {
+		return
+	}
+	payload, err := json.Marshal(event)
+	if err == nil {
+		_, err = p.db.With(ctx).NewQuery("SELECT pg_notify({:channel}, {:payload})").
+			Bind(dbx.Params{"channel": Channel, "payload": string(payload)}).
+			Execute()
+	}
+	if err != nil {
+		p.logger.With(ctx).Errorf("failed to publish %v of trip %v: %v", event.Type, event.TripId, err)
+	}
+}
+
+// Hub dispatches the events received by this server instance to the subscribers of their trip.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]bool
+}
+
+// NewHub creates a new Hub.
+func NewHub() *Hub {
+	return &Hub{subscribers: map[string]map[chan Event]bool{}}
+}
+
+// Subscribe returns a channel receiving the events of the trip, and a function ending the subscription.
+func (h *Hub) Subscribe(tripId string) (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+	h.mu.Lock()
+	if h.subscribers[tripId] == nil {
+		h.subscribers[tripId] = map[chan Event]bool{}
+	}
+	h.subscribers[tripId][ch] = true
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.subscribers[tripId], ch)
+			if len(h.subscribers[tripId]) == 0 {
+				delete(h.subscribers, tripId)
+			}
+			close(ch)
+		})
+	}
+}
+
+// Broadcast sends the event to the subscribers of its trip. Subscribers too slow to keep up miss the event
+// rather than blocking the others.
+func (h *Hub) Broadcast(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers[event.TripId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Listen receives the events published by all server instances and broadcasts them to the hub until the context
+// is cancelled. The connection is re-established automatically if it drops.
+func Listen(ctx context.Context, dsn string, hub *Hub, logger log.Logger) error {
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Errorf("trip events listener: %v", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(Channel); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// a nil notification means the connection was re-established and events may have been missed
+			if n == nil {
+				continue
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				logger.Errorf("invalid trip event: %v", err)
+				continue
+			}
+			hub.Broadcast(event)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
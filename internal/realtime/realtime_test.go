@@ -0,0 +1,61 @@
+package realtime
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent("trip1", "transaction", Created, map[string]string{"id": "t1"})
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "trip1", event.TripId)
+	assert.Equal(t, "transaction.created", event.Type)
+	assert.JSONEq(t, `{"id":"t1"}`, string(event.Data))
+
+	event = NewEvent("trip1", "item", Updated, strings.Repeat("x", maxDataSize))
+	assert.Nil(t, event.Data)
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub()
+	events, unsubscribe := hub.Subscribe("trip1")
+	others, unsubscribeOthers := hub.Subscribe("trip2")
+	defer unsubscribeOthers()
+
+	hub.Broadcast(Event{ID: "e1", TripId: "trip1", Type: "member.created"})
+	assert.Equal(t, "e1", (<-events).ID)
+	assert.Len(t, others, 0)
+
+	// slow subscribers miss events instead of blocking the hub
+	for i := 0; i < 20; i++ {
+		hub.Broadcast(Event{TripId: "trip1"})
+	}
+	assert.Len(t, events, cap(events))
+
+	unsubscribe()
+	unsubscribe()
+	hub.Broadcast(Event{TripId: "trip1"})
+	assert.Len(t, hub.subscribers, 1)
+}
+
+func TestStream(t *testing.T) {
+	events := make(chan Event, 2)
+	events <- Event{ID: "e1", TripId: "trip1", Type: "payment.updated"}
+	close(events)
+
+	w := httptest.NewRecorder()
+	err := Stream(context.Background(), w, events, time.Minute)
+	assert.Nil(t, err)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "id: e1\nevent: payment.updated\ndata: {\"id\":\"e1\",\"trip_id\":\"trip1\",\"type\":\"payment.updated\"}\n\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = httptest.NewRecorder()
+	assert.Nil(t, Stream(ctx, w, make(chan Event), time.Minute))
+}
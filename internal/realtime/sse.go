@@ -0,0 +1,61 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// errStreamingUnsupported is returned when the response writer cannot flush partial responses.
+var errStreamingUnsupported = errors.New("streaming is not supported by the response writer")
+
+// Stream writes the events to the response as server-sent events until the context is done or the events channel
+// is closed. A comment is sent every heartbeat interval to keep idle connections open through proxies.
+func Stream(ctx context.Context, w http.ResponseWriter, events <-chan Event, heartbeat time.Duration) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errStreamingUnsupported
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if _, err := writeEvent(w, event); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeEvent writes a single server-sent event. The data is the JSON encoding of the event, which never contains
+// a line break.
+func writeEvent(w http.ResponseWriter, event Event) (int, error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return 0, err
+	}
+	return fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,73 @@
+package reminder
+
+import (
+	"context"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access the payments due for a reminder from the data source.
+type Repository interface {
+	// Transactional runs the function within a transaction. The rows locked by LockDue stay locked until it returns.
+	Transactional(ctx context.Context, f func(ctx context.Context) error) error
+	// LockDue locks and returns pending payments that are due for a reminder. Payments requested before
+	// requestedBefore without any reminder yet are due, as well as payments whose next reminder is due at now.
+	// Rows locked by another transaction and payments of closed trips are skipped.
+	LockDue(ctx context.Context, requestedBefore, now time.Time, limit int) ([]entity.TransactionPayment, error)
+	// Schedule records the reminders sent for the payment and when the next one is due.
+	Schedule(ctx context.Context, payment entity.TransactionPayment) error
+}
+
+// repository reads and updates the payment reminders in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new reminder repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Transactional runs the function within a database transaction.
+func (r repository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return r.db.Transactional(ctx, f)
+}
+
+// LockDue selects the due payments with FOR UPDATE SKIP LOCKED so that concurrent server instances never remind
+// about the same payment twice. Payments of closed or archived trips are frozen and never reminded about.
+func (r repository) LockDue(ctx context.Context, requestedBefore, now time.Time, limit int) ([]entity.TransactionPayment, error) {
+	var payments []entity.TransactionPayment
+	err := r.db.With(ctx).NewQuery(`SELECT p.* FROM transaction_payment p
+		JOIN trip t ON t.id = p.trip_id
+		WHERE p.status = {:status} AND p.user_from_id <> ''
+			AND t.status NOT IN ({:closed}, {:archived})
+			AND (p.next_reminder_at <= {:now} OR p.next_reminder_at IS NULL AND p.created_at <= {:requested_before})
+		ORDER BY COALESCE(p.next_reminder_at, p.created_at)
+		LIMIT {:limit}
+		FOR UPDATE OF p SKIP LOCKED`).
+		Bind(dbx.Params{
+			"status":           entity.PaymentStatusPending,
+			"closed":           entity.TripStatusClosed,
+			"archived":         entity.TripStatusArchived,
+			"now":              now,
+			"requested_before": requestedBefore,
+			"limit":            limit,
+		}).
+		All(&payments)
+	return payments, err
+}
+
+// Schedule updates the reminder columns of the payment.
+func (r repository) Schedule(ctx context.Context, payment entity.TransactionPayment) error {
+	_, err := r.db.With(ctx).Update("transaction_payment", dbx.Params{
+		"reminder_count":   payment.ReminderCount,
+		"last_reminded_at": payment.LastRemindedAt,
+		"next_reminder_at": payment.NextReminderAt,
+	}, dbx.HashExp{"id": payment.ID}).Execute()
+	return err
+}
@@ -0,0 +1,186 @@
+// Package reminder periodically reminds the payers of pending payments.
+package reminder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/notification"
+	"tribbie/pkg/log"
+
+	User "tribbie/internal/user"
+)
+
+// batchSize is the number of payments locked and reminded within one transaction.
+const batchSize = 100
+
+// Scheduler sends reminders to the payers of pending payments.
+type Scheduler struct {
+	repo                Repository
+	profileService      User.ProfileService
+	notificationService notification.Service
+	cadence             []time.Duration
+	interval            time.Duration
+	quietStart          int
+	quietEnd            int
+	logger              log.Logger
+}
+
+// NewScheduler creates a new reminder scheduler.
+//
+// The cadence lists the days between reminders: the first reminder is sent cadence[0] days after a payment was
+// requested, the second cadence[1] days after the first, and so on, with the last interval repeating.
+// No reminders are sent between the quiet hours start and end in the time zone of the payer.
+// The interval is how often the pending payments are checked.
+func NewScheduler(repo Repository, profileService User.ProfileService, notificationService notification.Service,
+	cadence []int, interval time.Duration, quietStart, quietEnd int, logger log.Logger) *Scheduler {
+	s := &Scheduler{
+		repo:                repo,
+		profileService:      profileService,
+		notificationService: notificationService,
+		interval:            interval,
+		quietStart:          quietStart,
+		quietEnd:            quietEnd,
+		logger:              logger,
+	}
+	for _, days := range cadence {
+		s.cadence = append(s.cadence, time.Duration(days)*24*time.Hour)
+	}
+	return s
+}
+
+// Run checks the pending payments every interval until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.RunOnce(ctx, time.Now()); err != nil {
+			s.logger.With(ctx).Errorf("failed to send payment reminders: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce reminds the payers of all payments due at the given time.
+// Every payment handled gets a next reminder time in the future, so the loop ends once all due payments are handled.
+// The reminders of a batch are only sent once its schedule is committed, so that a failed batch is not reminded twice.
+func (s *Scheduler) RunOnce(ctx context.Context, now time.Time) error {
+	for {
+		var reminders []notification.NotifyRequest
+		var count int
+		err := s.repo.Transactional(ctx, func(ctx context.Context) error {
+			payments, err := s.repo.LockDue(ctx, now.Add(-s.after(0)), now, batchSize)
+			if err != nil {
+				return err
+			}
+			count = len(payments)
+			for _, payment := range payments {
+				reminder, err := s.schedule(ctx, payment, now)
+				if err != nil {
+					return err
+				}
+				if reminder != nil {
+					reminders = append(reminders, *reminder)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, reminder := range reminders {
+			s.notificationService.Notify(ctx, reminder)
+		}
+		if count < batchSize {
+			return nil
+		}
+	}
+}
+
+// schedule schedules the next reminder for the payment and returns the reminder to send now, if any.
+// No reminder is sent during the quiet hours of the payer.
+func (s *Scheduler) schedule(ctx context.Context, payment entity.TransactionPayment, now time.Time) (*notification.NotifyRequest, error) {
+	payer, err := s.profileService.Get(ctx, payment.UserFromId)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	location := loadLocation(payer.TimeZone)
+
+	if next, quiet := s.quietUntil(now.In(location)); quiet {
+		payment.NextReminderAt = &next
+		return nil, s.repo.Schedule(ctx, payment)
+	}
+
+	recipient := "the recipient"
+	if profile, err := s.profileService.Get(ctx, payment.UserToId); err == nil {
+		recipient = profile.Username
+		if profile.DisplayName != "" {
+			recipient = profile.DisplayName
+		}
+	}
+
+	next := now.Add(s.after(payment.ReminderCount + 1))
+	payment.ReminderCount++
+	payment.LastRemindedAt = &now
+	payment.NextReminderAt = &next
+	if err := s.repo.Schedule(ctx, payment); err != nil {
+		return nil, err
+	}
+	return &notification.NotifyRequest{
+		UserId:    payment.UserFromId,
+		Kind:      entity.NotificationPaymentReminder,
+		TripId:    payment.TripId,
+		SubjectId: payment.ID,
+		Title:     "Payment reminder",
+		Body:      fmt.Sprintf("You still owe %v %v to %v.", payment.Nominal, payment.Currency, recipient),
+	}, nil
+}
+
+// after returns the delay of the reminder with the given zero-based index, counted from the previous reminder or,
+// for the first reminder, from the payment request.
+func (s *Scheduler) after(reminder int) time.Duration {
+	if reminder >= len(s.cadence) {
+		reminder = len(s.cadence) - 1
+	}
+	return s.cadence[reminder]
+}
+
+// quietUntil returns whether the local time falls into the quiet hours, and if so, when they end.
+func (s *Scheduler) quietUntil(local time.Time) (time.Time, bool) {
+	if s.quietStart == s.quietEnd {
+		return time.Time{}, false
+	}
+	hour := local.Hour()
+	var quiet bool
+	if s.quietStart < s.quietEnd {
+		quiet = hour >= s.quietStart && hour < s.quietEnd
+	} else {
+		quiet = hour >= s.quietStart || hour < s.quietEnd
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+	end := time.Date(local.Year(), local.Month(), local.Day(), s.quietEnd, 0, 0, 0, local.Location())
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end, true
+}
+
+// loadLocation returns the time zone with the given IANA name, or UTC if the name is empty or unknown.
+func loadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
@@ -0,0 +1,173 @@
+package reminder
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/notification"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+
+	User "tribbie/internal/user"
+)
+
+func TestScheduler_RunOnce(t *testing.T) {
+	logger, _ := log.NewForTest()
+	requested := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockRepository{items: []entity.TransactionPayment{
+		{ID: "p1", UserFromId: "bob", UserToId: "alice", Nominal: 50000, Currency: "IDR", Status: entity.PaymentStatusPending, CreatedAt: requested},
+		{ID: "p2", UserFromId: "bob", UserToId: "alice", Status: entity.PaymentStatusConfirmed, CreatedAt: requested},
+	}}
+	profiles := mockProfileService{"alice": {UserDefault: User.UserDefault{UserDefault: entity.UserDefault{ID: "alice", Username: "alice", DisplayName: "Alice"}}}}
+	notifications := &mockNotificationService{}
+	s := NewScheduler(repo, profiles, notifications, []int{1, 3}, time.Minute, 22, 8, logger)
+	ctx := context.Background()
+
+	// not due before a day passed
+	assert.Nil(t, s.RunOnce(ctx, requested.Add(23*time.Hour)))
+	assert.Empty(t, notifications.sent)
+
+	first := requested.Add(25 * time.Hour)
+	assert.Nil(t, s.RunOnce(ctx, first))
+	if assert.Len(t, notifications.sent, 1) {
+		assert.Equal(t, "bob", notifications.sent[0].UserId)
+		assert.Equal(t, entity.NotificationPaymentReminder, notifications.sent[0].Kind)
+		assert.Equal(t, "You still owe 50000 IDR to Alice.", notifications.sent[0].Body)
+	}
+	assert.Equal(t, 1, repo.items[0].ReminderCount)
+	assert.Equal(t, first.Add(3*24*time.Hour), *repo.items[0].NextReminderAt)
+
+	// running again, e.g. on another instance, does not send the reminder twice
+	assert.Nil(t, s.RunOnce(ctx, first.Add(time.Minute)))
+	assert.Len(t, notifications.sent, 1)
+
+	// the last interval repeats
+	second := first.Add(3 * 24 * time.Hour)
+	assert.Nil(t, s.RunOnce(ctx, second))
+	assert.Len(t, notifications.sent, 2)
+	assert.Equal(t, second.Add(3*24*time.Hour), *repo.items[0].NextReminderAt)
+
+	// no more reminders once the payment is confirmed
+	repo.items[0].Status = entity.PaymentStatusConfirmed
+	assert.Nil(t, s.RunOnce(ctx, second.Add(7*24*time.Hour)))
+	assert.Len(t, notifications.sent, 2)
+}
+
+func TestScheduler_QuietHours(t *testing.T) {
+	logger, _ := log.NewForTest()
+	requested := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockRepository{items: []entity.TransactionPayment{
+		{ID: "p1", UserFromId: "bob", Status: entity.PaymentStatusPending, CreatedAt: requested},
+	}}
+	// 16:00 UTC is 23:00 in Jakarta
+	profiles := mockProfileService{"bob": {UserDefault: User.UserDefault{UserDefault: entity.UserDefault{ID: "bob", TimeZone: "Asia/Jakarta"}}}}
+	notifications := &mockNotificationService{}
+	s := NewScheduler(repo, profiles, notifications, []int{1}, time.Minute, 22, 8, logger)
+	ctx := context.Background()
+
+	assert.Nil(t, s.RunOnce(ctx, requested.Add(28*time.Hour)))
+	assert.Empty(t, notifications.sent)
+	// postponed until 08:00 in Jakarta
+	assert.Equal(t, time.Date(2026, 10, 3, 1, 0, 0, 0, time.UTC), repo.items[0].NextReminderAt.UTC())
+
+	assert.Nil(t, s.RunOnce(ctx, time.Date(2026, 10, 3, 1, 0, 0, 0, time.UTC)))
+	assert.Len(t, notifications.sent, 1)
+}
+
+func TestScheduler_FailedBatch(t *testing.T) {
+	logger, _ := log.NewForTest()
+	requested := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	repo := &mockRepository{items: []entity.TransactionPayment{
+		{ID: "p1", UserFromId: "bob", Status: entity.PaymentStatusPending, CreatedAt: requested},
+		{ID: "p2", UserFromId: "carol", Status: entity.PaymentStatusPending, CreatedAt: requested},
+	}, failOn: "p2"}
+	notifications := &mockNotificationService{}
+	s := NewScheduler(repo, mockProfileService{}, notifications, []int{1}, time.Minute, 0, 0, logger)
+
+	// the batch is rolled back, so none of its reminders is sent
+	assert.NotNil(t, s.RunOnce(context.Background(), requested.Add(25*time.Hour)))
+	assert.Empty(t, notifications.sent)
+}
+
+func TestScheduler_quietUntil(t *testing.T) {
+	logger, _ := log.NewForTest()
+	s := NewScheduler(nil, nil, nil, []int{1}, time.Minute, 22, 8, logger)
+	_, quiet := s.quietUntil(time.Date(2026, 10, 1, 21, 59, 0, 0, time.UTC))
+	assert.False(t, quiet)
+	end, quiet := s.quietUntil(time.Date(2026, 10, 1, 22, 0, 0, 0, time.UTC))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 10, 2, 8, 0, 0, 0, time.UTC), end)
+	end, quiet = s.quietUntil(time.Date(2026, 10, 2, 7, 30, 0, 0, time.UTC))
+	assert.True(t, quiet)
+	assert.Equal(t, time.Date(2026, 10, 2, 8, 0, 0, 0, time.UTC), end)
+
+	// no quiet hours
+	s = NewScheduler(nil, nil, nil, []int{1}, time.Minute, 0, 0, logger)
+	_, quiet = s.quietUntil(time.Date(2026, 10, 1, 23, 0, 0, 0, time.UTC))
+	assert.False(t, quiet)
+}
+
+type mockRepository struct {
+	items  []entity.TransactionPayment
+	failOn string
+}
+
+func (m *mockRepository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+func (m *mockRepository) LockDue(ctx context.Context, requestedBefore, now time.Time, limit int) ([]entity.TransactionPayment, error) {
+	var items []entity.TransactionPayment
+	for _, item := range m.items {
+		if item.Status != entity.PaymentStatusPending || item.UserFromId == "" {
+			continue
+		}
+		if item.NextReminderAt != nil && !item.NextReminderAt.After(now) || item.NextReminderAt == nil && !item.CreatedAt.After(requestedBefore) {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Schedule(ctx context.Context, payment entity.TransactionPayment) error {
+	if payment.ID == m.failOn {
+		return sql.ErrConnDone
+	}
+	for i, item := range m.items {
+		if item.ID == payment.ID {
+			m.items[i].ReminderCount = payment.ReminderCount
+			m.items[i].LastRemindedAt = payment.LastRemindedAt
+			m.items[i].NextReminderAt = payment.NextReminderAt
+		}
+	}
+	return nil
+}
+
+type mockProfileService map[string]User.Profile
+
+func (m mockProfileService) Get(ctx context.Context, id string) (User.Profile, error) {
+	if profile, ok := m[id]; ok {
+		return profile, nil
+	}
+	return User.Profile{}, sql.ErrNoRows
+}
+
+func (m mockProfileService) Update(ctx context.Context, id string, input User.UpdateProfileRequest) (User.Profile, error) {
+	return User.Profile{}, nil
+}
+
+func (m mockProfileService) GetMaskedPayout(ctx context.Context, id string) (*entity.Payout, error) {
+	return nil, nil
+}
+
+type mockNotificationService struct {
+	notification.Service
+	sent []notification.NotifyRequest
+}
+
+func (m *mockNotificationService) Notify(ctx context.Context, req notification.NotifyRequest) {
+	m.sent = append(m.sent, req)
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"strconv"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/trips/<id>/search", authHandler, res.search)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// search returns a page of the transactions and items of a trip matching the query.
+func (r resource) search(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	req := Request{
+		TripId:   c.Param("id"),
+		Query:    c.Query("q"),
+		Kind:     c.Query("kind"),
+		PayerId:  c.Query("payer"),
+		MemberId: c.Query("member"),
+		From:     c.Query("from"),
+		To:       c.Query("to"),
+	}
+	var err error
+	if req.MinAmount, err = parseAmount(c.Query("min_amount")); err != nil {
+		r.logger.With(ctx).Info(err)
+		return errors.BadRequest("The minimum amount must be an integer.")
+	}
+	if req.MaxAmount, err = parseAmount(c.Query("max_amount")); err != nil {
+		r.logger.With(ctx).Info(err)
+		return errors.BadRequest("The maximum amount must be an integer.")
+	}
+	count, err := r.service.Count(ctx, identity.GetID(), req)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	hits, err := r.service.Search(ctx, identity.GetID(), req, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = hits
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// parseAmount parses an optional amount query parameter.
+func parseAmount(value string) (*int64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+const (
+	// startSel and stopSel delimit the matched words in the snippets returned by the repository.
+	startSel = "\x02"
+	stopSel  = "\x03"
+)
+
+// Repository encapsulates the logic to search the data source.
+type Repository interface {
+	// GetTrip returns the trip with the specified ID.
+	GetTrip(ctx context.Context, id string) (entity.Trip, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+	// Count returns the number of transactions and items matching the criteria.
+	Count(ctx context.Context, criteria Criteria) (int, error)
+	// Search returns the transactions and items matching the criteria, the most relevant first.
+	Search(ctx context.Context, criteria Criteria, offset, limit int) ([]Hit, error)
+}
+
+// Criteria represents the conditions the hits of a search must satisfy.
+type Criteria struct {
+	TripId string
+	// Query is a tsquery in the 'simple' configuration.
+	Query string
+	// Kind restricts the hits to either transactions or items if it is not empty.
+	Kind     string
+	PayerId  string
+	MemberId string
+	// Since and Until bound the creation time of the transactions, Until being exclusive.
+	Since, Until *time.Time
+	// MinAmount and MaxAmount bound the grand total of transactions and the total price of items.
+	MinAmount, MaxAmount *int64
+}
+
+// repository searches the database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new search repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetTrip reads the trip with the specified ID from the database.
+func (r repository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	var trip entity.Trip
+	err := r.db.With(ctx).Select().Model(id, &trip)
+	return trip, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// hitsSQL selects the transactions and items of a trip matching a tsquery. The WHERE clauses use the same
+// expressions as the GIN indexes on the transaction and transaction_item tables so that the indexes can be used.
+// Items are scoped by the trip of their transaction rather than by their own trip_id, which the client sets.
+const hitsSQL = `WITH q AS (SELECT to_tsquery('simple'::regconfig, {:query}) AS query),
+hit AS (
+	SELECT 'transaction' AS kind, t.id AS transaction_id, '' AS item_id, COALESCE(t.title, '') AS title,
+		COALESCE(t.title, '') || ' ' || COALESCE(t.description, '') AS document,
+		ts_rank(setweight(to_tsvector('simple'::regconfig, COALESCE(t.title, '')), 'A') ||
+			setweight(to_tsvector('simple'::regconfig, COALESCE(t.description, '')), 'B'), q.query) AS rank,
+		COALESCE(t.grand_total, 0)::BIGINT AS amount, COALESCE(t.user_paid_id, '') AS user_paid_id, t.created_at
+	FROM transaction t, q
+	WHERE t.trip_id = {:trip_id}
+		AND to_tsvector('simple'::regconfig, COALESCE(t.title, '') || ' ' || COALESCE(t.description, '')) @@ q.query
+	UNION ALL
+	SELECT 'item', t.id, i.id, COALESCE(i.title, ''),
+		COALESCE(i.title, '') || ' ' || COALESCE(i.description, ''),
+		ts_rank(setweight(to_tsvector('simple'::regconfig, COALESCE(i.title, '')), 'A') ||
+			setweight(to_tsvector('simple'::regconfig, COALESCE(i.description, '')), 'B'), q.query),
+		(COALESCE(i.price, 0) * COALESCE(i.quantity, 1))::BIGINT, COALESCE(t.user_paid_id, ''), t.created_at
+	FROM transaction_item i JOIN transaction t ON t.id = i.transaction_id, q
+	WHERE t.trip_id = {:trip_id}
+		AND to_tsvector('simple'::regconfig, COALESCE(i.title, '') || ' ' || COALESCE(i.description, '')) @@ q.query
+)`
+
+// Count counts the hits of the search in the database.
+func (r repository) Count(ctx context.Context, criteria Criteria) (int, error) {
+	where, params := filter(criteria)
+	var count int
+	err := r.db.With(ctx).NewQuery(hitsSQL + `
+SELECT COUNT(*) FROM hit WHERE ` + where).Bind(params).Row(&count)
+	return count, err
+}
+
+// Search retrieves the hits of the search from the database with their snippets.
+func (r repository) Search(ctx context.Context, criteria Criteria, offset, limit int) ([]Hit, error) {
+	where, params := filter(criteria)
+	params["options"] = "StartSel=" + startSel + ", StopSel=" + stopSel + ", MinWords=10, MaxWords=25, MaxFragments=2"
+	params["offset"] = offset
+	params["limit"] = limit
+	var hits []Hit
+	err := r.db.With(ctx).NewQuery(hitsSQL + `
+SELECT kind, transaction_id, item_id, title, ts_headline('simple'::regconfig, document, q.query, {:options}) AS snippet,
+	rank, amount, user_paid_id, created_at
+FROM hit, q
+WHERE ` + where + `
+ORDER BY rank DESC, created_at DESC, transaction_id, item_id
+LIMIT {:limit} OFFSET {:offset}`).Bind(params).All(&hits)
+	return hits, err
+}
+
+// filter returns the condition on the hits of the search together with the parameters of the query.
+func filter(criteria Criteria) (string, dbx.Params) {
+	params := dbx.Params{"trip_id": criteria.TripId, "query": criteria.Query}
+	conditions := []string{"TRUE"}
+	if criteria.Kind != "" {
+		conditions = append(conditions, "hit.kind = {:kind}")
+		params["kind"] = criteria.Kind
+	}
+	if criteria.PayerId != "" {
+		conditions = append(conditions, "hit.user_paid_id = {:payer_id}")
+		params["payer_id"] = criteria.PayerId
+	}
+	if criteria.MemberId != "" {
+		// transactions shared by the member, or the items of which the member has a share
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM transaction_expenses e
+	WHERE e.transaction_id = hit.transaction_id AND e.trip_member_id = {:member_id}
+		AND (hit.item_id = '' OR e.item_id = hit.item_id))`)
+		params["member_id"] = criteria.MemberId
+	}
+	if criteria.Since != nil {
+		conditions = append(conditions, "hit.created_at >= {:since}")
+		params["since"] = *criteria.Since
+	}
+	if criteria.Until != nil {
+		conditions = append(conditions, "hit.created_at < {:until}")
+		params["until"] = *criteria.Until
+	}
+	if criteria.MinAmount != nil {
+		conditions = append(conditions, "hit.amount >= {:min_amount}")
+		params["min_amount"] = *criteria.MinAmount
+	}
+	if criteria.MaxAmount != nil {
+		conditions = append(conditions, "hit.amount <= {:max_amount}")
+		params["max_amount"] = *criteria.MaxAmount
+	}
+	return strings.Join(conditions, " AND "), params
+}
@@ -0,0 +1,209 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"unicode"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const (
+	// dateLayout is the format of the date range of a search.
+	dateLayout = "2006-01-02"
+	// maxTerms is the maximum number of words of a search query.
+	maxTerms = 10
+
+	// KindTransaction is the kind of the hits matching a transaction.
+	KindTransaction = "transaction"
+	// KindItem is the kind of the hits matching a transaction item.
+	KindItem = "item"
+)
+
+// Service encapsulates usecase logic for searching trips.
+// Only the members of a trip can search it.
+type Service interface {
+	// Search returns the transactions and items of the trip matching the request, the most relevant first.
+	Search(ctx context.Context, userId string, req Request, offset, limit int) ([]Hit, error)
+	// Count returns the number of transactions and items of the trip matching the request.
+	Count(ctx context.Context, userId string, req Request) (int, error)
+}
+
+// Hit represents a transaction or a transaction item matching a search.
+// The matched words of the snippet are HTML-escaped and wrapped in <mark> elements.
+type Hit struct {
+	Kind          string    `json:"kind"`
+	TransactionId string    `json:"transaction_id"`
+	ItemId        string    `json:"item_id,omitempty"`
+	Title         string    `json:"title"`
+	Snippet       string    `json:"snippet"`
+	Rank          float64   `json:"rank"`
+	Amount        int64     `json:"amount"`
+	UserPaidId    string    `json:"user_paid_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Request represents a search of the transactions and items of a trip.
+// Every word of the query must appear in the title or the description of a hit, words being matched by prefix.
+// The date range is inclusive and is interpreted in the time zone of the trip.
+type Request struct {
+	TripId    string
+	Query     string
+	Kind      string
+	PayerId   string
+	MemberId  string
+	From      string
+	To        string
+	MinAmount *int64
+	MaxAmount *int64
+}
+
+// Validate validates the Request fields.
+func (m Request) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.TripId, validation.Required),
+		validation.Field(&m.Query, validation.Required, validation.Length(0, 255), validation.By(hasTerms)),
+		validation.Field(&m.Kind, validation.In(KindTransaction, KindItem)),
+		validation.Field(&m.From, validation.Date(dateLayout)),
+		validation.Field(&m.To, validation.Date(dateLayout), validation.When(m.From != "", validation.By(notBefore(m.From)))),
+		validation.Field(&m.MinAmount, validation.Min(int64(0))),
+		validation.Field(&m.MaxAmount, validation.When(m.MinAmount != nil, validation.By(notLess(m.MinAmount)))),
+	)
+}
+
+type service struct {
+	repo   Repository
+	logger log.Logger
+}
+
+// NewService creates a new search service.
+func NewService(repo Repository, logger log.Logger) Service {
+	return service{repo, logger}
+}
+
+// Search returns the hits of the search with their snippets highlighted.
+func (s service) Search(ctx context.Context, userId string, req Request, offset, limit int) ([]Hit, error) {
+	criteria, err := s.criteria(ctx, userId, req)
+	if err != nil {
+		return nil, err
+	}
+	hits, err := s.repo.Search(ctx, criteria, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hits {
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+	return hits, nil
+}
+
+// Count returns the number of hits of the search.
+func (s service) Count(ctx context.Context, userId string, req Request) (int, error) {
+	criteria, err := s.criteria(ctx, userId, req)
+	if err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, criteria)
+}
+
+// criteria validates the request and translates it into search criteria if the user is a member of the trip.
+func (s service) criteria(ctx context.Context, userId string, req Request) (Criteria, error) {
+	if err := req.Validate(); err != nil {
+		return Criteria{}, err
+	}
+	trip, err := s.repo.GetTrip(ctx, req.TripId)
+	if err == sql.ErrNoRows {
+		return Criteria{}, errors.NotFound("")
+	} else if err != nil {
+		return Criteria{}, err
+	}
+	member, err := s.repo.IsTripMember(ctx, req.TripId, userId)
+	if err != nil {
+		return Criteria{}, err
+	}
+	if !member {
+		return Criteria{}, errors.Forbidden("Only the members of the trip can search it.")
+	}
+	criteria := Criteria{
+		TripId:    req.TripId,
+		Query:     tsquery(req.Query),
+		Kind:      req.Kind,
+		PayerId:   req.PayerId,
+		MemberId:  req.MemberId,
+		MinAmount: req.MinAmount,
+		MaxAmount: req.MaxAmount,
+	}
+	// the creation times are stored in the local time of the server
+	if req.From != "" {
+		since, _ := time.ParseInLocation(dateLayout, req.From, trip.Location())
+		since = since.In(time.Local)
+		criteria.Since = &since
+	}
+	if req.To != "" {
+		until, _ := time.ParseInLocation(dateLayout, req.To, trip.Location())
+		until = until.AddDate(0, 0, 1).In(time.Local)
+		criteria.Until = &until
+	}
+	return criteria, nil
+}
+
+// terms splits a search query into lower-case words made of letters and digits.
+func terms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxTerms {
+		words = words[:maxTerms]
+	}
+	return words
+}
+
+// tsquery returns a tsquery matching the documents containing every word of the search query by prefix.
+// The words contain no tsquery operators, so the query cannot be malformed.
+func tsquery(query string) string {
+	words := terms(query)
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// highlight escapes a snippet returned by the repository and wraps its matched words in <mark> elements.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, startSel, "<mark>")
+	return strings.ReplaceAll(snippet, stopSel, "</mark>")
+}
+
+// hasTerms checks that a search query contains at least one word.
+func hasTerms(value interface{}) error {
+	if s, _ := value.(string); s != "" && len(terms(s)) == 0 {
+		return validation.NewError("validation_search_terms", "must contain a letter or a digit")
+	}
+	return nil
+}
+
+// notBefore returns a rule checking that a date is not before the given date.
+func notBefore(date string) validation.RuleFunc {
+	return func(value interface{}) error {
+		if s, _ := value.(string); s != "" && s < date {
+			return validation.NewError("validation_date_order", "must not be before the start date")
+		}
+		return nil
+	}
+}
+
+// notLess returns a rule checking that an amount is not less than the given amount.
+func notLess(amount *int64) validation.RuleFunc {
+	return func(value interface{}) error {
+		if v, _ := value.(*int64); v != nil && *v < *amount {
+			return validation.NewError("validation_amount_order", "must not be less than the minimum amount")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequest_Validate(t *testing.T) {
+	min, max := int64(100000), int64(50000)
+	tests := []struct {
+		name      string
+		model     Request
+		wantError bool
+	}{
+		{"success", Request{TripId: "trip1", Query: "parking", From: "2026-07-14", To: "2026-07-14"}, false},
+		{"query required", Request{TripId: "trip1"}, true},
+		{"no terms", Request{TripId: "trip1", Query: "!? -"}, true},
+		{"invalid kind", Request{TripId: "trip1", Query: "parking", Kind: "payment"}, true},
+		{"invalid date", Request{TripId: "trip1", Query: "parking", From: "14/07/2026"}, true},
+		{"date order", Request{TripId: "trip1", Query: "parking", From: "2026-07-15", To: "2026-07-14"}, true},
+		{"amount order", Request{TripId: "trip1", Query: "parking", MinAmount: &min, MaxAmount: &max}, true},
+		{"zero amount", Request{TripId: "trip1", Query: "parking", MinAmount: new(int64)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestTsquery(t *testing.T) {
+	assert.Equal(t, "parking:*", tsquery("parking"))
+	assert.Equal(t, "parkir:* & kuta:* & 2:*", tsquery("Parkir (Kuta) & 2!"))
+	assert.Equal(t, "café:*", tsquery("'Café':*"))
+	assert.Equal(t, "", tsquery("|!"))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t, "<mark>Parking</mark> at &lt;Kuta&gt; &amp; beach",
+		highlight(startSel+"Parking"+stopSel+" at <Kuta> & beach"))
+}
+
+func TestService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		trips:   map[string]entity.Trip{"trip1": {ID: "trip1", TimeZone: "Asia/Makassar"}},
+		members: map[string]bool{"budi": true},
+		hits:    []Hit{{Kind: KindItem, TransactionId: "t1", ItemId: "i1", Snippet: startSel + "Parking" + stopSel + " <day 2>"}},
+	}
+	s := NewService(repo, logger)
+	ctx := context.Background()
+
+	_, err := s.Search(ctx, "carol", Request{TripId: "trip1", Query: "parking"}, 0, 10)
+	assert.Equal(t, errors.Forbidden("Only the members of the trip can search it."), err)
+	_, err = s.Count(ctx, "budi", Request{TripId: "trip0", Query: "parking"})
+	assert.Equal(t, errors.NotFound(""), err)
+	_, err = s.Count(ctx, "budi", Request{TripId: "trip1"})
+	assert.NotNil(t, err)
+
+	max := int64(50000)
+	hits, err := s.Search(ctx, "budi", Request{
+		TripId: "trip1", Query: "Parking fee", PayerId: "budi", MemberId: "m1", From: "2026-07-14", To: "2026-07-15", MaxAmount: &max,
+	}, 0, 10)
+	assert.Nil(t, err)
+	if assert.Len(t, hits, 1) {
+		assert.Equal(t, "<mark>Parking</mark> &lt;day 2&gt;", hits[0].Snippet)
+	}
+	criteria := repo.criteria
+	assert.Equal(t, "parking:* & fee:*", criteria.Query)
+	assert.Equal(t, "budi", criteria.PayerId)
+	assert.Equal(t, "m1", criteria.MemberId)
+	assert.Equal(t, &max, criteria.MaxAmount)
+	assert.Nil(t, criteria.MinAmount)
+	// the date range covers whole days in the time zone of the trip
+	if assert.NotNil(t, criteria.Since) && assert.NotNil(t, criteria.Until) {
+		assert.True(t, criteria.Since.Equal(time.Date(2026, 7, 13, 16, 0, 0, 0, time.UTC)))
+		assert.True(t, criteria.Until.Equal(time.Date(2026, 7, 15, 16, 0, 0, 0, time.UTC)))
+	}
+
+	count, err := s.Count(ctx, "budi", Request{TripId: "trip1", Query: "parking"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Nil(t, repo.criteria.Since)
+}
+
+type mockRepository struct {
+	trips    map[string]entity.Trip
+	members  map[string]bool
+	hits     []Hit
+	criteria Criteria
+}
+
+func (m *mockRepository) GetTrip(ctx context.Context, id string) (entity.Trip, error) {
+	if trip, ok := m.trips[id]; ok {
+		return trip, nil
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	return m.members[userId], nil
+}
+
+func (m *mockRepository) Count(ctx context.Context, criteria Criteria) (int, error) {
+	m.criteria = criteria
+	return len(m.hits), nil
+}
+
+func (m *mockRepository) Search(ctx context.Context, criteria Criteria, offset, limit int) ([]Hit, error) {
+	m.criteria = criteria
+	hits := make([]Hit, len(m.hits))
+	copy(hits, m.hits)
+	return hits, nil
+}
@@ -3,6 +3,7 @@ package transactionExpenses
 import (
 	"net/http"
 	"tribbie/internal/errors"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
@@ -16,7 +17,7 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 	r.Get("/transaction-expenses/<id>", res.get)
 	r.Get("/transaction-expenses", res.query)
 
-	// r.Use(authHandler)
+	r.Use(authHandler)
 
 	r.Post("/transaction-expenses", res.create)
 	r.Put("/transaction-expenses/<id>", res.update)
@@ -39,17 +40,23 @@ func (r resource) get(c *routing.Context) error {
 
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, QueryFields)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, options)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	transactionExpenses, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	transactionExpenses, err := r.service.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = transactionExpenses
-	return c.Write(transactionExpenses)
+	pages.NextCursor = options.NextCursor(transactionExpenses, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
@@ -3,22 +3,31 @@ package transactionExpenses
 import (
 	"context"
 	"tribbie/internal/entity"
+	"tribbie/internal/tripguard"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access transactionExpenses from the data source.
 type Repository interface {
+	tripguard.Repository
 	// Get returns the transactionExpenses with the specified transactionExpenses ID.
 	Get(ctx context.Context, id string) (entity.TransactionExpenses, error)
-	// Count returns the number of transactionExpenses.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of transactionExpenses with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.TransactionExpenses, error)
+	// Count returns the number of transactionExpenses matching the filter.
+	Count(ctx context.Context, options listing.Options) (int, error)
+	// Query returns the list of transactionExpenses matching the filter with the given offset and limit.
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionExpenses, error)
 	// Query returns the list of transactionExpenses with the given offset and limit.
 	QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionExpenses, error)
 	// Query returns the list of transactionExpenses with the given offset and limit.
 	QueryByTransaction(ctx context.Context, tripId string) ([]entity.TransactionExpenses, error)
+	// QueryByTransactions returns the transactionExpenses of the specified transactions.
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionExpenses, error)
+	// QueryByTripMembers returns the transactionExpenses of the specified trip members.
+	QueryByTripMembers(ctx context.Context, tripMemberIds []string) ([]entity.TransactionExpenses, error)
 	// Create saves a new transactionExpenses in the storage.
 	Create(ctx context.Context, transactionExpenses entity.TransactionExpenses) error
 	// Update updates the transactionExpenses with given ID in the storage.
@@ -29,13 +38,14 @@ type Repository interface {
 
 // repository persists transactionExpenses in database
 type repository struct {
+	tripguard.Repository
 	db     *dbcontext.DB
 	logger log.Logger
 }
 
 // NewRepository creates a new transactionExpenses repository
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
-	return repository{db, logger}
+	return repository{tripguard.NewRepository(db, logger), db, logger}
 }
 
 // Get reads the transactionExpenses with the specified ID from the database.
@@ -65,19 +75,33 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&transactionExpenses).Delete()
 }
 
-// Count returns the number of the transactionExpenses records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// QueryFields lists the fields of the transaction expenses that list requests can filter and sort by.
+var QueryFields = listing.Fields{
+	"id":             {Column: "id", Sortable: true},
+	"trip_id":        {Column: "trip_id"},
+	"trip_member_id": {Column: "trip_member_id"},
+	"transaction_id": {Column: "transaction_id"},
+	"item_id":        {Column: "item_id"},
+	"quantity":       {Column: "quantity", Type: listing.Int, Sortable: true},
+	"created_at":     {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at":     {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the transactionExpenses records matching the filter in the database.
+func (r repository) Count(ctx context.Context, options listing.Options) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_expenses").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_expenses").Where(options.Where()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the transactionExpenses records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.TransactionExpenses, error) {
+// Query retrieves the transactionExpenses records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionExpenses, error) {
 	var transactionExpenses []entity.TransactionExpenses
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(options.Where()).
+		AndWhere(options.After()).
+		OrderBy(options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&transactionExpenses)
@@ -87,9 +111,11 @@ func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Tran
 // Get reads the TransactionExpenses with the specified Trip ID from the database.
 func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionExpenses, error) {
 	var TransactionExpenses []entity.TransactionExpenses
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_expenses WHERE trip_id='" + tripId + "'")
-	err := q.All(&TransactionExpenses)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("id").
+		All(&TransactionExpenses)
 
 	return TransactionExpenses, err
 }
@@ -97,9 +123,47 @@ func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Tr
 // Get reads the TransactionExpenses with the specified Trip ID from the database.
 func (r repository) QueryByTransaction(ctx context.Context, tripId string) ([]entity.TransactionExpenses, error) {
 	var TransactionExpenses []entity.TransactionExpenses
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_expenses WHERE transaction_id='" + tripId + "'")
-	err := q.All(&TransactionExpenses)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": tripId}).
+		OrderBy("id").
+		All(&TransactionExpenses)
 
 	return TransactionExpenses, err
 }
+
+// QueryByTransactions reads the transactionExpenses of the specified transactions from the database.
+func (r repository) QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionExpenses, error) {
+	if len(transactionIds) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(transactionIds))
+	for i, id := range transactionIds {
+		ids[i] = id
+	}
+	var items []entity.TransactionExpenses
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.In("transaction_id", ids...)).
+		OrderBy("id").
+		All(&items)
+	return items, err
+}
+
+// QueryByTripMembers reads the transactionExpenses of the specified trip members from the database.
+func (r repository) QueryByTripMembers(ctx context.Context, tripMemberIds []string) ([]entity.TransactionExpenses, error) {
+	if len(tripMemberIds) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(tripMemberIds))
+	for i, id := range tripMemberIds {
+		ids[i] = id
+	}
+	var items []entity.TransactionExpenses
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.In("trip_member_id", ids...)).
+		OrderBy("created_at").
+		All(&items)
+	return items, err
+}
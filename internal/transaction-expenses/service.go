@@ -2,20 +2,30 @@ package transactionExpenses
 
 import (
 	"context"
+	"fmt"
 	"time"
 	"tribbie/internal/entity"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/tripguard"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	TransactionItem "tribbie/internal/transaction-item"
+	TripMember "tribbie/internal/trip-member"
 )
 
 // Service encapsulates usecase logic for transactionExpenses.
 type Service interface {
 	Get(ctx context.Context, id string) (TransactionExpenses, error)
-	Query(ctx context.Context, offset, limit int) ([]TransactionExpenses, error)
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionExpenses, error)
 	QueryByTrip(ctx context.Context, tripId string) ([]TransactionExpenses, error)
+	QueryByTripMembers(ctx context.Context, tripMemberIds []string) ([]TransactionExpenses, error)
 	QueryByTransaction(ctx context.Context, transactionId string) ([]TransactionExpenses, error)
-	Count(ctx context.Context) (int, error)
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionExpenses, error)
+	Count(ctx context.Context, options listing.Options) (int, error)
 	Create(ctx context.Context, input CreateTransactionExpensesRequest) (TransactionExpenses, error)
 	Update(ctx context.Context, id string, input UpdateTransactionExpensesRequest) (TransactionExpenses, error)
 	Delete(ctx context.Context, id string) (TransactionExpenses, error)
@@ -65,13 +75,19 @@ func (m UpdateTransactionExpensesRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo                Repository
+	tripMemberService   TripMember.Service
+	itemService         TransactionItem.Service
+	notificationService notification.Service
+	publisher           realtime.Publisher
+	logger              log.Logger
 }
 
 // NewService creates a new transactionExpenses service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The notification service informs users when they are included in an expense.
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, tripMemberService TripMember.Service, itemService TransactionItem.Service, notificationService notification.Service, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, tripMemberService, itemService, notificationService, publisher, logger}
 }
 
 // Get returns the transactionExpenses with the specified the transactionExpenses ID.
@@ -88,6 +104,9 @@ func (s service) Create(ctx context.Context, req CreateTransactionExpensesReques
 	if err := req.Validate(); err != nil {
 		return TransactionExpenses{}, err
 	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "expenses"); err != nil {
+		return TransactionExpenses{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 
@@ -104,7 +123,44 @@ func (s service) Create(ctx context.Context, req CreateTransactionExpensesReques
 	if err != nil {
 		return TransactionExpenses{}, err
 	}
-	return s.Get(ctx, id)
+	transactionExpenses, err := s.Get(ctx, id)
+	if err != nil {
+		return TransactionExpenses{}, err
+	}
+	s.notifyIncluded(ctx, transactionExpenses)
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionExpenses.TripId, "expense", realtime.Created, transactionExpenses.TransactionExpenses))
+	return transactionExpenses, nil
+}
+
+// notifyIncluded informs the user linked to the trip member that they were included in the transaction,
+// unless they already had an expense on it.
+func (s service) notifyIncluded(ctx context.Context, expense TransactionExpenses) {
+	expenses, err := s.repo.QueryByTransaction(ctx, expense.TransactionId)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+	for _, other := range expenses {
+		if other.ID != expense.ID && other.TripMemberId == expense.TripMemberId {
+			return
+		}
+	}
+	member, err := s.tripMemberService.Get(ctx, expense.TripMemberId)
+	if err != nil || member.UserId == "" {
+		return
+	}
+	item, err := s.itemService.Get(ctx, expense.ItemId)
+	if err != nil {
+		return
+	}
+	s.notificationService.Notify(ctx, notification.NotifyRequest{
+		UserId:    member.UserId,
+		Kind:      entity.NotificationExpenseIncluded,
+		TripId:    expense.TripId,
+		SubjectId: expense.TransactionId,
+		Title:     "Included in an expense",
+		Body:      fmt.Sprintf("You were included in %v.", item.Title),
+	})
 }
 
 // Update updates the transactionExpenses with the specified ID.
@@ -117,6 +173,12 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionExp
 	if err != nil {
 		return transactionExpenses, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionExpenses.TripId, "expenses"); err != nil {
+		return TransactionExpenses{}, err
+	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "expenses"); err != nil {
+		return TransactionExpenses{}, err
+	}
 	transactionExpenses.TripId = req.TripId
 	transactionExpenses.TripMemberId = req.TripMemberId
 	transactionExpenses.TransactionId = req.TransactionId
@@ -127,6 +189,7 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionExp
 	if err := s.repo.Update(ctx, transactionExpenses.TransactionExpenses); err != nil {
 		return transactionExpenses, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionExpenses.TripId, "expense", realtime.Updated, transactionExpenses.TransactionExpenses))
 	return transactionExpenses, nil
 }
 
@@ -136,20 +199,24 @@ func (s service) Delete(ctx context.Context, id string) (TransactionExpenses, er
 	if err != nil {
 		return TransactionExpenses{}, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionExpenses.TripId, "expenses"); err != nil {
+		return TransactionExpenses{}, err
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return TransactionExpenses{}, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionExpenses.TripId, "expense", realtime.Deleted, transactionExpenses.TransactionExpenses))
 	return transactionExpenses, nil
 }
 
-// Count returns the number of transactionExpenses.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of transactionExpenses matching the filter.
+func (s service) Count(ctx context.Context, options listing.Options) (int, error) {
+	return s.repo.Count(ctx, options)
 }
 
-// Query returns the transactionExpenses with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]TransactionExpenses, error) {
-	expenses, err := s.repo.Query(ctx, offset, limit)
+// Query returns the transactionExpenses matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionExpenses, error) {
+	expenses, err := s.repo.Query(ctx, options, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -185,3 +252,29 @@ func (s service) QueryByTransaction(ctx context.Context, tripId string) ([]Trans
 	}
 	return result, nil
 }
+
+// QueryByTransactions returns the transactionExpenses of the specified transactions.
+func (s service) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionExpenses, error) {
+	items, err := s.repo.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	result := []TransactionExpenses{}
+	for _, item := range items {
+		result = append(result, TransactionExpenses{item})
+	}
+	return result, nil
+}
+
+// QueryByTripMembers returns the transactionExpenses of the specified trip members.
+func (s service) QueryByTripMembers(ctx context.Context, tripMemberIds []string) ([]TransactionExpenses, error) {
+	items, err := s.repo.QueryByTripMembers(ctx, tripMemberIds)
+	if err != nil {
+		return nil, err
+	}
+	result := []TransactionExpenses{}
+	for _, item := range items {
+		result = append(result, TransactionExpenses{item})
+	}
+	return result, nil
+}
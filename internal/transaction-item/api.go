@@ -3,6 +3,7 @@ package transactionItem
 import (
 	"net/http"
 	"tribbie/internal/errors"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
@@ -39,17 +40,23 @@ func (r resource) get(c *routing.Context) error {
 
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, QueryFields)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, options)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	transactionItems, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	transactionItems, err := r.service.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = transactionItems
-	return c.Write(transactionItems)
+	pages.NextCursor = options.NextCursor(transactionItems, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
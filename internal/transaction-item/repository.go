@@ -3,22 +3,29 @@ package transactionItem
 import (
 	"context"
 	"tribbie/internal/entity"
+	"tribbie/internal/tripguard"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access transactionItems from the data source.
 type Repository interface {
+	tripguard.Repository
 	// Get returns the transactionItem with the specified transactionItem ID.
 	Get(ctx context.Context, id string) (entity.TransactionItem, error)
-	// Count returns the number of transactionItems.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of transactionItems with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.TransactionItem, error)
+	// Count returns the number of transactionItems matching the filter.
+	Count(ctx context.Context, options listing.Options) (int, error)
+	// Query returns the list of transactionItems matching the filter with the given offset and limit.
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionItem, error)
 	// Query returns the list of transactionItems with the given offset and limit.
 	QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionItem, error)
 	// Query returns the list of transactionItems with the given offset and limit.
 	QueryByTransaction(ctx context.Context, transactionId string) ([]entity.TransactionItem, error)
+	// QueryByTransactions returns the transactionItems of the specified transactions.
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionItem, error)
 	// Create saves a new transactionItem in the storage.
 	Create(ctx context.Context, transactionItem entity.TransactionItem) error
 	// Update updates the transactionItem with given ID in the storage.
@@ -29,13 +36,14 @@ type Repository interface {
 
 // repository persists transactionItems in database
 type repository struct {
+	tripguard.Repository
 	db     *dbcontext.DB
 	logger log.Logger
 }
 
 // NewRepository creates a new transactionItem repository
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
-	return repository{db, logger}
+	return repository{tripguard.NewRepository(db, logger), db, logger}
 }
 
 // Get reads the transactionItem with the specified ID from the database.
@@ -65,19 +73,33 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&transactionItem).Delete()
 }
 
-// Count returns the number of the transactionItem records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// QueryFields lists the fields of the transaction items that list requests can filter and sort by.
+var QueryFields = listing.Fields{
+	"id":             {Column: "id", Sortable: true},
+	"trip_id":        {Column: "trip_id"},
+	"transaction_id": {Column: "transaction_id"},
+	"title":          {Column: "title", Sortable: true},
+	"quantity":       {Column: "quantity", Type: listing.Int, Sortable: true},
+	"price":          {Column: "price", Type: listing.Int, Sortable: true},
+	"created_at":     {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at":     {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the transactionItem records matching the filter in the database.
+func (r repository) Count(ctx context.Context, options listing.Options) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_item").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_item").Where(options.Where()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the transactionItem records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.TransactionItem, error) {
+// Query retrieves the transactionItem records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionItem, error) {
 	var transactionItems []entity.TransactionItem
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(options.Where()).
+		AndWhere(options.After()).
+		OrderBy(options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&transactionItems)
@@ -87,9 +109,11 @@ func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Tran
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionItem, error) {
 	var transactionItem []entity.TransactionItem
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_item WHERE trip_id='" + tripId + "'")
-	err := q.All(&transactionItem)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("id").
+		All(&transactionItem)
 
 	return transactionItem, err
 }
@@ -97,9 +121,29 @@ func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Tr
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.TransactionItem, error) {
 	var tripMembers []entity.TransactionItem
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_item WHERE transaction_id='" + transactionId + "'")
-	err := q.All(&tripMembers)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": transactionId}).
+		OrderBy("id").
+		All(&tripMembers)
 
 	return tripMembers, err
 }
+
+// QueryByTransactions reads the transactionItems of the specified transactions from the database.
+func (r repository) QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionItem, error) {
+	if len(transactionIds) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(transactionIds))
+	for i, id := range transactionIds {
+		ids[i] = id
+	}
+	var items []entity.TransactionItem
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.In("transaction_id", ids...)).
+		OrderBy("id").
+		All(&items)
+	return items, err
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"time"
 	"tribbie/internal/entity"
+	"tribbie/internal/realtime"
+	"tribbie/internal/tripguard"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -12,10 +15,11 @@ import (
 // Service encapsulates usecase logic for transactionItems.
 type Service interface {
 	Get(ctx context.Context, id string) (TransactionItem, error)
-	Query(ctx context.Context, offset, limit int) ([]TransactionItem, error)
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionItem, error)
 	QueryByTrip(ctx context.Context, tripId string) ([]TransactionItem, error)
 	QueryByTransaction(ctx context.Context, transactionId string) ([]TransactionItem, error)
-	Count(ctx context.Context) (int, error)
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionItem, error)
+	Count(ctx context.Context, options listing.Options) (int, error)
 	Create(ctx context.Context, input CreateTransactionItemRequest) (TransactionItem, error)
 	Update(ctx context.Context, id string, input UpdateTransactionItemRequest) (TransactionItem, error)
 	Delete(ctx context.Context, id string) (TransactionItem, error)
@@ -65,13 +69,15 @@ func (m UpdateTransactionItemRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo      Repository
+	publisher realtime.Publisher
+	logger    log.Logger
 }
 
 // NewService creates a new transactionItem service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, publisher, logger}
 }
 
 // Get returns the transactionItem with the specified the transactionItem ID.
@@ -88,6 +94,9 @@ func (s service) Create(ctx context.Context, req CreateTransactionItemRequest) (
 	if err := req.Validate(); err != nil {
 		return TransactionItem{}, err
 	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "items"); err != nil {
+		return TransactionItem{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 	err := s.repo.Create(ctx, entity.TransactionItem{
@@ -104,7 +113,12 @@ func (s service) Create(ctx context.Context, req CreateTransactionItemRequest) (
 	if err != nil {
 		return TransactionItem{}, err
 	}
-	return s.Get(ctx, id)
+	transactionItem, err := s.Get(ctx, id)
+	if err != nil {
+		return TransactionItem{}, err
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionItem.TripId, "item", realtime.Created, transactionItem.TransactionItem))
+	return transactionItem, nil
 }
 
 // Update updates the transactionItem with the specified ID.
@@ -117,6 +131,12 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionIte
 	if err != nil {
 		return transactionItem, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionItem.TripId, "items"); err != nil {
+		return TransactionItem{}, err
+	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "items"); err != nil {
+		return TransactionItem{}, err
+	}
 	transactionItem.TripId = req.TripId
 	transactionItem.TransactionId = req.TransactionId
 	transactionItem.Title = req.Title
@@ -128,6 +148,7 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionIte
 	if err := s.repo.Update(ctx, transactionItem.TransactionItem); err != nil {
 		return transactionItem, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionItem.TripId, "item", realtime.Updated, transactionItem.TransactionItem))
 	return transactionItem, nil
 }
 
@@ -137,20 +158,24 @@ func (s service) Delete(ctx context.Context, id string) (TransactionItem, error)
 	if err != nil {
 		return TransactionItem{}, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionItem.TripId, "items"); err != nil {
+		return TransactionItem{}, err
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return TransactionItem{}, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionItem.TripId, "item", realtime.Deleted, transactionItem.TransactionItem))
 	return transactionItem, nil
 }
 
-// Count returns the number of transactionItems.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of transactionItems matching the filter.
+func (s service) Count(ctx context.Context, options listing.Options) (int, error) {
+	return s.repo.Count(ctx, options)
 }
 
-// Query returns the transactionItems with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]TransactionItem, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the transactionItems matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionItem, error) {
+	items, err := s.repo.Query(ctx, options, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -186,3 +211,16 @@ func (s service) QueryByTransaction(ctx context.Context, tripId string) ([]Trans
 	}
 	return result, nil
 }
+
+// QueryByTransactions returns the transactionItems of the specified transactions.
+func (s service) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionItem, error) {
+	items, err := s.repo.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	result := []TransactionItem{}
+	for _, item := range items {
+		result = append(result, TransactionItem{item})
+	}
+	return result, nil
+}
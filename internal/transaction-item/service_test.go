@@ -0,0 +1,103 @@
+package transactionItem
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/realtime"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_closedTrip(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{
+		trips: []entity.Trip{
+			{ID: "open", Title: "Bali", Status: entity.TripStatusOngoing},
+			{ID: "closed", Title: "Lombok", Status: entity.TripStatusClosed},
+		},
+		transactions: []entity.Transaction{
+			{ID: "t1", TripId: "open"},
+			{ID: "t2", TripId: "closed"},
+		},
+		items: []entity.TransactionItem{{ID: "i2", TripId: "closed", TransactionId: "t2", Title: "Ferry"}},
+	}
+	s := NewService(repo, mockPublisher{}, logger)
+	ctx := context.Background()
+
+	item, err := s.Create(ctx, CreateTransactionItemRequest{TripId: "open", TransactionId: "t1", Title: "Steak"})
+	assert.Nil(t, err)
+	assert.Equal(t, "open", item.TripId)
+
+	tests := []struct {
+		name   string
+		req    CreateTransactionItemRequest
+		status int
+	}{
+		{"closed trip", CreateTransactionItemRequest{TripId: "closed", TransactionId: "t2", Title: "Ferry"}, http.StatusConflict},
+		{"unknown trip", CreateTransactionItemRequest{TripId: "unknown", TransactionId: "t1", Title: "Steak"}, http.StatusBadRequest},
+		{"unknown transaction", CreateTransactionItemRequest{TripId: "open", TransactionId: "unknown", Title: "Steak"}, http.StatusBadRequest},
+		{"transaction of another trip", CreateTransactionItemRequest{TripId: "open", TransactionId: "t2", Title: "Ferry"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Create(ctx, tt.req)
+			if assert.IsType(t, errors.ErrorResponse{}, err) {
+				assert.Equal(t, tt.status, err.(errors.ErrorResponse).StatusCode())
+			}
+		})
+	}
+
+	// the items of a closed trip are frozen, and cannot be moved out of it
+	_, err = s.Update(ctx, "i2", UpdateTransactionItemRequest{TripId: "open", TransactionId: "t1", Title: "Ferry"})
+	assert.Equal(t, http.StatusConflict, err.(errors.ErrorResponse).StatusCode())
+	_, err = s.Delete(ctx, "i2")
+	assert.Equal(t, http.StatusConflict, err.(errors.ErrorResponse).StatusCode())
+}
+
+type mockRepository struct {
+	Repository
+	trips        []entity.Trip
+	transactions []entity.Transaction
+	items        []entity.TransactionItem
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.TransactionItem, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.TransactionItem{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, item entity.TransactionItem) error {
+	m.items = append(m.items, item)
+	return nil
+}
+
+func (m *mockRepository) GetTrip(ctx context.Context, tripId string) (entity.Trip, error) {
+	for _, trip := range m.trips {
+		if trip.ID == tripId {
+			return trip, nil
+		}
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetTransaction(ctx context.Context, transactionId string) (entity.Transaction, error) {
+	for _, transaction := range m.transactions {
+		if transaction.ID == transactionId {
+			return transaction, nil
+		}
+	}
+	return entity.Transaction{}, sql.ErrNoRows
+}
+
+type mockPublisher struct{}
+
+func (mockPublisher) Publish(ctx context.Context, event realtime.Event) {}
@@ -3,6 +3,7 @@ package transactionPayment
 import (
 	"net/http"
 	"tribbie/internal/errors"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
@@ -16,7 +17,7 @@ func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routin
 	r.Get("/transaction-payments/<id>", res.get)
 	r.Get("/transaction-payments", res.query)
 
-	// r.Use(authHandler)
+	r.Use(authHandler)
 
 	r.Post("/transaction-payments", res.create)
 	r.Put("/transaction-payments/<id>", res.update)
@@ -39,17 +40,23 @@ func (r resource) get(c *routing.Context) error {
 
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, QueryFields)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, options)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	transactionPayments, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	transactionPayments, err := r.service.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = transactionPayments
-	return c.Write(transactionPayments)
+	pages.NextCursor = options.NextCursor(transactionPayments, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
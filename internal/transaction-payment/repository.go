@@ -3,22 +3,31 @@ package transactionPayment
 import (
 	"context"
 	"tribbie/internal/entity"
+	"tribbie/internal/tripguard"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access transactionPayments from the data source.
 type Repository interface {
+	tripguard.Repository
 	// Get returns the transactionPayment with the specified transactionPayment ID.
 	Get(ctx context.Context, id string) (entity.TransactionPayment, error)
-	// Count returns the number of transactionPayments.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of transactionPayments with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.TransactionPayment, error)
+	// Count returns the number of transactionPayments matching the filter.
+	Count(ctx context.Context, options listing.Options) (int, error)
+	// Query returns the list of transactionPayments matching the filter with the given offset and limit.
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionPayment, error)
 	// Query returns the list of transactionPayments with the given offset and limit.
 	QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionPayment, error)
 	// Query returns the list of transactionPayments with the given offset and limit.
 	QueryByTransaction(ctx context.Context, tripId string) ([]entity.TransactionPayment, error)
+	// QueryByTransactions returns the transactionPayments of the specified transactions.
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionPayment, error)
+	// QueryByUser returns the transactionPayments made from or to the specified user.
+	QueryByUser(ctx context.Context, userId string) ([]entity.TransactionPayment, error)
 	// Create saves a new transactionPayment in the storage.
 	Create(ctx context.Context, transactionPayment entity.TransactionPayment) error
 	// Update updates the transactionPayment with given ID in the storage.
@@ -29,13 +38,14 @@ type Repository interface {
 
 // repository persists transactionPayments in database
 type repository struct {
+	tripguard.Repository
 	db     *dbcontext.DB
 	logger log.Logger
 }
 
 // NewRepository creates a new transactionPayment repository
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
-	return repository{db, logger}
+	return repository{tripguard.NewRepository(db, logger), db, logger}
 }
 
 // Get reads the transactionPayment with the specified ID from the database.
@@ -65,19 +75,38 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&transactionPayment).Delete()
 }
 
-// Count returns the number of the transactionPayment records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// QueryFields lists the fields of the transaction payments that list requests can filter and sort by.
+var QueryFields = listing.Fields{
+	"id":               {Column: "id", Sortable: true},
+	"trip_id":          {Column: "trip_id"},
+	"trip_member_id":   {Column: "trip_member_id"},
+	"transaction_id":   {Column: "transaction_id"},
+	"user_from_id":     {Column: "user_from_id"},
+	"user_to_id":       {Column: "user_to_id"},
+	"nominal":          {Column: "nominal", Type: listing.Int, Sortable: true},
+	"currency":         {Column: "currency"},
+	"status":           {Column: "status", Sortable: true},
+	"reminder_count":   {Column: "reminder_count", Type: listing.Int, Sortable: true},
+	"next_reminder_at": {Column: "next_reminder_at", Type: listing.Time},
+	"created_at":       {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at":       {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the transactionPayment records matching the filter in the database.
+func (r repository) Count(ctx context.Context, options listing.Options) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_payment").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("transaction_payment").Where(options.Where()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the transactionPayment records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.TransactionPayment, error) {
+// Query retrieves the transactionPayment records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TransactionPayment, error) {
 	var transactionPayments []entity.TransactionPayment
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(options.Where()).
+		AndWhere(options.After()).
+		OrderBy(options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&transactionPayments)
@@ -87,9 +116,11 @@ func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Tran
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.TransactionPayment, error) {
 	var tripMembers []entity.TransactionPayment
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_payment WHERE trip_id='" + tripId + "'")
-	err := q.All(&tripMembers)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("id").
+		All(&tripMembers)
 
 	return tripMembers, err
 }
@@ -97,9 +128,40 @@ func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Tr
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTransaction(ctx context.Context, transactionId string) ([]entity.TransactionPayment, error) {
 	var tripMembers []entity.TransactionPayment
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction_payment WHERE transaction_id='" + transactionId + "'")
-	err := q.All(&tripMembers)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"transaction_id": transactionId}).
+		OrderBy("id").
+		All(&tripMembers)
 
 	return tripMembers, err
 }
+
+// QueryByTransactions reads the transactionPayments of the specified transactions from the database.
+func (r repository) QueryByTransactions(ctx context.Context, transactionIds []string) ([]entity.TransactionPayment, error) {
+	if len(transactionIds) == 0 {
+		return nil, nil
+	}
+	ids := make([]interface{}, len(transactionIds))
+	for i, id := range transactionIds {
+		ids[i] = id
+	}
+	var items []entity.TransactionPayment
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.In("transaction_id", ids...)).
+		OrderBy("id").
+		All(&items)
+	return items, err
+}
+
+// QueryByUser reads the transactionPayments made from or to the specified user from the database.
+func (r repository) QueryByUser(ctx context.Context, userId string) ([]entity.TransactionPayment, error) {
+	var items []entity.TransactionPayment
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.Or(dbx.HashExp{"user_from_id": userId}, dbx.HashExp{"user_to_id": userId})).
+		OrderBy("created_at").
+		All(&items)
+	return items, err
+}
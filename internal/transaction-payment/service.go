@@ -2,20 +2,34 @@ package transactionPayment
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"time"
+	"tribbie/internal/activity"
+	"tribbie/internal/auth"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/tripguard"
+	"tribbie/internal/webhook"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	User "tribbie/internal/user"
 )
 
 // Service encapsulates usecase logic for transactionPayments.
 type Service interface {
 	Get(ctx context.Context, id string) (TransactionPayment, error)
-	Query(ctx context.Context, offset, limit int) ([]TransactionPayment, error)
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionPayment, error)
 	QueryByTrip(ctx context.Context, tripId string) ([]TransactionPayment, error)
+	QueryByUser(ctx context.Context, userId string) ([]TransactionPayment, error)
 	QueryByTransaction(ctx context.Context, tripId string) ([]TransactionPayment, error)
-	Count(ctx context.Context) (int, error)
+	QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionPayment, error)
+	Count(ctx context.Context, options listing.Options) (int, error)
 	Create(ctx context.Context, input CreateTransactionPaymentRequest) (TransactionPayment, error)
 	Update(ctx context.Context, id string, input UpdateTransactionPaymentRequest) (TransactionPayment, error)
 	Delete(ctx context.Context, id string) (TransactionPayment, error)
@@ -34,6 +48,7 @@ type CreateTransactionPaymentRequest struct {
 	UserToId      string `json:"user_to_id"`
 	Status        string `json:"status"`
 	Nominal       int64  `json:"nominal"`
+	Currency      string `json:"currency"`
 }
 
 // Validate validates the CreateTransactionPaymentRequest fields.
@@ -42,6 +57,8 @@ func (m CreateTransactionPaymentRequest) Validate() error {
 		validation.Field(&m.TripId, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.TransactionId, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.Nominal, validation.Required),
+		validation.Field(&m.Currency, validation.Length(3, 3)),
+		validation.Field(&m.Status, validation.In(entity.PaymentStatusPending, entity.PaymentStatusPaid, entity.PaymentStatusConfirmed)),
 	)
 }
 
@@ -56,22 +73,33 @@ type UpdateTransactionPaymentRequest struct {
 	Nominal       int64  `json:"transaction_nominal"`
 }
 
-// Validate validates the CreateTransactionPaymentRequest fields.
+// Validate validates the UpdateTransactionPaymentRequest fields.
 func (m UpdateTransactionPaymentRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.TripId, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.TransactionId, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Status, validation.Required, validation.In(entity.PaymentStatusPending, entity.PaymentStatusPaid, entity.PaymentStatusConfirmed)),
 	)
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo                Repository
+	profileService      User.ProfileService
+	notificationService notification.Service
+	webhookService      webhook.Service
+	activityService     activity.Service
+	publisher           realtime.Publisher
+	logger              log.Logger
 }
 
 // NewService creates a new transactionPayment service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The profile service provides the preferred currency of the user receiving a payment.
+// The notification service informs the payer and the recipient when the status of a payment changes, and the
+// webhook service delivers the payment.confirmed event.
+// The activity service records the changes in the feed of the trip.
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, profileService User.ProfileService, notificationService notification.Service, webhookService webhook.Service, activityService activity.Service, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, profileService, notificationService, webhookService, activityService, publisher, logger}
 }
 
 // Get returns the transactionPayment with the specified the transactionPayment ID.
@@ -84,10 +112,27 @@ func (s service) Get(ctx context.Context, id string) (TransactionPayment, error)
 }
 
 // Create creates a new transactionPayment.
+// The currency defaults to the preferred currency of the user receiving the payment.
 func (s service) Create(ctx context.Context, req CreateTransactionPaymentRequest) (TransactionPayment, error) {
 	if err := req.Validate(); err != nil {
 		return TransactionPayment{}, err
 	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "payments"); err != nil {
+		return TransactionPayment{}, err
+	}
+	if err := checkConfirm(ctx, req.Status, "", req.UserToId); err != nil {
+		return TransactionPayment{}, err
+	}
+	if req.Status == "" {
+		req.Status = entity.PaymentStatusPending
+	}
+	if req.Currency == "" && req.UserToId != "" {
+		profile, err := s.profileService.Get(ctx, req.UserToId)
+		if err != nil && err != sql.ErrNoRows {
+			return TransactionPayment{}, err
+		}
+		req.Currency = profile.PreferredCurrency
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 	err := s.repo.Create(ctx, entity.TransactionPayment{
@@ -98,6 +143,7 @@ func (s service) Create(ctx context.Context, req CreateTransactionPaymentRequest
 		UserFromId:    req.UserFromId,
 		UserToId:      req.UserToId,
 		Nominal:       req.Nominal,
+		Currency:      req.Currency,
 		Status:        req.Status,
 		CreatedAt:     now,
 		UpdatedAt:     now,
@@ -105,7 +151,13 @@ func (s service) Create(ctx context.Context, req CreateTransactionPaymentRequest
 	if err != nil {
 		return TransactionPayment{}, err
 	}
-	return s.Get(ctx, id)
+	transactionPayment, err := s.Get(ctx, id)
+	if err != nil {
+		return TransactionPayment{}, err
+	}
+	s.statusChanged(ctx, transactionPayment)
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionPayment.TripId, "payment", realtime.Created, transactionPayment.TransactionPayment))
+	return transactionPayment, nil
 }
 
 // Update updates the transactionPayment with the specified ID.
@@ -118,6 +170,16 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionPay
 	if err != nil {
 		return transactionPayment, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionPayment.TripId, "payments"); err != nil {
+		return TransactionPayment{}, err
+	}
+	if err := tripguard.CheckTarget(ctx, s.repo, req.TripId, req.TransactionId, "payments"); err != nil {
+		return TransactionPayment{}, err
+	}
+	if err := checkConfirm(ctx, req.Status, transactionPayment.Status, transactionPayment.UserToId); err != nil {
+		return TransactionPayment{}, err
+	}
+	previousStatus := transactionPayment.Status
 	transactionPayment.TripId = req.TripId
 	transactionPayment.TripMemberId = req.TripMemberId
 	transactionPayment.TransactionId = req.TransactionId
@@ -130,29 +192,91 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionPay
 	if err := s.repo.Update(ctx, transactionPayment.TransactionPayment); err != nil {
 		return transactionPayment, err
 	}
+	if transactionPayment.Status != previousStatus {
+		s.statusChanged(ctx, transactionPayment)
+	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionPayment.TripId, "payment", realtime.Updated, transactionPayment.TransactionPayment))
 	return transactionPayment, nil
 }
 
+// statusChanged informs the party of the payment who has to act next: the payer when a payment is requested or
+// confirmed, and the recipient when the payer reports it as paid. Confirmed payments are also published to webhooks,
+// and paid or confirmed payments are recorded in the feed of the trip.
+func (s service) statusChanged(ctx context.Context, payment TransactionPayment) {
+	if payment.IsConfirmed() {
+		s.webhookService.Publish(ctx, entity.WebhookEventPaymentConfirmed, payment.TripId, payment.TransactionPayment)
+	}
+	s.record(ctx, payment)
+	amount := fmt.Sprintf("%v %v", payment.Nominal, payment.Currency)
+	req := notification.NotifyRequest{TripId: payment.TripId, SubjectId: payment.ID}
+	switch payment.Status {
+	case entity.PaymentStatusPending:
+		req.UserId, req.Kind, req.Title = payment.UserFromId, entity.NotificationPaymentRequested, "Payment requested"
+		req.Body = fmt.Sprintf("You were asked to pay %v.", amount)
+	case entity.PaymentStatusPaid:
+		req.UserId, req.Kind, req.Title = payment.UserToId, entity.NotificationPaymentSent, "Payment sent"
+		req.Body = fmt.Sprintf("A payment of %v was sent to you. Please confirm it once received.", amount)
+	case entity.PaymentStatusConfirmed:
+		req.UserId, req.Kind, req.Title = payment.UserFromId, entity.NotificationPaymentConfirmed, "Payment confirmed"
+		req.Body = fmt.Sprintf("Your payment of %v was confirmed.", amount)
+	default:
+		return
+	}
+	s.notificationService.Notify(ctx, req)
+}
+
+// record adds payments reported as paid or confirmed to the feed of their trip.
+func (s service) record(ctx context.Context, payment TransactionPayment) {
+	amount := activity.FormatAmount(payment.Nominal, payment.Currency)
+	req := activity.RecordRequest{TripId: payment.TripId, SubjectId: payment.ID}
+	switch payment.Status {
+	case entity.PaymentStatusPaid:
+		req.Kind, req.UserId = entity.ActivityPaymentPaid, payment.UserToId
+		req.Summary = fmt.Sprintf("paid %v to {user}", amount)
+	case entity.PaymentStatusConfirmed:
+		req.Kind, req.UserId = entity.ActivityPaymentConfirmed, payment.UserFromId
+		req.Summary = fmt.Sprintf("confirmed payment from {user} — %v", amount)
+	default:
+		return
+	}
+	s.activityService.Record(ctx, req)
+}
+
 // Delete deletes the transactionPayment with the specified ID.
 func (s service) Delete(ctx context.Context, id string) (TransactionPayment, error) {
 	transactionPayment, err := s.Get(ctx, id)
 	if err != nil {
 		return TransactionPayment{}, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transactionPayment.TripId, "payments"); err != nil {
+		return TransactionPayment{}, err
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return TransactionPayment{}, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(transactionPayment.TripId, "payment", realtime.Deleted, transactionPayment.TransactionPayment))
 	return transactionPayment, nil
 }
 
-// Count returns the number of transactionPayments.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// checkConfirm returns an error if a payment is being confirmed by someone other than its recipient.
+func checkConfirm(ctx context.Context, status, previousStatus, userToId string) error {
+	if status != entity.PaymentStatusConfirmed || previousStatus == entity.PaymentStatusConfirmed {
+		return nil
+	}
+	if identity := auth.CurrentUserDefault(ctx); identity == nil || identity.GetID() != userToId {
+		return errors.Forbidden("Only the recipient can confirm a payment.")
+	}
+	return nil
 }
 
-// Query returns the transactionPayments with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]TransactionPayment, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Count returns the number of transactionPayments matching the filter.
+func (s service) Count(ctx context.Context, options listing.Options) (int, error) {
+	return s.repo.Count(ctx, options)
+}
+
+// Query returns the transactionPayments matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TransactionPayment, error) {
+	items, err := s.repo.Query(ctx, options, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -188,3 +312,29 @@ func (s service) QueryByTransaction(ctx context.Context, transactionId string) (
 	}
 	return result, nil
 }
+
+// QueryByTransactions returns the transactionPayments of the specified transactions.
+func (s service) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionPayment, error) {
+	items, err := s.repo.QueryByTransactions(ctx, transactionIds)
+	if err != nil {
+		return nil, err
+	}
+	result := []TransactionPayment{}
+	for _, item := range items {
+		result = append(result, TransactionPayment{item})
+	}
+	return result, nil
+}
+
+// QueryByUser returns the transactionPayments made from or to the specified user.
+func (s service) QueryByUser(ctx context.Context, userId string) ([]TransactionPayment, error) {
+	items, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := []TransactionPayment{}
+	for _, item := range items {
+		result = append(result, TransactionPayment{item})
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package transactionPayment
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateTransactionPaymentRequest_Validate(t *testing.T) {
+	req := UpdateTransactionPaymentRequest{TripId: "trip", TransactionId: "t1", Status: entity.PaymentStatusPaid}
+	assert.Nil(t, req.Validate())
+	req.Status = "refunded"
+	assert.NotNil(t, req.Validate())
+	req.Status = ""
+	assert.NotNil(t, req.Validate())
+}
+
+func Test_checkConfirm(t *testing.T) {
+	alice := auth.WithUserDefault(context.Background(), "alice", "")
+	bob := auth.WithUserDefault(context.Background(), "bob", "")
+
+	assert.Nil(t, checkConfirm(bob, entity.PaymentStatusPaid, entity.PaymentStatusPending, "alice"))
+	assert.Nil(t, checkConfirm(alice, entity.PaymentStatusConfirmed, entity.PaymentStatusPaid, "alice"))
+	// a payment that is already confirmed can be edited by the other party
+	assert.Nil(t, checkConfirm(bob, entity.PaymentStatusConfirmed, entity.PaymentStatusConfirmed, "alice"))
+
+	for _, ctx := range []context.Context{bob, context.Background()} {
+		err := checkConfirm(ctx, entity.PaymentStatusConfirmed, entity.PaymentStatusPaid, "alice")
+		if assert.IsType(t, errors.ErrorResponse{}, err) {
+			assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+		}
+	}
+}
@@ -3,6 +3,8 @@ package transaction
 import (
 	"net/http"
 	"tribbie/internal/errors"
+	"tribbie/internal/tripguard"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
@@ -11,6 +13,7 @@ import (
 	TransactionExpenses "tribbie/internal/transaction-expenses"
 	TransactionItem "tribbie/internal/transaction-item"
 	TransactionPayment "tribbie/internal/transaction-payment"
+	TripMember "tribbie/internal/trip-member"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
@@ -20,18 +23,20 @@ func RegisterHandlers(
 	transactionItemService TransactionItem.Service,
 	transactionPaymentService TransactionPayment.Service,
 	transactionExpensesService TransactionExpenses.Service,
+	tripMemberService TripMember.Service,
+	expander Expander,
 	authHandler routing.Handler,
 	logger log.Logger) {
-	res := resource{service, transactionItemService, transactionPaymentService, transactionExpensesService, logger}
-
-	r.Get("/transactions/<id>", res.get)
-	r.Get("/transactions", res.query)
-	r.Get("/transactions/<id>/transaction-items", res.queryItemList)
-	r.Get("/transactions/<id>/transaction-expenses", res.queryExpensesList)
-	r.Get("/transactions/<id>/transaction-payments", res.queryPaymentList)
-	r.Post("/transactions", res.create)
-	r.Put("/transactions/<id>", res.update)
-	r.Delete("/transactions/<id>", res.delete)
+	res := resource{service, transactionItemService, transactionPaymentService, transactionExpensesService, tripMemberService, expander, logger}
+
+	r.Get("/transactions/<id>", authHandler, res.get)
+	r.Get("/transactions", authHandler, res.query)
+	r.Get("/transactions/<id>/transaction-items", authHandler, res.queryItemList)
+	r.Get("/transactions/<id>/transaction-expenses", authHandler, res.queryExpensesList)
+	r.Get("/transactions/<id>/transaction-payments", authHandler, res.queryPaymentList)
+	r.Post("/transactions", authHandler, res.create)
+	r.Put("/transactions/<id>", authHandler, res.update)
+	r.Delete("/transactions/<id>", authHandler, res.delete)
 }
 
 type resource struct {
@@ -39,58 +44,144 @@ type resource struct {
 	transactionItemService     TransactionItem.Service
 	transactionPaymentService  TransactionPayment.Service
 	transactionExpensesService TransactionExpenses.Service
+	tripMemberService          TripMember.Service
+	expander                   Expander
 	logger                     log.Logger
 }
 
+// get returns a transaction with the relations listed in the expand query parameter to a member of its trip.
 func (r resource) get(c *routing.Context) error {
-	transaction, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	relations, err := ParseExpand(c.Query(ExpandVar))
+	if err != nil {
+		return err
+	}
+	transaction, err := r.getVisible(c)
+	if err != nil {
+		return err
+	}
+	expanded, err := r.expander.Expand(c.Request.Context(), []Transaction{transaction}, relations)
 	if err != nil {
 		return err
 	}
 
-	return c.Write(transaction)
+	return c.Write(expanded[0])
+}
+
+// getVisible returns the transaction with the ID in the path if the current user is a member of its trip.
+func (r resource) getVisible(c *routing.Context) (Transaction, error) {
+	transaction, err := r.service.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return Transaction{}, err
+	}
+	if err := tripguard.CheckMember(c.Request.Context(), r.tripMemberService, transaction.TripId); err != nil {
+		return Transaction{}, err
+	}
+	return transaction, nil
 }
 
+// queryItemList returns a page of the items of a transaction.
 func (r resource) queryItemList(c *routing.Context) error {
-	trip, err := r.transactionItemService.QueryByTransaction(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if _, err := r.getVisible(c); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionItem.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("transaction_id", c.Param("id"))
+	count, err := r.transactionItemService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	items, err := r.transactionItemService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = items
+	pages.NextCursor = options.NextCursor(items, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryExpensesList returns a page of the expenses of a transaction.
 func (r resource) queryExpensesList(c *routing.Context) error {
-	trip, err := r.transactionExpensesService.QueryByTransaction(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if _, err := r.getVisible(c); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionExpenses.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("transaction_id", c.Param("id"))
+	count, err := r.transactionExpensesService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	expenses, err := r.transactionExpensesService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = expenses
+	pages.NextCursor = options.NextCursor(expenses, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryPaymentList returns a page of the payments of a transaction.
 func (r resource) queryPaymentList(c *routing.Context) error {
-	trip, err := r.transactionPaymentService.QueryByTransaction(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if _, err := r.getVisible(c); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionPayment.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("transaction_id", c.Param("id"))
+	count, err := r.transactionPaymentService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	payments, err := r.transactionPaymentService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = payments
+	pages.NextCursor = options.NextCursor(payments, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// query returns a page of the transactions of the trips of the current user.
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, QueryFields)
+	if err != nil {
+		return err
+	}
+	tripIds, err := tripguard.TripIds(ctx, r.tripMemberService)
+	if err != nil {
+		return err
+	}
+	options = options.With("trip_id", tripIds...)
+	count, err := r.service.Count(ctx, options)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	transactions, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	transactions, err := r.service.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = transactions
-	return c.Write(transactions)
+	pages.NextCursor = options.NextCursor(transactions, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
@@ -130,18 +221,3 @@ func (r resource) delete(c *routing.Context) error {
 
 	return c.Write(transaction)
 }
-
-func (r resource) queryTransactionItemList(c *routing.Context) error {
-	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
-	if err != nil {
-		return err
-	}
-	pages := pagination.NewFromRequest(c.Request, count)
-	transactions, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
-	if err != nil {
-		return err
-	}
-	pages.Items = transactions
-	return c.Write(pages)
-}
@@ -0,0 +1,197 @@
+package transaction
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	User "tribbie/internal/user"
+)
+
+// ExpandVar specifies the query parameter name listing the relations to include in the transactions, e.g. "items,payer".
+const ExpandVar = "expand"
+
+// The relations of a transaction that can be expanded.
+const (
+	ExpandItems    = "items"
+	ExpandExpenses = "expenses"
+	ExpandPayments = "payments"
+	ExpandPayer    = "payer"
+)
+
+// Expander loads the relations of transactions.
+// Each relation is loaded with a single query for all the transactions.
+type Expander interface {
+	// Expand returns the transactions with the given relations.
+	Expand(ctx context.Context, transactions []Transaction, relations []string) ([]ExpandedTransaction, error)
+}
+
+// ExpandedTransaction represents a transaction with the relations requested by the client.
+// The relations that were not requested are omitted.
+type ExpandedTransaction struct {
+	Transaction
+	Items    *[]TransactionItem.TransactionItem         `json:"items,omitempty"`
+	Expenses *[]TransactionExpenses.TransactionExpenses `json:"expenses,omitempty"`
+	Payments *[]TransactionPayment.TransactionPayment   `json:"payments,omitempty"`
+	Payer    *Payer                                     `json:"payer,omitempty"`
+}
+
+// Payer represents the user who paid a transaction as shown to the other members of the trip.
+type Payer struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarUrl   string `json:"avatar_url"`
+}
+
+// ParseExpand parses a comma-separated list of relations. Unknown relations are reported as a validation error keyed
+// by the name of the query parameter.
+func ParseExpand(value string) ([]string, error) {
+	var relations []string
+	seen := map[string]bool{}
+	for _, relation := range strings.Split(value, ",") {
+		relation = strings.TrimSpace(relation)
+		if relation == "" || seen[relation] {
+			continue
+		}
+		switch relation {
+		case ExpandItems, ExpandExpenses, ExpandPayments, ExpandPayer:
+		default:
+			return nil, validation.Errors{
+				ExpandVar: validation.NewError("validation_expand_unknown", fmt.Sprintf("cannot expand %q", relation)),
+			}
+		}
+		seen[relation] = true
+		relations = append(relations, relation)
+	}
+	return relations, nil
+}
+
+type expander struct {
+	itemService     TransactionItem.Service
+	expensesService TransactionExpenses.Service
+	paymentService  TransactionPayment.Service
+	userService     User.Service
+}
+
+// NewExpander creates a new expander loading the relations from the given services.
+func NewExpander(itemService TransactionItem.Service, expensesService TransactionExpenses.Service, paymentService TransactionPayment.Service, userService User.Service) Expander {
+	return expander{itemService, expensesService, paymentService, userService}
+}
+
+// Expand returns the transactions with the given relations, in the same order.
+func (e expander) Expand(ctx context.Context, transactions []Transaction, relations []string) ([]ExpandedTransaction, error) {
+	result := make([]ExpandedTransaction, len(transactions))
+	index := map[string]int{}
+	ids := make([]string, len(transactions))
+	for i, transaction := range transactions {
+		result[i].Transaction = transaction
+		index[transaction.ID] = i
+		ids[i] = transaction.ID
+	}
+	if len(transactions) == 0 {
+		return result, nil
+	}
+	for _, relation := range relations {
+		var err error
+		switch relation {
+		case ExpandItems:
+			err = e.expandItems(ctx, result, index, ids)
+		case ExpandExpenses:
+			err = e.expandExpenses(ctx, result, index, ids)
+		case ExpandPayments:
+			err = e.expandPayments(ctx, result, index, ids)
+		case ExpandPayer:
+			err = e.expandPayer(ctx, result)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (e expander) expandItems(ctx context.Context, result []ExpandedTransaction, index map[string]int, ids []string) error {
+	items, err := e.itemService.QueryByTransactions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range result {
+		result[i].Items = &[]TransactionItem.TransactionItem{}
+	}
+	for _, item := range items {
+		if i, ok := index[item.TransactionId]; ok {
+			*result[i].Items = append(*result[i].Items, item)
+		}
+	}
+	return nil
+}
+
+func (e expander) expandExpenses(ctx context.Context, result []ExpandedTransaction, index map[string]int, ids []string) error {
+	expenses, err := e.expensesService.QueryByTransactions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range result {
+		result[i].Expenses = &[]TransactionExpenses.TransactionExpenses{}
+	}
+	for _, expense := range expenses {
+		if i, ok := index[expense.TransactionId]; ok {
+			*result[i].Expenses = append(*result[i].Expenses, expense)
+		}
+	}
+	return nil
+}
+
+func (e expander) expandPayments(ctx context.Context, result []ExpandedTransaction, index map[string]int, ids []string) error {
+	payments, err := e.paymentService.QueryByTransactions(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range result {
+		result[i].Payments = &[]TransactionPayment.TransactionPayment{}
+	}
+	for _, payment := range payments {
+		if i, ok := index[payment.TransactionId]; ok {
+			*result[i].Payments = append(*result[i].Payments, payment)
+		}
+	}
+	return nil
+}
+
+// expandPayer loads the users who paid the transactions. Transactions without a known payer get no payer.
+func (e expander) expandPayer(ctx context.Context, result []ExpandedTransaction) error {
+	var ids []string
+	seen := map[string]bool{}
+	for _, transaction := range result {
+		if id := transaction.UserPaidId; id != "" && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	users, err := e.userService.QueryByIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+	payers := map[string]*Payer{}
+	for _, user := range users {
+		payers[user.ID] = &Payer{
+			ID:          user.ID,
+			Username:    user.Username,
+			DisplayName: user.DisplayName,
+			AvatarUrl:   user.AvatarUrl,
+		}
+	}
+	for i := range result {
+		result[i].Payer = payers[result[i].UserPaidId]
+	}
+	return nil
+}
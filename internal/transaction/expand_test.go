@@ -0,0 +1,123 @@
+package transaction
+
+import (
+	"context"
+	"testing"
+	"tribbie/internal/entity"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+
+	TransactionExpenses "tribbie/internal/transaction-expenses"
+	TransactionItem "tribbie/internal/transaction-item"
+	TransactionPayment "tribbie/internal/transaction-payment"
+	User "tribbie/internal/user"
+)
+
+func TestParseExpand(t *testing.T) {
+	relations, err := ParseExpand("")
+	assert.Nil(t, err)
+	assert.Empty(t, relations)
+
+	relations, err = ParseExpand("items, payer,items")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ExpandItems, ExpandPayer}, relations)
+
+	_, err = ParseExpand("items,trip")
+	if assert.IsType(t, validation.Errors{}, err) {
+		assert.Contains(t, err.(validation.Errors), ExpandVar)
+	}
+}
+
+func TestExpander_Expand(t *testing.T) {
+	items := &mockItemService{items: []TransactionItem.TransactionItem{
+		{TransactionItem: entity.TransactionItem{ID: "i1", TransactionId: "t1"}},
+		{TransactionItem: entity.TransactionItem{ID: "i2", TransactionId: "t1"}},
+		{TransactionItem: entity.TransactionItem{ID: "i3", TransactionId: "t2"}},
+	}}
+	expenses := &mockExpensesService{}
+	payments := &mockPaymentService{}
+	users := &mockUserService{users: []User.UserDefault{
+		{UserDefault: entity.UserDefault{ID: "u1", Username: "budi", Email: "budi@example.com"}},
+	}}
+	e := NewExpander(items, expenses, payments, users)
+	transactions := []Transaction{
+		{entity.Transaction{ID: "t1", UserPaidId: "u1"}},
+		{entity.Transaction{ID: "t2", UserPaidId: "u1"}},
+		{entity.Transaction{ID: "t3", UserPaidId: "u2"}},
+	}
+
+	result, err := e.Expand(context.Background(), transactions, nil)
+	assert.Nil(t, err)
+	if assert.Len(t, result, 3) {
+		assert.Nil(t, result[0].Items)
+		assert.Nil(t, result[0].Payer)
+	}
+	assert.Equal(t, 0, items.calls+expenses.calls+payments.calls+users.calls)
+
+	result, err = e.Expand(context.Background(), transactions, []string{ExpandItems, ExpandExpenses, ExpandPayments, ExpandPayer})
+	assert.Nil(t, err)
+	// one query per relation
+	assert.Equal(t, 1, items.calls)
+	assert.Equal(t, 1, expenses.calls)
+	assert.Equal(t, 1, payments.calls)
+	assert.Equal(t, 1, users.calls)
+	assert.Equal(t, []string{"t1", "t2", "t3"}, items.ids)
+	assert.Equal(t, []string{"u1", "u2"}, users.ids)
+	if assert.Len(t, result, 3) {
+		assert.Len(t, *result[0].Items, 2)
+		assert.Len(t, *result[1].Items, 1)
+		assert.Len(t, *result[2].Items, 0)
+		assert.Len(t, *result[2].Expenses, 0)
+		assert.Len(t, *result[2].Payments, 0)
+		assert.Equal(t, &Payer{ID: "u1", Username: "budi"}, result[0].Payer)
+		assert.Equal(t, result[0].Payer, result[1].Payer)
+		assert.Nil(t, result[2].Payer)
+	}
+}
+
+type mockItemService struct {
+	TransactionItem.Service
+	items []TransactionItem.TransactionItem
+	ids   []string
+	calls int
+}
+
+func (m *mockItemService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionItem.TransactionItem, error) {
+	m.calls++
+	m.ids = transactionIds
+	return m.items, nil
+}
+
+type mockExpensesService struct {
+	TransactionExpenses.Service
+	calls int
+}
+
+func (m *mockExpensesService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionExpenses.TransactionExpenses, error) {
+	m.calls++
+	return nil, nil
+}
+
+type mockPaymentService struct {
+	TransactionPayment.Service
+	calls int
+}
+
+func (m *mockPaymentService) QueryByTransactions(ctx context.Context, transactionIds []string) ([]TransactionPayment.TransactionPayment, error) {
+	m.calls++
+	return nil, nil
+}
+
+type mockUserService struct {
+	User.Service
+	users []User.UserDefault
+	ids   []string
+	calls int
+}
+
+func (m *mockUserService) QueryByIds(ctx context.Context, ids []string) ([]User.UserDefault, error) {
+	m.calls++
+	m.ids = ids
+	return m.users, nil
+}
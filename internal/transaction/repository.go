@@ -3,20 +3,27 @@ package transaction
 import (
 	"context"
 	"tribbie/internal/entity"
+	"tribbie/internal/tripguard"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access transactions from the data source.
 type Repository interface {
+	tripguard.Repository
 	// Get returns the transaction with the specified transaction ID.
 	Get(ctx context.Context, id string) (entity.Transaction, error)
-	// Count returns the number of transactions.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of transactions with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Transaction, error)
+	// Count returns the number of transactions matching the filter.
+	Count(ctx context.Context, options listing.Options) (int, error)
+	// Query returns the list of transactions matching the filter with the given offset and limit.
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.Transaction, error)
 	// Query returns the list of transactions with the given offset and limit.
 	QueryByTrip(ctx context.Context, tripId string) ([]entity.Transaction, error)
+	// QueryByUserPaid returns the transactions paid by the specified user.
+	QueryByUserPaid(ctx context.Context, userId string) ([]entity.Transaction, error)
 	// Create saves a new transaction in the storage.
 	Create(ctx context.Context, transaction entity.Transaction) error
 	// Update updates the transaction with given ID in the storage.
@@ -27,13 +34,14 @@ type Repository interface {
 
 // repository persists transactions in database
 type repository struct {
+	tripguard.Repository
 	db     *dbcontext.DB
 	logger log.Logger
 }
 
 // NewRepository creates a new transaction repository
 func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
-	return repository{db, logger}
+	return repository{tripguard.NewRepository(db, logger), db, logger}
 }
 
 // Get reads the transaction with the specified ID from the database.
@@ -63,19 +71,36 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&transaction).Delete()
 }
 
-// Count returns the number of the transaction records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// QueryFields lists the fields of the transactions that list requests can filter and sort by.
+var QueryFields = listing.Fields{
+	"id":             {Column: "id", Sortable: true},
+	"trip_id":        {Column: "trip_id"},
+	"user_paid_id":   {Column: "user_paid_id"},
+	"title":          {Column: "title", Sortable: true},
+	"method":         {Column: "method"},
+	"status":         {Column: "status", Sortable: true},
+	"grand_total":    {Column: "grand_total", Type: listing.Int, Sortable: true},
+	"sub_total":      {Column: "sub_total", Type: listing.Int, Sortable: true},
+	"service_charge": {Column: "service_charge", Type: listing.Int, Sortable: true},
+	"created_at":     {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at":     {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the transaction records matching the filter in the database.
+func (r repository) Count(ctx context.Context, options listing.Options) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("transaction").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("transaction").Where(options.Where()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the transaction records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Transaction, error) {
+// Query retrieves the transaction records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.Transaction, error) {
 	var transactions []entity.Transaction
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(options.Where()).
+		AndWhere(options.After()).
+		OrderBy(options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&transactions)
@@ -85,9 +110,22 @@ func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Tran
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Transaction, error) {
 	var transactions []entity.Transaction
-
-	q := r.db.DB().NewQuery("SELECT * FROM transaction WHERE trip_id='" + tripId + "'")
-	err := q.All(&transactions)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("id").
+		All(&transactions)
 
 	return transactions, err
 }
+
+// QueryByUserPaid reads the transactions paid by the specified user from the database.
+func (r repository) QueryByUserPaid(ctx context.Context, userId string) ([]entity.Transaction, error) {
+	var items []entity.Transaction
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_paid_id": userId}).
+		OrderBy("created_at").
+		All(&items)
+	return items, err
+}
@@ -2,19 +2,29 @@ package transaction
 
 import (
 	"context"
+	"fmt"
 	"time"
+	"tribbie/internal/activity"
 	"tribbie/internal/entity"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/tripguard"
+	"tribbie/internal/webhook"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+
+	TripMember "tribbie/internal/trip-member"
 )
 
 // Service encapsulates usecase logic for transactions.
 type Service interface {
 	Get(ctx context.Context, id string) (Transaction, error)
-	Query(ctx context.Context, offset, limit int) ([]Transaction, error)
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]Transaction, error)
 	QueryByTrip(ctx context.Context, tripId string) ([]Transaction, error)
-	Count(ctx context.Context) (int, error)
+	QueryByUserPaid(ctx context.Context, userId string) ([]Transaction, error)
+	Count(ctx context.Context, options listing.Options) (int, error)
 	Create(ctx context.Context, input CreateTransactionRequest) (Transaction, error)
 	Update(ctx context.Context, id string, input UpdateTransactionRequest) (Transaction, error)
 	Delete(ctx context.Context, id string) (Transaction, error)
@@ -68,13 +78,22 @@ func (m UpdateTransactionRequest) Validate() error {
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo                Repository
+	tripMemberService   TripMember.Service
+	notificationService notification.Service
+	webhookService      webhook.Service
+	activityService     activity.Service
+	publisher           realtime.Publisher
+	logger              log.Logger
 }
 
 // NewService creates a new transaction service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The notification service informs the members of a trip when its spending exceeds the budget, and the webhook
+// service delivers the transaction.created event.
+// The activity service records the changes in the feed of the trip.
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, tripMemberService TripMember.Service, notificationService notification.Service, webhookService webhook.Service, activityService activity.Service, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, tripMemberService, notificationService, webhookService, activityService, publisher, logger}
 }
 
 // Get returns the transaction with the specified the transaction ID.
@@ -91,6 +110,9 @@ func (s service) Create(ctx context.Context, req CreateTransactionRequest) (Tran
 	if err := req.Validate(); err != nil {
 		return Transaction{}, err
 	}
+	if err := tripguard.CheckTrip(ctx, s.repo, req.TripId, "transactions"); err != nil {
+		return Transaction{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 	err := s.repo.Create(ctx, entity.Transaction{
@@ -110,7 +132,15 @@ func (s service) Create(ctx context.Context, req CreateTransactionRequest) (Tran
 	if err != nil {
 		return Transaction{}, err
 	}
-	return s.Get(ctx, id)
+	transaction, err := s.Get(ctx, id)
+	if err != nil {
+		return Transaction{}, err
+	}
+	s.webhookService.Publish(ctx, entity.WebhookEventTransactionCreated, transaction.TripId, transaction.Transaction)
+	s.checkBudget(ctx, transaction.TripId, int64(transaction.GrandTotal))
+	s.record(ctx, transaction, entity.ActivityTransactionCreated, fmt.Sprintf("added %v — %v", transaction.Title, s.amount(ctx, transaction)))
+	s.publisher.Publish(ctx, realtime.NewEvent(transaction.TripId, "transaction", realtime.Created, transaction.Transaction))
+	return transaction, nil
 }
 
 // Update updates the transaction with the specified ID.
@@ -123,6 +153,13 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionReq
 	if err != nil {
 		return transaction, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transaction.TripId, "transactions"); err != nil {
+		return Transaction{}, err
+	}
+	if err := tripguard.CheckTrip(ctx, s.repo, req.TripId, "transactions"); err != nil {
+		return Transaction{}, err
+	}
+	previousTotal := transaction.GrandTotal
 	transaction.TripId = req.TripId
 	transaction.UserPaidId = req.UserPaidId
 	transaction.Title = req.Title
@@ -137,29 +174,95 @@ func (s service) Update(ctx context.Context, id string, req UpdateTransactionReq
 	if err := s.repo.Update(ctx, transaction.Transaction); err != nil {
 		return transaction, err
 	}
+	s.checkBudget(ctx, transaction.TripId, int64(transaction.GrandTotal-previousTotal))
+	s.record(ctx, transaction, entity.ActivityTransactionUpdated, fmt.Sprintf("updated %v", transaction.Title))
+	s.publisher.Publish(ctx, realtime.NewEvent(transaction.TripId, "transaction", realtime.Updated, transaction.Transaction))
 	return transaction, nil
 }
 
+// checkBudget notifies the members of the trip when a change of the given amount made the spending of the trip
+// exceed its budget. Trips without a budget are not checked.
+func (s service) checkBudget(ctx context.Context, tripId string, change int64) {
+	if tripId == "" || change <= 0 {
+		return
+	}
+	trip, err := s.repo.GetTrip(ctx, tripId)
+	if err != nil || trip.Budget <= 0 {
+		return
+	}
+	transactions, err := s.repo.QueryByTrip(ctx, tripId)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+	var spent int64
+	for _, transaction := range transactions {
+		spent += int64(transaction.GrandTotal)
+	}
+	if spent <= trip.Budget || spent-change > trip.Budget {
+		return
+	}
+	members, err := s.tripMemberService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		s.logger.With(ctx).Error(err)
+		return
+	}
+	for _, member := range members {
+		s.notificationService.Notify(ctx, notification.NotifyRequest{
+			UserId:    member.UserId,
+			Kind:      entity.NotificationBudgetExceeded,
+			TripId:    tripId,
+			SubjectId: tripId,
+			Title:     "Budget exceeded",
+			Body:      fmt.Sprintf("%v has spent %v %v of its %v %v budget.", trip.Title, spent, trip.Currency, trip.Budget, trip.Currency),
+		})
+	}
+}
+
+// record adds the change of the transaction to the feed of its trip.
+func (s service) record(ctx context.Context, transaction Transaction, kind, summary string) {
+	s.activityService.Record(ctx, activity.RecordRequest{
+		TripId:    transaction.TripId,
+		Kind:      kind,
+		SubjectId: transaction.ID,
+		Summary:   summary,
+	})
+}
+
+// amount formats the grand total of the transaction in the currency of its trip.
+func (s service) amount(ctx context.Context, transaction Transaction) string {
+	currency := ""
+	if trip, err := s.repo.GetTrip(ctx, transaction.TripId); err == nil {
+		currency = trip.Currency
+	}
+	return activity.FormatAmount(int64(transaction.GrandTotal), currency)
+}
+
 // Delete deletes the transaction with the specified ID.
 func (s service) Delete(ctx context.Context, id string) (Transaction, error) {
 	transaction, err := s.Get(ctx, id)
 	if err != nil {
 		return Transaction{}, err
 	}
+	if err := tripguard.CheckOpen(ctx, s.repo, transaction.TripId, "transactions"); err != nil {
+		return Transaction{}, err
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return Transaction{}, err
 	}
+	s.record(ctx, transaction, entity.ActivityTransactionDeleted, fmt.Sprintf("deleted %v", transaction.Title))
+	s.publisher.Publish(ctx, realtime.NewEvent(transaction.TripId, "transaction", realtime.Deleted, transaction.Transaction))
 	return transaction, nil
 }
 
-// Count returns the number of transactions.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of transactions matching the filter.
+func (s service) Count(ctx context.Context, options listing.Options) (int, error) {
+	return s.repo.Count(ctx, options)
 }
 
-// Query returns the transactions with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Transaction, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the transactions matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, options listing.Options, offset, limit int) ([]Transaction, error) {
+	items, err := s.repo.Query(ctx, options, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -182,3 +285,16 @@ func (s service) QueryByTrip(ctx context.Context, tripId string) ([]Transaction,
 	}
 	return result, nil
 }
+
+// QueryByUserPaid returns the transactions paid by the specified user.
+func (s service) QueryByUserPaid(ctx context.Context, userId string) ([]Transaction, error) {
+	items, err := s.repo.QueryByUserPaid(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := []Transaction{}
+	for _, item := range items {
+		result = append(result, Transaction{item})
+	}
+	return result, nil
+}
@@ -2,30 +2,37 @@ package tripMember
 
 import (
 	"net/http"
+	"tribbie/internal/auth"
 	"tribbie/internal/errors"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+
+	User "tribbie/internal/user"
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
-func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
-	res := resource{service, logger}
+func RegisterHandlers(r *routing.RouteGroup, service Service, profileService User.ProfileService, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, profileService, logger}
 
 	r.Get("/trip-members/<id>", res.get)
+	r.Get("/trip-members/<id>/payout", authHandler, res.getPayout)
 	r.Get("/trip-members", res.query)
 
-	// r.Use(authHandler)
+	r.Use(authHandler)
 
 	r.Post("/trip-members", res.create)
 	r.Put("/trip-members/<id>", res.update)
+	r.Post("/trip-members/<id>/invite", res.invite)
 	r.Delete("/trip-members/<id>", res.delete)
 }
 
 type resource struct {
-	service Service
-	logger  log.Logger
+	service        Service
+	profileService User.ProfileService
+	logger         log.Logger
 }
 
 func (r resource) get(c *routing.Context) error {
@@ -37,19 +44,62 @@ func (r resource) get(c *routing.Context) error {
 	return c.Write(tripMember)
 }
 
+// getPayout returns the masked payout details of a trip member to the other members of the trip.
+func (r resource) getPayout(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	tripMember, err := r.service.Get(ctx, c.Param("id"))
+	if err != nil {
+		return err
+	}
+	members, err := r.service.QueryByTrip(ctx, tripMember.TripId)
+	if err != nil {
+		return err
+	}
+	isMember := false
+	for _, member := range members {
+		if member.UserId == identity.GetID() {
+			isMember = true
+		}
+	}
+	if !isMember {
+		return errors.Forbidden("Only the members of the trip can see the payout details.")
+	}
+	if tripMember.UserId == "" {
+		return errors.NotFound("The member has no payout details.")
+	}
+	payout, err := r.profileService.GetMaskedPayout(ctx, tripMember.UserId)
+	if err != nil {
+		return err
+	}
+	if payout == nil {
+		return errors.NotFound("The member has no payout details.")
+	}
+	return c.Write(payout)
+}
+
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, QueryFields)
+	if err != nil {
+		return err
+	}
+	count, err := r.service.Count(ctx, options)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	tripMembers, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	tripMembers, err := r.service.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = tripMembers
-	return c.Write(tripMembers)
+	pages.NextCursor = options.NextCursor(tripMembers, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
@@ -81,6 +131,22 @@ func (r resource) update(c *routing.Context) error {
 	return c.Write(tripMember)
 }
 
+// invite links a member without an account to a user.
+func (r resource) invite(c *routing.Context) error {
+	var input InviteTripMemberRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	tripMember, err := r.service.Invite(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(tripMember)
+}
+
 func (r resource) delete(c *routing.Context) error {
 	tripMember, err := r.service.Delete(c.Request.Context(), c.Param("id"))
 	if err != nil {
@@ -4,7 +4,10 @@ import (
 	"context"
 	"tribbie/internal/entity"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access tripMembers from the data source.
@@ -13,16 +16,20 @@ type Repository interface {
 	Get(ctx context.Context, id string) (entity.TripMember, error)
 	// Get returns the tripMember with the specified tripMember ID.
 	QueryByTrip(ctx context.Context, tripId string) ([]entity.TripMember, error)
-	// Count returns the number of tripMembers.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of tripMembers with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.TripMember, error)
+	// Count returns the number of tripMembers matching the filter.
+	Count(ctx context.Context, options listing.Options) (int, error)
+	// Query returns the list of tripMembers matching the filter with the given offset and limit.
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TripMember, error)
+	// QueryByUser returns the trip memberships of the specified user.
+	QueryByUser(ctx context.Context, userId string) ([]entity.TripMember, error)
 	// Create saves a new tripMember in the storage.
 	Create(ctx context.Context, tripMember entity.TripMember) error
 	// Update updates the tripMember with given ID in the storage.
 	Update(ctx context.Context, tripMember entity.TripMember) error
 	// Delete removes the tripMember with given ID from the storage.
 	Delete(ctx context.Context, id string) error
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
 }
 
 // repository persists tripMembers in database
@@ -63,19 +70,32 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&tripMember).Delete()
 }
 
-// Count returns the number of the tripMember records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// QueryFields lists the fields of the trip members that list requests can filter and sort by.
+var QueryFields = listing.Fields{
+	"id":         {Column: "id", Sortable: true},
+	"trip_id":    {Column: "trip_id"},
+	"user_id":    {Column: "user_id"},
+	"name":       {Column: "name", Sortable: true},
+	"status":     {Column: "status", Sortable: true},
+	"created_at": {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at": {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the tripMember records matching the filter in the database.
+func (r repository) Count(ctx context.Context, options listing.Options) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(options.Where()).Row(&count)
 	return count, err
 }
 
-// Query retrieves the tripMember records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.TripMember, error) {
+// Query retrieves the tripMember records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, options listing.Options, offset, limit int) ([]entity.TripMember, error) {
 	var tripMembers []entity.TripMember
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(options.Where()).
+		AndWhere(options.After()).
+		OrderBy(options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&tripMembers)
@@ -85,9 +105,29 @@ func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Trip
 // Get reads the tripMember with the specified Trip ID from the database.
 func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.TripMember, error) {
 	var tripMembers []entity.TripMember
-
-	q := r.db.DB().NewQuery("SELECT * FROM trip_member WHERE trip_id='" + tripId + "'")
-	err := q.All(&tripMembers)
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"trip_id": tripId}).
+		OrderBy("id").
+		All(&tripMembers)
 
 	return tripMembers, err
 }
+
+// QueryByUser reads the trip memberships of the specified user from the database.
+func (r repository) QueryByUser(ctx context.Context, userId string) ([]entity.TripMember, error) {
+	var items []entity.TripMember
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"user_id": userId}).
+		OrderBy("created_at").
+		All(&items)
+	return items, err
+}
+
+// IsTripMember checks the trip members in database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
@@ -2,8 +2,16 @@ package tripMember
 
 import (
 	"context"
+	"fmt"
 	"time"
+	"tribbie/internal/activity"
+	"tribbie/internal/auth"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/webhook"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -12,11 +20,13 @@ import (
 // Service encapsulates usecase logic for tripMembers.
 type Service interface {
 	Get(ctx context.Context, id string) (TripMember, error)
-	Query(ctx context.Context, offset, limit int) ([]TripMember, error)
+	Query(ctx context.Context, options listing.Options, offset, limit int) ([]TripMember, error)
 	QueryByTrip(ctx context.Context, tripId string) ([]TripMember, error)
-	Count(ctx context.Context) (int, error)
+	QueryByUser(ctx context.Context, userId string) ([]TripMember, error)
+	Count(ctx context.Context, options listing.Options) (int, error)
 	Create(ctx context.Context, input CreateTripMemberRequest) (TripMember, error)
 	Update(ctx context.Context, id string, input UpdateTripMemberRequest) (TripMember, error)
+	Invite(ctx context.Context, id string, input InviteTripMemberRequest) (TripMember, error)
 	Delete(ctx context.Context, id string) (TripMember, error)
 }
 
@@ -42,7 +52,8 @@ func (m CreateTripMemberRequest) Validate() error {
 	)
 }
 
-// UpdateTripMemberRequest represents an tripMember update request.
+// UpdateTripMemberRequest represents an tripMember update request. The user of a member cannot change,
+// members without an account are linked to a user by an invite instead.
 type UpdateTripMemberRequest struct {
 	TripId string `json:"trip_id"`
 	UserId string `json:"user_id"`
@@ -50,23 +61,43 @@ type UpdateTripMemberRequest struct {
 	Status string `json:"status"`
 }
 
-// Validate validates the CreateTripMemberRequest fields.
+// Validate validates the UpdateTripMemberRequest fields.
 func (m UpdateTripMemberRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.TripId, validation.Required, validation.Length(0, 128)),
-		validation.Field(&m.UserId, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.UserId, validation.Length(0, 128)),
 		validation.Field(&m.Name, validation.Required, validation.Length(0, 128)),
 	)
 }
 
+// InviteTripMemberRequest represents a request linking a member without an account to a user.
+type InviteTripMemberRequest struct {
+	UserId string `json:"user_id"`
+}
+
+// Validate validates the InviteTripMemberRequest fields.
+func (m InviteTripMemberRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.UserId, validation.Required, validation.Length(0, 128)),
+	)
+}
+
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo                Repository
+	notificationService notification.Service
+	webhookService      webhook.Service
+	activityService     activity.Service
+	publisher           realtime.Publisher
+	logger              log.Logger
 }
 
 // NewService creates a new tripMember service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The notification service informs users when they are added to a trip, and the webhook service delivers
+// the member.joined event.
+// The activity service records the changes in the feed of the trip.
+// The publisher streams the changes to the members of the trip.
+func NewService(repo Repository, notificationService notification.Service, webhookService webhook.Service, activityService activity.Service, publisher realtime.Publisher, logger log.Logger) Service {
+	return service{repo, notificationService, webhookService, activityService, publisher, logger}
 }
 
 // Get returns the tripMember with the specified the tripMember ID.
@@ -78,11 +109,14 @@ func (s service) Get(ctx context.Context, id string) (TripMember, error) {
 	return TripMember{tripMember}, nil
 }
 
-// Create creates a new tripMember.
+// Create creates a new tripMember. Only the members of the trip can add members to it.
 func (s service) Create(ctx context.Context, req CreateTripMemberRequest) (TripMember, error) {
 	if err := req.Validate(); err != nil {
 		return TripMember{}, err
 	}
+	if err := s.checkMember(ctx, req.TripId); err != nil {
+		return TripMember{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
 	err := s.repo.Create(ctx, entity.TripMember{
@@ -91,16 +125,25 @@ func (s service) Create(ctx context.Context, req CreateTripMemberRequest) (TripM
 		UserId:    req.UserId,
 		Name:      req.Name,
 		Status:    req.Status,
+		Role:      entity.TripMemberRoleMember,
 		CreatedAt: now,
 		UpdatedAt: now,
 	})
 	if err != nil {
 		return TripMember{}, err
 	}
-	return s.Get(ctx, id)
+	tripMember, err := s.Get(ctx, id)
+	if err != nil {
+		return TripMember{}, err
+	}
+	s.joined(ctx, tripMember)
+	s.added(ctx, tripMember)
+	s.publisher.Publish(ctx, realtime.NewEvent(tripMember.TripId, "member", realtime.Created, tripMember.TripMember))
+	return tripMember, nil
 }
 
-// Update updates the tripMember with the specified ID.
+// Update updates the tripMember with the specified ID. Only the members of the trip can change its members,
+// and neither the trip nor the user of a member can change.
 func (s service) Update(ctx context.Context, id string, req UpdateTripMemberRequest) (TripMember, error) {
 	if err := req.Validate(); err != nil {
 		return TripMember{}, err
@@ -110,8 +153,15 @@ func (s service) Update(ctx context.Context, id string, req UpdateTripMemberRequ
 	if err != nil {
 		return tripMember, err
 	}
-	tripMember.TripId = req.TripId
-	tripMember.UserId = req.UserId
+	if err := s.checkMember(ctx, tripMember.TripId); err != nil {
+		return TripMember{}, err
+	}
+	if req.TripId != tripMember.TripId {
+		return TripMember{}, errors.BadRequest("A member cannot move to another trip.")
+	}
+	if req.UserId != "" && req.UserId != tripMember.UserId {
+		return TripMember{}, errors.BadRequest("The user of a member cannot change. Invite a user to a member without an account instead.")
+	}
 	tripMember.Name = req.Name
 	tripMember.Status = req.Status
 	tripMember.UpdatedAt = time.Now()
@@ -119,29 +169,122 @@ func (s service) Update(ctx context.Context, id string, req UpdateTripMemberRequ
 	if err := s.repo.Update(ctx, tripMember.TripMember); err != nil {
 		return tripMember, err
 	}
+	s.publisher.Publish(ctx, realtime.NewEvent(tripMember.TripId, "member", realtime.Updated, tripMember.TripMember))
 	return tripMember, nil
 }
 
-// Delete deletes the tripMember with the specified ID.
+// Invite links the tripMember with the specified ID, which has no account yet, to a user.
+// Only the members of the trip can invite users to it.
+func (s service) Invite(ctx context.Context, id string, req InviteTripMemberRequest) (TripMember, error) {
+	if err := req.Validate(); err != nil {
+		return TripMember{}, err
+	}
+
+	tripMember, err := s.Get(ctx, id)
+	if err != nil {
+		return tripMember, err
+	}
+	if err := s.checkMember(ctx, tripMember.TripId); err != nil {
+		return TripMember{}, err
+	}
+	if tripMember.UserId != "" {
+		return TripMember{}, errors.Conflict("The member is already linked to a user.")
+	}
+	isMember, err := s.repo.IsTripMember(ctx, tripMember.TripId, req.UserId)
+	if err != nil {
+		return TripMember{}, err
+	}
+	if isMember {
+		return TripMember{}, errors.Conflict("The user is already a member of the trip.")
+	}
+	tripMember.UserId = req.UserId
+	tripMember.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, tripMember.TripMember); err != nil {
+		return tripMember, err
+	}
+	s.joined(ctx, tripMember)
+	s.publisher.Publish(ctx, realtime.NewEvent(tripMember.TripId, "member", realtime.Updated, tripMember.TripMember))
+	return tripMember, nil
+}
+
+// checkMember returns an error unless the current user is a member of the trip.
+func (s service) checkMember(ctx context.Context, tripId string) error {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	isMember, err := s.repo.IsTripMember(ctx, tripId, identity.GetID())
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return errors.Forbidden("Only the members of the trip can change its members.")
+	}
+	return nil
+}
+
+// joined informs the user linked to the trip member that they were added to the trip and publishes the
+// member.joined event. Members without an account have not joined yet.
+func (s service) joined(ctx context.Context, tripMember TripMember) {
+	if tripMember.UserId == "" {
+		return
+	}
+	s.webhookService.Publish(ctx, entity.WebhookEventMemberJoined, tripMember.TripId, tripMember.TripMember)
+	s.notificationService.Notify(ctx, notification.NotifyRequest{
+		UserId:    tripMember.UserId,
+		Kind:      entity.NotificationTripMemberAdded,
+		TripId:    tripMember.TripId,
+		SubjectId: tripMember.ID,
+		Title:     "Added to a trip",
+		Body:      fmt.Sprintf("You were added to a trip as %v.", tripMember.Name),
+	})
+}
+
+// added records the new member in the feed of the trip. Users adding themselves are recorded as joining it.
+func (s service) added(ctx context.Context, tripMember TripMember) {
+	summary := fmt.Sprintf("added %v to the trip", tripMember.Name)
+	if identity := auth.CurrentUserDefault(ctx); identity != nil && tripMember.UserId != "" && identity.GetID() == tripMember.UserId {
+		summary = "joined the trip"
+	}
+	s.activityService.Record(ctx, activity.RecordRequest{
+		TripId:    tripMember.TripId,
+		Kind:      entity.ActivityMemberAdded,
+		SubjectId: tripMember.ID,
+		Summary:   summary,
+	})
+}
+
+// Delete deletes the tripMember with the specified ID. Only the members of the trip can remove its members.
 func (s service) Delete(ctx context.Context, id string) (TripMember, error) {
 	tripMember, err := s.Get(ctx, id)
 	if err != nil {
 		return TripMember{}, err
 	}
+	if err := s.checkMember(ctx, tripMember.TripId); err != nil {
+		return TripMember{}, err
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return TripMember{}, err
 	}
+	s.activityService.Record(ctx, activity.RecordRequest{
+		TripId:    tripMember.TripId,
+		Kind:      entity.ActivityMemberRemoved,
+		SubjectId: tripMember.ID,
+		Summary:   fmt.Sprintf("removed %v from the trip", tripMember.Name),
+	})
+	s.publisher.Publish(ctx, realtime.NewEvent(tripMember.TripId, "member", realtime.Deleted, tripMember.TripMember))
 	return tripMember, nil
 }
 
-// Count returns the number of tripMembers.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// Count returns the number of tripMembers matching the filter.
+func (s service) Count(ctx context.Context, options listing.Options) (int, error) {
+	return s.repo.Count(ctx, options)
 }
 
-// Query returns the tripMembers with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]TripMember, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the tripMembers matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, options listing.Options, offset, limit int) ([]TripMember, error) {
+	items, err := s.repo.Query(ctx, options, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -164,3 +307,16 @@ func (s service) QueryByTrip(ctx context.Context, tripId string) ([]TripMember,
 	}
 	return result, nil
 }
+
+// QueryByUser returns the trip memberships of the specified user.
+func (s service) QueryByUser(ctx context.Context, userId string) ([]TripMember, error) {
+	items, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := []TripMember{}
+	for _, item := range items {
+		result = append(result, TripMember{item})
+	}
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package tripMember
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"tribbie/internal/activity"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/internal/notification"
+	"tribbie/internal/realtime"
+	"tribbie/internal/webhook"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_membership(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.TripMember{
+		{ID: "m1", TripId: "bali", UserId: "alice", Name: "Alice"},
+		{ID: "m2", TripId: "bali", Name: "Bob"},
+		{ID: "m3", TripId: "lombok", UserId: "carol", Name: "Carol"},
+	}}
+	notifier := &mockNotifier{}
+	s := NewService(repo, notifier, mockWebhooks{}, mockActivities{}, mockPublisher{}, logger)
+	alice := auth.WithUserDefault(context.Background(), "alice", "")
+	mallory := auth.WithUserDefault(context.Background(), "mallory", "")
+
+	assertStatus := func(t *testing.T, status int, err error) {
+		if assert.IsType(t, errors.ErrorResponse{}, err) {
+			assert.Equal(t, status, err.(errors.ErrorResponse).StatusCode())
+		}
+	}
+
+	// outsiders can neither join nor change the members of a trip
+	_, err := s.Create(mallory, CreateTripMemberRequest{TripId: "bali", UserId: "mallory", Name: "Mallory"})
+	assertStatus(t, http.StatusForbidden, err)
+	_, err = s.Update(mallory, "m2", UpdateTripMemberRequest{TripId: "bali", Name: "Bob"})
+	assertStatus(t, http.StatusForbidden, err)
+	_, err = s.Invite(mallory, "m2", InviteTripMemberRequest{UserId: "mallory"})
+	assertStatus(t, http.StatusForbidden, err)
+	_, err = s.Delete(mallory, "m1")
+	assertStatus(t, http.StatusForbidden, err)
+	_, err = s.Create(context.Background(), CreateTripMemberRequest{TripId: "bali", Name: "Dave"})
+	assertStatus(t, http.StatusUnauthorized, err)
+
+	// the user of a member only changes through an invite
+	_, err = s.Update(alice, "m2", UpdateTripMemberRequest{TripId: "bali", UserId: "mallory", Name: "Bob"})
+	assertStatus(t, http.StatusBadRequest, err)
+	_, err = s.Update(alice, "m2", UpdateTripMemberRequest{TripId: "lombok", Name: "Bob"})
+	assertStatus(t, http.StatusBadRequest, err)
+	member, err := s.Update(alice, "m2", UpdateTripMemberRequest{TripId: "bali", Name: "Bobby"})
+	assert.Nil(t, err)
+	assert.Equal(t, "Bobby", member.Name)
+	assert.Equal(t, "", member.UserId)
+
+	_, err = s.Invite(alice, "m1", InviteTripMemberRequest{UserId: "bob"})
+	assertStatus(t, http.StatusConflict, err)
+	_, err = s.Invite(alice, "m2", InviteTripMemberRequest{UserId: "alice"})
+	assertStatus(t, http.StatusConflict, err)
+	member, err = s.Invite(alice, "m2", InviteTripMemberRequest{UserId: "bob"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", member.UserId)
+	if assert.Len(t, notifier.requests, 1) {
+		assert.Equal(t, "bob", notifier.requests[0].UserId)
+	}
+
+	member, err = s.Create(alice, CreateTripMemberRequest{TripId: "bali", Name: "Dave"})
+	assert.Nil(t, err)
+	assert.Equal(t, "bali", member.TripId)
+	_, err = s.Delete(alice, member.ID)
+	assert.Nil(t, err)
+}
+
+type mockRepository struct {
+	Repository
+	items []entity.TripMember
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.TripMember, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.TripMember{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Create(ctx context.Context, tripMember entity.TripMember) error {
+	m.items = append(m.items, tripMember)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, tripMember entity.TripMember) error {
+	for i, item := range m.items {
+		if item.ID == tripMember.ID {
+			m.items[i] = tripMember
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, item := range m.items {
+		if item.ID == id {
+			m.items = append(m.items[:i], m.items[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	for _, item := range m.items {
+		if item.TripId == tripId && item.UserId == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type mockNotifier struct {
+	notification.Service
+	requests []notification.NotifyRequest
+}
+
+func (m *mockNotifier) Notify(ctx context.Context, req notification.NotifyRequest) {
+	m.requests = append(m.requests, req)
+}
+
+type mockWebhooks struct {
+	webhook.Service
+}
+
+func (mockWebhooks) Publish(ctx context.Context, event, tripId string, data interface{}) {}
+
+type mockActivities struct {
+	activity.Service
+}
+
+func (mockActivities) Record(ctx context.Context, req activity.RecordRequest) {}
+
+type mockPublisher struct{}
+
+func (mockPublisher) Publish(ctx context.Context, event realtime.Event) {}
@@ -2,7 +2,13 @@ package trip
 
 import (
 	"net/http"
+	"strings"
+	"time"
+	"tribbie/internal/auth"
 	"tribbie/internal/errors"
+	"tribbie/internal/realtime"
+	"tribbie/internal/tripguard"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"tribbie/pkg/pagination"
 
@@ -24,20 +30,24 @@ func RegisterHandlers(
 	transactionItemService TransactionItem.Service,
 	transactionExpenseservice TransactionExpenses.Service,
 	transactionPaymentService TransactionPayment.Service,
+	transactionExpander Transaction.Expander,
+	hub *realtime.Hub,
 	authHandler routing.Handler,
 	logger log.Logger) {
-	res := resource{service, tripMemberService, transactionService, transactionItemService, transactionExpenseservice, transactionPaymentService, logger}
-
-	r.Get("/trips/<id>", res.get)
-	r.Get("/trips/<id>/trip-members", res.queryMemberList)
-	r.Get("/trips/<id>/transactions", res.queryTransactionList)
-	r.Get("/trips/<id>/transaction-items", res.queryTransactionItemList)
-	r.Get("/trips/<id>/transaction-expenses", res.queryTransactionExpensesList)
-	r.Get("/trips/<id>/transaction-payments", res.queryTransactionPaymentList)
-	r.Get("/trips", res.query)
-	r.Post("/trips", res.create)
-	r.Put("/trips/<id>", res.update)
-	r.Delete("/trips/<id>", res.delete)
+	res := resource{service, tripMemberService, transactionService, transactionItemService, transactionExpenseservice, transactionPaymentService, transactionExpander, hub, logger}
+
+	r.Get("/trips/<id>", authHandler, res.get)
+	r.Get("/trips/<id>/trip-members", authHandler, res.queryMemberList)
+	r.Get("/trips/<id>/transactions", authHandler, res.queryTransactionList)
+	r.Get("/trips/<id>/transaction-items", authHandler, res.queryTransactionItemList)
+	r.Get("/trips/<id>/transaction-expenses", authHandler, res.queryTransactionExpensesList)
+	r.Get("/trips/<id>/transaction-payments", authHandler, res.queryTransactionPaymentList)
+	r.Get("/trips/<id>/events", authHandler, res.events)
+	r.Get("/trips", authHandler, res.query)
+	r.Post("/trips", authHandler, res.create)
+	r.Put("/trips/<id>", authHandler, res.update)
+	r.Put("/trips/<id>/status", authHandler, res.changeStatus)
+	r.Delete("/trips/<id>", authHandler, res.delete)
 }
 
 type resource struct {
@@ -47,10 +57,19 @@ type resource struct {
 	transactionItemService    TransactionItem.Service
 	TransactionExpenseservice TransactionExpenses.Service
 	transactionPaymentService TransactionPayment.Service
+	transactionExpander       Transaction.Expander
+	hub                       *realtime.Hub
 	logger                    log.Logger
 }
 
+// heartbeat is the interval of the comments keeping an idle event stream open.
+const heartbeat = 25 * time.Second
+
+// get returns a trip to one of its members.
 func (r resource) get(c *routing.Context) error {
+	if err := tripguard.CheckMember(c.Request.Context(), r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
 	trip, err := r.service.Get(c.Request.Context(), c.Param("id"))
 	if err != nil {
 		return err
@@ -59,64 +78,198 @@ func (r resource) get(c *routing.Context) error {
 	return c.Write(trip)
 }
 
+// queryMemberList returns a page of the members of a trip.
 func (r resource) queryMemberList(c *routing.Context) error {
-	trip, err := r.tripMemberService.QueryByTrip(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if err := tripguard.CheckMember(ctx, r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TripMember.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("trip_id", c.Param("id"))
+	count, err := r.tripMemberService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	members, err := r.tripMemberService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = members
+	pages.NextCursor = options.NextCursor(members, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryTransactionList returns a page of the transactions of a trip with the relations listed in the expand query
+// parameter.
 func (r resource) queryTransactionList(c *routing.Context) error {
-	trip, err := r.transactionService.QueryByTrip(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if err := tripguard.CheckMember(ctx, r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, Transaction.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	relations, err := Transaction.ParseExpand(c.Query(Transaction.ExpandVar))
+	if err != nil {
+		return err
+	}
+	options = options.With("trip_id", c.Param("id"))
+	count, err := r.transactionService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	transactions, err := r.transactionService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items, err = r.transactionExpander.Expand(ctx, transactions, relations)
+	if err != nil {
+		return err
+	}
+	pages.NextCursor = options.NextCursor(transactions, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryTransactionItemList returns a page of the transaction items of a trip.
 func (r resource) queryTransactionItemList(c *routing.Context) error {
-	trip, err := r.transactionItemService.QueryByTrip(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if err := tripguard.CheckMember(ctx, r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionItem.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("trip_id", c.Param("id"))
+	count, err := r.transactionItemService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	items, err := r.transactionItemService.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = items
+	pages.NextCursor = options.NextCursor(items, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryTransactionExpensesList returns a page of the transaction expenses of a trip.
 func (r resource) queryTransactionExpensesList(c *routing.Context) error {
-	trip, err := r.TransactionExpenseservice.QueryByTrip(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if err := tripguard.CheckMember(ctx, r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionExpenses.QueryFields)
 	if err != nil {
 		return err
 	}
-
-	return c.Write(trip)
+	options = options.With("trip_id", c.Param("id"))
+	count, err := r.TransactionExpenseservice.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	expenses, err := r.TransactionExpenseservice.Query(ctx, options, pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = expenses
+	pages.NextCursor = options.NextCursor(expenses, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
+// queryTransactionPaymentList returns a page of the transaction payments of a trip.
 func (r resource) queryTransactionPaymentList(c *routing.Context) error {
-	trip, err := r.transactionPaymentService.QueryByTrip(c.Request.Context(), c.Param("id"))
+	ctx := c.Request.Context()
+	if err := tripguard.CheckMember(ctx, r.tripMemberService, c.Param("id")); err != nil {
+		return err
+	}
+	options, err := listing.NewFromRequest(c.Request, TransactionPayment.QueryFields)
+	if err != nil {
+		return err
+	}
+	options = options.With("trip_id", c.Param("id"))
+	count, err := r.transactionPaymentService.Count(ctx, options)
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	payments, err := r.transactionPaymentService.Query(ctx, options, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
+	pages.Items = payments
+	pages.NextCursor = options.NextCursor(payments, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
 
-	return c.Write(trip)
+// events streams the changes of the trip to one of its members as server-sent events.
+func (r resource) events(c *routing.Context) error {
+	ctx := c.Request.Context()
+	tripId := c.Param("id")
+	members, err := r.tripMemberService.QueryByTrip(ctx, tripId)
+	if err != nil {
+		return err
+	}
+	identity := auth.CurrentUserDefault(ctx)
+	member := false
+	for _, m := range members {
+		if identity != nil && m.UserId == identity.GetID() {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return errors.Forbidden("Only the members of the trip can follow its events.")
+	}
+
+	events, unsubscribe := r.hub.Subscribe(tripId)
+	defer unsubscribe()
+	return realtime.Stream(ctx, c.Response, events, heartbeat)
 }
 
+// query returns a page of the trips of the current user.
 func (r resource) query(c *routing.Context) error {
 	ctx := c.Request.Context()
-	count, err := r.service.Count(ctx)
+	options, err := listing.NewFromRequest(c.Request, queryFields)
+	if err != nil {
+		return err
+	}
+	tripIds, err := tripguard.TripIds(ctx, r.tripMemberService)
+	if err != nil {
+		return err
+	}
+	options = options.With("id", tripIds...)
+	filter := QueryFilter{From: c.Query("from"), To: c.Query("to"), Options: options}
+	if status := c.Query("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+	count, err := r.service.Count(ctx, filter)
 	if err != nil {
 		return err
 	}
 	pages := pagination.NewFromRequest(c.Request, count)
-	trips, err := r.service.Query(ctx, pages.Offset(), pages.Limit())
+	trips, err := r.service.Query(ctx, filter, pages.Offset(), pages.Limit())
 	if err != nil {
 		return err
 	}
 	pages.Items = trips
-	return c.Write(trips)
+	pages.NextCursor = filter.Options.NextCursor(trips, pages.Limit())
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
@@ -148,6 +301,22 @@ func (r resource) update(c *routing.Context) error {
 	return c.Write(trip)
 }
 
+// changeStatus moves a trip to another lifecycle status.
+func (r resource) changeStatus(c *routing.Context) error {
+	var input ChangeStatusRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+
+	trip, err := r.service.ChangeStatus(c.Request.Context(), c.Param("id"), input)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(trip)
+}
+
 func (r resource) delete(c *routing.Context) error {
 	trip, err := r.service.Delete(c.Request.Context(), c.Param("id"))
 	if err != nil {
@@ -4,23 +4,32 @@ import (
 	"context"
 	"tribbie/internal/entity"
 	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 // Repository encapsulates the logic to access trips from the data source.
 type Repository interface {
 	// Get returns the trip with the specified trip ID.
 	Get(ctx context.Context, id string) (entity.Trip, error)
-	// Count returns the number of trips.
-	Count(ctx context.Context) (int, error)
-	// Query returns the list of trips with the given offset and limit.
-	Query(ctx context.Context, offset, limit int) ([]entity.Trip, error)
+	// Count returns the number of trips matching the filter.
+	Count(ctx context.Context, filter QueryFilter) (int, error)
+	// Query returns the list of trips matching the filter with the given offset and limit.
+	Query(ctx context.Context, filter QueryFilter, offset, limit int) ([]entity.Trip, error)
 	// Create saves a new trip in the storage.
 	Create(ctx context.Context, trip entity.Trip) error
 	// Update updates the trip with given ID in the storage.
 	Update(ctx context.Context, trip entity.Trip) error
 	// Delete removes the trip with given ID from the storage.
 	Delete(ctx context.Context, id string) error
+	// Transactional runs the function within a transaction.
+	Transactional(ctx context.Context, f func(ctx context.Context) error) error
+	// GetMember returns the membership of the user in the trip.
+	GetMember(ctx context.Context, tripId, userId string) (entity.TripMember, error)
+	// CreateMember saves a new trip member in the storage.
+	CreateMember(ctx context.Context, member entity.TripMember) error
 }
 
 // repository persists trips in database
@@ -61,21 +70,71 @@ func (r repository) Delete(ctx context.Context, id string) error {
 	return r.db.With(ctx).Model(&trip).Delete()
 }
 
-// Count returns the number of the trip records in the database.
-func (r repository) Count(ctx context.Context) (int, error) {
+// Transactional runs the function within a database transaction.
+func (r repository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return r.db.Transactional(ctx, f)
+}
+
+// GetMember reads the membership of the user in the trip from the database.
+func (r repository) GetMember(ctx context.Context, tripId, userId string) (entity.TripMember, error) {
+	var member entity.TripMember
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).One(&member)
+	return member, err
+}
+
+// CreateMember saves a new trip member record in the database.
+func (r repository) CreateMember(ctx context.Context, member entity.TripMember) error {
+	return r.db.With(ctx).Model(&member).Insert()
+}
+
+// queryFields lists the fields of the trips that list requests can filter and sort by. The status has a query
+// parameter of its own, which also lists archived trips.
+var queryFields = listing.Fields{
+	"id":         {Column: "id", Sortable: true},
+	"title":      {Column: "title", Sortable: true},
+	"place":      {Column: "place", Sortable: true},
+	"currency":   {Column: "currency"},
+	"budget":     {Column: "budget", Type: listing.Int, Sortable: true},
+	"start_date": {Column: "start_date", Sortable: true},
+	"end_date":   {Column: "end_date", Sortable: true},
+	"created_at": {Column: "created_at", Type: listing.Time, Sortable: true},
+	"updated_at": {Column: "updated_at", Type: listing.Time, Sortable: true},
+}
+
+// Count returns the number of the trip records matching the filter in the database.
+func (r repository) Count(ctx context.Context, filter QueryFilter) (int, error) {
 	var count int
-	err := r.db.With(ctx).Select("COUNT(*)").From("trip").Row(&count)
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip").Where(filterExp(filter)).Row(&count)
 	return count, err
 }
 
-// Query retrieves the trip records with the specified offset and limit from the database.
-func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.Trip, error) {
+// Query retrieves the trip records matching the filter with the specified offset and limit from the database.
+func (r repository) Query(ctx context.Context, filter QueryFilter, offset, limit int) ([]entity.Trip, error) {
 	var trips []entity.Trip
 	err := r.db.With(ctx).
 		Select().
-		OrderBy("id").
+		Where(filterExp(filter)).
+		AndWhere(filter.Options.After()).
+		OrderBy(filter.Options.OrderBy()...).
 		Offset(int64(offset)).
 		Limit(int64(limit)).
 		All(&trips)
 	return trips, err
 }
+
+// filterExp returns the condition selecting the trips matching the filter. The trips end on their start date if
+// they have no end date.
+func filterExp(filter QueryFilter) dbx.Expression {
+	exps := []dbx.Expression{dbx.NotIn("status", entity.TripStatusArchived)}
+	if len(filter.Statuses) > 0 {
+		exps[0] = dbx.In("status", toInterfaces(filter.Statuses)...)
+	}
+	if filter.From != "" {
+		exps = append(exps, dbx.NewExp("start_date <> '' AND (CASE WHEN end_date = '' THEN start_date ELSE end_date END) >= {:from}", dbx.Params{"from": filter.From}))
+	}
+	if filter.To != "" {
+		exps = append(exps, dbx.NewExp("start_date <> '' AND start_date <= {:to}", dbx.Params{"to": filter.To}))
+	}
+	exps = append(exps, filter.Options.Where())
+	return dbx.And(exps...)
+}
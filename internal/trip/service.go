@@ -2,32 +2,92 @@ package trip
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"net/url"
+	"tribbie/internal/activity"
+	"tribbie/internal/auth"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/listing"
 	"tribbie/pkg/log"
 	"time"
+
+	User "tribbie/internal/user"
 )
 
 // Service encapsulates usecase logic for trips.
 type Service interface {
 	Get(ctx context.Context, id string) (Trip, error)
-	Query(ctx context.Context, offset, limit int) ([]Trip, error)
-	Count(ctx context.Context) (int, error)
+	Query(ctx context.Context, filter QueryFilter, offset, limit int) ([]Trip, error)
+	Count(ctx context.Context, filter QueryFilter) (int, error)
 	Create(ctx context.Context, input CreateTripRequest) (Trip, error)
 	Update(ctx context.Context, id string, input UpdateTripRequest) (Trip, error)
+	// ChangeStatus moves the trip to another lifecycle status.
+	ChangeStatus(ctx context.Context, id string, input ChangeStatusRequest) (Trip, error)
 	Delete(ctx context.Context, id string) (Trip, error)
 }
 
+// dateLayout is the format of the start and end dates of trips.
+const dateLayout = "2006-01-02"
+
+// statusTransitions lists the statuses each status can move to. Besides moving forward, a trip can move back one
+// status, e.g. to reopen a closed trip for a forgotten payment.
+var statusTransitions = map[string][]string{
+	entity.TripStatusPlanning: {entity.TripStatusOngoing, entity.TripStatusSettling},
+	entity.TripStatusOngoing:  {entity.TripStatusPlanning, entity.TripStatusSettling},
+	entity.TripStatusSettling: {entity.TripStatusOngoing, entity.TripStatusClosed},
+	entity.TripStatusClosed:   {entity.TripStatusSettling, entity.TripStatusArchived},
+	entity.TripStatusArchived: {entity.TripStatusClosed},
+}
+
+// statusSummaries describes the status changes in the activity feed of a trip.
+var statusSummaries = map[string]string{
+	entity.TripStatusPlanning: "moved the trip back to planning",
+	entity.TripStatusOngoing:  "started the trip",
+	entity.TripStatusSettling: "started settling up",
+	entity.TripStatusClosed:   "closed the trip",
+	entity.TripStatusArchived: "archived the trip",
+}
+
+// QueryFilter represents the conditions of a trip listing.
+// Archived trips are listed only if requested by status. The date range matches the trips taking place on any day
+// between From and To, so trips without a start date are excluded when a range is given. Options holds the
+// conditions on the other fields of the trips and the sort order.
+type QueryFilter struct {
+	Statuses []string
+	From     string
+	To       string
+	Options  listing.Options
+}
+
+// Validate validates the QueryFilter fields.
+func (m QueryFilter) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Statuses, validation.Each(validation.In(toInterfaces(entity.TripStatuses)...))),
+		validation.Field(&m.From, validation.Date(dateLayout)),
+		validation.Field(&m.To, validation.Date(dateLayout), validation.By(notBefore(m.From))),
+	)
+}
+
 // Trip represents the data about an trip.
 type Trip struct {
 	entity.Trip
 }
 
 // CreateTripRequest represents an trip creation request.
+// The currency and time zone default to the preferences of the user creating the trip, who becomes its first member.
 type CreateTripRequest struct {
 	Title      	string    `json:"title"`
 	Description string    `json:"description"`
 	Place	 	string    `json:"place"`
+	Currency	string    `json:"currency"`
+	TimeZone	string    `json:"time_zone"`
+	Budget		int64     `json:"budget"`
+	StartDate	string    `json:"start_date"`
+	EndDate		string    `json:"end_date"`
+	CoverImage	string    `json:"cover_image"`
 }
 
 // Validate validates the CreateTripRequest fields.
@@ -36,31 +96,64 @@ func (m CreateTripRequest) Validate() error {
 		validation.Field(&m.Title, validation.Required, validation.Length(0, 128)),
 		validation.Field(&m.Description, validation.Length(0, 128)),
 		validation.Field(&m.Place, validation.Length(0, 128)),
+		validation.Field(&m.Currency, validation.Length(3, 3)),
+		validation.Field(&m.TimeZone, validation.Length(0, 64), validation.By(validateTimeZone)),
+		validation.Field(&m.Budget, validation.Min(int64(0))),
+		validation.Field(&m.StartDate, validation.Date(dateLayout)),
+		validation.Field(&m.EndDate, validation.Date(dateLayout), validation.By(notBefore(m.StartDate))),
+		validation.Field(&m.CoverImage, validation.Length(0, 2048), validation.By(validateURL)),
 	)
 }
 
 // UpdateTripRequest represents an trip update request.
+// The time zone of the trip is kept if empty.
 type UpdateTripRequest struct {
 	Title string `json:"title"`
 	Description string `json:"description"`
 	Place string `json:"place"`
+	Budget int64 `json:"budget"`
+	TimeZone string `json:"time_zone"`
+	StartDate string `json:"start_date"`
+	EndDate string `json:"end_date"`
+	CoverImage string `json:"cover_image"`
 }
 
 // Validate validates the CreateTripRequest fields.
 func (m UpdateTripRequest) Validate() error {
 	return validation.ValidateStruct(&m,
 		validation.Field(&m.Title, validation.Required, validation.Length(0, 128)),
+		validation.Field(&m.Budget, validation.Min(int64(0))),
+		validation.Field(&m.TimeZone, validation.Length(0, 64), validation.By(validateTimeZone)),
+		validation.Field(&m.StartDate, validation.Date(dateLayout)),
+		validation.Field(&m.EndDate, validation.Date(dateLayout), validation.By(notBefore(m.StartDate))),
+		validation.Field(&m.CoverImage, validation.Length(0, 2048), validation.By(validateURL)),
+	)
+}
+
+// ChangeStatusRequest represents a request to move a trip to another lifecycle status.
+type ChangeStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// Validate validates the ChangeStatusRequest fields.
+func (m ChangeStatusRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Status, validation.Required, validation.In(toInterfaces(entity.TripStatuses)...)),
 	)
 }
 
 type service struct {
-	repo   Repository
-	logger log.Logger
+	repo            Repository
+	profileService  User.ProfileService
+	activityService activity.Service
+	logger          log.Logger
 }
 
 // NewService creates a new trip service.
-func NewService(repo Repository, logger log.Logger) Service {
-	return service{repo, logger}
+// The profile service provides the preferences of the user creating a trip.
+// The activity service records the changes in the feed of the trip.
+func NewService(repo Repository, profileService User.ProfileService, activityService activity.Service, logger log.Logger) Service {
+	return service{repo, profileService, activityService, logger}
 }
 
 // Get returns the trip with the specified the trip ID.
@@ -72,28 +165,80 @@ func (s service) Get(ctx context.Context, id string) (Trip, error) {
 	return Trip{trip}, nil
 }
 
-// Create creates a new trip.
+// Create creates a new trip on behalf of the current user and adds them as its first member, an admin.
 func (s service) Create(ctx context.Context, req CreateTripRequest) (Trip, error) {
 	if err := req.Validate(); err != nil {
 		return Trip{}, err
 	}
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return Trip{}, errors.Unauthorized("")
+	}
+	profile, err := s.profileService.Get(ctx, identity.GetID())
+	if err != nil && err != sql.ErrNoRows {
+		return Trip{}, err
+	}
+	if req.Currency == "" {
+		req.Currency = profile.PreferredCurrency
+	}
+	if req.TimeZone == "" {
+		req.TimeZone = profile.TimeZone
+	}
 	id := entity.GenerateID()
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.Trip{
-		ID:        id,
-		Title:      req.Title,
-		Description:      req.Description,
-		Place:      req.Place,
-		CreatedAt: now,
-		UpdatedAt: now,
+	err = s.repo.Transactional(ctx, func(ctx context.Context) error {
+		err := s.repo.Create(ctx, entity.Trip{
+			ID:        id,
+			Title:      req.Title,
+			Description:      req.Description,
+			Place:      req.Place,
+			Currency:   req.Currency,
+			TimeZone:   req.TimeZone,
+			Budget:     req.Budget,
+			StartDate:  req.StartDate,
+			EndDate:    req.EndDate,
+			CoverImage: req.CoverImage,
+			Status:     entity.TripStatusPlanning,
+			CreatedBy:  identity.GetID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		return s.repo.CreateMember(ctx, entity.TripMember{
+			ID:        entity.GenerateID(),
+			TripId:    id,
+			UserId:    identity.GetID(),
+			Name:      memberName(profile),
+			Role:      entity.TripMemberRoleAdmin,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
 	})
 	if err != nil {
 		return Trip{}, err
 	}
-	return s.Get(ctx, id)
+	trip, err := s.Get(ctx, id)
+	if err != nil {
+		return Trip{}, err
+	}
+	s.activityService.Record(ctx, activity.RecordRequest{TripId: trip.ID, Kind: entity.ActivityTripCreated, SubjectId: trip.ID, Summary: "created the trip"})
+	return trip, nil
 }
 
-// Update updates the trip with the specified ID.
+// memberName returns the name of the user as a member of their new trip.
+func memberName(profile User.Profile) string {
+	if profile.DisplayName != "" {
+		return profile.DisplayName
+	}
+	if profile.Username != "" {
+		return profile.Username
+	}
+	return "Organizer"
+}
+
+// Update updates the trip with the specified ID. Only the members of the trip can change it.
 func (s service) Update(ctx context.Context, id string, req UpdateTripRequest) (Trip, error) {
 	if err := req.Validate(); err != nil {
 		return Trip{}, err
@@ -103,37 +248,121 @@ func (s service) Update(ctx context.Context, id string, req UpdateTripRequest) (
 	if err != nil {
 		return trip, err
 	}
+	if _, err := s.checkMember(ctx, trip); err != nil {
+		return Trip{}, err
+	}
 	trip.Title = req.Title
 	trip.Description = req.Description
 	trip.Place = req.Place
+	trip.Budget = req.Budget
+	if req.TimeZone != "" {
+		trip.TimeZone = req.TimeZone
+	}
+	trip.StartDate = req.StartDate
+	trip.EndDate = req.EndDate
+	trip.CoverImage = req.CoverImage
 	trip.UpdatedAt = time.Now()
 
 	if err := s.repo.Update(ctx, trip.Trip); err != nil {
 		return trip, err
 	}
+	s.activityService.Record(ctx, activity.RecordRequest{TripId: trip.ID, Kind: entity.ActivityTripUpdated, SubjectId: trip.ID, Summary: "updated the trip details"})
 	return trip, nil
 }
 
-// Delete deletes the trip with the specified ID.
+// ChangeStatus moves the trip with the specified ID to another lifecycle status, following the allowed transitions.
+// Only the creator or an admin of the trip can close, archive or reopen it.
+func (s service) ChangeStatus(ctx context.Context, id string, req ChangeStatusRequest) (Trip, error) {
+	if err := req.Validate(); err != nil {
+		return Trip{}, err
+	}
+	trip, err := s.Get(ctx, id)
+	if err != nil {
+		return trip, err
+	}
+	member, err := s.checkMember(ctx, trip)
+	if err != nil {
+		return Trip{}, err
+	}
+	closing := req.Status == entity.TripStatusClosed || req.Status == entity.TripStatusArchived
+	if (closing || trip.IsClosed()) && !isManager(trip, member) {
+		return Trip{}, errors.Forbidden("Only the creator or an admin of the trip can close, archive or reopen it.")
+	}
+	if trip.Status == req.Status {
+		return trip, nil
+	}
+	allowed := false
+	for _, status := range statusTransitions[trip.Status] {
+		allowed = allowed || status == req.Status
+	}
+	if !allowed {
+		return Trip{}, errors.Conflict(fmt.Sprintf("A %v trip cannot be moved to %v.", trip.Status, req.Status))
+	}
+	summary := statusSummaries[req.Status]
+	if trip.Status == entity.TripStatusArchived {
+		summary = "restored the trip from the archive"
+	}
+	trip.Status = req.Status
+	trip.UpdatedAt = time.Now()
+
+	if err := s.repo.Update(ctx, trip.Trip); err != nil {
+		return trip, err
+	}
+	s.activityService.Record(ctx, activity.RecordRequest{TripId: trip.ID, Kind: entity.ActivityTripStatusChanged, SubjectId: trip.ID, Summary: summary})
+	return trip, nil
+}
+
+// Delete deletes the trip with the specified ID. Only the creator or an admin of the trip can delete it.
 func (s service) Delete(ctx context.Context, id string) (Trip, error) {
 	trip, err := s.Get(ctx, id)
 	if err != nil {
 		return Trip{}, err
 	}
+	member, err := s.checkMember(ctx, trip)
+	if err != nil {
+		return Trip{}, err
+	}
+	if !isManager(trip, member) {
+		return Trip{}, errors.Forbidden("Only the creator or an admin of the trip can delete it.")
+	}
 	if err = s.repo.Delete(ctx, id); err != nil {
 		return Trip{}, err
 	}
 	return trip, nil
 }
 
-// Count returns the number of trips.
-func (s service) Count(ctx context.Context) (int, error) {
-	return s.repo.Count(ctx)
+// checkMember returns the membership of the current user in the trip, or an error if they are not a member.
+func (s service) checkMember(ctx context.Context, trip Trip) (entity.TripMember, error) {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return entity.TripMember{}, errors.Unauthorized("")
+	}
+	member, err := s.repo.GetMember(ctx, trip.ID, identity.GetID())
+	if err == sql.ErrNoRows {
+		return entity.TripMember{}, errors.Forbidden("Only the members of the trip can change it.")
+	}
+	return member, err
+}
+
+// isManager returns whether the member created the trip or is one of its admins.
+func isManager(trip Trip, member entity.TripMember) bool {
+	return trip.CreatedBy == member.UserId || member.IsAdmin()
+}
+
+// Count returns the number of trips matching the filter.
+func (s service) Count(ctx context.Context, filter QueryFilter) (int, error) {
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, filter)
 }
 
-// Query returns the trips with the specified offset and limit.
-func (s service) Query(ctx context.Context, offset, limit int) ([]Trip, error) {
-	items, err := s.repo.Query(ctx, offset, limit)
+// Query returns the trips matching the filter with the specified offset and limit.
+func (s service) Query(ctx context.Context, filter QueryFilter, offset, limit int) ([]Trip, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	items, err := s.repo.Query(ctx, filter, offset, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -143,3 +372,49 @@ func (s service) Query(ctx context.Context, offset, limit int) ([]Trip, error) {
 	}
 	return result, nil
 }
+
+// validateTimeZone checks that the value is empty or an IANA time zone name.
+func validateTimeZone(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(s); err != nil {
+		return validation.NewError("validation_time_zone", "must be a valid IANA time zone")
+	}
+	return nil
+}
+
+// validateURL checks that the value is empty or an absolute http(s) URL.
+func validateURL(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_url", "must be a valid URL")
+	}
+	return nil
+}
+
+// notBefore returns a rule checking that a date is empty or not before the given date. Dates in the YYYY-MM-DD
+// format compare as strings.
+func notBefore(start string) validation.RuleFunc {
+	return func(value interface{}) error {
+		s, _ := value.(string)
+		if s != "" && start != "" && s < start {
+			return validation.NewError("validation_date_order", "must not be before "+start)
+		}
+		return nil
+	}
+}
+
+// toInterfaces converts the values for use with validation.In.
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
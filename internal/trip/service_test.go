@@ -0,0 +1,176 @@
+package trip
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"tribbie/internal/activity"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+
+	User "tribbie/internal/user"
+)
+
+func TestCreateTripRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     CreateTripRequest
+		wantError bool
+	}{
+		{"success", CreateTripRequest{Title: "Bali", StartDate: "2026-07-10", EndDate: "2026-07-15", TimeZone: "Asia/Makassar", CoverImage: "https://example.com/bali.jpg"}, false},
+		{"required", CreateTripRequest{Title: ""}, true},
+		{"invalid date", CreateTripRequest{Title: "Bali", StartDate: "10/07/2026"}, true},
+		{"end before start", CreateTripRequest{Title: "Bali", StartDate: "2026-07-10", EndDate: "2026-07-09"}, true},
+		{"invalid time zone", CreateTripRequest{Title: "Bali", TimeZone: "Bali"}, true},
+		{"invalid cover image", CreateTripRequest{Title: "Bali", CoverImage: "javascript:alert(1)"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.model.Validate()
+			assert.Equal(t, tt.wantError, err != nil)
+		})
+	}
+}
+
+func TestQueryFilter_Validate(t *testing.T) {
+	assert.Nil(t, QueryFilter{Statuses: []string{"ongoing", "archived"}, From: "2026-07-01", To: "2026-07-31"}.Validate())
+	assert.NotNil(t, QueryFilter{Statuses: []string{"cancelled"}}.Validate())
+	assert.NotNil(t, QueryFilter{From: "2026-07-31", To: "2026-07-01"}.Validate())
+}
+
+func Test_service_ChangeStatus(t *testing.T) {
+	logger, _ := log.NewForTest()
+	activities := &mockActivityService{}
+	repo := &mockRepository{
+		items: map[string]entity.Trip{"trip1": {ID: "trip1", Title: "Bali", Status: entity.TripStatusPlanning, CreatedBy: "alice"}},
+		members: []entity.TripMember{
+			{ID: "m1", TripId: "trip1", UserId: "alice", Role: entity.TripMemberRoleAdmin},
+			{ID: "m2", TripId: "trip1", UserId: "bob", Role: entity.TripMemberRoleMember},
+		},
+	}
+	s := NewService(repo, nil, activities, logger)
+	ctx := auth.WithUserDefault(context.Background(), "alice", "")
+
+	_, err := s.ChangeStatus(ctx, "trip1", ChangeStatusRequest{Status: entity.TripStatusClosed})
+	assert.Equal(t, errors.Conflict("A planning trip cannot be moved to closed."), err)
+	_, err = s.ChangeStatus(ctx, "trip1", ChangeStatusRequest{Status: "cancelled"})
+	assert.NotNil(t, err)
+
+	for _, status := range []string{entity.TripStatusOngoing, entity.TripStatusSettling, entity.TripStatusClosed, entity.TripStatusArchived, entity.TripStatusClosed} {
+		trip, err := s.ChangeStatus(ctx, "trip1", ChangeStatusRequest{Status: status})
+		assert.Nil(t, err)
+		assert.Equal(t, status, trip.Status)
+	}
+	assert.Equal(t, entity.TripStatusClosed, repo.items["trip1"].Status)
+	if assert.Len(t, activities.requests, 5) {
+		assert.Equal(t, "started the trip", activities.requests[0].Summary)
+		assert.Equal(t, "restored the trip from the archive", activities.requests[4].Summary)
+	}
+
+	// regular members cannot reopen, archive or delete the trip, and outsiders cannot change it at all
+	bob := auth.WithUserDefault(context.Background(), "bob", "")
+	_, err = s.ChangeStatus(bob, "trip1", ChangeStatusRequest{Status: entity.TripStatusSettling})
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	_, err = s.Delete(bob, "trip1")
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	mallory := auth.WithUserDefault(context.Background(), "mallory", "")
+	_, err = s.Update(mallory, "trip1", UpdateTripRequest{Title: "Mine"})
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	_, err = s.Update(context.Background(), "trip1", UpdateTripRequest{Title: "Mine"})
+	assert.Equal(t, http.StatusUnauthorized, err.(errors.ErrorResponse).StatusCode())
+
+	_, err = s.ChangeStatus(ctx, "trip1", ChangeStatusRequest{Status: entity.TripStatusSettling})
+	assert.Nil(t, err)
+	_, err = s.ChangeStatus(bob, "trip1", ChangeStatusRequest{Status: entity.TripStatusOngoing})
+	assert.Nil(t, err)
+}
+
+func Test_service_Create(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: map[string]entity.Trip{}}
+	profiles := mockProfileService{profiles: map[string]User.Profile{
+		"alice": {UserDefault: User.UserDefault{UserDefault: entity.UserDefault{ID: "alice", DisplayName: "Alice", PreferredCurrency: "IDR"}}},
+	}}
+	s := NewService(repo, profiles, &mockActivityService{}, logger)
+
+	_, err := s.Create(context.Background(), CreateTripRequest{Title: "Bali"})
+	assert.Equal(t, http.StatusUnauthorized, err.(errors.ErrorResponse).StatusCode())
+
+	trip, err := s.Create(auth.WithUserDefault(context.Background(), "alice", ""), CreateTripRequest{Title: "Bali"})
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", trip.CreatedBy)
+	assert.Equal(t, "IDR", trip.Currency)
+	if assert.Len(t, repo.members, 1) {
+		assert.Equal(t, trip.ID, repo.members[0].TripId)
+		assert.Equal(t, "alice", repo.members[0].UserId)
+		assert.Equal(t, "Alice", repo.members[0].Name)
+		assert.True(t, repo.members[0].IsAdmin())
+	}
+}
+
+type mockActivityService struct {
+	activity.Service
+	requests []activity.RecordRequest
+}
+
+func (m *mockActivityService) Record(ctx context.Context, req activity.RecordRequest) {
+	m.requests = append(m.requests, req)
+}
+
+type mockProfileService struct {
+	User.ProfileService
+	profiles map[string]User.Profile
+}
+
+func (m mockProfileService) Get(ctx context.Context, id string) (User.Profile, error) {
+	if profile, ok := m.profiles[id]; ok {
+		return profile, nil
+	}
+	return User.Profile{}, sql.ErrNoRows
+}
+
+type mockRepository struct {
+	Repository
+	items   map[string]entity.Trip
+	members []entity.TripMember
+}
+
+func (m *mockRepository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return f(ctx)
+}
+
+func (m *mockRepository) Create(ctx context.Context, trip entity.Trip) error {
+	m.items[trip.ID] = trip
+	return nil
+}
+
+func (m *mockRepository) GetMember(ctx context.Context, tripId, userId string) (entity.TripMember, error) {
+	for _, member := range m.members {
+		if member.TripId == tripId && member.UserId == userId {
+			return member, nil
+		}
+	}
+	return entity.TripMember{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) CreateMember(ctx context.Context, member entity.TripMember) error {
+	m.members = append(m.members, member)
+	return nil
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Trip, error) {
+	if trip, ok := m.items[id]; ok {
+		return trip, nil
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Update(ctx context.Context, trip entity.Trip) error {
+	m.items[trip.ID] = trip
+	return nil
+}
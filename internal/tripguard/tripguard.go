@@ -0,0 +1,138 @@
+// Package tripguard checks the trips read and written by the ledger services. Only the members of a trip can see
+// it, and closed trips freeze their transactions, items, expenses and payments.
+package tripguard
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	TripMember "tribbie/internal/trip-member"
+)
+
+// Repository encapsulates the logic to access the trips and transactions being checked.
+type Repository interface {
+	// GetTrip returns the trip with the specified trip ID.
+	GetTrip(ctx context.Context, tripId string) (entity.Trip, error)
+	// GetTransaction returns the transaction with the specified transaction ID.
+	GetTransaction(ctx context.Context, transactionId string) (entity.Transaction, error)
+}
+
+// repository reads trips and transactions from database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new repository of the trips and transactions being checked. The repositories of the
+// ledger services embed it.
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// GetTrip reads the trip with the specified ID from the database.
+func (r repository) GetTrip(ctx context.Context, tripId string) (entity.Trip, error) {
+	var trip entity.Trip
+	err := r.db.With(ctx).Select().Model(tripId, &trip)
+	return trip, err
+}
+
+// GetTransaction reads the transaction with the specified ID from the database.
+func (r repository) GetTransaction(ctx context.Context, transactionId string) (entity.Transaction, error) {
+	var transaction entity.Transaction
+	err := r.db.With(ctx).Select().Model(transactionId, &transaction)
+	return transaction, err
+}
+
+// CheckTrip returns an error unless the trip exists and is open. Writes without a trip are not checked.
+// The kind names the records being written in the error, e.g. "items".
+func CheckTrip(ctx context.Context, repo Repository, tripId, kind string) error {
+	if tripId == "" {
+		return nil
+	}
+	trip, err := repo.GetTrip(ctx, tripId)
+	if err == sql.ErrNoRows {
+		return errors.BadRequest("The trip does not exist.")
+	} else if err != nil {
+		return err
+	}
+	return checkClosed(trip, kind)
+}
+
+// CheckTarget returns an error unless the trip exists and is open, and the transaction belongs to it.
+func CheckTarget(ctx context.Context, repo Repository, tripId, transactionId, kind string) error {
+	transaction, err := repo.GetTransaction(ctx, transactionId)
+	if err == sql.ErrNoRows {
+		return errors.BadRequest("The transaction does not exist.")
+	} else if err != nil {
+		return err
+	}
+	if transaction.TripId != tripId {
+		return errors.BadRequest("The transaction does not belong to the trip.")
+	}
+	return CheckTrip(ctx, repo, tripId, kind)
+}
+
+// CheckOpen returns an error if the trip was closed. Unknown trips are not checked, so that records left behind
+// by a deleted trip can still be removed.
+func CheckOpen(ctx context.Context, repo Repository, tripId, kind string) error {
+	if tripId == "" {
+		return nil
+	}
+	trip, err := repo.GetTrip(ctx, tripId)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return checkClosed(trip, kind)
+}
+
+// Memberships lists the trips a user is a member of.
+type Memberships interface {
+	QueryByUser(ctx context.Context, userId string) ([]TripMember.TripMember, error)
+}
+
+// TripIds returns the IDs of the trips the current user is a member of, ready to filter a listing by.
+func TripIds(ctx context.Context, memberships Memberships) ([]interface{}, error) {
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return nil, errors.Unauthorized("")
+	}
+	members, err := memberships.QueryByUser(ctx, identity.GetID())
+	if err != nil {
+		return nil, err
+	}
+	tripIds := make([]interface{}, len(members))
+	for i, member := range members {
+		tripIds[i] = member.TripId
+	}
+	return tripIds, nil
+}
+
+// CheckMember returns an error unless the current user is a member of the trip.
+func CheckMember(ctx context.Context, memberships Memberships, tripId string) error {
+	tripIds, err := TripIds(ctx, memberships)
+	if err != nil {
+		return err
+	}
+	for _, id := range tripIds {
+		if id == tripId {
+			return nil
+		}
+	}
+	return errors.Forbidden("Only the members of the trip can see it.")
+}
+
+// checkClosed returns an error if the trip was closed.
+func checkClosed(trip entity.Trip, kind string) error {
+	if trip.IsClosed() {
+		return errors.Conflict(fmt.Sprintf("The %v of %v cannot change because the trip is %v.", kind, trip.Title, trip.Status))
+	}
+	return nil
+}
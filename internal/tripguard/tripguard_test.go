@@ -0,0 +1,99 @@
+package tripguard
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"tribbie/internal/auth"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+
+	"github.com/stretchr/testify/assert"
+
+	TripMember "tribbie/internal/trip-member"
+)
+
+func TestCheckTarget(t *testing.T) {
+	repo := mockRepository{
+		trips: []entity.Trip{
+			{ID: "open", Title: "Bali", Status: entity.TripStatusOngoing},
+			{ID: "closed", Title: "Lombok", Status: entity.TripStatusClosed},
+		},
+		transactions: []entity.Transaction{{ID: "t1", TripId: "open"}, {ID: "t2", TripId: "closed"}},
+	}
+	ctx := context.Background()
+
+	assert.Nil(t, CheckTarget(ctx, repo, "open", "t1", "items"))
+	assert.Nil(t, CheckTrip(ctx, repo, "", "transactions"))
+	assert.Nil(t, CheckOpen(ctx, repo, "deleted", "items"))
+	assert.Equal(t, errors.Conflict("The items of Lombok cannot change because the trip is closed."), CheckOpen(ctx, repo, "closed", "items"))
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"closed trip", CheckTarget(ctx, repo, "closed", "t2", "payments"), http.StatusConflict},
+		{"unknown trip", CheckTrip(ctx, repo, "unknown", "transactions"), http.StatusBadRequest},
+		{"unknown transaction", CheckTarget(ctx, repo, "open", "unknown", "items"), http.StatusBadRequest},
+		{"transaction of another trip", CheckTarget(ctx, repo, "open", "t2", "expenses"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if assert.IsType(t, errors.ErrorResponse{}, tt.err) {
+				assert.Equal(t, tt.status, tt.err.(errors.ErrorResponse).StatusCode())
+			}
+		})
+	}
+}
+
+func TestCheckMember(t *testing.T) {
+	memberships := mockMemberships{"alice": {"bali", "lombok"}}
+	alice := auth.WithUserDefault(context.Background(), "alice", "")
+
+	tripIds, err := TripIds(alice, memberships)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"bali", "lombok"}, tripIds)
+	assert.Nil(t, CheckMember(alice, memberships, "bali"))
+
+	err = CheckMember(alice, memberships, "komodo")
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	err = CheckMember(auth.WithUserDefault(context.Background(), "mallory", ""), memberships, "bali")
+	assert.Equal(t, http.StatusForbidden, err.(errors.ErrorResponse).StatusCode())
+	_, err = TripIds(context.Background(), memberships)
+	assert.Equal(t, http.StatusUnauthorized, err.(errors.ErrorResponse).StatusCode())
+}
+
+type mockMemberships map[string][]string
+
+func (m mockMemberships) QueryByUser(ctx context.Context, userId string) ([]TripMember.TripMember, error) {
+	var members []TripMember.TripMember
+	for _, tripId := range m[userId] {
+		members = append(members, TripMember.TripMember{TripMember: entity.TripMember{TripId: tripId, UserId: userId}})
+	}
+	return members, nil
+}
+
+type mockRepository struct {
+	trips        []entity.Trip
+	transactions []entity.Transaction
+}
+
+func (m mockRepository) GetTrip(ctx context.Context, tripId string) (entity.Trip, error) {
+	for _, trip := range m.trips {
+		if trip.ID == tripId {
+			return trip, nil
+		}
+	}
+	return entity.Trip{}, sql.ErrNoRows
+}
+
+func (m mockRepository) GetTransaction(ctx context.Context, transactionId string) (entity.Transaction, error) {
+	for _, transaction := range m.transactions {
+		if transaction.ID == transactionId {
+			return transaction, nil
+		}
+	}
+	return entity.Transaction{}, sql.ErrNoRows
+}
@@ -10,21 +10,16 @@ import (
 )
 
 // RegisterHandlers sets up the routing of the HTTP handlers.
+// Users change or delete their own account through /me.
 func RegisterHandlers(
 	r *routing.RouteGroup,
 	service Service,
-	authHandler routing.Handler,
 	logger log.Logger) {
 	res := resource{service, logger}
 
 	r.Get("/users/<id>", res.get)
 	r.Get("/users", res.query)
-
-	// r.Use(authHandler)
-
 	r.Post("/users", res.create)
-	r.Put("/users/<id>", res.update)
-	r.Delete("/users/<id>", res.delete)
 }
 
 type resource struct {
@@ -53,7 +48,8 @@ func (r resource) query(c *routing.Context) error {
 		return err
 	}
 	pages.Items = users
-	return c.Write(users)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
 }
 
 func (r resource) create(c *routing.Context) error {
@@ -69,27 +65,3 @@ func (r resource) create(c *routing.Context) error {
 
 	return c.WriteWithStatus(user, http.StatusCreated)
 }
-
-func (r resource) update(c *routing.Context) error {
-	var input UpdateUserRequest
-	if err := c.Read(&input); err != nil {
-		r.logger.With(c.Request.Context()).Info(err)
-		return errors.BadRequest("")
-	}
-
-	user, err := r.service.Update(c.Request.Context(), c.Param("id"), input)
-	if err != nil {
-		return err
-	}
-
-	return c.Write(user)
-}
-
-func (r resource) delete(c *routing.Context) error {
-	user, err := r.service.Delete(c.Request.Context(), c.Param("id"))
-	if err != nil {
-		return err
-	}
-
-	return c.Write(user)
-}
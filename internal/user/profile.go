@@ -0,0 +1,199 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/secretbox"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	localePattern   = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	accountPattern  = regexp.MustCompile(`^[0-9A-Za-z+\- ]{4,34}$`)
+)
+
+// ProfileService encapsulates usecase logic for user profiles and preferences.
+type ProfileService interface {
+	// Get returns the profile of the user including the decrypted payout details.
+	Get(ctx context.Context, id string) (Profile, error)
+	// Update applies a partial update to the profile of the user.
+	Update(ctx context.Context, id string, input UpdateProfileRequest) (Profile, error)
+	// GetMaskedPayout returns the payout details of the user as shown to other trip members.
+	GetMaskedPayout(ctx context.Context, id string) (*entity.Payout, error)
+}
+
+// Profile represents the profile of a user as shown to the user themselves.
+type Profile struct {
+	UserDefault
+	Payout *entity.Payout `json:"payout"`
+}
+
+// UpdateProfileRequest represents a partial profile update request. Omitted fields are left unchanged.
+// Sending a payout with an empty account number removes the payout details.
+type UpdateProfileRequest struct {
+	Username          *string        `json:"username"`
+	DisplayName       *string        `json:"display_name"`
+	AvatarUrl         *string        `json:"avatar_url"`
+	PreferredCurrency *string        `json:"preferred_currency"`
+	Locale            *string        `json:"locale"`
+	TimeZone          *string        `json:"time_zone"`
+	Payout            *entity.Payout `json:"payout"`
+}
+
+// Validate validates the UpdateProfileRequest fields.
+func (m UpdateProfileRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Username, validation.NilOrNotEmpty, validation.Length(1, 128)),
+		validation.Field(&m.DisplayName, validation.Length(0, 128)),
+		validation.Field(&m.AvatarUrl, validation.Length(0, 1024), validation.By(validateURL)),
+		validation.Field(&m.PreferredCurrency, validation.Match(currencyPattern).Error("must be an ISO 4217 currency code")),
+		validation.Field(&m.Locale, validation.Match(localePattern).Error("must be a BCP 47 language tag")),
+		validation.Field(&m.TimeZone, validation.By(validateTimeZone)),
+		validation.Field(&m.Payout, validation.By(validatePayout)),
+	)
+}
+
+type profileService struct {
+	repo   Repository
+	box    *secretbox.Box
+	logger log.Logger
+}
+
+// NewProfileService creates a new profile service. The box encrypts the payout details at rest.
+func NewProfileService(repo Repository, box *secretbox.Box, logger log.Logger) ProfileService {
+	return profileService{repo, box, logger}
+}
+
+// Get returns the profile of the user including the decrypted payout details.
+func (s profileService) Get(ctx context.Context, id string) (Profile, error) {
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Profile{}, err
+	}
+	payout, err := s.openPayout(user.PayoutDetails)
+	if err != nil {
+		return Profile{}, err
+	}
+	return Profile{UserDefault{user}, payout}, nil
+}
+
+// Update applies a partial update to the profile of the user.
+func (s profileService) Update(ctx context.Context, id string, req UpdateProfileRequest) (Profile, error) {
+	if err := req.Validate(); err != nil {
+		return Profile{}, err
+	}
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return Profile{}, err
+	}
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&user.Username, req.Username)
+	set(&user.DisplayName, req.DisplayName)
+	set(&user.AvatarUrl, req.AvatarUrl)
+	set(&user.PreferredCurrency, req.PreferredCurrency)
+	set(&user.Locale, req.Locale)
+	set(&user.TimeZone, req.TimeZone)
+	if req.Payout != nil {
+		if user.PayoutDetails, err = s.sealPayout(*req.Payout); err != nil {
+			return Profile{}, err
+		}
+	}
+	user.UpdatedAt = time.Now()
+	if err := s.repo.Update(ctx, user); err != nil {
+		return Profile{}, err
+	}
+	return s.Get(ctx, id)
+}
+
+// GetMaskedPayout returns the payout details of the user with all but the last digits of the account number hidden.
+// Nil is returned if the user has no payout details.
+func (s profileService) GetMaskedPayout(ctx context.Context, id string) (*entity.Payout, error) {
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	payout, err := s.openPayout(user.PayoutDetails)
+	if err != nil || payout == nil {
+		return nil, err
+	}
+	masked := payout.Masked()
+	return &masked, nil
+}
+
+// sealPayout encrypts the payout details. Details without an account number are stored as empty.
+func (s profileService) sealPayout(payout entity.Payout) (string, error) {
+	if payout.AccountNumber == "" {
+		return "", nil
+	}
+	data, err := json.Marshal(payout)
+	if err != nil {
+		return "", err
+	}
+	return s.box.Seal(data)
+}
+
+// openPayout decrypts the stored payout details.
+func (s profileService) openPayout(sealed string) (*entity.Payout, error) {
+	if sealed == "" {
+		return nil, nil
+	}
+	data, err := s.box.Open(sealed)
+	if err != nil {
+		return nil, err
+	}
+	var payout entity.Payout
+	if err := json.Unmarshal(data, &payout); err != nil {
+		return nil, err
+	}
+	return &payout, nil
+}
+
+// validateURL checks that the value is empty or an absolute http(s) URL.
+func validateURL(value interface{}) error {
+	s, _ := value.(*string)
+	if s == nil || *s == "" {
+		return nil
+	}
+	u, err := url.Parse(*s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_url", "must be a valid URL")
+	}
+	return nil
+}
+
+// validateTimeZone checks that the value is empty or an IANA time zone name.
+func validateTimeZone(value interface{}) error {
+	s, _ := value.(*string)
+	if s == nil || *s == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(*s); err != nil {
+		return validation.NewError("validation_time_zone", "must be a valid IANA time zone")
+	}
+	return nil
+}
+
+// validatePayout checks the payout details unless they are being removed.
+func validatePayout(value interface{}) error {
+	payout, _ := value.(*entity.Payout)
+	if payout == nil || payout.AccountNumber == "" {
+		return nil
+	}
+	return validation.ValidateStruct(payout,
+		validation.Field(&payout.Method, validation.Required, validation.In("bank", "ewallet")),
+		validation.Field(&payout.Provider, validation.Required, validation.Length(1, 64)),
+		validation.Field(&payout.AccountName, validation.Required, validation.Length(1, 128)),
+		validation.Field(&payout.AccountNumber, validation.Match(accountPattern)),
+	)
+}
@@ -0,0 +1,58 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/secretbox"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_profileService(t *testing.T) {
+	logger, _ := log.NewForTest()
+	box, _ := secretbox.New(bytes.Repeat([]byte{1}, secretbox.KeySize))
+	repo := &mockRepository{items: []entity.UserDefault{{ID: "100", Username: "test"}}}
+	s := NewProfileService(repo, box, logger)
+	ctx := context.Background()
+
+	currency, zone := "IDR", "Asia/Jakarta"
+	payout := entity.Payout{Method: "bank", Provider: "BCA", AccountName: "Test", AccountNumber: "1234567890"}
+	profile, err := s.Update(ctx, "100", UpdateProfileRequest{PreferredCurrency: &currency, TimeZone: &zone, Payout: &payout})
+	assert.Nil(t, err)
+	assert.Equal(t, "IDR", profile.PreferredCurrency)
+	assert.Equal(t, "test", profile.Username)
+	assert.Equal(t, &payout, profile.Payout)
+
+	// payout details are encrypted at rest and masked for other members
+	assert.NotContains(t, repo.items[0].PayoutDetails, "1234567890")
+	masked, err := s.GetMaskedPayout(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "******7890", masked.AccountNumber)
+
+	// omitted fields are left unchanged
+	name := "Tester"
+	profile, err = s.Update(ctx, "100", UpdateProfileRequest{DisplayName: &name})
+	assert.Nil(t, err)
+	assert.Equal(t, "IDR", profile.PreferredCurrency)
+	assert.NotNil(t, profile.Payout)
+
+	// validation
+	invalid := "idr"
+	_, err = s.Update(ctx, "100", UpdateProfileRequest{PreferredCurrency: &invalid})
+	assert.NotNil(t, err)
+	invalid = "Mars/Olympus"
+	_, err = s.Update(ctx, "100", UpdateProfileRequest{TimeZone: &invalid})
+	assert.NotNil(t, err)
+	_, err = s.Update(ctx, "100", UpdateProfileRequest{Payout: &entity.Payout{Method: "cash", AccountNumber: "1234"}})
+	assert.NotNil(t, err)
+
+	// an empty account number removes the payout details
+	_, err = s.Update(ctx, "100", UpdateProfileRequest{Payout: &entity.Payout{}})
+	assert.Nil(t, err)
+	masked, err = s.GetMaskedPayout(ctx, "100")
+	assert.Nil(t, err)
+	assert.Nil(t, masked)
+}
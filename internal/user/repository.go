@@ -5,15 +5,19 @@ import (
 	"tribbie/internal/entity"
 	"tribbie/pkg/dbcontext"
 	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
 )
 
 type Repository interface {
 	Get(ctx context.Context, id string) (entity.UserDefault, error)
 	GetByEmail(ctx context.Context, email string) (entity.UserDefault, error)
+	GetByUsername(ctx context.Context, username string) (entity.UserDefault, error)
 	GetByAppleId(ctx context.Context, appleId string) (entity.UserDefault, error)
 	GetByDeviceId(ctx context.Context, deviceId string) (entity.UserDefault, error)
 	Count(ctx context.Context) (int, error)
 	Query(ctx context.Context, offset, limit int) ([]entity.UserDefault, error)
+	QueryByIds(ctx context.Context, ids []string) ([]entity.UserDefault, error)
 	Create(ctx context.Context, user entity.UserDefault) error
 	Update(ctx context.Context, user entity.UserDefault) error
 	Delete(ctx context.Context, id string) error
@@ -37,28 +41,26 @@ func (r repository) Get(ctx context.Context, id string) (entity.UserDefault, err
 
 func (r repository) GetByEmail(ctx context.Context, email string) (entity.UserDefault, error) {
 	var user entity.UserDefault
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"email": email}, dbx.NewExp("deleted_at IS NULL"))).One(&user)
+	return user, err
+}
 
-	q := r.db.DB().NewQuery("SELECT * FROM user_default WHERE email='" + email + "'")
-	err := q.One(&user)
-
+func (r repository) GetByUsername(ctx context.Context, username string) (entity.UserDefault, error) {
+	var user entity.UserDefault
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"username": username}, dbx.NewExp("deleted_at IS NULL"))).One(&user)
 	return user, err
 }
 
 func (r repository) GetByAppleId(ctx context.Context, appleId string) (entity.UserDefault, error) {
 	var user entity.UserDefault
-
-	q := r.db.DB().NewQuery("SELECT * FROM user_default WHERE apple_id='" + appleId + "'")
-	err := q.One(&user)
-
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"apple_id": appleId}, dbx.NewExp("deleted_at IS NULL"))).One(&user)
 	return user, err
 }
 
 func (r repository) GetByDeviceId(ctx context.Context, deviceId string) (entity.UserDefault, error) {
 	var user entity.UserDefault
 
-	q := r.db.DB().NewQuery("SELECT * FROM user_default WHERE device_id='" + deviceId + "'")
-	err := q.One(&user)
-
+	err := r.db.With(ctx).Select().Where(dbx.And(dbx.HashExp{"device_id": deviceId}, dbx.NewExp("deleted_at IS NULL"))).One(&user)
 	return user, err
 }
 
@@ -86,9 +88,31 @@ func (r repository) Count(ctx context.Context) (int, error) {
 
 func (r repository) Query(ctx context.Context, offset, limit int) ([]entity.UserDefault, error) {
 	var users []entity.UserDefault
+	err := r.db.With(ctx).
+		Select().
+		From("user_default").
+		OrderBy("id").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&users)
+	return users, err
+}
 
-	q := r.db.DB().NewQuery("SELECT * FROM user_default")
-	err := q.All(&users)
-
+// QueryByIds reads the users with the specified IDs from the database.
+func (r repository) QueryByIds(ctx context.Context, ids []string) ([]entity.UserDefault, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	var users []entity.UserDefault
+	err := r.db.With(ctx).
+		Select().
+		From("user_default").
+		Where(dbx.In("id", values...)).
+		OrderBy("id").
+		All(&users)
 	return users, err
 }
@@ -2,24 +2,41 @@ package user
 
 import (
 	"context"
+	"crypto/subtle"
+	"database/sql"
+	"regexp"
+	"strings"
 	"time"
 	"tribbie/internal/entity"
+	"tribbie/internal/errors"
 	"tribbie/pkg/log"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// minPasswordLength is the minimum length of a new password.
+const minPasswordLength = 8
+
+var emailPattern = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
 // Service encapsulates usecase logic for users.
 type Service interface {
 	Get(ctx context.Context, id string) (UserDefault, error)
 	GetByEmail(ctx context.Context, email string) (UserDefault, error)
+	GetByUsername(ctx context.Context, username string) (UserDefault, error)
 	GetByAppleId(ctx context.Context, appleId string) (UserDefault, error)
 	GetByDeviceId(ctx context.Context, deviceId string) (UserDefault, error)
+	Authenticate(ctx context.Context, email, password string) (UserDefault, error)
 	Query(ctx context.Context, offset, limit int) ([]UserDefault, error)
+	QueryByIds(ctx context.Context, ids []string) ([]UserDefault, error)
 	Count(ctx context.Context) (int, error)
 	Create(ctx context.Context, input CreateUserRequest) (UserDefault, error)
+	CreateWithAppleId(ctx context.Context, input CreateUserRequest, appleId string) (UserDefault, error)
 	Update(ctx context.Context, id string, input UpdateUserRequest) (UserDefault, error)
 	Delete(ctx context.Context, id string) (UserDefault, error)
+	SetPassword(ctx context.Context, id, password string) error
+	VerifyEmail(ctx context.Context, id string) (UserDefault, error)
 }
 
 // User represents the data about an user.
@@ -32,13 +49,24 @@ type CreateUserRequest struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Password string `json:"password"`
-	AppleId  string `json:"apple_id"`
 	DeviceId string `json:"device_id"`
 }
 
-// Validate validates the CreateUserRequest fields.
+// Validate validates the CreateUserRequest fields. A password is required unless the user logs in with a device.
 func (m CreateUserRequest) Validate() error {
-	return validation.ValidateStruct(&m)
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Email, validation.Required, validation.Length(0, 254), validation.Match(emailPattern).Error("must be a valid email address")),
+		validation.Field(&m.Username, validation.Length(0, 128)),
+		validation.Field(&m.Password, validation.When(m.DeviceId == "", validation.Required), validation.Length(minPasswordLength, 128)),
+	)
+}
+
+// validateApple validates the fields of a user signing in with Apple, who may have hidden their email address.
+func (m CreateUserRequest) validateApple() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Email, validation.Length(0, 254), validation.Match(emailPattern).Error("must be a valid email address")),
+		validation.Field(&m.Username, validation.Length(0, 128)),
+	)
 }
 
 // UpdateUserRequest represents an user update request.
@@ -46,13 +74,25 @@ type UpdateUserRequest struct {
 	Email    string `json:"email"`
 	Username string `json:"username"`
 	Password string `json:"password"`
-	AppleId  string `json:"apple_id"`
 	DeviceId string `json:"device_id"`
 }
 
-// Validate validates the CreateUserRequest fields.
+// Validate validates the UpdateUserRequest fields. An empty password leaves the password unchanged.
 func (m UpdateUserRequest) Validate() error {
-	return validation.ValidateStruct(&m)
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Email, validation.Required, validation.Length(0, 254), validation.Match(emailPattern).Error("must be a valid email address")),
+		validation.Field(&m.Username, validation.Length(0, 128)),
+		validation.Field(&m.Password, validation.Length(minPasswordLength, 128)),
+	)
+}
+
+// ValidatePassword checks that a new password is acceptable.
+func ValidatePassword(password string) error {
+	err := validation.Validate(password, validation.Required, validation.Length(minPasswordLength, 128))
+	if err != nil {
+		return validation.Errors{"password": err}
+	}
+	return nil
 }
 
 type service struct {
@@ -83,6 +123,15 @@ func (s service) GetByEmail(ctx context.Context, email string) (UserDefault, err
 	return UserDefault{user}, nil
 }
 
+// GetByUsername returns the user with the specified username.
+func (s service) GetByUsername(ctx context.Context, username string) (UserDefault, error) {
+	user, err := s.repo.GetByUsername(ctx, username)
+	if err != nil {
+		return UserDefault{}, err
+	}
+	return UserDefault{user}, nil
+}
+
 // Get returns the user with the specified the user ID.
 func (s service) GetByAppleId(ctx context.Context, appleId string) (UserDefault, error) {
 	user, err := s.repo.GetByAppleId(ctx, appleId)
@@ -101,19 +150,57 @@ func (s service) GetByDeviceId(ctx context.Context, deviceId string) (UserDefaul
 	return UserDefault{user}, nil
 }
 
+// Authenticate returns the user with the given email if the password matches.
+// Users created before passwords were hashed are compared against the stored plain text.
+func (s service) Authenticate(ctx context.Context, email, password string) (UserDefault, error) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err == sql.ErrNoRows {
+		return UserDefault{}, errors.Unauthorized("")
+	} else if err != nil {
+		return UserDefault{}, err
+	}
+	if user.Password == "" || !checkPassword(user.Password, password) {
+		return UserDefault{}, errors.Unauthorized("")
+	}
+	return UserDefault{user}, nil
+}
+
 // Create creates a new user.
 func (s service) Create(ctx context.Context, req CreateUserRequest) (UserDefault, error) {
 	if err := req.Validate(); err != nil {
 		return UserDefault{}, err
 	}
+	return s.create(ctx, req, "")
+}
+
+// CreateWithAppleId creates a new user signing in with Apple. The Apple ID must come from a verified identity token:
+// it is never accepted from the client.
+func (s service) CreateWithAppleId(ctx context.Context, req CreateUserRequest, appleId string) (UserDefault, error) {
+	if err := req.validateApple(); err != nil {
+		return UserDefault{}, err
+	}
+	// users signing in with Apple have no password
+	req.Password = ""
+	return s.create(ctx, req, appleId)
+}
+
+// create stores a new user with the given Apple ID.
+func (s service) create(ctx context.Context, req CreateUserRequest, appleId string) (UserDefault, error) {
+	if err := s.checkEmail(ctx, "", req.Email); err != nil {
+		return UserDefault{}, err
+	}
+	password, err := hashPassword(req.Password)
+	if err != nil {
+		return UserDefault{}, err
+	}
 	id := entity.GenerateID()
 	now := time.Now()
-	err := s.repo.Create(ctx, entity.UserDefault{
+	err = s.repo.Create(ctx, entity.UserDefault{
 		ID:        id,
 		Email:     req.Email,
 		Username:  req.Username,
-		Password:  req.Password,
-		AppleId:   req.AppleId,
+		Password:  password,
+		AppleId:   appleId,
 		DeviceId:  req.DeviceId,
 		CreatedAt: now,
 		UpdatedAt: now,
@@ -134,10 +221,19 @@ func (s service) Update(ctx context.Context, id string, req UpdateUserRequest) (
 	if err != nil {
 		return user, err
 	}
+	if req.Email != user.Email {
+		if err := s.checkEmail(ctx, id, req.Email); err != nil {
+			return user, err
+		}
+		user.EmailVerifiedAt = nil
+	}
 	user.Email = req.Email
 	user.Username = req.Username
-	user.Password = req.Password
-	user.AppleId = req.AppleId
+	if req.Password != "" {
+		if user.Password, err = hashPassword(req.Password); err != nil {
+			return user, err
+		}
+	}
 	user.DeviceId = req.DeviceId
 	user.UpdatedAt = time.Now()
 
@@ -147,18 +243,68 @@ func (s service) Update(ctx context.Context, id string, req UpdateUserRequest) (
 	return user, nil
 }
 
-// Delete deletes the user with the specified ID.
+// Delete anonymizes the user with the specified ID. The row is kept so that the trip ledgers
+// referring to the user stay intact, but every personal detail and login method is removed.
 func (s service) Delete(ctx context.Context, id string) (UserDefault, error) {
 	user, err := s.Get(ctx, id)
 	if err != nil {
 		return UserDefault{}, err
 	}
-	if err = s.repo.Delete(ctx, id); err != nil {
+	if user.DeletedAt != nil {
+		return user, nil
+	}
+	now := time.Now()
+	user.Username = entity.DeletedUserName
+	user.Email = ""
+	user.EmailVerifiedAt = nil
+	user.Password = ""
+	user.AppleId = ""
+	user.DeviceId = ""
+	user.DisplayName = ""
+	user.AvatarUrl = ""
+	user.PayoutDetails = ""
+	user.DeletedAt = &now
+	user.UpdatedAt = now
+	if err = s.repo.Update(ctx, user.UserDefault); err != nil {
 		return UserDefault{}, err
 	}
 	return user, nil
 }
 
+// SetPassword replaces the password of the user with the specified ID.
+func (s service) SetPassword(ctx context.Context, id, password string) error {
+	if err := ValidatePassword(password); err != nil {
+		return err
+	}
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Password, err = hashPassword(password); err != nil {
+		return err
+	}
+	user.UpdatedAt = time.Now()
+	return s.repo.Update(ctx, user)
+}
+
+// VerifyEmail marks the email address of the user with the specified ID as verified.
+func (s service) VerifyEmail(ctx context.Context, id string) (UserDefault, error) {
+	user, err := s.Get(ctx, id)
+	if err != nil {
+		return user, err
+	}
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+	if err := s.repo.Update(ctx, user.UserDefault); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
 // Count returns the number of users.
 func (s service) Count(ctx context.Context) (int, error) {
 	return s.repo.Count(ctx)
@@ -176,3 +322,54 @@ func (s service) Query(ctx context.Context, offset, limit int) ([]UserDefault, e
 	}
 	return result, nil
 }
+
+// QueryByIds returns the users with the specified IDs. Unknown IDs are skipped.
+func (s service) QueryByIds(ctx context.Context, ids []string) ([]UserDefault, error) {
+	items, err := s.repo.QueryByIds(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	result := []UserDefault{}
+	for _, item := range items {
+		result = append(result, UserDefault{item})
+	}
+	return result, nil
+}
+
+// checkEmail returns a conflict if the email address belongs to another user than the one with the specified ID.
+// Users without an email address do not conflict.
+func (s service) checkEmail(ctx context.Context, id, email string) error {
+	if email == "" {
+		return nil
+	}
+	user, err := s.repo.GetByEmail(ctx, email)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if user.ID != id {
+		return errors.Conflict("The email address is already registered.")
+	}
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of the password. An empty password is stored as is.
+func hashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// checkPassword tells whether the password matches the stored one.
+func checkPassword(stored, password string) bool {
+	if stored == "" {
+		return false
+	}
+	if strings.HasPrefix(stored, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
@@ -0,0 +1,156 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_service_Delete(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{items: []entity.UserDefault{{ID: "100", Username: "test", Email: "test@example.com", DeviceId: "device"}}}
+	s := NewService(repo, logger)
+	ctx := context.Background()
+	assert.Nil(t, s.SetPassword(ctx, "100", "password"))
+
+	user, err := s.Delete(ctx, "100")
+	assert.Nil(t, err)
+	assert.Equal(t, entity.DeletedUserName, user.Username)
+	assert.NotNil(t, user.DeletedAt)
+
+	// the row is kept but can no longer be used to log in
+	assert.Len(t, repo.items, 1)
+	assert.Empty(t, repo.items[0].Email)
+	assert.Empty(t, repo.items[0].Password)
+	assert.Empty(t, repo.items[0].DeviceId)
+	_, err = s.Authenticate(ctx, "", "")
+	assert.NotNil(t, err)
+
+	_, err = s.Delete(ctx, "101")
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func Test_service_CreateWithAppleId(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+	ctx := context.Background()
+
+	user, err := s.CreateWithAppleId(ctx, CreateUserRequest{Email: "test@example.com", Username: "test"}, "apple.sub")
+	assert.Nil(t, err)
+	assert.Equal(t, "apple.sub", user.AppleId)
+
+	// the Apple ID of a user is never taken from the client
+	user, err = s.Create(ctx, CreateUserRequest{Email: "other@example.com", Username: "other", Password: "password"})
+	assert.Nil(t, err)
+	assert.Empty(t, user.AppleId)
+}
+
+func Test_service_Create(t *testing.T) {
+	logger, _ := log.NewForTest()
+	repo := &mockRepository{}
+	s := NewService(repo, logger)
+	ctx := context.Background()
+
+	_, err := s.Create(ctx, CreateUserRequest{Email: "test@example.com", Username: "test"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, CreateUserRequest{Email: "test@example.com", Username: "test", Password: "x"})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, CreateUserRequest{Email: "test", Username: "test", Password: "password"})
+	assert.NotNil(t, err)
+	user, err := s.Create(ctx, CreateUserRequest{Email: "test@example.com", Username: "test", Password: "password"})
+	assert.Nil(t, err)
+
+	// the email address belongs to a single user
+	_, err = s.Create(ctx, CreateUserRequest{Email: "test@example.com", Username: "other", Password: "password"})
+	assert.Equal(t, http.StatusConflict, err.(errors.ErrorResponse).StatusCode())
+	other, err := s.Create(ctx, CreateUserRequest{Email: "other@example.com", Username: "other", Password: "password"})
+	assert.Nil(t, err)
+	_, err = s.Update(ctx, other.ID, UpdateUserRequest{Email: "test@example.com", Username: "other"})
+	assert.Equal(t, http.StatusConflict, err.(errors.ErrorResponse).StatusCode())
+	_, err = s.Update(ctx, user.ID, UpdateUserRequest{Email: "test@example.com", Username: "renamed"})
+	assert.Nil(t, err)
+}
+
+type mockRepository struct {
+	items []entity.UserDefault
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.ID == id {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByEmail(ctx context.Context, email string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.Email == email && item.DeletedAt == nil {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByUsername(ctx context.Context, username string) (entity.UserDefault, error) {
+	for _, item := range m.items {
+		if item.Username == username {
+			return item, nil
+		}
+	}
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByAppleId(ctx context.Context, appleId string) (entity.UserDefault, error) {
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) GetByDeviceId(ctx context.Context, deviceId string) (entity.UserDefault, error) {
+	return entity.UserDefault{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) Count(ctx context.Context) (int, error) {
+	return len(m.items), nil
+}
+
+func (m *mockRepository) Query(ctx context.Context, offset, limit int) ([]entity.UserDefault, error) {
+	return m.items, nil
+}
+
+func (m *mockRepository) QueryByIds(ctx context.Context, ids []string) ([]entity.UserDefault, error) {
+	var items []entity.UserDefault
+	for _, item := range m.items {
+		for _, id := range ids {
+			if item.ID == id {
+				items = append(items, item)
+			}
+		}
+	}
+	return items, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, user entity.UserDefault) error {
+	m.items = append(m.items, user)
+	return nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, user entity.UserDefault) error {
+	for i, item := range m.items {
+		if item.ID == user.ID {
+			m.items[i] = user
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	return nil
+}
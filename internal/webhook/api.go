@@ -0,0 +1,121 @@
+package webhook
+
+import (
+	"net/http"
+	"tribbie/internal/auth"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/pagination"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers sets up the routing of the HTTP handlers.
+func RegisterHandlers(r *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	res := resource{service, logger}
+
+	r.Get("/webhooks", authHandler, res.query)
+	r.Post("/webhooks", authHandler, res.create)
+	r.Get("/webhooks/<id>", authHandler, res.get)
+	r.Delete("/webhooks/<id>", authHandler, res.delete)
+	r.Get("/webhooks/<id>/deliveries", authHandler, res.queryDeliveries)
+	r.Post("/webhooks/<id>/deliveries/<delivery_id>/replay", authHandler, res.replay)
+}
+
+type resource struct {
+	service Service
+	logger  log.Logger
+}
+
+// query returns a page of the webhooks of the current user.
+func (r resource) query(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	webhooks, err := r.service.Query(c.Request.Context(), identity.GetID())
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromSlice(c.Request, webhooks)
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// get returns a webhook of the current user.
+func (r resource) get(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	webhook, err := r.service.Get(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+// create registers a webhook for the current user. The response is the only time the signing secret is shown.
+func (r resource) create(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	var input CreateWebhookRequest
+	if err := c.Read(&input); err != nil {
+		r.logger.With(c.Request.Context()).Info(err)
+		return errors.BadRequest("")
+	}
+	webhook, err := r.service.Create(c.Request.Context(), identity.GetID(), input)
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(webhook, http.StatusCreated)
+}
+
+// delete removes a webhook of the current user.
+func (r resource) delete(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	webhook, err := r.service.Delete(c.Request.Context(), identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.Write(webhook)
+}
+
+// queryDeliveries returns a page of the deliveries of a webhook of the current user.
+func (r resource) queryDeliveries(c *routing.Context) error {
+	ctx := c.Request.Context()
+	identity := auth.CurrentUserDefault(ctx)
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	count, err := r.service.CountDeliveries(ctx, identity.GetID(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+	pages := pagination.NewFromRequest(c.Request, count)
+	deliveries, err := r.service.QueryDeliveries(ctx, identity.GetID(), c.Param("id"), pages.Offset(), pages.Limit())
+	if err != nil {
+		return err
+	}
+	pages.Items = deliveries
+	pages.SetLinkHeader(c.Response.Header(), c.Request)
+	return c.Write(pages)
+}
+
+// replay queues a past delivery of a webhook of the current user again.
+func (r resource) replay(c *routing.Context) error {
+	identity := auth.CurrentUserDefault(c.Request.Context())
+	if identity == nil {
+		return errors.Unauthorized("")
+	}
+	delivery, err := r.service.Replay(c.Request.Context(), identity.GetID(), c.Param("id"), c.Param("delivery_id"))
+	if err != nil {
+		return err
+	}
+	return c.WriteWithStatus(delivery, http.StatusAccepted)
+}
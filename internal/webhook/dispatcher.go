@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/secretbox"
+)
+
+const (
+	// maxAttempts is the number of attempts after which a delivery is marked as failed.
+	maxAttempts = 8
+	// retryDelay is the delay before the second attempt. It doubles with every further attempt.
+	retryDelay = 30 * time.Second
+	// batchSize is the number of deliveries claimed at once.
+	batchSize = 50
+	// requestTimeout is how long an attempt may take.
+	requestTimeout = 10 * time.Second
+	// claimTimeout is how long the deliveries of a batch are hidden from other dispatchers while they are sent.
+	// A delivery whose dispatcher stopped before recording the outcome is attempted again afterwards.
+	claimTimeout = batchSize*requestTimeout + time.Minute
+)
+
+// blockedNetworks lists the loopback, private, link-local and other special-purpose networks that webhooks
+// cannot be sent to, so that webhooks cannot reach internal services or cloud metadata endpoints.
+var blockedNetworks = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// Dispatcher sends the queued webhook deliveries.
+type Dispatcher struct {
+	repo     Repository
+	box      *secretbox.Box
+	client   *http.Client
+	interval time.Duration
+	logger   log.Logger
+}
+
+// NewDispatcher creates a new dispatcher checking for due deliveries every interval.
+// The box decrypts the signing secrets of the webhooks.
+func NewDispatcher(repo Repository, box *secretbox.Box, interval time.Duration, logger log.Logger) *Dispatcher {
+	return &Dispatcher{repo, box, newClient(), interval, logger}
+}
+
+// newClient returns an HTTP client that only connects to public IP addresses. The address is checked after the
+// host name is resolved, so that a host name resolving to an internal address is refused as well.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: requestTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isBlocked(ip) {
+				return fmt.Errorf("the address %v is not allowed", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     time.Minute,
+		},
+	}
+}
+
+// isBlocked tells whether the IP address belongs to a network webhooks cannot be sent to.
+func isBlocked(ip net.IP) bool {
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworks parses the given CIDR ranges. It panics if a range is invalid.
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the timestamp and the payload, joined by a dot.
+// Receivers verify the X-Tribbie-Signature header of a delivery by computing it with their signing secret.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Run sends the due deliveries every interval until the context is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+	for {
+		if err := d.RunOnce(ctx, time.Now()); err != nil {
+			d.logger.With(ctx).Errorf("failed to send webhook deliveries: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends all deliveries due at the given time.
+// The due deliveries are claimed within a short transaction and sent after it is committed, so that no rows stay
+// locked while waiting for the receivers.
+func (d *Dispatcher) RunOnce(ctx context.Context, now time.Time) error {
+	for {
+		deliveries, err := d.claim(ctx, now)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			if err := d.repo.UpdateDelivery(ctx, d.send(ctx, delivery, now)); err != nil {
+				return err
+			}
+		}
+		if len(deliveries) < batchSize {
+			return nil
+		}
+	}
+}
+
+// claim locks a batch of due deliveries and postpones their next attempt by the claim timeout.
+// It returns the deliveries as they were before being claimed.
+func (d *Dispatcher) claim(ctx context.Context, now time.Time) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := d.repo.Transactional(ctx, func(ctx context.Context) error {
+		var err error
+		if deliveries, err = d.repo.LockDue(ctx, now, batchSize); err != nil {
+			return err
+		}
+		until := now.Add(claimTimeout)
+		for _, delivery := range deliveries {
+			delivery.NextAttemptAt = &until
+			if err := d.repo.UpdateDelivery(ctx, delivery); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return deliveries, err
+}
+
+// send makes one attempt of the delivery and returns it with the outcome recorded.
+func (d *Dispatcher) send(ctx context.Context, delivery entity.WebhookDelivery, now time.Time) entity.WebhookDelivery {
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	delivery.ResponseCode = 0
+	delivery.Error = ""
+
+	webhook, err := d.repo.Get(ctx, delivery.WebhookId)
+	if err == sql.ErrNoRows {
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.Error = "the webhook was deleted"
+		return delivery
+	}
+	if err == nil {
+		delivery.ResponseCode, err = d.post(ctx, webhook, delivery, now)
+	}
+	if err == nil {
+		delivery.Status = entity.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		return delivery
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+	} else {
+		next := now.Add(retryDelay << uint(delivery.Attempts-1))
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
+
+// post sends the signed payload to the webhook URL and returns the response status code.
+// Responses other than 2xx are reported as errors.
+func (d *Dispatcher) post(ctx context.Context, webhook entity.Webhook, delivery entity.WebhookDelivery, now time.Time) (int, error) {
+	secret, err := d.box.Open(webhook.Secret)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tribbie-Webhooks")
+	req.Header.Set("X-Tribbie-Event", delivery.Event)
+	req.Header.Set("X-Tribbie-Delivery", delivery.ID)
+	req.Header.Set("X-Tribbie-Signature", fmt.Sprintf("t=%v,v1=%v", now.Unix(), Sign(string(secret), now.Unix(), []byte(delivery.Payload))))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("unexpected response status %v", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
@@ -0,0 +1,159 @@
+package webhook
+
+import (
+	"context"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/dbcontext"
+	"tribbie/pkg/log"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+)
+
+// Repository encapsulates the logic to access webhooks and their deliveries from the data source.
+type Repository interface {
+	// Transactional runs the function within a transaction. Deliveries locked by LockDue stay locked until it returns.
+	Transactional(ctx context.Context, f func(ctx context.Context) error) error
+	// Get returns the webhook with the specified ID.
+	Get(ctx context.Context, id string) (entity.Webhook, error)
+	// QueryByUser returns the webhooks owned by the user.
+	QueryByUser(ctx context.Context, userId string) ([]entity.Webhook, error)
+	// QueryByTrip returns the webhooks receiving the events of the trip: those registered for the trip and those
+	// registered for all trips by a member of the trip.
+	QueryByTrip(ctx context.Context, tripId string) ([]entity.Webhook, error)
+	// IsTripMember returns whether the user is a member of the trip.
+	IsTripMember(ctx context.Context, tripId, userId string) (bool, error)
+	// Create saves a new webhook in the storage.
+	Create(ctx context.Context, webhook entity.Webhook) error
+	// Delete removes the webhook with given ID and its deliveries from the storage.
+	Delete(ctx context.Context, id string) error
+
+	// GetDelivery returns the delivery with the specified ID.
+	GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error)
+	// QueryDeliveries returns the deliveries of the webhook, newest first.
+	QueryDeliveries(ctx context.Context, webhookId string, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries of the webhook.
+	CountDeliveries(ctx context.Context, webhookId string) (int, error)
+	// CreateDelivery saves a new delivery in the storage.
+	CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// UpdateDelivery updates the delivery with given ID in the storage.
+	UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error
+	// LockDue locks and returns pending deliveries whose next attempt is due at now.
+	// Rows locked by another transaction are skipped.
+	LockDue(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error)
+}
+
+// repository persists webhooks in database
+type repository struct {
+	db     *dbcontext.DB
+	logger log.Logger
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository(db *dbcontext.DB, logger log.Logger) Repository {
+	return repository{db, logger}
+}
+
+// Transactional runs the function within a database transaction.
+func (r repository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	return r.db.Transactional(ctx, f)
+}
+
+// Get reads the webhook with the specified ID from the database.
+func (r repository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	var webhook entity.Webhook
+	err := r.db.With(ctx).Select().Model(id, &webhook)
+	return webhook, err
+}
+
+// QueryByUser retrieves the webhooks of the user from the database.
+func (r repository) QueryByUser(ctx context.Context, userId string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).Select().Where(dbx.HashExp{"user_id": userId}).OrderBy("created_at").All(&webhooks)
+	return webhooks, err
+}
+
+// QueryByTrip retrieves the webhooks receiving the events of the trip from the database.
+func (r repository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	err := r.db.With(ctx).Select().
+		Where(dbx.Or(
+			dbx.HashExp{"trip_id": tripId},
+			dbx.NewExp("trip_id = '' AND user_id IN (SELECT user_id FROM trip_member WHERE trip_id = {:trip_id})", dbx.Params{"trip_id": tripId}),
+		)).
+		OrderBy("created_at").
+		All(&webhooks)
+	return webhooks, err
+}
+
+// IsTripMember checks the trip members in the database.
+func (r repository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("trip_member").Where(dbx.HashExp{"trip_id": tripId, "user_id": userId}).Row(&count)
+	return count > 0, err
+}
+
+// Create saves a new webhook record in the database.
+func (r repository) Create(ctx context.Context, webhook entity.Webhook) error {
+	return r.db.With(ctx).Model(&webhook).Insert()
+}
+
+// Delete deletes the webhook and its deliveries from the database.
+func (r repository) Delete(ctx context.Context, id string) error {
+	if _, err := r.db.With(ctx).Delete("webhook_delivery", dbx.HashExp{"webhook_id": id}).Execute(); err != nil {
+		return err
+	}
+	_, err := r.db.With(ctx).Delete("webhook", dbx.HashExp{"id": id}).Execute()
+	return err
+}
+
+// GetDelivery reads the delivery with the specified ID from the database.
+func (r repository) GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error) {
+	var delivery entity.WebhookDelivery
+	err := r.db.With(ctx).Select().Model(id, &delivery)
+	return delivery, err
+}
+
+// QueryDeliveries retrieves the deliveries of the webhook from the database.
+func (r repository) QueryDeliveries(ctx context.Context, webhookId string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).
+		Select().
+		Where(dbx.HashExp{"webhook_id": webhookId}).
+		OrderBy("created_at DESC", "id DESC").
+		Offset(int64(offset)).
+		Limit(int64(limit)).
+		All(&deliveries)
+	return deliveries, err
+}
+
+// CountDeliveries returns the number of deliveries of the webhook in the database.
+func (r repository) CountDeliveries(ctx context.Context, webhookId string) (int, error) {
+	var count int
+	err := r.db.With(ctx).Select("COUNT(*)").From("webhook_delivery").Where(dbx.HashExp{"webhook_id": webhookId}).Row(&count)
+	return count, err
+}
+
+// CreateDelivery saves a new delivery record in the database.
+func (r repository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Insert()
+}
+
+// UpdateDelivery saves the changes to a delivery in the database.
+func (r repository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	return r.db.With(ctx).Model(&delivery).Update()
+}
+
+// LockDue selects the due deliveries with FOR UPDATE SKIP LOCKED so that concurrent server instances never send
+// the same delivery twice.
+func (r repository) LockDue(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	err := r.db.With(ctx).NewQuery(`SELECT * FROM webhook_delivery
+		WHERE status = {:status} AND next_attempt_at <= {:now}
+		ORDER BY next_attempt_at
+		LIMIT {:limit}
+		FOR UPDATE SKIP LOCKED`).
+		Bind(dbx.Params{"status": entity.WebhookDeliveryPending, "now": now, "limit": limit}).
+		All(&deliveries)
+	return deliveries, err
+}
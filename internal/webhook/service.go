@@ -0,0 +1,283 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/internal/errors"
+	"tribbie/pkg/log"
+	"tribbie/pkg/secretbox"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// SecretPrefix is the prefix of webhook signing secrets.
+const SecretPrefix = "whsec_"
+
+// Service encapsulates usecase logic for webhooks.
+type Service interface {
+	// Query returns the webhooks of the user.
+	Query(ctx context.Context, userId string) ([]Webhook, error)
+	// Get returns the webhook of the user with the specified ID.
+	Get(ctx context.Context, userId, id string) (Webhook, error)
+	// Create registers a new webhook for the user. The signing secret is only returned here.
+	Create(ctx context.Context, userId string, input CreateWebhookRequest) (CreatedWebhook, error)
+	// Delete removes the webhook of the user with the specified ID.
+	Delete(ctx context.Context, userId, id string) (Webhook, error)
+	// QueryDeliveries returns the deliveries of the webhook of the user, newest first.
+	QueryDeliveries(ctx context.Context, userId, id string, offset, limit int) ([]entity.WebhookDelivery, error)
+	// CountDeliveries returns the number of deliveries of the webhook of the user.
+	CountDeliveries(ctx context.Context, userId, id string) (int, error)
+	// Replay sends the payload of a past delivery again as a new delivery.
+	Replay(ctx context.Context, userId, id, deliveryId string) (entity.WebhookDelivery, error)
+	// Publish queues the event for all webhooks of the trip subscribed to it. Failures are logged rather than
+	// returned so that they never fail the operation producing the event.
+	Publish(ctx context.Context, event, tripId string, data interface{})
+}
+
+// Webhook represents the data about a webhook.
+type Webhook struct {
+	entity.Webhook
+	Events []string `json:"events"`
+}
+
+// CreatedWebhook represents a newly created webhook together with its signing secret.
+type CreatedWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// Event represents the JSON payload delivered to a webhook.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	TripId    string      `json:"trip_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// CreateWebhookRequest represents a webhook creation request.
+// A webhook without a trip receives the events of all trips the user is a member of.
+type CreateWebhookRequest struct {
+	Url    string   `json:"url"`
+	TripId string   `json:"trip_id"`
+	Events []string `json:"events"`
+}
+
+// Validate validates the CreateWebhookRequest fields.
+func (m CreateWebhookRequest) Validate() error {
+	return validation.ValidateStruct(&m,
+		validation.Field(&m.Url, validation.Required, validation.Length(0, 1024), validation.By(validateURL)),
+		validation.Field(&m.TripId, validation.Length(0, 128)),
+		validation.Field(&m.Events, validation.Required, validation.Each(validation.In(
+			entity.WebhookEventTransactionCreated,
+			entity.WebhookEventPaymentConfirmed,
+			entity.WebhookEventMemberJoined,
+		))),
+	)
+}
+
+type service struct {
+	repo   Repository
+	box    *secretbox.Box
+	logger log.Logger
+}
+
+// NewService creates a new webhook service. The box encrypts the signing secrets at rest.
+func NewService(repo Repository, box *secretbox.Box, logger log.Logger) Service {
+	return service{repo, box, logger}
+}
+
+// Query returns the webhooks of the user.
+func (s service) Query(ctx context.Context, userId string) ([]Webhook, error) {
+	items, err := s.repo.QueryByUser(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	result := []Webhook{}
+	for _, item := range items {
+		result = append(result, newWebhook(item))
+	}
+	return result, nil
+}
+
+// Get returns the webhook with the specified ID. Webhooks of other users are not found.
+func (s service) Get(ctx context.Context, userId, id string) (Webhook, error) {
+	webhook, err := s.repo.Get(ctx, id)
+	if err == sql.ErrNoRows || err == nil && webhook.UserId != userId {
+		return Webhook{}, errors.NotFound("")
+	} else if err != nil {
+		return Webhook{}, err
+	}
+	return newWebhook(webhook), nil
+}
+
+// Create registers a new webhook with a random signing secret. Only members of a trip can register a webhook for it.
+func (s service) Create(ctx context.Context, userId string, req CreateWebhookRequest) (CreatedWebhook, error) {
+	if err := req.Validate(); err != nil {
+		return CreatedWebhook{}, err
+	}
+	if req.TripId != "" {
+		member, err := s.repo.IsTripMember(ctx, req.TripId, userId)
+		if err != nil {
+			return CreatedWebhook{}, err
+		}
+		if !member {
+			return CreatedWebhook{}, errors.Forbidden("Only the members of the trip can register webhooks for it.")
+		}
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return CreatedWebhook{}, err
+	}
+	sealed, err := s.box.Seal([]byte(secret))
+	if err != nil {
+		return CreatedWebhook{}, err
+	}
+	now := time.Now()
+	webhook := entity.Webhook{
+		ID:        entity.GenerateID(),
+		UserId:    userId,
+		TripId:    req.TripId,
+		Url:       req.Url,
+		Events:    strings.Join(req.Events, ","),
+		Secret:    sealed,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.repo.Create(ctx, webhook); err != nil {
+		return CreatedWebhook{}, err
+	}
+	return CreatedWebhook{newWebhook(webhook), secret}, nil
+}
+
+// Delete removes the webhook with the specified ID together with its deliveries.
+func (s service) Delete(ctx context.Context, userId, id string) (Webhook, error) {
+	webhook, err := s.Get(ctx, userId, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return Webhook{}, err
+	}
+	return webhook, nil
+}
+
+// QueryDeliveries returns the deliveries of the webhook with the specified offset and limit.
+func (s service) QueryDeliveries(ctx context.Context, userId, id string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, userId, id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.QueryDeliveries(ctx, id, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []entity.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+// CountDeliveries returns the number of deliveries of the webhook.
+func (s service) CountDeliveries(ctx context.Context, userId, id string) (int, error) {
+	if _, err := s.Get(ctx, userId, id); err != nil {
+		return 0, err
+	}
+	return s.repo.CountDeliveries(ctx, id)
+}
+
+// Replay queues a new delivery with the event and payload of the given delivery.
+func (s service) Replay(ctx context.Context, userId, id, deliveryId string) (entity.WebhookDelivery, error) {
+	if _, err := s.Get(ctx, userId, id); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	delivery, err := s.repo.GetDelivery(ctx, deliveryId)
+	if err == sql.ErrNoRows || err == nil && delivery.WebhookId != id {
+		return entity.WebhookDelivery{}, errors.NotFound("")
+	} else if err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	replay := newDelivery(id, delivery.EventId, delivery.Event, delivery.Payload, time.Now())
+	if err := s.repo.CreateDelivery(ctx, replay); err != nil {
+		return entity.WebhookDelivery{}, err
+	}
+	return replay, nil
+}
+
+// Publish queues a delivery of the event for every webhook of the trip subscribed to it.
+func (s service) Publish(ctx context.Context, event, tripId string, data interface{}) {
+	webhooks, err := s.repo.QueryByTrip(ctx, tripId)
+	if err != nil {
+		s.logger.With(ctx).Errorf("failed to publish %v of trip %v: %v", event, tripId, err)
+		return
+	}
+	now := time.Now()
+	payload := Event{ID: entity.GenerateID(), Type: event, TripId: tripId, CreatedAt: now, Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.With(ctx).Errorf("failed to publish %v of trip %v: %v", event, tripId, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.Subscribes(event) {
+			continue
+		}
+		if err := s.repo.CreateDelivery(ctx, newDelivery(webhook.ID, payload.ID, event, string(body), now)); err != nil {
+			s.logger.With(ctx).Errorf("failed to queue %v for webhook %v: %v", event, webhook.ID, err)
+		}
+	}
+}
+
+// newWebhook converts the stored webhook into its API representation.
+func newWebhook(webhook entity.Webhook) Webhook {
+	return Webhook{webhook, strings.Split(webhook.Events, ",")}
+}
+
+// newDelivery creates a pending delivery due at the given time.
+func newDelivery(webhookId, eventId, event, payload string, now time.Time) entity.WebhookDelivery {
+	return entity.WebhookDelivery{
+		ID:            entity.GenerateID(),
+		WebhookId:     webhookId,
+		EventId:       eventId,
+		Event:         event,
+		Payload:       payload,
+		Status:        entity.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// generateSecret returns a new random signing secret.
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validateURL checks that the value is an absolute http(s) URL that does not point to the local host or to an
+// internal network. Host names are checked again once resolved when the deliveries are sent.
+func validateURL(value interface{}) error {
+	s, _ := value.(string)
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return validation.NewError("validation_is_url", "must be a valid URL")
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if ip := net.ParseIP(host); ip != nil && isBlocked(ip) || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return validation.NewError("validation_url_internal", "must not point to an internal address")
+	}
+	return nil
+}
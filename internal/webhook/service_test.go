@@ -0,0 +1,261 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+	"tribbie/internal/entity"
+	"tribbie/pkg/log"
+	"tribbie/pkg/secretbox"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhooks(t *testing.T) {
+	logger, _ := log.NewForTest()
+	box, _ := secretbox.New(make([]byte, secretbox.KeySize))
+	repo := &mockRepository{members: map[string][]string{"trip1": {"alice", "bob"}}}
+	s := NewService(repo, box, logger)
+	d := NewDispatcher(repo, box, time.Minute, logger)
+	ctx := context.Background()
+
+	var secret string
+	status := http.StatusInternalServerError
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var timestamp int64
+		var signature string
+		_, _ = fmt.Sscanf(r.Header.Get("X-Tribbie-Signature"), "t=%d,v1=%s", &timestamp, &signature)
+		assert.Equal(t, Sign(secret, timestamp, body), signature)
+		var event Event
+		_ = json.Unmarshal(body, &event)
+		assert.Equal(t, event.Type, r.Header.Get("X-Tribbie-Event"))
+		// no rows are locked while waiting for the receiver
+		assert.False(t, repo.inTransaction)
+		received = append(received, event)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	// the receiver is reached through a public host name; the test server itself listens on the loopback address
+	d.client = &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return net.Dial(network, server.Listener.Addr().String())
+	}}}
+	url := "http://hooks.example.com/tribbie"
+
+	// only members can register webhooks for a trip
+	_, err := s.Create(ctx, "carol", CreateWebhookRequest{Url: url, TripId: "trip1", Events: []string{entity.WebhookEventTransactionCreated}})
+	assert.NotNil(t, err)
+	_, err = s.Create(ctx, "alice", CreateWebhookRequest{Url: "ftp://example.com", Events: []string{entity.WebhookEventTransactionCreated}})
+	assert.NotNil(t, err)
+
+	tripHook, err := s.Create(ctx, "alice", CreateWebhookRequest{Url: url, TripId: "trip1", Events: []string{entity.WebhookEventTransactionCreated}})
+	assert.Nil(t, err)
+	secret = tripHook.Secret
+	// a webhook of bob for all his trips, subscribed to another event
+	_, err = s.Create(ctx, "bob", CreateWebhookRequest{Url: url, Events: []string{entity.WebhookEventMemberJoined}})
+	assert.Nil(t, err)
+
+	s.Publish(ctx, entity.WebhookEventTransactionCreated, "trip1", map[string]string{"id": "t1"})
+	s.Publish(ctx, entity.WebhookEventTransactionCreated, "trip2", map[string]string{"id": "t2"})
+	assert.Len(t, repo.deliveries, 1)
+
+	// a failed attempt is retried with exponential backoff
+	now := time.Now()
+	assert.Nil(t, d.RunOnce(ctx, now))
+	delivery := repo.deliveries[0]
+	assert.Equal(t, entity.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusInternalServerError, delivery.ResponseCode)
+	assert.Equal(t, now.Add(retryDelay), *delivery.NextAttemptAt)
+	assert.Nil(t, d.RunOnce(ctx, now.Add(retryDelay)))
+	assert.Equal(t, now.Add(3*retryDelay), *repo.deliveries[0].NextAttemptAt)
+	// not due yet
+	assert.Nil(t, d.RunOnce(ctx, now.Add(2*retryDelay)))
+	assert.Len(t, received, 2)
+
+	status = http.StatusNoContent
+	assert.Nil(t, d.RunOnce(ctx, now.Add(3*retryDelay)))
+	delivery = repo.deliveries[0]
+	assert.Equal(t, entity.WebhookDeliverySucceeded, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.ResponseCode)
+	if assert.Len(t, received, 3) {
+		assert.Equal(t, "trip1", received[2].TripId)
+		assert.Equal(t, received[0].ID, received[2].ID)
+	}
+
+	// deliveries are listed for the owner only and can be replayed
+	_, err = s.QueryDeliveries(ctx, "bob", tripHook.ID, 0, 10)
+	assert.NotNil(t, err)
+	deliveries, err := s.QueryDeliveries(ctx, "alice", tripHook.ID, 0, 10)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	replay, err := s.Replay(ctx, "alice", tripHook.ID, delivery.ID)
+	assert.Nil(t, err)
+	assert.Nil(t, d.RunOnce(ctx, replay.CreatedAt))
+	assert.Len(t, received, 4)
+	count, _ := s.CountDeliveries(ctx, "alice", tripHook.ID)
+	assert.Equal(t, 2, count)
+}
+
+func TestInternalAddresses(t *testing.T) {
+	for _, url := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://10.1.2.3/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://[::ffff:192.168.1.1]/hook",
+	} {
+		assert.NotNil(t, validateURL(url), url)
+	}
+	assert.Nil(t, validateURL("https://hooks.example.com/tribbie"))
+
+	// host names resolving to an internal address are refused when connecting
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, err := newClient().Get(server.URL)
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "is not allowed")
+	}
+}
+
+func TestDispatcher_maxAttempts(t *testing.T) {
+	logger, _ := log.NewForTest()
+	box, _ := secretbox.New(make([]byte, secretbox.KeySize))
+	now := time.Now()
+	repo := &mockRepository{deliveries: []entity.WebhookDelivery{newDelivery("deleted", "e1", entity.WebhookEventMemberJoined, "{}", now)}}
+	d := NewDispatcher(repo, box, time.Minute, logger)
+
+	// deliveries of deleted webhooks fail at once
+	assert.Nil(t, d.RunOnce(context.Background(), now))
+	assert.Equal(t, entity.WebhookDeliveryFailed, repo.deliveries[0].Status)
+	assert.Nil(t, repo.deliveries[0].NextAttemptAt)
+
+	delivery := d.send(context.Background(), entity.WebhookDelivery{WebhookId: "deleted", Attempts: maxAttempts - 1}, now)
+	assert.Equal(t, entity.WebhookDeliveryFailed, delivery.Status)
+}
+
+type mockRepository struct {
+	members       map[string][]string
+	webhooks      []entity.Webhook
+	deliveries    []entity.WebhookDelivery
+	inTransaction bool
+}
+
+func (m *mockRepository) Transactional(ctx context.Context, f func(ctx context.Context) error) error {
+	m.inTransaction = true
+	defer func() { m.inTransaction = false }()
+	return f(ctx)
+}
+
+func (m *mockRepository) Get(ctx context.Context, id string) (entity.Webhook, error) {
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return entity.Webhook{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryByUser(ctx context.Context, userId string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.UserId == userId {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) QueryByTrip(ctx context.Context, tripId string) ([]entity.Webhook, error) {
+	var webhooks []entity.Webhook
+	for _, webhook := range m.webhooks {
+		member, _ := m.IsTripMember(ctx, tripId, webhook.UserId)
+		if webhook.TripId == tripId || webhook.TripId == "" && member {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockRepository) IsTripMember(ctx context.Context, tripId, userId string) (bool, error) {
+	for _, member := range m.members[tripId] {
+		if member == userId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockRepository) Create(ctx context.Context, webhook entity.Webhook) error {
+	m.webhooks = append(m.webhooks, webhook)
+	return nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id string) error {
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) GetDelivery(ctx context.Context, id string) (entity.WebhookDelivery, error) {
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return entity.WebhookDelivery{}, sql.ErrNoRows
+}
+
+func (m *mockRepository) QueryDeliveries(ctx context.Context, webhookId string, offset, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookId == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockRepository) CountDeliveries(ctx context.Context, webhookId string) (int, error) {
+	deliveries, _ := m.QueryDeliveries(ctx, webhookId, 0, 0)
+	return len(deliveries), nil
+}
+
+func (m *mockRepository) CreateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	m.deliveries = append(m.deliveries, delivery)
+	return nil
+}
+
+func (m *mockRepository) UpdateDelivery(ctx context.Context, delivery entity.WebhookDelivery) error {
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == delivery.ID {
+			m.deliveries[i] = delivery
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) LockDue(ctx context.Context, now time.Time, limit int) ([]entity.WebhookDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == entity.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].NextAttemptAt.Before(*deliveries[j].NextAttemptAt) })
+	return deliveries, nil
+}
@@ -0,0 +1,21 @@
+CREATE TABLE session
+(
+    id          VARCHAR PRIMARY KEY,
+    user_id     VARCHAR NOT NULL,
+    revoked_at  TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX session_user_id_idx ON session (user_id);
+CREATE TABLE refresh_token
+(
+    id          VARCHAR PRIMARY KEY,
+    session_id  VARCHAR NOT NULL,
+    user_id     VARCHAR NOT NULL,
+    token_hash  VARCHAR NOT NULL UNIQUE,
+    expires_at  TIMESTAMP NOT NULL,
+    used_at     TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX refresh_token_session_id_idx ON refresh_token (session_id);
@@ -0,0 +1,2 @@
+DROP TABLE user_token;
+ALTER TABLE user_default DROP COLUMN email_verified_at;
@@ -0,0 +1,13 @@
+ALTER TABLE user_default ADD COLUMN email_verified_at TIMESTAMP;
+CREATE TABLE user_token
+(
+    id          VARCHAR PRIMARY KEY,
+    user_id     VARCHAR NOT NULL,
+    purpose     VARCHAR NOT NULL,
+    token_hash  VARCHAR NOT NULL UNIQUE,
+    expires_at  TIMESTAMP NOT NULL,
+    used_at     TIMESTAMP,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX user_token_user_id_idx ON user_token (user_id, purpose);
@@ -0,0 +1,16 @@
+CREATE TABLE access_token
+(
+    id           VARCHAR PRIMARY KEY,
+    user_id      VARCHAR NOT NULL,
+    name         VARCHAR NOT NULL,
+    scope        VARCHAR NOT NULL,
+    trip_id      VARCHAR NOT NULL DEFAULT '',
+    token_hash   VARCHAR NOT NULL UNIQUE,
+    expires_at   TIMESTAMP,
+    last_used_at TIMESTAMP,
+    last_used_ip VARCHAR NOT NULL DEFAULT '',
+    revoked_at   TIMESTAMP,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL
+);
+CREATE INDEX access_token_user_id_idx ON access_token (user_id);
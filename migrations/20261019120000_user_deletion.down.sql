@@ -0,0 +1 @@
+ALTER TABLE user_default DROP COLUMN deleted_at;
@@ -0,0 +1 @@
+ALTER TABLE user_default ADD COLUMN deleted_at TIMESTAMP;
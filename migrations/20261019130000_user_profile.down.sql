@@ -0,0 +1,9 @@
+ALTER TABLE transaction_payment DROP COLUMN currency;
+ALTER TABLE trip DROP COLUMN time_zone;
+ALTER TABLE trip DROP COLUMN currency;
+ALTER TABLE user_default DROP COLUMN payout_details;
+ALTER TABLE user_default DROP COLUMN time_zone;
+ALTER TABLE user_default DROP COLUMN locale;
+ALTER TABLE user_default DROP COLUMN preferred_currency;
+ALTER TABLE user_default DROP COLUMN avatar_url;
+ALTER TABLE user_default DROP COLUMN display_name;
@@ -0,0 +1,9 @@
+ALTER TABLE user_default ADD COLUMN display_name VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE user_default ADD COLUMN avatar_url VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE user_default ADD COLUMN preferred_currency VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE user_default ADD COLUMN locale VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE user_default ADD COLUMN time_zone VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE user_default ADD COLUMN payout_details VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip ADD COLUMN currency VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip ADD COLUMN time_zone VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE transaction_payment ADD COLUMN currency VARCHAR NOT NULL DEFAULT '';
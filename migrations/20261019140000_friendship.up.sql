@@ -0,0 +1,10 @@
+CREATE TABLE friendship
+(
+    id          VARCHAR PRIMARY KEY,
+    user_id     VARCHAR NOT NULL,
+    friend_id   VARCHAR NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL,
+    UNIQUE (user_id, friend_id)
+);
+CREATE INDEX friendship_friend_id_idx ON friendship (friend_id);
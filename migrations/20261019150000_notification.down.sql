@@ -0,0 +1,2 @@
+ALTER TABLE trip DROP COLUMN budget;
+DROP TABLE notification;
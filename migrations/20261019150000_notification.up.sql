@@ -0,0 +1,16 @@
+CREATE TABLE notification
+(
+    id          VARCHAR PRIMARY KEY,
+    user_id     VARCHAR NOT NULL,
+    actor_id    VARCHAR NOT NULL DEFAULT '',
+    kind        VARCHAR NOT NULL,
+    trip_id     VARCHAR NOT NULL DEFAULT '',
+    subject_id  VARCHAR NOT NULL DEFAULT '',
+    title       VARCHAR NOT NULL,
+    body        VARCHAR NOT NULL DEFAULT '',
+    read_at     TIMESTAMP NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX notification_user_id_created_at_idx ON notification (user_id, created_at DESC);
+ALTER TABLE trip ADD COLUMN budget BIGINT NOT NULL DEFAULT 0;
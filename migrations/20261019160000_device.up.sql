@@ -0,0 +1,13 @@
+CREATE TABLE device
+(
+    id              VARCHAR PRIMARY KEY,
+    user_id         VARCHAR NOT NULL,
+    platform        VARCHAR NOT NULL,
+    push_token      VARCHAR NOT NULL UNIQUE,
+    name            VARCHAR NOT NULL DEFAULT '',
+    failure_count   INTEGER NOT NULL DEFAULT 0,
+    last_pushed_at  TIMESTAMP NULL,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX device_user_id_idx ON device (user_id);
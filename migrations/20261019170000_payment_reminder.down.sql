@@ -0,0 +1,4 @@
+DROP INDEX transaction_payment_reminder_idx;
+ALTER TABLE transaction_payment DROP COLUMN next_reminder_at;
+ALTER TABLE transaction_payment DROP COLUMN last_reminded_at;
+ALTER TABLE transaction_payment DROP COLUMN reminder_count;
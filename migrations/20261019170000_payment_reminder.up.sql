@@ -0,0 +1,4 @@
+ALTER TABLE transaction_payment ADD COLUMN reminder_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE transaction_payment ADD COLUMN last_reminded_at TIMESTAMP NULL;
+ALTER TABLE transaction_payment ADD COLUMN next_reminder_at TIMESTAMP NULL;
+CREATE INDEX transaction_payment_reminder_idx ON transaction_payment (status, next_reminder_at);
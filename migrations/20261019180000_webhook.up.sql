@@ -0,0 +1,32 @@
+CREATE TABLE webhook
+(
+    id          VARCHAR PRIMARY KEY,
+    user_id     VARCHAR NOT NULL,
+    trip_id     VARCHAR NOT NULL DEFAULT '',
+    url         VARCHAR NOT NULL,
+    events      VARCHAR NOT NULL,
+    secret      VARCHAR NOT NULL,
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX webhook_user_id_idx ON webhook (user_id);
+CREATE INDEX webhook_trip_id_idx ON webhook (trip_id);
+
+CREATE TABLE webhook_delivery
+(
+    id               VARCHAR PRIMARY KEY,
+    webhook_id       VARCHAR NOT NULL,
+    event_id         VARCHAR NOT NULL,
+    event            VARCHAR NOT NULL,
+    payload          TEXT NOT NULL,
+    status           VARCHAR NOT NULL,
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    response_code    INTEGER NOT NULL DEFAULT 0,
+    error            VARCHAR NOT NULL DEFAULT '',
+    next_attempt_at  TIMESTAMP NULL,
+    delivered_at     TIMESTAMP NULL,
+    created_at       TIMESTAMP NOT NULL,
+    updated_at       TIMESTAMP NOT NULL
+);
+CREATE INDEX webhook_delivery_webhook_id_idx ON webhook_delivery (webhook_id, created_at DESC);
+CREATE INDEX webhook_delivery_due_idx ON webhook_delivery (status, next_attempt_at);
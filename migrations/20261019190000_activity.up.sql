@@ -0,0 +1,11 @@
+CREATE TABLE activity
+(
+    id          VARCHAR PRIMARY KEY,
+    trip_id     VARCHAR NOT NULL,
+    actor_id    VARCHAR NOT NULL DEFAULT '',
+    kind        VARCHAR NOT NULL,
+    subject_id  VARCHAR NOT NULL DEFAULT '',
+    message     VARCHAR NOT NULL,
+    created_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX activity_trip_id_created_at_idx ON activity (trip_id, created_at DESC);
@@ -0,0 +1,23 @@
+CREATE TABLE comment
+(
+    id              VARCHAR PRIMARY KEY,
+    transaction_id  VARCHAR NOT NULL,
+    trip_id         VARCHAR NOT NULL,
+    user_id         VARCHAR NOT NULL,
+    parent_id       VARCHAR NOT NULL DEFAULT '',
+    body            VARCHAR NOT NULL,
+    deleted_at      TIMESTAMP NULL,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX comment_transaction_id_idx ON comment (transaction_id, created_at);
+CREATE TABLE reaction
+(
+    id              VARCHAR PRIMARY KEY,
+    transaction_id  VARCHAR NOT NULL,
+    comment_id      VARCHAR NOT NULL DEFAULT '',
+    user_id         VARCHAR NOT NULL,
+    emoji           VARCHAR NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    UNIQUE (transaction_id, comment_id, user_id, emoji)
+);
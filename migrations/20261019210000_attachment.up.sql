@@ -0,0 +1,18 @@
+CREATE TABLE attachment
+(
+    id              VARCHAR PRIMARY KEY,
+    trip_id         VARCHAR NOT NULL,
+    transaction_id  VARCHAR NOT NULL DEFAULT '',
+    payment_id      VARCHAR NOT NULL DEFAULT '',
+    user_id         VARCHAR NOT NULL,
+    file_name       VARCHAR NOT NULL,
+    content_type    VARCHAR NOT NULL,
+    size            BIGINT NOT NULL,
+    width           INTEGER NOT NULL DEFAULT 0,
+    height          INTEGER NOT NULL DEFAULT 0,
+    storage_key     VARCHAR NOT NULL,
+    thumbnail_key   VARCHAR NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL
+);
+CREATE INDEX attachment_transaction_id_idx ON attachment (transaction_id);
+CREATE INDEX attachment_payment_id_idx ON attachment (payment_id);
@@ -0,0 +1,9 @@
+DROP TABLE photo;
+DROP TABLE album;
+CREATE TABLE album
+(
+    id         VARCHAR PRIMARY KEY,
+    name       VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,32 @@
+DROP TABLE IF EXISTS album;
+CREATE TABLE album
+(
+    id          VARCHAR PRIMARY KEY,
+    trip_id     VARCHAR NOT NULL,
+    user_id     VARCHAR NOT NULL,
+    name        VARCHAR NOT NULL,
+    description VARCHAR NOT NULL DEFAULT '',
+    created_at  TIMESTAMP NOT NULL,
+    updated_at  TIMESTAMP NOT NULL
+);
+CREATE INDEX album_trip_id_idx ON album (trip_id);
+CREATE TABLE photo
+(
+    id            VARCHAR PRIMARY KEY,
+    album_id      VARCHAR NOT NULL,
+    trip_id       VARCHAR NOT NULL,
+    user_id       VARCHAR NOT NULL,
+    caption       VARCHAR NOT NULL DEFAULT '',
+    content_type  VARCHAR NOT NULL,
+    size          BIGINT NOT NULL,
+    width         INTEGER NOT NULL,
+    height        INTEGER NOT NULL,
+    taken_at      TIMESTAMP WITH TIME ZONE,
+    latitude      DOUBLE PRECISION,
+    longitude     DOUBLE PRECISION,
+    storage_key   VARCHAR NOT NULL,
+    thumbnail_key VARCHAR NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    updated_at    TIMESTAMP NOT NULL
+);
+CREATE INDEX photo_album_id_taken_at_idx ON photo (album_id, taken_at, created_at);
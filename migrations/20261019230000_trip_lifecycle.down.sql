@@ -0,0 +1,5 @@
+DROP INDEX trip_status_idx;
+ALTER TABLE trip DROP COLUMN status;
+ALTER TABLE trip DROP COLUMN cover_image;
+ALTER TABLE trip DROP COLUMN end_date;
+ALTER TABLE trip DROP COLUMN start_date;
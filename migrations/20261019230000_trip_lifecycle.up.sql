@@ -0,0 +1,5 @@
+ALTER TABLE trip ADD COLUMN start_date VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip ADD COLUMN end_date VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip ADD COLUMN cover_image VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip ADD COLUMN status VARCHAR NOT NULL DEFAULT 'planning';
+CREATE INDEX trip_status_idx ON trip (status);
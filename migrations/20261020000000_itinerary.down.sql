@@ -0,0 +1,2 @@
+DROP TABLE itinerary_entry;
+DROP TABLE itinerary_day;
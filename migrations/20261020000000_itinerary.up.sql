@@ -0,0 +1,30 @@
+CREATE TABLE itinerary_day
+(
+    id         VARCHAR PRIMARY KEY,
+    trip_id    VARCHAR NOT NULL,
+    date       VARCHAR NOT NULL,
+    title      VARCHAR NOT NULL DEFAULT '',
+    notes      VARCHAR NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (trip_id, date)
+);
+CREATE TABLE itinerary_entry
+(
+    id                VARCHAR PRIMARY KEY,
+    trip_id           VARCHAR NOT NULL,
+    day_id            VARCHAR NOT NULL,
+    position          INTEGER NOT NULL,
+    activity          VARCHAR NOT NULL,
+    place             VARCHAR NOT NULL DEFAULT '',
+    start_time        VARCHAR NOT NULL DEFAULT '',
+    end_time          VARCHAR NOT NULL DEFAULT '',
+    notes             VARCHAR NOT NULL DEFAULT '',
+    booking_reference VARCHAR NOT NULL DEFAULT '',
+    estimated_cost    BIGINT NOT NULL DEFAULT 0,
+    transaction_id    VARCHAR NOT NULL DEFAULT '',
+    created_at        TIMESTAMP NOT NULL,
+    updated_at        TIMESTAMP NOT NULL
+);
+CREATE INDEX itinerary_entry_trip_id_idx ON itinerary_entry (trip_id);
+CREATE INDEX itinerary_entry_day_id_idx ON itinerary_entry (day_id, position);
@@ -0,0 +1,4 @@
+DROP INDEX transaction_item_trip_id_idx;
+DROP INDEX transaction_trip_id_idx;
+DROP INDEX transaction_item_search_idx;
+DROP INDEX transaction_search_idx;
@@ -0,0 +1,6 @@
+CREATE INDEX transaction_search_idx ON transaction
+    USING GIN (to_tsvector('simple'::regconfig, COALESCE(title, '') || ' ' || COALESCE(description, '')));
+CREATE INDEX transaction_item_search_idx ON transaction_item
+    USING GIN (to_tsvector('simple'::regconfig, COALESCE(title, '') || ' ' || COALESCE(description, '')));
+CREATE INDEX transaction_trip_id_idx ON transaction (trip_id);
+CREATE INDEX transaction_item_trip_id_idx ON transaction_item (trip_id);
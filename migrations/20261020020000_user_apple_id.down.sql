@@ -0,0 +1 @@
+DROP INDEX user_default_apple_id_idx;
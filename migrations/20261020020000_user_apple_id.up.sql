@@ -0,0 +1 @@
+CREATE UNIQUE INDEX user_default_apple_id_idx ON user_default (apple_id) WHERE apple_id <> '' AND deleted_at IS NULL;
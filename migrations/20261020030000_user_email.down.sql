@@ -0,0 +1 @@
+DROP INDEX user_default_email_idx;
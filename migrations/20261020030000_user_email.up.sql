@@ -0,0 +1 @@
+CREATE UNIQUE INDEX user_default_email_idx ON user_default (email) WHERE email <> '' AND deleted_at IS NULL;
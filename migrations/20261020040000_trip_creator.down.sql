@@ -0,0 +1,2 @@
+ALTER TABLE trip_member DROP COLUMN role;
+ALTER TABLE trip DROP COLUMN created_by;
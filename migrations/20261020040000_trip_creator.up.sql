@@ -0,0 +1,5 @@
+ALTER TABLE trip ADD COLUMN created_by VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE trip_member ADD COLUMN role VARCHAR NOT NULL DEFAULT 'member';
+UPDATE trip_member SET role = 'admin' WHERE id IN (
+    SELECT DISTINCT ON (trip_id) id FROM trip_member WHERE user_id <> '' ORDER BY trip_id, created_at
+);
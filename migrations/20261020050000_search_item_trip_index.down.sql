@@ -0,0 +1 @@
+CREATE INDEX transaction_item_trip_id_idx ON transaction_item (trip_id);
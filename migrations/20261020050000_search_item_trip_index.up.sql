@@ -0,0 +1 @@
+DROP INDEX transaction_item_trip_id_idx;
@@ -0,0 +1,154 @@
+// Package blobstore provides a simple abstraction for storing binary objects such as uploaded files, together with
+// local-filesystem, S3-compatible and in-memory implementations.
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned when no object is stored under the requested key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store stores objects under slash-separated keys such as "attachments/<id>/original".
+type Store interface {
+	// Put stores the data under the key, replacing any existing object.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns a reader of the object stored under the key. The caller must close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object stored under the key. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey returns whether the key is safe to use as a relative file path.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// errInvalidKey is returned for keys that are empty or could escape the storage location.
+var errInvalidKey = errors.New("invalid blob key")
+
+type local struct {
+	dir string
+}
+
+// NewLocal creates a Store keeping the objects as files under the given directory.
+func NewLocal(dir string) Store {
+	return local{dir}
+}
+
+// Put writes the object to a temporary file first so that readers never see a partial object.
+func (s local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens the file of the object.
+func (s local) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if !validKey(key) {
+		return nil, errInvalidKey
+	}
+	f, err := os.Open(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes the file of the object.
+func (s local) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Memory is a Store keeping the objects in memory, e.g. for tests.
+type Memory struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemory creates a new in-memory Store.
+func NewMemory() *Memory {
+	return &Memory{objects: map[string][]byte{}}
+}
+
+// Put stores a copy of the data.
+func (m *Memory) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return errInvalidKey
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Get returns a reader of the stored data.
+func (m *Memory) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Delete removes the stored data.
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+// Keys returns the keys of the stored objects.
+func (m *Memory) Keys() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key := range m.objects {
+		keys = append(keys, key)
+	}
+	return keys
+}
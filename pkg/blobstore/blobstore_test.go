@@ -0,0 +1,98 @@
+package blobstore
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	_, err := store.Get(ctx, "attachments/a1/original")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.Nil(t, store.Put(ctx, "attachments/a1/original", []byte("receipt"), "image/jpeg"))
+	assert.Nil(t, store.Put(ctx, "attachments/a1/original", []byte("receipt v2"), "image/jpeg"))
+	r, err := store.Get(ctx, "attachments/a1/original")
+	if assert.Nil(t, err) {
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		assert.Equal(t, "receipt v2", string(data))
+	}
+
+	assert.Nil(t, store.Delete(ctx, "attachments/a1/original"))
+	assert.Nil(t, store.Delete(ctx, "attachments/a1/original"))
+	_, err = store.Get(ctx, "attachments/a1/original")
+	assert.Equal(t, ErrNotFound, err)
+
+	assert.NotNil(t, store.Put(ctx, "../escape", []byte("x"), ""))
+	assert.NotNil(t, store.Put(ctx, "/absolute", []byte("x"), ""))
+}
+
+func TestLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	testStore(t, NewLocal(dir))
+}
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestS3(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") ||
+			r.Header.Get("X-Amz-Content-Sha256") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = string(body)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewS3(server.URL, "us-east-1", "receipts", "minio", "minio123")
+	assert.Nil(t, err)
+	testStore(t, store)
+
+	_, err = NewS3("localhost:9000", "us-east-1", "receipts", "minio", "minio123")
+	assert.NotNil(t, err)
+}
+
+func TestSign(t *testing.T) {
+	// the "get-vanilla" case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	emptyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	Sign(req, emptyHash, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+}
@@ -0,0 +1,106 @@
+// Package ical writes calendars in the iCalendar format (RFC 5545), e.g. for exporting a trip itinerary to a
+// calendar app.
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar data.
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineLength is the largest length of a content line in octets, excluding the line break.
+const maxLineLength = 75
+
+// Calendar represents a calendar of events.
+type Calendar struct {
+	// ProdID identifies the product that created the calendar, e.g. "-//Tribbie//Itinerary//EN".
+	ProdID string
+	// Name is the name calendar apps display for the calendar.
+	Name   string
+	Events []Event
+}
+
+// Event represents an event of a calendar. All-day events span the dates of Start to End, excluding End. Other
+// events are written in UTC.
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Summary     string
+	Location    string
+	Description string
+	// Stamp is the time the event was last modified.
+	Stamp time.Time
+}
+
+// Marshal returns the calendar in the iCalendar format.
+func (c Calendar) Marshal() []byte {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		writeLine(&buf, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		line("X-WR-CALNAME", Escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", formatTime(e.Stamp))
+		if e.AllDay {
+			line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+			line("DTEND;VALUE=DATE", e.End.Format("20060102"))
+		} else {
+			line("DTSTART", formatTime(e.Start))
+			line("DTEND", formatTime(e.End))
+		}
+		line("SUMMARY", Escape(e.Summary))
+		if e.Location != "" {
+			line("LOCATION", Escape(e.Location))
+		}
+		if e.Description != "" {
+			line("DESCRIPTION", Escape(e.Description))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+// Escape escapes the special characters of a text value.
+func Escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// formatTime formats the time in UTC.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// writeLine writes a content line terminated by CRLF, folding it into lines of at most maxLineLength octets
+// without splitting multi-byte characters. Continuation lines start with a space.
+func writeLine(buf *bytes.Buffer, s string) {
+	limit := maxLineLength
+	for len(s) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		buf.WriteString(s[:i])
+		buf.WriteString("\r\n ")
+		s = s[i:]
+		// the leading space counts towards the length of continuation lines
+		limit = maxLineLength - 1
+	}
+	buf.WriteString(s)
+	buf.WriteString("\r\n")
+}
@@ -0,0 +1,54 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendar_Marshal(t *testing.T) {
+	wita := time.FixedZone("WITA", 8*3600)
+	calendar := Calendar{
+		ProdID: "-//Tribbie//Itinerary//EN",
+		Name:   "Bali, 2026",
+		Events: []Event{
+			{
+				UID:         "e1@tribbie",
+				Start:       time.Date(2026, 7, 14, 19, 0, 0, 0, wita),
+				End:         time.Date(2026, 7, 14, 21, 30, 0, 0, wita),
+				Summary:     "Dinner; seafood",
+				Location:    "Jimbaran",
+				Description: "Booking: JMB-42\nEstimated cost: Rp 850.000",
+				Stamp:       time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC),
+			},
+			{
+				UID:     "e2@tribbie",
+				Start:   time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC),
+				End:     time.Date(2026, 7, 16, 0, 0, 0, 0, time.UTC),
+				AllDay:  true,
+				Summary: "Nusa Penida",
+				Stamp:   time.Date(2026, 7, 1, 8, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	data := string(calendar.Marshal())
+	assert.True(t, strings.HasPrefix(data, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(data, "END:VEVENT\r\nEND:VCALENDAR\r\n"))
+	assert.Contains(t, data, "X-WR-CALNAME:Bali\\, 2026\r\n")
+	assert.Contains(t, data, "DTSTART:20260714T110000Z\r\nDTEND:20260714T133000Z\r\n")
+	assert.Contains(t, data, "SUMMARY:Dinner\\; seafood\r\n")
+	assert.Contains(t, data, "DESCRIPTION:Booking: JMB-42\\nEstimated cost: Rp 850.000\r\n")
+	assert.Contains(t, data, "DTSTART;VALUE=DATE:20260715\r\nDTEND;VALUE=DATE:20260716\r\n")
+}
+
+func TestWriteLine(t *testing.T) {
+	var buf strings.Builder
+	calendar := Calendar{ProdID: "-//Tribbie//EN", Events: []Event{{Summary: strings.Repeat("é", 100)}}}
+	for _, line := range strings.Split(strings.TrimSuffix(string(calendar.Marshal()), "\r\n"), "\r\n") {
+		assert.True(t, len(line) <= maxLineLength, line)
+		buf.WriteString(strings.TrimPrefix(line, " "))
+	}
+	assert.Contains(t, buf.String(), "SUMMARY:"+strings.Repeat("é", 100))
+}
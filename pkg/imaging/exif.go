@@ -0,0 +1,238 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Exif represents the metadata of a photo read from its EXIF data.
+type Exif struct {
+	// Orientation is the EXIF orientation (1-8) describing how the stored pixels must be rotated or mirrored for
+	// display. It is 0 if unknown.
+	Orientation int
+	// TakenAt is the time the photo was taken, if recorded.
+	TakenAt *time.Time
+	// Latitude and Longitude are the location the photo was taken at in decimal degrees, if recorded.
+	Latitude  *float64
+	Longitude *float64
+}
+
+// errMalformedExif is returned for EXIF data that cannot be parsed.
+var errMalformedExif = errors.New("malformed EXIF data")
+
+const (
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagGPSLatitudeRef     = 0x0001
+	tagGPSLatitude        = 0x0002
+	tagGPSLongitudeRef    = 0x0003
+	tagGPSLongitude       = 0x0004
+)
+
+// typeSizes maps the EXIF field types to the size of a single value in bytes.
+var typeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+// ReadExif reads the EXIF metadata of a JPEG image. Images without EXIF data return an empty Exif.
+// Capture times recorded without a UTC offset are interpreted in the given location.
+func ReadExif(data []byte, loc *time.Location) (Exif, error) {
+	tiff := findExif(data)
+	if tiff == nil {
+		return Exif{}, nil
+	}
+	if len(tiff) < 8 {
+		return Exif{}, errMalformedExif
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return Exif{}, errMalformedExif
+	}
+	p := parser{tiff, order}
+	ifd0, err := p.ifd(order.Uint32(tiff[4:8]))
+	if err != nil {
+		return Exif{}, err
+	}
+
+	var exif Exif
+	if v, ok := p.uint(ifd0, tagOrientation); ok && v >= 1 && v <= 8 {
+		exif.Orientation = int(v)
+	}
+	taken, offset := p.ascii(ifd0, tagDateTime), ""
+	if pointer, ok := p.uint(ifd0, tagExifIFD); ok {
+		if sub, err := p.ifd(pointer); err == nil {
+			if original := p.ascii(sub, tagDateTimeOriginal); original != "" {
+				taken = original
+			}
+			offset = p.ascii(sub, tagOffsetTimeOriginal)
+		}
+	}
+	if t, ok := parseExifTime(taken, offset, loc); ok {
+		exif.TakenAt = &t
+	}
+	if pointer, ok := p.uint(ifd0, tagGPSIFD); ok {
+		if gps, err := p.ifd(pointer); err == nil {
+			lat, latOK := p.degrees(gps, tagGPSLatitude)
+			lon, lonOK := p.degrees(gps, tagGPSLongitude)
+			if latOK && lonOK && lat <= 90 && lon <= 180 {
+				if p.ascii(gps, tagGPSLatitudeRef) == "S" {
+					lat = -lat
+				}
+				if p.ascii(gps, tagGPSLongitudeRef) == "W" {
+					lon = -lon
+				}
+				exif.Latitude, exif.Longitude = &lat, &lon
+			}
+		}
+	}
+	return exif, nil
+}
+
+// findExif returns the TIFF structure of the EXIF segment of a JPEG image, or nil if there is none.
+func findExif(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker >= 0xD0 && marker <= 0xD7 || marker == 0xFF {
+			i++
+			continue
+		}
+		// the image data follows the start of scan, and no metadata comes after it
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			return nil
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i += 2 + length
+	}
+	return nil
+}
+
+// parser reads the image file directories of a TIFF structure.
+type parser struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+// field represents an entry of an image file directory.
+type field struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// ifd reads the entries of the image file directory at the offset.
+func (p parser) ifd(offset uint32) (map[uint16]field, error) {
+	if uint64(offset)+2 > uint64(len(p.tiff)) {
+		return nil, errMalformedExif
+	}
+	n := int(p.order.Uint16(p.tiff[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(p.tiff) {
+		return nil, errMalformedExif
+	}
+	fields := map[uint16]field{}
+	for i := 0; i < n; i++ {
+		entry := p.tiff[start+i*12 : start+i*12+12]
+		typ, count := p.order.Uint16(entry[2:4]), p.order.Uint32(entry[4:8])
+		size, ok := typeSizes[typ]
+		if !ok || uint64(count)*uint64(size) > uint64(len(p.tiff)) {
+			continue
+		}
+		length := int(count) * size
+		value := entry[8 : 8+min(length, 4)]
+		if length > 4 {
+			at := p.order.Uint32(entry[8:12])
+			if uint64(at)+uint64(length) > uint64(len(p.tiff)) {
+				continue
+			}
+			value = p.tiff[at : int(at)+length]
+		}
+		fields[p.order.Uint16(entry[0:2])] = field{typ, count, value}
+	}
+	return fields, nil
+}
+
+// uint returns the first value of a SHORT or LONG field.
+func (p parser) uint(fields map[uint16]field, tag uint16) (uint32, bool) {
+	f, ok := fields[tag]
+	if !ok || f.count == 0 {
+		return 0, false
+	}
+	switch f.typ {
+	case 3:
+		return uint32(p.order.Uint16(f.value)), true
+	case 4:
+		return p.order.Uint32(f.value), true
+	}
+	return 0, false
+}
+
+// ascii returns the value of an ASCII field without its terminating NUL.
+func (p parser) ascii(fields map[uint16]field, tag uint16) string {
+	f, ok := fields[tag]
+	if !ok || f.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(f.value), "\x00"))
+}
+
+// degrees returns the decimal degrees of a GPS coordinate stored as degrees, minutes and seconds rationals.
+func (p parser) degrees(fields map[uint16]field, tag uint16) (float64, bool) {
+	f, ok := fields[tag]
+	if !ok || f.typ != 5 || f.count != 3 {
+		return 0, false
+	}
+	var result float64
+	for i, scale := range []float64{1, 60, 3600} {
+		num, den := p.order.Uint32(f.value[i*8:]), p.order.Uint32(f.value[i*8+4:])
+		if den == 0 {
+			return 0, false
+		}
+		result += float64(num) / float64(den) / scale
+	}
+	return result, true
+}
+
+// parseExifTime parses an EXIF date and time such as "2026:07:14 19:30:00" with an optional offset such as
+// "+08:00". Times without an offset are interpreted in the location.
+func parseExifTime(value, offset string, loc *time.Location) (time.Time, bool) {
+	if value == "" || strings.HasPrefix(value, "0000") {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", value+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", value, loc)
+	return t, err == nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
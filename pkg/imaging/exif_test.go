@@ -0,0 +1,119 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifJPEG returns a JPEG image of the size with an EXIF segment recording orientation 6, a capture time in
+// Singapore and a location in Bali.
+func exifJPEG(t *testing.T, width, height int) []byte {
+	var img bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&img, image.NewRGBA(image.Rect(0, 0, width, height)), nil))
+
+	// the layout of the TIFF structure: IFD0 at 8 with 3 entries, the Exif IFD at 50 with 2 entries,
+	// the GPS IFD at 80 with 4 entries, followed by the out-of-line values at 134
+	var tiff bytes.Buffer
+	order := binary.BigEndian
+	write := func(values ...interface{}) {
+		for _, v := range values {
+			assert.Nil(t, binary.Write(&tiff, order, v))
+		}
+	}
+	entry := func(tag, typ uint16, count, value uint32) { write(tag, typ, count, value) }
+	tiff.WriteString("MM")
+	write(uint16(42), uint32(8))
+	write(uint16(3))
+	entry(tagOrientation, 3, 1, 6<<16)
+	entry(tagExifIFD, 4, 1, 50)
+	entry(tagGPSIFD, 4, 1, 80)
+	write(uint32(0))
+	write(uint16(2))
+	entry(tagDateTimeOriginal, 2, 20, 134)
+	entry(tagOffsetTimeOriginal, 2, 7, 154)
+	write(uint32(0))
+	write(uint16(4))
+	entry(tagGPSLatitudeRef, 2, 2, 'S'<<24)
+	entry(tagGPSLatitude, 5, 3, 161)
+	entry(tagGPSLongitudeRef, 2, 2, 'E'<<24)
+	entry(tagGPSLongitude, 5, 3, 185)
+	write(uint32(0))
+	assert.Equal(t, 134, tiff.Len())
+	tiff.WriteString("2026:07:14 19:30:00\x00")
+	tiff.WriteString("+08:00\x00")
+	write(uint32(8), uint32(1), uint32(30), uint32(1), uint32(0), uint32(1))
+	write(uint32(115), uint32(1), uint32(15), uint32(1), uint32(36), uint32(1))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var buf bytes.Buffer
+	buf.Write(img.Bytes()[:2])
+	buf.Write([]byte{0xFF, 0xE1})
+	write = func(values ...interface{}) {
+		for _, v := range values {
+			assert.Nil(t, binary.Write(&buf, order, v))
+		}
+	}
+	write(uint16(len(segment) + 2))
+	buf.Write(segment)
+	buf.Write(img.Bytes()[2:])
+	return buf.Bytes()
+}
+
+func TestReadExif(t *testing.T) {
+	exif, err := ReadExif(exifJPEG(t, 40, 20), time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, exif.Orientation)
+	if assert.NotNil(t, exif.TakenAt) {
+		assert.True(t, time.Date(2026, 7, 14, 11, 30, 0, 0, time.UTC).Equal(*exif.TakenAt))
+	}
+	if assert.NotNil(t, exif.Latitude) && assert.NotNil(t, exif.Longitude) {
+		assert.InDelta(t, -8.5, *exif.Latitude, 1e-9)
+		assert.InDelta(t, 115.26, *exif.Longitude, 1e-9)
+	}
+
+	// images without EXIF data have no metadata
+	var buf bytes.Buffer
+	assert.Nil(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 4)), nil))
+	exif, err = ReadExif(buf.Bytes(), time.UTC)
+	assert.Nil(t, err)
+	assert.Equal(t, Exif{}, exif)
+
+	exif, err = ReadExif([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x0C, 'E', 'x', 'i', 'f', 0, 0, 'X', 'X', 0, 0}, time.UTC)
+	assert.Equal(t, errMalformedExif, err)
+}
+
+func Test_parseExifTime(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*3600)
+	taken, ok := parseExifTime("2026:07:14 19:30:00", "", jakarta)
+	assert.True(t, ok)
+	assert.True(t, time.Date(2026, 7, 14, 12, 30, 0, 0, time.UTC).Equal(taken))
+	_, ok = parseExifTime("0000:00:00 00:00:00", "", jakarta)
+	assert.False(t, ok)
+}
+
+func TestThumbnail_orientation(t *testing.T) {
+	thumbnail, width, height, err := Thumbnail(exifJPEG(t, 40, 20), 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, width)
+	assert.Equal(t, 40, height)
+	img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	if assert.Nil(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 20, 40), img.Bounds())
+	}
+}
+
+func TestOrient(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	src.Pix[0] = 255 // marks the top left pixel
+	for orientation, want := range map[int]image.Point{1: {0, 0}, 2: {2, 0}, 3: {2, 1}, 4: {0, 1}, 5: {0, 0}, 6: {1, 0}, 7: {1, 2}, 8: {0, 2}} {
+		dst := Orient(src, orientation)
+		r, _, _, _ := dst.At(want.X, want.Y).RGBA()
+		assert.Equal(t, uint32(0xffff), r, "orientation %v", orientation)
+	}
+}
@@ -0,0 +1,151 @@
+// Package imaging generates thumbnails of uploaded photos using only the standard library.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"time"
+
+	// register the decoders of the supported formats
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ErrUnsupported is returned for data that is not a JPEG, PNG or GIF image.
+var ErrUnsupported = errors.New("unsupported image format")
+
+// ErrTooLarge is returned for images with more than MaxPixels pixels.
+var ErrTooLarge = errors.New("image too large")
+
+// MaxPixels is the largest number of pixels of an image that can be decoded. A small compressed file can describe a
+// huge image, so the dimensions are checked before the image is decoded into memory.
+const MaxPixels = 50000000
+
+// maxSamples is the largest number of source pixels averaged per axis for a thumbnail pixel. Sampling keeps the
+// cost of thumbnails of large photos independent of their resolution.
+const maxSamples = 4
+
+// Thumbnail decodes the image and returns a JPEG thumbnail fitting within size×size pixels, together with the
+// dimensions of the original image as displayed. Images smaller than the thumbnail are not enlarged, and JPEG
+// images are rotated according to their EXIF orientation. Images over MaxPixels pixels are rejected with ErrTooLarge.
+func Thumbnail(data []byte, size int) (thumbnail []byte, width, height int, err error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, 0, 0, ErrUnsupported
+	} else if err != nil {
+		return nil, 0, 0, err
+	}
+	if int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, 0, 0, ErrTooLarge
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err == image.ErrFormat {
+		return nil, 0, 0, ErrUnsupported
+	} else if err != nil {
+		return nil, 0, 0, err
+	}
+	bounds := src.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, 0, 0, ErrUnsupported
+	}
+	orientation := 0
+	if format == "jpeg" {
+		// the orientation is best effort: photos with malformed EXIF data are kept as stored
+		exif, _ := ReadExif(data, time.UTC)
+		orientation = exif.Orientation
+	}
+	if orientation >= 5 {
+		width, height = height, width
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, Orient(Resize(src, size), orientation), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), width, height, nil
+}
+
+// Resize scales the image down to fit within size×size pixels, preserving its aspect ratio. Each pixel of the
+// result averages the source pixels it covers, which avoids the aliasing of nearest-neighbour scaling.
+func Resize(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if w > size || h > size {
+		if w >= h {
+			dw, dh = size, max(1, h*size/w)
+		} else {
+			dw, dh = max(1, w*size/h), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := bounds.Min.Y+y*h/dh, bounds.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := bounds.Min.X+x*w/dw, bounds.Min.X+(x+1)*w/dw
+			dst.Set(x, y, average(src, x0, y0, max(x1, x0+1), max(y1, y0+1)))
+		}
+	}
+	return dst
+}
+
+// Orient rotates and mirrors the image according to an EXIF orientation so that it is displayed upright.
+// Unknown orientations return the image unchanged.
+func Orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// average returns the average color of up to maxSamples×maxSamples pixels evenly spread over the rectangle.
+func average(src image.Image, x0, y0, x1, y1 int) color.Color {
+	stepX, stepY := max(1, (x1-x0)/maxSamples), max(1, (y1-y0)/maxSamples)
+	var r, g, b, a, n uint32
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			cr, cg, cb, ca := src.At(x, y).RGBA()
+			r, g, b, a, n = r+cr, g+cg, b+cb, a+ca, n+1
+		}
+	}
+	return color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,49 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 800, 400))
+	for y := 0; y < 400; y++ {
+		for x := 0; x < 800; x++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.Nil(t, png.Encode(&buf, src))
+
+	thumbnail, width, height, err := Thumbnail(buf.Bytes(), 200)
+	assert.Nil(t, err)
+	assert.Equal(t, 800, width)
+	assert.Equal(t, 400, height)
+	img, err := jpeg.Decode(bytes.NewReader(thumbnail))
+	if assert.Nil(t, err) {
+		assert.Equal(t, image.Rect(0, 0, 200, 100), img.Bounds())
+		r, g, _, _ := img.At(100, 50).RGBA()
+		assert.True(t, r > 0xf000 && g < 0x1000)
+	}
+
+	_, _, _, err = Thumbnail([]byte("%PDF-1.4"), 200)
+	assert.Equal(t, ErrUnsupported, err)
+
+	// a GIF header describing a 65535×65535 image is rejected before decoding any pixel
+	bomb := append([]byte("GIF89a"), 0xff, 0xff, 0xff, 0xff, 0, 0, 0)
+	_, _, _, err = Thumbnail(bomb, 200)
+	assert.Equal(t, ErrTooLarge, err)
+}
+
+func TestResize(t *testing.T) {
+	assert.Equal(t, image.Rect(0, 0, 50, 100), Resize(image.NewRGBA(image.Rect(0, 0, 300, 600)), 100).Bounds())
+	// small images are not enlarged
+	assert.Equal(t, image.Rect(0, 0, 30, 20), Resize(image.NewRGBA(image.Rect(10, 10, 40, 30)), 100).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 100, 1), Resize(image.NewRGBA(image.Rect(0, 0, 1000, 2)), 100).Bounds())
+}
@@ -0,0 +1,391 @@
+// Package listing provides support for filtering and sorting list requests.
+//
+// A filter is a comma-separated list of conditions on the fields of a resource, all of which must hold, such as
+// "grand_total>=100000,status:paid|pending". The supported operators are ":" (equal to one of the values separated by
+// "|"), "!:" (equal to none of the values), ">", ">=", "<", "<=" and "~" (contains, case-insensitively). A sort order
+// is a comma-separated list of fields, each prefixed with "-" to sort in descending order, such as "-created_at,title".
+// Only the fields listed by the resource can be filtered or sorted by. The items are sorted by ID by default and
+// finally by ID in any order, so that the items can be paged through with keyset cursors.
+package listing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"tribbie/pkg/pagination"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var (
+	// FilterVar specifies the query parameter name for the filter
+	FilterVar = "filter"
+	// SortVar specifies the query parameter name for the sort order
+	SortVar = "sort"
+	// MaxConditions specifies the maximum number of conditions of a filter
+	MaxConditions = 20
+)
+
+// Type is the type of the values of a field.
+type Type int
+
+const (
+	// String fields compare their values as text.
+	String Type = iota
+	// Int fields accept integer values.
+	Int
+	// Time fields accept RFC 3339 times and dates in the YYYY-MM-DD format, the latter in the local time zone.
+	Time
+	// Bool fields accept "true" and "false".
+	Bool
+)
+
+// operators lists the supported operators, the longer ones first so that they are matched before their prefixes.
+var operators = []string{">=", "<=", "!:", ":", ">", "<", "~"}
+
+// Field describes a field of a resource that list requests can filter by.
+type Field struct {
+	// Column is the database column of the field.
+	Column string
+	// Type is the type of the values of the field.
+	Type Type
+	// Sortable specifies whether list requests can sort by the field.
+	Sortable bool
+}
+
+// Fields maps the names of the fields of a resource in list requests to their description.
+type Fields map[string]Field
+
+// Condition represents a condition on a column parsed from a filter.
+type Condition struct {
+	Column   string
+	Operator string
+	Values   []interface{}
+}
+
+// Order represents a column parsed from a sort order.
+type Order struct {
+	Column string
+	Desc   bool
+	Type   Type
+}
+
+// idOrder is the order by ID ending every sort order.
+var idOrder = Order{Column: "id"}
+
+// Options represents the filter and the sort order of a list request. The zero value selects all the items in the
+// default order. Keys holds the sort keys of the item a cursor points after.
+type Options struct {
+	Conditions []Condition
+	Orders     []Order
+	Keys       []interface{}
+}
+
+// NewFromRequest parses the filter, the sort order and the cursor found in the query parameters of the given HTTP
+// request. The cursor must have been issued for the same sort order.
+func NewFromRequest(req *http.Request, fields Fields) (Options, error) {
+	query := req.URL.Query()
+	options, err := Parse(query.Get(FilterVar), query.Get(SortVar), fields)
+	if err != nil {
+		return Options{}, err
+	}
+	if cursor := query.Get(pagination.CursorVar); cursor != "" {
+		if options.Keys, err = options.decodeKeys(cursor); err != nil {
+			return Options{}, validation.Errors{pagination.CursorVar: err}
+		}
+	}
+	return options, nil
+}
+
+// Parse parses a filter and a sort order on the given fields.
+// The errors are reported as validation errors keyed by the name of the query parameter.
+func Parse(filter, sort string, fields Fields) (Options, error) {
+	var options Options
+	errs := validation.Errors{}
+	var err error
+	if options.Conditions, err = parseFilter(filter, fields); err != nil {
+		errs[FilterVar] = err
+	}
+	if options.Orders, err = parseSort(sort, fields); err != nil {
+		errs[SortVar] = err
+	}
+	if len(errs) > 0 {
+		return Options{}, errs
+	}
+	return options, nil
+}
+
+// With returns a copy of the options whose filter also requires the column to equal one of the values.
+// Without any value, the filter matches no item.
+func (o Options) With(column string, values ...interface{}) Options {
+	conditions := make([]Condition, len(o.Conditions), len(o.Conditions)+1)
+	copy(conditions, o.Conditions)
+	o.Conditions = append(conditions, Condition{Column: column, Operator: ":", Values: values})
+	return o
+}
+
+// Where returns the condition selecting the items matching the filter.
+func (o Options) Where() dbx.Expression {
+	exps := make([]dbx.Expression, len(o.Conditions))
+	for i, c := range o.Conditions {
+		exps[i] = c.expression(fmt.Sprintf("filter_%d", i))
+	}
+	return dbx.And(exps...)
+}
+
+// OrderBy returns the ORDER BY columns of the sort order.
+func (o Options) OrderBy() []string {
+	orders := o.orders()
+	cols := make([]string, len(orders))
+	for i, order := range orders {
+		cols[i] = order.Column
+		if order.Desc {
+			cols[i] += " DESC"
+		}
+	}
+	return cols
+}
+
+// After returns the condition selecting the items after the cursor in the sort order. It is empty without a cursor.
+func (o Options) After() dbx.Expression {
+	if len(o.Keys) == 0 {
+		return dbx.And()
+	}
+	orders := o.orders()
+	exps := make([]dbx.Expression, len(orders))
+	for i := range orders {
+		// the items with the same keys as the cursor on the preceding columns and a later key on this one
+		parts := make([]string, i+1)
+		params := dbx.Params{}
+		for j := 0; j <= i; j++ {
+			operator := "="
+			if j == i && orders[j].Desc {
+				operator = "<"
+			} else if j == i {
+				operator = ">"
+			}
+			param := fmt.Sprintf("cursor_%d", j)
+			parts[j] = orders[j].Column + operator + "{:" + param + "}"
+			params[param] = o.Keys[j]
+		}
+		exps[i] = dbx.NewExp(strings.Join(parts, " AND "), params)
+	}
+	return dbx.Or(exps...)
+}
+
+// NextCursor returns the cursor pointing after the last of the items, or an empty string if the items, a slice of
+// structs holding the sort columns, are fewer than the limit and thus the last page.
+func (o Options) NextCursor(items interface{}, limit int) string {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice || v.Len() == 0 || v.Len() < limit {
+		return ""
+	}
+	last := v.Index(v.Len() - 1)
+	orders := o.orders()
+	keys := make([]interface{}, len(orders))
+	for i, order := range orders {
+		key, ok := columnValue(last, order.Column)
+		if !ok {
+			return ""
+		}
+		keys[i] = key
+	}
+	return pagination.EncodeCursor(strings.Join(o.OrderBy(), ","), keys)
+}
+
+// orders returns the sort order ending with the order by ID.
+func (o Options) orders() []Order {
+	for _, order := range o.Orders {
+		if order.Column == idOrder.Column {
+			return o.Orders
+		}
+	}
+	orders := make([]Order, len(o.Orders), len(o.Orders)+1)
+	copy(orders, o.Orders)
+	return append(orders, idOrder)
+}
+
+// decodeKeys returns the sort keys of the cursor converted into the types of their columns.
+func (o Options) decodeKeys(cursor string) ([]interface{}, error) {
+	keys, err := pagination.DecodeCursor(cursor, strings.Join(o.OrderBy(), ","))
+	if err != nil {
+		return nil, err
+	}
+	orders := o.orders()
+	if len(keys) != len(orders) {
+		return nil, pagination.ErrInvalidCursor
+	}
+	for i, order := range orders {
+		var ok bool
+		switch key := keys[i].(type) {
+		case json.Number:
+			keys[i], err = key.Int64()
+			ok = order.Type == Int && err == nil
+		case string:
+			if order.Type == Time {
+				keys[i], err = time.Parse(time.RFC3339Nano, key)
+				ok = err == nil
+			} else {
+				ok = order.Type == String
+			}
+		case bool:
+			ok = order.Type == Bool
+		}
+		if !ok {
+			return nil, pagination.ErrInvalidCursor
+		}
+	}
+	return keys, nil
+}
+
+// columnValue returns the value of the field of the struct mapped to the column the way dbx maps it.
+func columnValue(v reflect.Value, column string) (interface{}, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous {
+			if value, ok := columnValue(v.Field(i), column); ok {
+				return value, true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Tag.Get(dbx.DbTag)
+		if name == "" {
+			name = dbx.DefaultFieldMapFunc(field.Name)
+		}
+		if name == column {
+			return v.Field(i).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+// expression returns the expression of the condition using the given name for its parameter.
+func (c Condition) expression(param string) dbx.Expression {
+	switch c.Operator {
+	case ":":
+		if len(c.Values) == 1 {
+			return dbx.HashExp{c.Column: c.Values[0]}
+		}
+		return dbx.In(c.Column, c.Values...)
+	case "!:":
+		return dbx.NotIn(c.Column, c.Values...)
+	case "~":
+		return dbx.NewExp(c.Column+" ILIKE {:"+param+"}", dbx.Params{param: "%" + escapeLike(c.Values[0].(string)) + "%"})
+	default:
+		return dbx.NewExp(c.Column+c.Operator+"{:"+param+"}", dbx.Params{param: c.Values[0]})
+	}
+}
+
+// parseFilter parses the conditions of a filter.
+func parseFilter(filter string, fields Fields) ([]Condition, error) {
+	if filter == "" {
+		return nil, nil
+	}
+	parts := strings.Split(filter, ",")
+	if len(parts) > MaxConditions {
+		return nil, fmt.Errorf("must have at most %d conditions", MaxConditions)
+	}
+	conditions := make([]Condition, len(parts))
+	for i, part := range parts {
+		name, operator, value := splitCondition(strings.TrimSpace(part))
+		if operator == "" {
+			return nil, fmt.Errorf("invalid condition %q", part)
+		}
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("cannot filter by %q", name)
+		}
+		if operator == "~" && field.Type != String || field.Type == Bool && operator != ":" && operator != "!:" {
+			return nil, fmt.Errorf("cannot use %q on %q", operator, name)
+		}
+		values := []string{value}
+		if operator == ":" || operator == "!:" {
+			values = strings.Split(value, "|")
+		}
+		condition := Condition{Column: field.Column, Operator: operator, Values: make([]interface{}, len(values))}
+		for j, v := range values {
+			parsed, err := parseValue(v, field.Type)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for %q", v, name)
+			}
+			condition.Values[j] = parsed
+		}
+		conditions[i] = condition
+	}
+	return conditions, nil
+}
+
+// splitCondition splits a condition into a field name, an operator and a value.
+// The operator is empty if the condition is malformed.
+func splitCondition(condition string) (string, string, string) {
+	i := strings.IndexFunc(condition, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+	})
+	if i <= 0 {
+		return condition, "", ""
+	}
+	for _, operator := range operators {
+		if strings.HasPrefix(condition[i:], operator) {
+			return condition[:i], operator, condition[i+len(operator):]
+		}
+	}
+	return condition[:i], "", ""
+}
+
+// parseValue converts a value of a filter into the type of its field.
+func parseValue(value string, t Type) (interface{}, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(value, 10, 64)
+	case Time:
+		if v, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+			return v, nil
+		}
+		return time.Parse(time.RFC3339, value)
+	case Bool:
+		return strconv.ParseBool(value)
+	}
+	return value, nil
+}
+
+// parseSort parses the columns of a sort order.
+func parseSort(sort string, fields Fields) ([]Order, error) {
+	if sort == "" {
+		return nil, nil
+	}
+	var orders []Order
+	for _, name := range strings.Split(sort, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		field, ok := fields[name]
+		if !ok || !field.Sortable {
+			return nil, fmt.Errorf("cannot sort by %q", name)
+		}
+		orders = append(orders, Order{Column: field.Column, Desc: desc, Type: field.Type})
+	}
+	return orders, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
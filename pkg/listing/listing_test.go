@@ -0,0 +1,174 @@
+package listing
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+	"tribbie/pkg/pagination"
+
+	dbx "github.com/go-ozzo/ozzo-dbx"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+var testFields = Fields{
+	"id":          {Column: "id", Sortable: true},
+	"title":       {Column: "title", Sortable: true},
+	"status":      {Column: "status"},
+	"grand_total": {Column: "grand_total", Type: Int, Sortable: true},
+	"created_at":  {Column: "created_at", Type: Time, Sortable: true},
+	"settled":     {Column: "is_settled", Type: Bool},
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		sort   string
+		want   Options
+		errs   []string
+	}{
+		{"empty", "", "", Options{}, nil},
+		{"equal", "status:paid", "", Options{Conditions: []Condition{{"status", ":", []interface{}{"paid"}}}}, nil},
+		{"one of", "status:paid|pending", "", Options{Conditions: []Condition{{"status", ":", []interface{}{"paid", "pending"}}}}, nil},
+		{"comparisons", "grand_total>=100000, grand_total<5", "", Options{Conditions: []Condition{
+			{"grand_total", ">=", []interface{}{int64(100000)}},
+			{"grand_total", "<", []interface{}{int64(5)}},
+		}}, nil},
+		{"bool", "settled!:true", "", Options{Conditions: []Condition{{"is_settled", "!:", []interface{}{true}}}}, nil},
+		{"contains", "title~Dinner", "", Options{Conditions: []Condition{{"title", "~", []interface{}{"Dinner"}}}}, nil},
+		{"sort", "", "-created_at,title", Options{Orders: []Order{{"created_at", true, Time}, {"title", false, String}}}, nil},
+		{"unknown field", "user_paid_id:budi", "", Options{}, []string{FilterVar}},
+		{"no operator", "status", "", Options{}, []string{FilterVar}},
+		{"no field", ">=1", "", Options{}, []string{FilterVar}},
+		{"invalid int", "grand_total>=lots", "", Options{}, []string{FilterVar}},
+		{"contains int", "grand_total~1", "", Options{}, []string{FilterVar}},
+		{"compare bool", "settled>true", "", Options{}, []string{FilterVar}},
+		{"unsortable", "", "status", Options{}, []string{SortVar}},
+		{"both", "password:x", "password", Options{}, []string{FilterVar, SortVar}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := Parse(tt.filter, tt.sort, testFields)
+			if tt.errs == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.want, options)
+				return
+			}
+			if assert.IsType(t, validation.Errors{}, err) {
+				errs := err.(validation.Errors)
+				assert.Len(t, errs, len(tt.errs))
+				for _, key := range tt.errs {
+					assert.Contains(t, errs, key)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_Time(t *testing.T) {
+	options, err := Parse("created_at>=2026-07-14,created_at<2026-07-15T00:00:00Z", "", testFields)
+	assert.Nil(t, err)
+	if assert.Len(t, options.Conditions, 2) {
+		assert.Equal(t, time.Date(2026, 7, 14, 0, 0, 0, 0, time.Local), options.Conditions[0].Values[0])
+		assert.Equal(t, time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC), options.Conditions[1].Values[0])
+	}
+}
+
+func TestNewFromRequest(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/transactions?"+url.Values{
+		"filter": {"grand_total>=100000,status:paid"},
+		"sort":   {"-created_at"},
+	}.Encode(), nil)
+	options, err := NewFromRequest(req, testFields)
+	assert.Nil(t, err)
+	assert.Len(t, options.Conditions, 2)
+	assert.Equal(t, []Order{{"created_at", true, Time}}, options.Orders)
+}
+
+func TestOptions_Where(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	options, _ := Parse("grand_total>=100000,status:paid|pending,title~50%_off", "", testFields)
+	params := dbx.Params{}
+	sql := options.Where().Build(db, params)
+	assert.Equal(t, `(grand_total>={:filter_0}) AND ("status" IN ({:p1}, {:p2})) AND (title ILIKE {:filter_2})`, sql)
+	assert.Equal(t, int64(100000), params["filter_0"])
+	assert.Equal(t, `%50\%\_off%`, params["filter_2"])
+
+	assert.Equal(t, "", Options{}.Where().Build(db, dbx.Params{}))
+}
+
+func TestOptions_OrderBy(t *testing.T) {
+	assert.Equal(t, []string{"id"}, Options{}.OrderBy())
+	assert.Equal(t, []string{"grand_total DESC", "id"}, Options{Orders: []Order{{"grand_total", true, Int}}}.OrderBy())
+	assert.Equal(t, []string{"id DESC"}, Options{Orders: []Order{{"id", true, String}}}.OrderBy())
+}
+
+func TestOptions_With(t *testing.T) {
+	options, _ := Parse("status:paid", "", testFields)
+	scoped := options.With("trip_id", "trip1")
+	assert.Len(t, options.Conditions, 1)
+	assert.Equal(t, []Condition{{"status", ":", []interface{}{"paid"}}, {"trip_id", ":", []interface{}{"trip1"}}}, scoped.Conditions)
+
+	db := dbx.NewFromDB(nil, "postgres")
+	params := dbx.Params{}
+	assert.Equal(t, `"trip_id" IN ({:p0}, {:p1})`, Options{}.With("trip_id", "trip1", "trip2").Where().Build(db, params))
+	assert.Equal(t, "0=1", Options{}.With("trip_id").Where().Build(db, dbx.Params{}))
+}
+
+func TestOptions_After(t *testing.T) {
+	db := dbx.NewFromDB(nil, "postgres")
+	assert.Equal(t, "", Options{}.After().Build(db, dbx.Params{}))
+
+	options := Options{Orders: []Order{{"grand_total", true, Int}}, Keys: []interface{}{int64(100000), "t1"}}
+	params := dbx.Params{}
+	sql := options.After().Build(db, params)
+	assert.Equal(t, "(grand_total<{:cursor_0}) OR (grand_total={:cursor_0} AND id>{:cursor_1})", sql)
+	assert.Equal(t, dbx.Params{"cursor_0": int64(100000), "cursor_1": "t1"}, params)
+}
+
+type testItem struct {
+	ID         string
+	GrandTotal int
+	CreatedAt  time.Time
+}
+
+type testWrapper struct {
+	testItem
+	Comments int
+}
+
+func TestOptions_NextCursor(t *testing.T) {
+	pagination.CursorKey = []byte("secret")
+	created := time.Date(2026, 7, 14, 19, 0, 0, 123456000, time.UTC)
+	items := []testWrapper{
+		{testItem{"t2", 150000, created}, 0},
+		{testItem{"t1", 100000, created}, 2},
+	}
+	options, _ := Parse("", "-grand_total,created_at", testFields)
+	assert.Equal(t, "", options.NextCursor(items, 3))
+	assert.Equal(t, "", options.NextCursor([]testWrapper{}, 0))
+	cursor := options.NextCursor(items, 2)
+	assert.NotEqual(t, "", cursor)
+
+	req, _ := http.NewRequest("GET", "/transactions?"+url.Values{"sort": {"-grand_total,created_at"}, "cursor": {cursor}}.Encode(), nil)
+	next, err := NewFromRequest(req, testFields)
+	assert.Nil(t, err)
+	if assert.Len(t, next.Keys, 3) {
+		assert.Equal(t, int64(100000), next.Keys[0])
+		assert.True(t, created.Equal(next.Keys[1].(time.Time)))
+		assert.Equal(t, "t1", next.Keys[2])
+	}
+
+	// the cursor is only valid for the sort order it was issued for
+	req, _ = http.NewRequest("GET", "/transactions?"+url.Values{"sort": {"grand_total"}, "cursor": {cursor}}.Encode(), nil)
+	_, err = NewFromRequest(req, testFields)
+	if assert.IsType(t, validation.Errors{}, err) {
+		assert.Contains(t, err.(validation.Errors), pagination.CursorVar)
+	}
+	// and cannot be tampered with
+	req, _ = http.NewRequest("GET", "/transactions?"+url.Values{"sort": {"-grand_total,created_at"}, "cursor": {"W10" + cursor[3:]}}.Encode(), nil)
+	_, err = NewFromRequest(req, testFields)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,111 @@
+// Package mailer provides a simple abstraction for sending emails together with
+// SMTP, file-based and in-memory implementations.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message represents a plain text email message.
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	// Send delivers the given message.
+	Send(ctx context.Context, msg Message) error
+}
+
+// build renders the message in RFC 5322 format.
+func (m Message) build(from string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(m.Body, "\n", "\r\n", -1))
+	return b.Bytes()
+}
+
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP creates a Mailer that delivers messages through the given SMTP server.
+// If username is empty, no authentication is performed.
+func NewSMTP(host string, port int, username, password, from string) Mailer {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return smtpMailer{fmt.Sprintf("%v:%v", host, port), auth, from}
+}
+
+// Send delivers the message through the SMTP server.
+func (m smtpMailer) Send(ctx context.Context, msg Message) error {
+	return smtp.SendMail(m.addr, m.auth, m.from, msg.To, msg.build(m.from, time.Now()))
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFile creates a Mailer that writes every message as an .eml file into the given directory.
+// It is meant for local development.
+func NewFile(dir, from string) Mailer {
+	return fileMailer{dir, from}
+}
+
+// Send writes the message into a new file in the mail directory.
+func (m fileMailer) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := filepath.Join(m.dir, fmt.Sprintf("%v.eml", now.UnixNano()))
+	return ioutil.WriteFile(name, msg.build(m.from, now), 0644)
+}
+
+// Memory is a Mailer that keeps the sent messages in memory. It is meant for testing.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory creates a new in-memory Mailer.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send records the message.
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
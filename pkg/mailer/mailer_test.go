@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	assert.Empty(t, m.Messages())
+	err := m.Send(context.Background(), Message{To: []string{"a@example.com"}, Subject: "hi", Body: "hello"})
+	assert.Nil(t, err)
+	if assert.Len(t, m.Messages(), 1) {
+		assert.Equal(t, "hi", m.Messages()[0].Subject)
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailer")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	m := NewFile(filepath.Join(dir, "mail"), "no-reply@example.com")
+	err = m.Send(context.Background(), Message{To: []string{"a@example.com", "b@example.com"}, Subject: "hi", Body: "line1\nline2"})
+	assert.Nil(t, err)
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "mail"))
+	assert.Nil(t, err)
+	if assert.Len(t, files, 1) {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, "mail", files[0].Name()))
+		assert.Contains(t, string(data), "From: no-reply@example.com\r\n")
+		assert.Contains(t, string(data), "To: a@example.com, b@example.com\r\n")
+		assert.Contains(t, string(data), "Subject: hi\r\n")
+		assert.Contains(t, string(data), "\r\n\r\nline1\r\nline2")
+	}
+}
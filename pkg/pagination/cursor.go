@@ -0,0 +1,61 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var (
+	// CursorVar specifies the query parameter name for the cursor
+	CursorVar = "cursor"
+	// CursorKey specifies the key signing the cursors. It must be set before cursors are issued.
+	CursorKey []byte
+
+	// ErrInvalidCursor is returned when a cursor was not issued by the server for the same sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// EncodeCursor returns an opaque cursor pointing after the item with the given keys in a list sorted by the given order.
+// The cursor is signed so that clients cannot forge the keys.
+func EncodeCursor(order string, keys []interface{}) string {
+	payload, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign(order, payload))
+}
+
+// DecodeCursor returns the keys of the item the cursor points after. The order must be the one the cursor was issued
+// for. Numbers are decoded as json.Number and times as strings.
+func DecodeCursor(cursor, order string) ([]interface{}, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, sign(order, payload)) {
+		return nil, ErrInvalidCursor
+	}
+	var keys []interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&keys); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return keys, nil
+}
+
+// sign returns the signature of the keys of a cursor for the given order.
+func sign(order string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, CursorKey)
+	mac.Write([]byte(order))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
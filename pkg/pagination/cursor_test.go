@@ -0,0 +1,28 @@
+package pagination
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	CursorKey = []byte("secret")
+	cursor := EncodeCursor("created_at DESC,id", []interface{}{"2026-07-14T19:00:00Z", 42, "t1"})
+
+	keys, err := DecodeCursor(cursor, "created_at DESC,id")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"2026-07-14T19:00:00Z", json.Number("42"), "t1"}, keys)
+
+	_, err = DecodeCursor(cursor, "created_at,id")
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor("abc", "created_at DESC,id")
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = DecodeCursor(EncodeCursor("id", []interface{}{"t2"})[:10]+cursor[10:], "id")
+	assert.Equal(t, ErrInvalidCursor, err)
+
+	CursorKey = []byte("another secret")
+	_, err = DecodeCursor(cursor, "created_at DESC,id")
+	assert.Equal(t, ErrInvalidCursor, err)
+}
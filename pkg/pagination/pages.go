@@ -4,6 +4,8 @@ package pagination
 import (
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
 	"strconv"
 	"strings"
 )
@@ -20,12 +22,17 @@ var (
 )
 
 // Pages represents a paginated list of data items.
+// A page is either selected by its number or, for lists supporting cursors, by the cursor pointing after the last item
+// of the previous page. Page is 0 in the latter case. NextCursor points after the last item of the page if the list
+// supports cursors and the page is full.
 type Pages struct {
 	Page       int         `json:"page"`
 	PerPage    int         `json:"per_page"`
 	PageCount  int         `json:"page_count"`
 	TotalCount int         `json:"total_count"`
 	Items      interface{} `json:"items"`
+	Cursor     string      `json:"cursor,omitempty"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 // New creates a new Pages instance.
@@ -61,10 +68,36 @@ func New(page, perPage, total int) *Pages {
 
 // NewFromRequest creates a Pages object using the query parameters found in the given HTTP request.
 // count stands for the total number of items. Use -1 if this is unknown.
+// The page is selected by the cursor instead of its number if the request has a cursor.
 func NewFromRequest(req *http.Request, count int) *Pages {
 	page := parseInt(req.URL.Query().Get(PageVar), 1)
 	perPage := parseInt(req.URL.Query().Get(PageSizeVar), DefaultPageSize)
-	return New(page, perPage, count)
+	pages := New(page, perPage, count)
+	if cursor := req.URL.Query().Get(CursorVar); cursor != "" {
+		pages.Page = 0
+		pages.Cursor = cursor
+	}
+	return pages
+}
+
+// NewFromSlice creates a Pages object holding the page of the given slice selected by the query parameters found in
+// the given HTTP request. It is meant for short lists that are loaded as a whole, such as lists computed from other
+// data, and thus does not support cursors.
+func NewFromSlice(req *http.Request, items interface{}) *Pages {
+	v := reflect.ValueOf(items)
+	page := parseInt(req.URL.Query().Get(PageVar), 1)
+	perPage := parseInt(req.URL.Query().Get(PageSizeVar), DefaultPageSize)
+	pages := New(page, perPage, v.Len())
+	start := pages.Offset()
+	if start > v.Len() {
+		start = v.Len()
+	}
+	end := start + pages.Limit()
+	if end > v.Len() {
+		end = v.Len()
+	}
+	pages.Items = v.Slice(start, end).Interface()
+	return pages
 }
 
 // parseInt parses a string into an integer. If parsing is failed, defaultValue will be returned.
@@ -79,7 +112,11 @@ func parseInt(value string, defaultValue int) int {
 }
 
 // Offset returns the OFFSET value that can be used in a SQL statement.
+// It is 0 for pages selected by a cursor, whose condition selects the items after the cursor instead.
 func (p *Pages) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
 	return (p.Page - 1) * p.PerPage
 }
 
@@ -108,6 +145,45 @@ func (p *Pages) BuildLinkHeader(baseURL string, defaultPerPage int) string {
 	return header
 }
 
+// LinkHeader returns an HTTP header containing the links about the pagination of the given request.
+// The links keep the other query parameters of the request. Pages selected by a cursor link to the first page and,
+// using their next cursor, to the next page.
+func (p *Pages) LinkHeader(req *http.Request) string {
+	query := req.URL.Query()
+	query.Del(PageVar)
+	query.Del(PageSizeVar)
+	query.Del(CursorVar)
+	baseURL := req.URL.Path
+	if encoded := query.Encode(); encoded != "" {
+		baseURL += "?" + encoded
+	}
+	if p.Cursor == "" {
+		return p.BuildLinkHeader(baseURL, DefaultPageSize)
+	}
+
+	if strings.Contains(baseURL, "?") {
+		baseURL += "&"
+	} else {
+		baseURL += "?"
+	}
+	perPage := ""
+	if p.PerPage != DefaultPageSize {
+		perPage = fmt.Sprintf("&%v=%v", PageSizeVar, p.PerPage)
+	}
+	header := fmt.Sprintf("<%v%v=1%v>; rel=\"first\"", baseURL, PageVar, perPage)
+	if p.NextCursor != "" {
+		header += fmt.Sprintf(", <%v%v=%v%v>; rel=\"next\"", baseURL, CursorVar, url.QueryEscape(p.NextCursor), perPage)
+	}
+	return header
+}
+
+// SetLinkHeader sets the Link header of a response to the links about the pagination of the given request, if any.
+func (p *Pages) SetLinkHeader(header http.Header, req *http.Request) {
+	if links := p.LinkHeader(req); links != "" {
+		header.Set("Link", links)
+	}
+}
+
 // BuildLinks returns the first, prev, next, and last links corresponding to the pagination.
 // A link could be an empty string if it is not needed.
 // For example, if the pagination is at the first page, then both first and prev links
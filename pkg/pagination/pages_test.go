@@ -100,3 +100,44 @@ func TestNewFromRequest(t *testing.T) {
 	assert.Equal(t, 100, p.TotalCount)
 	assert.Equal(t, 5, p.PageCount)
 }
+
+func TestNewFromRequest_Cursor(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com?page=2&per_page=20&cursor=abc", bytes.NewBufferString(""))
+	p := NewFromRequest(req, 100)
+	assert.Equal(t, 0, p.Page)
+	assert.Equal(t, "abc", p.Cursor)
+	assert.Equal(t, 0, p.Offset())
+	assert.Equal(t, 20, p.Limit())
+}
+
+func TestPages_LinkHeader(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/v1/transactions?page=2&sort=-created_at", nil)
+	p := NewFromRequest(req, 250)
+	assert.Equal(t, `</v1/transactions?sort=-created_at&page=1>; rel="first", </v1/transactions?sort=-created_at&page=1>; rel="prev", `+
+		`</v1/transactions?sort=-created_at&page=3>; rel="next", </v1/transactions?sort=-created_at&page=3>; rel="last"`, p.LinkHeader(req))
+
+	req, _ = http.NewRequest("GET", "http://example.com/v1/transactions?cursor=abc&per_page=10", nil)
+	p = NewFromRequest(req, 250)
+	p.NextCursor = "def.g+h"
+	assert.Equal(t, `</v1/transactions?page=1&per_page=10>; rel="first", </v1/transactions?cursor=def.g%2Bh&per_page=10>; rel="next"`, p.LinkHeader(req))
+
+	header := http.Header{}
+	req, _ = http.NewRequest("GET", "http://example.com/v1/transactions", nil)
+	NewFromRequest(req, 5).SetLinkHeader(header, req)
+	assert.Equal(t, "", header.Get("Link"))
+}
+
+func TestNewFromSlice(t *testing.T) {
+	items := []string{"a", "b", "c", "d", "e"}
+	req, _ := http.NewRequest("GET", "http://example.com?page=2&per_page=2", nil)
+	p := NewFromSlice(req, items)
+	assert.Equal(t, 2, p.Page)
+	assert.Equal(t, 3, p.PageCount)
+	assert.Equal(t, 5, p.TotalCount)
+	assert.Equal(t, []string{"c", "d"}, p.Items)
+
+	req, _ = http.NewRequest("GET", "http://example.com?page=3&per_page=2", nil)
+	assert.Equal(t, []string{"e"}, NewFromSlice(req, items).Items)
+	req, _ = http.NewRequest("GET", "http://example.com", nil)
+	assert.Equal(t, []string{}, NewFromSlice(req, []string{}).Items)
+}
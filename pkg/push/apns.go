@@ -0,0 +1,159 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// APNsProduction is the endpoint of the production APNs environment.
+	APNsProduction = "https://api.push.apple.com"
+	// APNsDevelopment is the endpoint of the development (sandbox) APNs environment.
+	APNsDevelopment = "https://api.sandbox.push.apple.com"
+
+	// apnsTokenTTL is how long a provider token is reused. APNs rejects tokens older than an hour
+	// and throttles tokens refreshed more often than every 20 minutes.
+	apnsTokenTTL = 50 * time.Minute
+)
+
+// APNs is a Sender that delivers notifications through the Apple Push Notification service over HTTP/2
+// using token-based authentication.
+type APNs struct {
+	client   *http.Client
+	endpoint string
+	key      *ecdsa.PrivateKey
+	keyID    string
+	teamID   string
+	topic    string
+
+	mu       sync.Mutex
+	token    string
+	issuedAt time.Time
+}
+
+// NewAPNs creates a Sender for the given APNs endpoint. The key is the ES256 authentication key with the given ID
+// issued to the team, and the topic is the bundle ID of the app.
+func NewAPNs(endpoint string, key *ecdsa.PrivateKey, keyID, teamID, topic string) *APNs {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			ForceAttemptHTTP2: true,
+			TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS12},
+		},
+	}
+	return &APNs{client: client, endpoint: endpoint, key: key, keyID: keyID, teamID: teamID, topic: topic}
+}
+
+// LoadAPNsKey reads an APNs authentication key from a .p8 file.
+func LoadAPNsKey(file string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("push: no PEM block found in the APNs key file")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("push: the APNs key is not an ECDSA key")
+	}
+	return ecKey, nil
+}
+
+// apnsPayload is the JSON body of an APNs request.
+type apnsPayload map[string]interface{}
+
+// apnsError is the JSON body of a failed APNs response.
+type apnsError struct {
+	Reason string `json:"reason"`
+}
+
+// Send delivers the message to APNs.
+func (a *APNs) Send(ctx context.Context, msg Message) error {
+	payload := apnsPayload{}
+	for k, v := range msg.Data {
+		payload[k] = v
+	}
+	payload["aps"] = map[string]interface{}{
+		"alert": map[string]string{"title": msg.Title, "body": msg.Body},
+		"sound": "default",
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	token, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.endpoint+"/3/device/"+msg.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	var apnsErr apnsError
+	_ = json.NewDecoder(res.Body).Decode(&apnsErr)
+	switch {
+	case res.StatusCode == http.StatusGone,
+		apnsErr.Reason == "BadDeviceToken",
+		apnsErr.Reason == "DeviceTokenNotForTopic",
+		apnsErr.Reason == "Unregistered":
+		return ErrInvalidToken
+	case apnsErr.Reason == "ExpiredProviderToken":
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	}
+	return fmt.Errorf("push: APNs responded with %v %v", res.StatusCode, apnsErr.Reason)
+}
+
+// providerToken returns the JWT authenticating the requests, signing a new one when the current one gets old.
+func (a *APNs) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.token != "" && now.Sub(a.issuedAt) < apnsTokenTTL {
+		return a.token, nil
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.StandardClaims{Issuer: a.teamID, IssuedAt: now.Unix()})
+	token.Header["kid"] = a.keyID
+	signed, err := token.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.issuedAt = signed, now
+	return signed, nil
+}
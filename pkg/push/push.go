@@ -0,0 +1,66 @@
+// Package push provides a simple abstraction for sending push notifications to devices together with
+// APNs and in-memory implementations.
+package push
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrInvalidToken is returned when the push service rejects a device token because it is malformed,
+// belongs to another app or was unregistered. Such tokens will never work again and should be removed.
+var ErrInvalidToken = errors.New("push: invalid or unregistered device token")
+
+// Message represents a push notification sent to a single device.
+type Message struct {
+	// Token is the push token of the device.
+	Token string
+	Title string
+	Body  string
+	// Data holds custom key-value pairs delivered along with the notification.
+	Data map[string]string
+}
+
+// Sender sends push notifications.
+type Sender interface {
+	// Send delivers the given message. It returns ErrInvalidToken if the device token is no longer valid.
+	Send(ctx context.Context, msg Message) error
+}
+
+// Memory is a Sender that keeps the sent messages in memory. It is meant for testing.
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+	failures map[string]error
+}
+
+// NewMemory creates a new in-memory Sender.
+func NewMemory() *Memory {
+	return &Memory{failures: map[string]error{}}
+}
+
+// Fail makes every message sent to the token fail with the given error.
+func (m *Memory) Fail(token string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failures[token] = err
+}
+
+// Send records the message, or returns the error registered for its token.
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.failures[msg.Token]; err != nil {
+		return err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
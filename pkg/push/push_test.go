@@ -0,0 +1,69 @@
+package push
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+	m.Fail("bad", ErrInvalidToken)
+	assert.Nil(t, m.Send(context.Background(), Message{Token: "good", Title: "hi"}))
+	assert.Equal(t, ErrInvalidToken, m.Send(context.Background(), Message{Token: "bad", Title: "hi"}))
+	if assert.Len(t, m.Messages(), 1) {
+		assert.Equal(t, "good", m.Messages()[0].Token)
+	}
+}
+
+func TestAPNs(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	var payload map[string]interface{}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "HTTP/2.0", r.Proto)
+		assert.Equal(t, "app.tribbie", r.Header.Get("apns-topic"))
+		token, err := jwt.Parse(strings.TrimPrefix(r.Header.Get("Authorization"), "bearer "), func(token *jwt.Token) (interface{}, error) {
+			assert.Equal(t, "KEY", token.Header["kid"])
+			return &key.PublicKey, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "TEAM", token.Claims.(jwt.MapClaims)["iss"])
+
+		switch r.URL.Path {
+		case "/3/device/good":
+			_ = json.NewDecoder(r.Body).Decode(&payload)
+		case "/3/device/gone":
+			w.WriteHeader(http.StatusGone)
+			_, _ = w.Write([]byte(`{"reason":"Unregistered"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"reason":"InternalServerError"}`))
+		}
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	a := NewAPNs(server.URL, key, "KEY", "TEAM", "app.tribbie")
+	a.client = server.Client()
+
+	err := a.Send(context.Background(), Message{Token: "good", Title: "Payment requested", Body: "Pay 100", Data: map[string]string{"kind": "payment.requested"}})
+	assert.Nil(t, err)
+	assert.Equal(t, "payment.requested", payload["kind"])
+	assert.Equal(t, "Payment requested", payload["aps"].(map[string]interface{})["alert"].(map[string]interface{})["title"])
+
+	assert.True(t, errors.Is(a.Send(context.Background(), Message{Token: "gone"}), ErrInvalidToken))
+	err = a.Send(context.Background(), Message{Token: "other"})
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrInvalidToken))
+}
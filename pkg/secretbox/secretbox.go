@@ -0,0 +1,69 @@
+// Package secretbox encrypts small values, such as payout account numbers, before they are stored.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// KeySize is the size of an encryption key in bytes.
+const KeySize = 32
+
+// ErrInvalidCiphertext is returned when a value cannot be decrypted.
+var ErrInvalidCiphertext = errors.New("secretbox: invalid ciphertext")
+
+// Box encrypts and decrypts values with AES-256-GCM.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New creates a Box from a 32-byte key.
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("secretbox: the key must be 32 bytes long")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead}, nil
+}
+
+// NewFromString creates a Box from a base64-encoded 32-byte key.
+func NewFromString(key string) (*Box, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, errors.New("secretbox: the key must be base64-encoded")
+	}
+	return New(data)
+}
+
+// Seal encrypts the plaintext and returns it base64-encoded together with a random nonce.
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b.aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Open decrypts a value produced by Seal.
+func (b *Box) Open(ciphertext string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(data) < b.aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := b.aead.Open(nil, data[:b.aead.NonceSize()], data[b.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,40 @@
+package secretbox
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBox(t *testing.T) {
+	box, err := NewFromString(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize)))
+	if !assert.Nil(t, err) {
+		return
+	}
+	sealed, err := box.Seal([]byte("1234567890"))
+	assert.Nil(t, err)
+	assert.NotContains(t, sealed, "1234567890")
+
+	// every seal uses a fresh nonce
+	again, _ := box.Seal([]byte("1234567890"))
+	assert.NotEqual(t, sealed, again)
+
+	opened, err := box.Open(sealed)
+	assert.Nil(t, err)
+	assert.Equal(t, "1234567890", string(opened))
+
+	_, err = box.Open("not base64!")
+	assert.Equal(t, ErrInvalidCiphertext, err)
+	other, _ := New(bytes.Repeat([]byte{2}, KeySize))
+	_, err = other.Open(sealed)
+	assert.Equal(t, ErrInvalidCiphertext, err)
+}
+
+func TestNew(t *testing.T) {
+	_, err := New([]byte("short"))
+	assert.NotNil(t, err)
+	_, err = NewFromString("not base64!")
+	assert.NotNil(t, err)
+}